@@ -0,0 +1,692 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/aoi"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/proj"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tms"
+)
+
+// bboxDensify is the number of points added along each edge of transformed bbox, so that
+// curved edges are covered.
+const bboxDensify = 21
+
+// addAreaFlags registers flags describing area (and grid) of tiles to download.
+func addAreaFlags(cmd *cobra.Command) {
+	cmd.Flags().Float64SliceP(
+		"bbox", "b", nil, "Comma-separated list of bbox coords",
+	)
+	cmd.Flags().String(
+		"bbox-crs", "", "CRS of bbox coords, e.g. EPSG:2180 (default WGS84 or CRS of tile matrix set)",
+	)
+	cmd.Flags().String(
+		"aoi", "", "Area of interest file (GeoJSON, Shapefile, zipped Shapefile, KML, KMZ or WKT), used in place of bbox",
+	)
+	cmd.Flags().String(
+		"aoi-wkt", "", "Area of interest as WKT geometry (optionally EWKT with SRID=XXXX; prefix), used in place of bbox",
+	)
+	cmd.Flags().StringToString(
+		"aoi-filter", nil, "Use only features of aoi/route file with given attribute values, e.g. name=Warsaw",
+	)
+	cmd.Flags().String(
+		"route", "", "Route file (GPX tracks/routes or GeoJSON LineString), tiles along the route are used in place of bbox",
+	)
+	cmd.Flags().String(
+		"buffer", "0", "Buffer around area of interest or route, e.g. 2km or per zoom 0-12:5km,13-18:500m",
+	)
+	cmd.Flags().StringArray(
+		"zoom-bbox", nil, "Bbox used only on given zoom levels instead of the main area, e.g. 13-18:20.85,52.1,21.27,52.37 (can be repeated)",
+	)
+	cmd.Flags().String(
+		"extents", "", "JSON file with areas used on given zoom levels instead of the main area",
+	)
+	cmd.Flags().String(
+		"tiles-file", "", "File with list of tiles in z/x/y format, one per line (- for stdin), used in place of bbox",
+	)
+	cmd.Flags().String(
+		"cascade", "", "Expand tiles of tiles file with their parents and children on given zoom range, e.g. 10-18",
+	)
+	cmd.Flags().String(
+		"tile-matrix-set", "", "Built-in tile matrix set ID or path to OGC TMS 2.0 JSON definition (bbox coords in its CRS)",
+	)
+}
+
+// area describes tiles to download: bbox, area of interest, or route. Empty area
+// covers no tiles.
+type area struct {
+	BBox      []float64         `json:"bbox,omitempty"`
+	BBoxCRS   string            `json:"bbox_crs,omitempty"`
+	AOI       string            `json:"aoi,omitempty"`
+	AOIWKT    string            `json:"aoi_wkt,omitempty"`
+	AOIFilter map[string]string `json:"aoi_filter,omitempty"`
+	Route     string            `json:"route,omitempty"`
+	Buffer    string            `json:"buffer,omitempty"`
+}
+
+// zoomExtent is an area used only on given zoom levels.
+type zoomExtent struct {
+	area
+	Zoom string `json:"zoom"`
+
+	minZoom, maxZoom int
+}
+
+func (a area) isEmpty() bool {
+	return len(a.BBox) == 0 && a.AOI == "" && a.AOIWKT == "" && a.Route == ""
+}
+
+// tilesFromFlags returns IDs of tiles intersecting area given by flags on requested zoom
+// levels, along with their number per zoom level. Tiles are computed lazily on Web Mercator grid unless
+// custom tile matrix set is provided (returned as the third value). Zoom levels with their
+// own extents use these extents instead of the main area, tiles are returned without
+// duplicates.
+func tilesFromFlags(cmd *cobra.Command) (iter.Seq[mercantile.TileID], map[int]int, *tms.TileMatrixSet, error) {
+	zoomFlag, err := cmd.Flags().GetStringSlice("zoom")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	zoom, err := parseZooms(zoomFlag)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	offset, err := zoomOffset(cmd)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if zoom, err = shiftZooms(zoom, offset); err != nil {
+		return nil, nil, nil, err
+	}
+	tilesFile, err := cmd.Flags().GetString("tiles-file")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if tilesFile != "" {
+		return tilesFromList(cmd, tilesFile, zoom, offset)
+	}
+	var main area
+	if main.BBox, err = cmd.Flags().GetFloat64Slice("bbox"); err != nil {
+		return nil, nil, nil, err
+	}
+	if main.BBoxCRS, err = cmd.Flags().GetString("bbox-crs"); err != nil {
+		return nil, nil, nil, err
+	}
+	if main.AOI, err = cmd.Flags().GetString("aoi"); err != nil {
+		return nil, nil, nil, err
+	}
+	if main.AOIWKT, err = cmd.Flags().GetString("aoi-wkt"); err != nil {
+		return nil, nil, nil, err
+	}
+	if main.AOIFilter, err = cmd.Flags().GetStringToString("aoi-filter"); err != nil {
+		return nil, nil, nil, err
+	}
+	if main.Route, err = cmd.Flags().GetString("route"); err != nil {
+		return nil, nil, nil, err
+	}
+	if main.Buffer, err = cmd.Flags().GetString("buffer"); err != nil {
+		return nil, nil, nil, err
+	}
+	zoomBBoxes, err := cmd.Flags().GetStringArray("zoom-bbox")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	extentsPath, err := cmd.Flags().GetString("extents")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tileMatrixSet, err := cmd.Flags().GetString("tile-matrix-set")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var matrixSet *tms.TileMatrixSet
+	if tileMatrixSet != "" {
+		matrixSet, err = tms.Lookup(tileMatrixSet)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	var extents []zoomExtent
+	if extentsPath != "" {
+		if extents, err = loadExtents(extentsPath); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	for _, value := range zoomBBoxes {
+		extent, err := parseZoomBBox(value, main.BBoxCRS)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		extents = append(extents, extent)
+	}
+	for i := range extents {
+		extents[i].minZoom += offset
+		extents[i].maxZoom += offset
+	}
+	if len(extents) == 0 {
+		tileIDs, counts, err := main.tiles(zoom, matrixSet)
+		return tileIDs, counts, matrixSet, err
+	}
+
+	// Every zoom level is covered either by the main area or by extents given for it.
+	type source struct {
+		area  area
+		zooms []int
+	}
+	var sources []source
+	var mainZooms []int
+	for _, z := range zoom {
+		covered := false
+		for _, extent := range extents {
+			if z >= extent.minZoom && z <= extent.maxZoom {
+				covered = true
+			}
+		}
+		if !covered {
+			mainZooms = append(mainZooms, z)
+		}
+	}
+	if len(mainZooms) > 0 {
+		if main.isEmpty() {
+			return nil, nil, nil, fmt.Errorf("no area given for zoom %d", mainZooms[0])
+		}
+		sources = append(sources, source{main, mainZooms})
+	}
+	for _, extent := range extents {
+		var extentZooms []int
+		for _, z := range zoom {
+			if z >= extent.minZoom && z <= extent.maxZoom {
+				extentZooms = append(extentZooms, z)
+			}
+		}
+		if len(extentZooms) > 0 {
+			sources = append(sources, source{extent.area, extentZooms})
+		}
+	}
+
+	var seqs []iter.Seq[mercantile.TileID]
+	counts := map[int]int{}
+	sourcesPerZoom := map[int]int{}
+	for _, source := range sources {
+		for _, z := range source.zooms {
+			sourcesPerZoom[z]++
+		}
+		tileIDs, sourceCounts, err := source.area.tiles(source.zooms, matrixSet)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		seqs = append(seqs, tileIDs)
+		for z, count := range sourceCounts {
+			counts[z] += count
+		}
+	}
+
+	// Tiles of all sources are enumerated zoom level after zoom level.
+	tileIDs := mercantile.MergeZoomLevels(seqs...)
+	// Extents overlapping on some zoom levels may produce the same tiles. Only tiles
+	// of such levels have to be remembered to skip duplicates.
+	shared := map[int]bool{}
+	for z, n := range sourcesPerZoom {
+		if n > 1 {
+			shared[z] = true
+		}
+	}
+	if len(shared) == 0 {
+		return tileIDs, counts, matrixSet, nil
+	}
+
+	// Unique tiles are counted by enumerating them, only on shared zoom levels, numbers of
+	// tiles of other levels are exact already.
+	var sharedSeqs []iter.Seq[mercantile.TileID]
+	for _, source := range sources {
+		var sharedZooms []int
+		for _, z := range source.zooms {
+			if shared[z] {
+				sharedZooms = append(sharedZooms, z)
+			}
+		}
+		if len(sharedZooms) == 0 {
+			continue
+		}
+		sharedTiles, _, err := source.area.tiles(sharedZooms, matrixSet)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		sharedSeqs = append(sharedSeqs, sharedTiles)
+	}
+	maps.Copy(counts, countTiles(uniqueTiles(mercantile.MergeZoomLevels(sharedSeqs...), shared)))
+	return uniqueTiles(tileIDs, shared), counts, matrixSet, nil
+}
+
+// uniqueTiles skips duplicates of tiles on shared zoom levels. Tiles have to be ordered by
+// zoom level, so that only tiles of the current zoom level are remembered.
+func uniqueTiles(tileIDs iter.Seq[mercantile.TileID], shared map[int]bool) iter.Seq[mercantile.TileID] {
+	return func(yield func(mercantile.TileID) bool) {
+		zoom := -1
+		var seen map[mercantile.TileID]bool
+		for tile := range tileIDs {
+			if shared[tile.Z] {
+				if tile.Z != zoom {
+					zoom, seen = tile.Z, map[mercantile.TileID]bool{}
+				}
+				if seen[tile] {
+					continue
+				}
+				seen[tile] = true
+			}
+			if !yield(tile) {
+				return
+			}
+		}
+	}
+}
+
+// tilesFromList returns IDs of tiles listed in the file (or stdin), optionally expanded
+// with their parents and children on cascade zoom range. Tiles on zoom levels other than
+// requested ones (if any) are skipped.
+func tilesFromList(cmd *cobra.Command, name string, zoom []int, offset int) (iter.Seq[mercantile.TileID], map[int]int, *tms.TileMatrixSet, error) {
+	for _, flag := range []string{"bbox", "aoi", "aoi-wkt", "route", "zoom-bbox", "extents"} {
+		if cmd.Flags().Changed(flag) {
+			return nil, nil, nil, fmt.Errorf("tiles-file and %s are mutually exclusive", flag)
+		}
+	}
+	if cmd.Flags().Changed("tile-matrix-set") {
+		return nil, nil, nil, errors.New("tiles-file is supported only on Web Mercator grid")
+	}
+	cascade, err := cmd.Flags().GetString("cascade")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	r := cmd.InOrStdin()
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	list, err := mercantile.ReadTileList(r)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Listed tiles are enumerated zoom level after zoom level, in their order within each
+	// zoom level.
+	list = mercantile.Unique(list)
+	slices.SortStableFunc(list, func(a, b mercantile.TileID) int { return a.Z - b.Z })
+	tileIDs := slices.Values(list)
+	if cascade != "" {
+		minZoom, maxZoom, err := parseZoomRange(cascade)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		tileIDs = mercantile.Cascade(list, max(minZoom+offset, 0), maxZoom+offset)
+	}
+	if len(zoom) > 0 {
+		all := tileIDs
+		tileIDs = func(yield func(mercantile.TileID) bool) {
+			for tile := range all {
+				if slices.Contains(zoom, tile.Z) && !yield(tile) {
+					return
+				}
+			}
+		}
+	}
+	return tileIDs, countTiles(tileIDs), nil, nil
+}
+
+// tiles returns IDs of tiles intersecting the area on given zoom levels, along with
+// their number per zoom level. Tiles are computed lazily, number of tiles within bbox
+// is computed arithmetically.
+func (a area) tiles(zoom []int, matrixSet *tms.TileMatrixSet) (iter.Seq[mercantile.TileID], map[int]int, error) {
+	sources := 0
+	for _, set := range []bool{len(a.BBox) > 0, a.AOI != "", a.AOIWKT != "", a.Route != ""} {
+		if set {
+			sources++
+		}
+	}
+	switch {
+	case sources > 1:
+		return nil, nil, errors.New("bbox, aoi, aoi-wkt and route are mutually exclusive")
+	case (a.AOI != "" || a.AOIWKT != "" || a.Route != "") && matrixSet != nil:
+		return nil, nil, errors.New("aoi and route are supported only on Web Mercator grid")
+	case a.AOI != "" || a.AOIWKT != "":
+		buffer, err := parseBuffer(a.bufferOrDefault())
+		if err != nil {
+			return nil, nil, err
+		}
+		features, err := loadFeatures(a.AOI, a.AOIWKT, a.AOIFilter)
+		if err != nil {
+			return nil, nil, err
+		}
+		polygons, err := aoi.Polygons(features)
+		if err != nil {
+			return nil, nil, err
+		}
+		tileIDs := func(yield func(mercantile.TileID) bool) {
+			for _, z := range zoom {
+				for tile := range mercantile.PolygonTilesSeq(polygons, []int{z}, buffer(z)) {
+					if !yield(tile) {
+						return
+					}
+				}
+			}
+		}
+		return tileIDs, countTiles(tileIDs), nil
+	case a.Route != "":
+		buffer, err := parseBuffer(a.bufferOrDefault())
+		if err != nil {
+			return nil, nil, err
+		}
+		features, err := loadFeatures(a.Route, "", a.AOIFilter)
+		if err != nil {
+			return nil, nil, err
+		}
+		lines, err := aoi.Lines(features)
+		if err != nil {
+			return nil, nil, err
+		}
+		tileIDs := mercantile.LineTilesSeq(lines, zoom, buffer)
+		return tileIDs, countTiles(tileIDs), nil
+	case len(a.BBox) != 4:
+		return nil, nil, errors.New("either bbox (4 coords), aoi, aoi-wkt or route is required")
+	}
+
+	// By default bbox coords are expected in WGS84 for Web Mercator grid and in the
+	// native CRS of custom tile matrix set.
+	targetCRS := "EPSG:4326"
+	if matrixSet != nil {
+		targetCRS = matrixSet.CRS()
+	}
+	extent := mercantile.Bbox{Left: a.BBox[0], Bottom: a.BBox[1], Right: a.BBox[2], Top: a.BBox[3]}
+	if a.BBoxCRS != "" {
+		var err error
+		extent, err = transformBbox(extent, a.BBoxCRS, targetCRS)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if matrixSet != nil {
+		counts := map[int]int{}
+		for _, z := range zoom {
+			counts[z] = matrixSet.Count(extent, []int{z})
+		}
+		return matrixSet.TilesSeq(extent, zoom), counts, nil
+	}
+
+	counts := map[int]int{}
+	for _, z := range zoom {
+		counts[z] = mercantile.Count(extent.Left, extent.Bottom, extent.Right, extent.Top, []int{z})
+	}
+	return mercantile.TilesSeq(extent.Left, extent.Bottom, extent.Right, extent.Top, zoom), counts, nil
+}
+
+// countTiles counts tiles per zoom level by enumerating them, without keeping them in memory.
+// Tiles are enumerated again when downloaded, so it is used only for tiles which can't be
+// counted arithmetically (e.g. of aoi or route), trading computing them twice for memory
+// independent of their number.
+func countTiles(tileIDs iter.Seq[mercantile.TileID]) map[int]int {
+	counts := map[int]int{}
+	for tile := range tileIDs {
+		counts[tile.Z]++
+	}
+	return counts
+}
+
+// totalCount sums numbers of tiles of all zoom levels.
+func totalCount(counts map[int]int) int {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	return total
+}
+
+func (a area) bufferOrDefault() string {
+	if a.Buffer == "" {
+		return "0"
+	}
+	return a.Buffer
+}
+
+// loadExtents reads per zoom extents from JSON file, e.g.
+// [{"zoom": "0-12", "bbox": [14.1, 49.0, 24.2, 54.9]}, {"zoom": "13-18", "aoi": "cities.geojson"}].
+// Relative aoi and route paths are resolved against directory of the file.
+func loadExtents(name string) ([]zoomExtent, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var extents []zoomExtent
+	if err := json.Unmarshal(data, &extents); err != nil {
+		return nil, fmt.Errorf("error decoding extents: %w", err)
+	}
+
+	dir := filepath.Dir(name)
+	for i := range extents {
+		e := &extents[i]
+		if e.minZoom, e.maxZoom, err = parseZoomRange(e.Zoom); err != nil {
+			return nil, err
+		}
+		if e.isEmpty() {
+			return nil, fmt.Errorf("extent for zoom %s: either bbox, aoi, aoi_wkt or route is required", e.Zoom)
+		}
+		if e.AOI != "" && !filepath.IsAbs(e.AOI) {
+			e.AOI = filepath.Join(dir, e.AOI)
+		}
+		if e.Route != "" && !filepath.IsAbs(e.Route) {
+			e.Route = filepath.Join(dir, e.Route)
+		}
+	}
+	return extents, nil
+}
+
+// parseZoomBBox parses zoom range with bbox, e.g. 13-18:20.85,52.1,21.27,52.37.
+func parseZoomBBox(value, bboxCRS string) (zoomExtent, error) {
+	zooms, coords, ok := strings.Cut(value, ":")
+	if !ok {
+		return zoomExtent{}, fmt.Errorf("invalid zoom bbox: %q", value)
+	}
+	minZoom, maxZoom, err := parseZoomRange(zooms)
+	if err != nil {
+		return zoomExtent{}, err
+	}
+	parts := strings.Split(coords, ",")
+	if len(parts) != 4 {
+		return zoomExtent{}, fmt.Errorf("invalid zoom bbox: %q", value)
+	}
+	bbox := make([]float64, 0, 4)
+	for _, part := range parts {
+		coord, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return zoomExtent{}, fmt.Errorf("invalid zoom bbox: %q", value)
+		}
+		bbox = append(bbox, coord)
+	}
+
+	return zoomExtent{
+		area: area{BBox: bbox, BBoxCRS: bboxCRS}, Zoom: zooms, minZoom: minZoom, maxZoom: maxZoom,
+	}, nil
+}
+
+// zoomOffset returns offset between zoom levels given by flags and zoom levels of tiles. In
+// 512px grid tiles of zoom z have resolution of 256px tiles of zoom z+1, so clients like
+// Mapbox GL (or Leaflet with zoomOffset -1) display them on zoom z+1.
+func zoomOffset(cmd *cobra.Command) (int, error) {
+	tileSize, err := cmd.Flags().GetInt("tile-size")
+	if err != nil {
+		return 0, err
+	}
+	switch tileSize {
+	case 256:
+		return 0, nil
+	case 512:
+		if cmd.Flags().Changed("tile-matrix-set") {
+			return 0, errors.New("512px grid is supported only on Web Mercator grid")
+		}
+		return -1, nil
+	}
+	return 0, fmt.Errorf("unsupported tile size: %d (use 256 or 512)", tileSize)
+}
+
+// shiftZooms shifts zoom levels by offset.
+func shiftZooms(zoom []int, offset int) ([]int, error) {
+	shifted := make([]int, 0, len(zoom))
+	for _, z := range zoom {
+		if z+offset < 0 {
+			return nil, fmt.Errorf("zoom %d is not available in 512px grid", z)
+		}
+		shifted = append(shifted, z+offset)
+	}
+	return shifted, nil
+}
+
+// parseZooms parses zoom levels and zoom ranges (e.g. 0-12,14), duplicates are removed.
+// Zoom levels are sorted, so that tiles are enumerated from the lowest zoom level (e.g.
+// before their descendants are pruned).
+func parseZooms(values []string) ([]int, error) {
+	var zooms []int
+	seen := map[int]bool{}
+	for _, value := range values {
+		minZoom, maxZoom, err := parseZoomRange(value)
+		if err != nil {
+			return nil, err
+		}
+		for z := minZoom; z <= maxZoom; z++ {
+			if !seen[z] {
+				seen[z] = true
+				zooms = append(zooms, z)
+			}
+		}
+	}
+	slices.Sort(zooms)
+	return zooms, nil
+}
+
+// loadFeatures reads features from a file or WKT geometry and keeps only those matching
+// all attribute filters.
+func loadFeatures(path, wkt string, filter map[string]string) ([]aoi.Feature, error) {
+	var features []aoi.Feature
+	var err error
+	if wkt != "" {
+		features, err = aoi.ReadWKT(wkt)
+	} else {
+		features, err = aoi.LoadFeatures(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range filter {
+		features = aoi.Where(features, key, value)
+	}
+	if len(features) == 0 {
+		return nil, errors.New("no features match aoi filter")
+	}
+	return features, nil
+}
+
+// transformBbox transforms bbox between CRSs given by their identifiers (e.g. EPSG:2180).
+func transformBbox(bbox mercantile.Bbox, from, to string) (mercantile.Bbox, error) {
+	src, err := proj.Lookup(from)
+	if err != nil {
+		return mercantile.Bbox{}, err
+	}
+	dst, err := proj.Lookup(to)
+	if err != nil {
+		return mercantile.Bbox{}, err
+	}
+
+	return proj.TransformBounds(src, dst, bbox, bboxDensify)
+}
+
+// parseBuffer parses buffer specification: either a single distance used on every zoom
+// level (e.g. 2km) or comma-separated list of zoom ranges with distances
+// (e.g. 0-12:5km,13-18:500m). Zoom levels not listed get no buffer.
+func parseBuffer(value string) (func(zoom int) float64, error) {
+	if !strings.Contains(value, ":") {
+		distance, err := parseDistance(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(int) float64 { return distance }, nil
+	}
+
+	type band struct {
+		minZoom, maxZoom int
+		distance         float64
+	}
+	var bands []band
+	for _, part := range strings.Split(value, ",") {
+		zooms, distanceValue, _ := strings.Cut(part, ":")
+		minZoom, maxZoom, err := parseZoomRange(zooms)
+		if err != nil {
+			return nil, err
+		}
+		distance, err := parseDistance(distanceValue)
+		if err != nil {
+			return nil, err
+		}
+		bands = append(bands, band{minZoom, maxZoom, distance})
+	}
+	return func(zoom int) float64 {
+		for _, b := range bands {
+			if zoom >= b.minZoom && zoom <= b.maxZoom {
+				return b.distance
+			}
+		}
+		return 0
+	}, nil
+}
+
+// parseZoomRange parses single zoom level (e.g. 12) or inclusive range of zoom levels (e.g. 0-12).
+func parseZoomRange(value string) (int, int, error) {
+	from, to, isRange := strings.Cut(strings.TrimSpace(value), "-")
+	minZoom, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid zoom range: %q", value)
+	}
+	maxZoom := minZoom
+	if isRange {
+		maxZoom, err = strconv.Atoi(strings.TrimSpace(to))
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid zoom range: %q", value)
+		}
+	}
+	if minZoom < 0 || maxZoom < minZoom {
+		return 0, 0, fmt.Errorf("invalid zoom range: %q", value)
+	}
+	return minZoom, maxZoom, nil
+}
+
+// parseDistance parses distance in meters, optionally with m or km unit (e.g. 2km).
+func parseDistance(input string) (float64, error) {
+	value := strings.ToLower(strings.TrimSpace(input))
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(value, "km"):
+		value, multiplier = strings.TrimSuffix(value, "km"), 1000.0
+	case strings.HasSuffix(value, "m"):
+		value = strings.TrimSuffix(value, "m")
+	}
+	distance, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || distance < 0 {
+		return 0, fmt.Errorf("invalid distance: %q", input)
+	}
+	return distance * multiplier, nil
+}
@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"fmt"
+	"image/jpeg"
+	"math"
+	"os"
+
+	"github.com/schollz/progressbar/v3"
+	"github.com/spf13/cobra"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/cog"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tilestore"
+)
+
+// worldExtent is the width of Web Mercator extent in meters.
+const worldExtent = 2 * math.Pi * 6378137.0
+
+var cogCmd = &cobra.Command{
+	Use:   "cog",
+	Short: "Export tiles as Cloud Optimized GeoTIFF",
+	Long: `Export downloaded tile pyramid as Cloud Optimized GeoTIFF in Web Mercator (EPSG:3857). The
+full resolution image is made of tiles of the maximum zoom level, overviews of tiles of lower
+zoom levels, down to the minimum one. The image covers tiles of the minimum zoom level
+intersecting bbox (or bounds of area of interest), so that tiles of all zoom levels are
+aligned with internal tiles of the GeoTIFF. Missing tiles are left without data.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := writeCOG(cmd); err != nil {
+			fmt.Printf("ERR: %s\n", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cogCmd)
+
+	// Required args/flags
+	cogCmd.Flags().StringP(
+		"input", "i", "", "Output directory or zip archive of downloaded tiles",
+	)
+	cogCmd.MarkFlagRequired("input")
+	cogCmd.Flags().StringP(
+		"output", "o", "", "Output GeoTIFF file",
+	)
+	cogCmd.MarkFlagRequired("output")
+	cogCmd.Flags().StringP(
+		"zoom", "z", "", "Zoom range, e.g. 10-14: tiles of the maximum zoom level and overviews down to the minimum one",
+	)
+	cogCmd.MarkFlagRequired("zoom")
+	addExtentFlags(cogCmd)
+
+	// Optional args/flags
+	cogCmd.Flags().String(
+		"compression", cog.Deflate, "Compression of internal tiles: deflate or jpeg",
+	)
+	cogCmd.Flags().Int(
+		"quality", jpeg.DefaultQuality, "Quality (1-100) of JPEG compression",
+	)
+	cogCmd.Flags().String(
+		"mask", "", "Mask of pixels without data: alpha (band) or nodata (value 0) (default alpha, nodata for jpeg)",
+	)
+	cogCmd.Flags().Int(
+		"tile-size", 256, "Tile grid size: 256 or 512 (512px grid is displayed with zoom offset -1)",
+	)
+	cogCmd.Flags().Int(
+		"scale", 1, "Scale of HiDPI tiles, e.g. 2 for {y}@2x tiles",
+	)
+}
+
+// writeCOG writes Cloud Optimized GeoTIFF of tiles configured by flags.
+func writeCOG(cmd *cobra.Command) (err error) {
+	input, err := cmd.Flags().GetString("input")
+	if err != nil {
+		return err
+	}
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	zoomRange, err := cmd.Flags().GetString("zoom")
+	if err != nil {
+		return err
+	}
+	minZoom, maxZoom, err := parseZoomRange(zoomRange)
+	if err != nil {
+		return err
+	}
+	offset, err := zoomOffset(cmd)
+	if err != nil {
+		return err
+	}
+	if minZoom += offset; minZoom < 0 {
+		return fmt.Errorf("invalid zoom range: %q", zoomRange)
+	}
+	maxZoom += offset
+	tileSize, err := cmd.Flags().GetInt("tile-size")
+	if err != nil {
+		return err
+	}
+	scale, err := cmd.Flags().GetInt("scale")
+	if err != nil {
+		return err
+	}
+	if scale < 1 {
+		return fmt.Errorf("invalid scale: %d", scale)
+	}
+	options, err := cogOptionsFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	bbox, err := extentFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	// Tiles of the minimum zoom level covering the bbox, with columns beyond the antimeridian
+	// numbered past the last column.
+	const eps = 1e-9
+	ul := mercantile.Tile(bbox.West, bbox.North, minZoom)
+	lr := mercantile.Tile(bbox.East-eps, bbox.South+eps, minZoom)
+	if bbox.West > bbox.East {
+		lr.X += 1 << minZoom
+	}
+	cols, rows := lr.X-ul.X+1, lr.Y-ul.Y+1
+	levels := maxZoom - minZoom
+	if (cols<<levels)*(rows<<levels) > cog.MaxTiles {
+		return fmt.Errorf(
+			"too many tiles on zoom %d: %dx%d (limit %d tiles, use narrower zoom range or smaller area)",
+			maxZoom-offset, cols<<levels, rows<<levels, cog.MaxTiles,
+		)
+	}
+	span := worldExtent / math.Exp2(float64(minZoom))
+	left := mercantile.XyBounds(ul).Left
+	top := mercantile.XyBounds(ul).Top
+	bounds := mercantile.Bbox{Left: left, Bottom: top - float64(rows)*span, Right: left + float64(cols)*span, Top: top}
+
+	reader, err := tilestore.Open(input, tilestore.WithScale(scale))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	// Incomplete GeoTIFF is removed.
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(output)
+		}
+	}()
+
+	pixels := tileSize * scale
+	w, err := cog.NewWriter(f, bounds, cols*pixels<<levels, rows*pixels<<levels, pixels, levels, options...)
+	if err != nil {
+		return err
+	}
+	// Temporary files of tiles are removed on errors.
+	defer func() {
+		if err != nil {
+			w.Close()
+		}
+	}()
+
+	// Only tiles saved in the store are read, tiles of the image without data are skipped.
+	type imageTile struct {
+		id       mercantile.TileID
+		col, row int
+	}
+	var tiles []imageTile
+	total := 0
+	for z := minZoom; z <= maxZoom; z++ {
+		k := z - minZoom
+		total += (cols * rows) << (2 * k)
+		saved, err := reader.Tiles(z)
+		if err != nil {
+			return err
+		}
+		for _, id := range saved {
+			col, row := id.X-(ul.X<<k), id.Y-(ul.Y<<k)
+			// Columns beyond the antimeridian are numbered past the last column.
+			if col < 0 {
+				col += 1 << z
+			}
+			if col >= cols<<k || row < 0 || row >= rows<<k {
+				continue
+			}
+			tiles = append(tiles, imageTile{id: id, col: col, row: row})
+		}
+	}
+
+	bar := progressbar.Default(int64(len(tiles)))
+	for _, tile := range tiles {
+		bar.Add(1)
+		body, err := reader.ReadTile(tile.id)
+		if err != nil {
+			return err
+		}
+		img, err := imaging.Decode(body)
+		if err != nil {
+			return err
+		}
+		if err := w.WriteTile(maxZoom-tile.id.Z, tile.col, tile.row, img); err != nil {
+			return fmt.Errorf("error writing tile %v: %w", tile.id, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	size := w.Levels()[0]
+	fmt.Fprintf(
+		cmd.OutOrStdout(), "Tiles: %d, missing: %d\nSaved %s (%dx%d, %d overviews)\n",
+		len(tiles), total-len(tiles), output, size.X, size.Y, levels,
+	)
+	return nil
+}
+
+// cogOptionsFromFlags returns options of GeoTIFF writer configured by flags.
+func cogOptionsFromFlags(cmd *cobra.Command) ([]cog.Option, error) {
+	compression, err := cmd.Flags().GetString("compression")
+	if err != nil {
+		return nil, err
+	}
+	quality, err := cmd.Flags().GetInt("quality")
+	if err != nil {
+		return nil, err
+	}
+	mask, err := cmd.Flags().GetString("mask")
+	if err != nil {
+		return nil, err
+	}
+	// JPEG has no alpha band, pixels without data are marked with nodata value.
+	if mask == "" {
+		mask = cog.MaskAlpha
+		if compression == cog.JPEG {
+			mask = cog.MaskNoData
+		}
+	}
+	return []cog.Option{cog.WithCompression(compression), cog.WithQuality(quality), cog.WithMask(mask)}, nil
+}
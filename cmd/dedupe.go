@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/dedupe"
+)
+
+// tileFilePattern matches paths of tile files (relative to output directory), z/x/y.ext.
+var tileFilePattern = regexp.MustCompile(`^\d+/\d+/[^/]+$`)
+
+var dedupeCmd = &cobra.Command{
+	Use:   "dedupe [output directory]",
+	Short: "Deduplicate downloaded tiles",
+	Long: `Deduplicate tiles of existing output directory, keeping each unique tile body once. Tiles are
+replaced with hard links or symbolic links to blobs (stored in blobs directory), or moved into
+blobs and listed in index.tsv.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		mode, err := cmd.Flags().GetString("mode")
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+			return
+		}
+		store, err := dedupe.NewStore(args[0], mode)
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+			return
+		}
+		err = filepath.WalkDir(args[0], func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(args[0], name)
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && rel == dedupe.BlobDir {
+				return filepath.SkipDir
+			}
+			// Symbolic links are deduplicated already.
+			if !d.Type().IsRegular() || !tileFilePattern.MatchString(filepath.ToSlash(rel)) {
+				return nil
+			}
+			body, err := os.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			return store.Write(rel, body)
+		})
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+		}
+		if err := store.Close(); err != nil {
+			fmt.Printf("ERR: %s\n", err)
+		}
+		writeDedupeStats(cmd.OutOrStdout(), store.Stats())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dedupeCmd)
+
+	dedupeCmd.Flags().String(
+		"mode", dedupe.Hardlink, "Deduplication mode: hardlink, symlink or blob",
+	)
+}
+
+// writeDedupeStats writes summary of deduplicated tiles.
+func writeDedupeStats(out io.Writer, stats dedupe.Stats) {
+	fmt.Fprintf(
+		out, "Tiles: %d, unique: %d, duplicates: %d, saved: %s\n",
+		stats.Files, stats.Unique, stats.Duplicates, formatBytes(float64(stats.SavedBytes)),
+	)
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tms"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/wms"
+)
+
+// Output formats of planned tiles.
+const (
+	planText  = "text"
+	planCSV   = "csv"
+	planJSONL = "jsonl"
+)
+
+// plannedTile represents single line of JSON Lines output of planned tiles.
+type plannedTile struct {
+	Z    int        `json:"z"`
+	X    int        `json:"x"`
+	Y    int        `json:"y"`
+	Bbox [4]float64 `json:"bbox"`
+	URL  string     `json:"url"`
+}
+
+// planWriter writes planned tiles in one of output formats.
+type planWriter struct {
+	w         io.Writer
+	csvWriter *csv.Writer
+	format    string
+}
+
+// writePlan writes planned tiles with their bounds (in CRS of the grid) and GetMap URLs
+// in given format, without sending any requests. Tiles requested as metatiles (with size
+// greater than 1) have URL of their metatile.
+func writePlan(
+	w io.Writer, client *wms.Client, tileIDs iter.Seq[mercantile.TileID], format string,
+	metatileSize int, matrixSet *tms.TileMatrixSet, options ...wms.TileOption,
+) error {
+	plan := &planWriter{w: w, format: format}
+	switch format {
+	case planText, planJSONL:
+	case planCSV:
+		plan.csvWriter = csv.NewWriter(w)
+		if err := plan.csvWriter.Write([]string{"z", "x", "y", "left", "bottom", "right", "top", "url"}); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported dry run format: %s (use text, csv or jsonl)", format)
+	}
+
+	if metatileSize > 1 {
+		for metatile := range wms.Metatiles(tileIDs, metatileSize, matrixSet) {
+			metatileURL, err := client.MetatileURL(metatile, options...)
+			if err != nil {
+				return err
+			}
+			for _, tileID := range metatile.Tiles {
+				if err := plan.write(tileID, metatileURL, options...); err != nil {
+					return err
+				}
+			}
+		}
+	} else {
+		for tileID := range tileIDs {
+			tileURL, err := client.TileURL(tileID, options...)
+			if err != nil {
+				return err
+			}
+			if err := plan.write(tileID, tileURL, options...); err != nil {
+				return err
+			}
+		}
+	}
+
+	if plan.csvWriter != nil {
+		plan.csvWriter.Flush()
+		return plan.csvWriter.Error()
+	}
+	return nil
+}
+
+func (p *planWriter) write(tileID mercantile.TileID, tileURL string, options ...wms.TileOption) error {
+	b := wms.NewTile(tileID, options...).Bounds()
+	tile := plannedTile{
+		Z: tileID.Z, X: tileID.X, Y: tileID.Y, Bbox: [4]float64{b.Left, b.Bottom, b.Right, b.Top}, URL: tileURL,
+	}
+
+	bbox := make([]string, len(tile.Bbox))
+	for i, coord := range tile.Bbox {
+		bbox[i] = strconv.FormatFloat(coord, 'f', -1, 64)
+	}
+
+	switch p.format {
+	case planText:
+		_, err := fmt.Fprintf(p.w, "%d/%d/%d %s %s\n", tile.Z, tile.X, tile.Y, strings.Join(bbox, ","), tile.URL)
+		return err
+	case planCSV:
+		record := []string{strconv.Itoa(tile.Z), strconv.Itoa(tile.X), strconv.Itoa(tile.Y)}
+		return p.csvWriter.Write(append(append(record, bbox...), tile.URL))
+	default:
+		return writeJSON(p.w, tile)
+	}
+}
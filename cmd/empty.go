@@ -0,0 +1,405 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/atomicfile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/dedupe"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tilestore"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/wms"
+)
+
+// Policies for empty tiles: fully transparent or uniform colour images, and responses
+// without data.
+const (
+	emptyOff         = "off"
+	emptySkip        = "skip"
+	emptyWrite       = "write"
+	emptyPlaceholder = "placeholder"
+	emptySidecar     = "sidecar"
+)
+
+const (
+	// placeholderName is the name (without extension) of the placeholder file shared by
+	// transparent tiles, placeholders of uniform colour tiles have the colour appended,
+	// e.g. empty-aad3dfff.
+	placeholderName = "empty"
+	// sidecarName is the name of the file listing empty tiles in z/x/y format.
+	sidecarName = "empty-tiles.txt"
+)
+
+// tileWriter saves downloaded tiles in the output directory, applying the policy to empty
+// tiles, and counts saved, empty, pruned (skipped as descendants of empty tiles) and failed
+// tiles for the run summary.
+type tileWriter struct {
+	policy    string
+	tolerance uint8
+	// store keeps each unique tile body once, if set.
+	store *dedupe.Store
+	// mixed is set when tiles are stored in mixed format, as JPEG or PNG.
+	mixed bool
+	// replace is set when saved tiles replace tiles saved earlier in any format (e.g. built
+	// overviews replace downloaded tiles).
+	replace bool
+	// tileSet collects saved tiles for TileJSON metadata, if set.
+	tileSet *tileSet
+	// overzoomed lists tiles synthesised from their ancestors in the output directory.
+	overzoomed *overzoomList
+
+	mu sync.Mutex
+	// placeholders are names of placeholders created so far.
+	placeholders map[string]bool
+	sidecar      *os.File
+
+	saved, empty, pruned, failed atomic.Int64
+}
+
+// addTileWriterFlags registers flags controlling how tiles are saved in the output directory.
+func addTileWriterFlags(cmd *cobra.Command, outputUsage string) {
+	cmd.Flags().StringP(
+		"output", "o", "", outputUsage,
+	)
+	cmd.Flags().String(
+		"empty", emptyOff, "Policy for empty (transparent or uniform colour) tiles: off (no detection), skip, write, placeholder or sidecar",
+	)
+	cmd.Flags().Int(
+		"empty-tolerance", 0, "Maximum difference of colour channels (0-255) of pixels of uniform colour tiles",
+	)
+	cmd.Flags().String(
+		"dedupe", "", "Keep each unique tile once: hardlink, symlink (tiles link to blobs) or blob (blobs with index)",
+	)
+	cmd.Flags().String(
+		"tilejson", "", "Write TileJSON metadata of saved tiles ("+tileJSONName+" in output directory) with tile URLs under this base URL (without extension in mixed format)",
+	)
+}
+
+// tileWriterFromFlags returns tile writer configured by tile writer flags.
+func tileWriterFromFlags(cmd *cobra.Command) (*tileWriter, error) {
+	policy, err := cmd.Flags().GetString("empty")
+	if err != nil {
+		return nil, err
+	}
+	switch policy {
+	case emptyOff, emptySkip, emptyWrite, emptyPlaceholder, emptySidecar:
+	default:
+		return nil, fmt.Errorf("unsupported empty tiles policy: %s", policy)
+	}
+	tolerance, err := cmd.Flags().GetInt("empty-tolerance")
+	if err != nil {
+		return nil, err
+	}
+	if tolerance < 0 || tolerance > 255 {
+		return nil, fmt.Errorf("invalid empty tolerance: %d (use 0-255)", tolerance)
+	}
+
+	w := &tileWriter{policy: policy, tolerance: uint8(tolerance)}
+	outputFormat, err := cmd.Flags().GetString("output-format")
+	if err != nil {
+		return nil, err
+	}
+	w.mixed = strings.EqualFold(outputFormat, imaging.Mixed)
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return nil, err
+	}
+	mode, err := cmd.Flags().GetString("dedupe")
+	if err != nil {
+		return nil, err
+	}
+	if mode != "" {
+		if w.store, err = dedupe.NewStore(output, mode); err != nil {
+			return nil, err
+		}
+	}
+
+	if w.overzoomed, err = readOverzoomList(output); err != nil {
+		return nil, err
+	}
+
+	url, err := cmd.Flags().GetString("tilejson")
+	if err != nil {
+		return nil, err
+	}
+	if url != "" {
+		// TileJSON describes tiles of Web Mercator grid only.
+		if f := cmd.Flags().Lookup("tile-matrix-set"); f != nil && f.Value.String() != "" {
+			return nil, errors.New("TileJSON is supported only on Web Mercator grid")
+		}
+		w.tileSet = &tileSet{url: url, output: output, mixed: w.mixed}
+	}
+
+	return w, nil
+}
+
+// save saves the tile unless it is empty, then the policy is applied. It reports whether
+// the tile is empty.
+func (w *tileWriter) save(tile *wms.Tile) bool {
+	if w.policy != emptyOff {
+		empty, err := tile.IsEmpty(w.tolerance)
+		if err != nil {
+			w.fail(err)
+			return false
+		}
+		if empty {
+			w.saveEmpty(tile)
+			return true
+		}
+	}
+	if err := w.write(tile); err != nil {
+		w.fail(err)
+		return false
+	}
+	w.saved.Add(1)
+	w.track(tile)
+	return false
+}
+
+// handle saves the tile downloaded with given error, which is reported unless it means
+// that the server has no data for the tile. Such tiles are empty, but as there is no image
+// to write, with write policy they are skipped. It reports whether the tile is empty.
+func (w *tileWriter) handle(tile *wms.Tile, err error) bool {
+	if errors.Is(err, wms.ErrNoData) {
+		w.saveEmpty(tile)
+		return true
+	}
+	if err != nil {
+		w.fail(err)
+		return false
+	}
+	return w.save(tile)
+}
+
+// saveEmpty applies the policy to the empty tile.
+func (w *tileWriter) saveEmpty(tile *wms.Tile) {
+	w.empty.Add(1)
+	var err error
+	switch w.policy {
+	case emptyWrite:
+		if len(tile.Body()) == 0 {
+			return
+		}
+		err = w.write(tile)
+	case emptyPlaceholder:
+		err = w.linkPlaceholder(tile)
+	case emptySidecar:
+		err = w.record(tile)
+	default:
+		return
+	}
+	if err != nil {
+		w.fail(err)
+		return
+	}
+	if w.policy != emptySidecar {
+		w.track(tile)
+	}
+}
+
+// track adds the saved tile to TileJSON metadata, if any. The tile replaces the tile
+// synthesised from its ancestor, if any, it is listed again when synthesised.
+func (w *tileWriter) track(tile *wms.Tile) {
+	if w.tileSet != nil {
+		w.tileSet.add(tile)
+	}
+	if w.overzoomed != nil {
+		w.overzoomed.remove(mercantile.TileID{X: tile.X(), Y: tile.Y(), Z: tile.Z()})
+	}
+}
+
+// removeStale removes the tile saved earlier with other extension than the tile file name:
+// in mixed format the tile saved in the other one, and when tiles are replaced, the tile
+// saved in any other format.
+func (w *tileWriter) removeStale(name string) error {
+	if !w.mixed && !w.replace {
+		return nil
+	}
+	ext := path.Ext(name)
+	for _, other := range tilestore.Extensions {
+		if other == ext {
+			continue
+		}
+		if err := os.Remove(strings.TrimSuffix(name, ext) + other); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// write saves the tile in the output directory, through the deduplicating store if any.
+// Tiles in mixed format replace the tile saved earlier with the other extension.
+func (w *tileWriter) write(tile *wms.Tile) error {
+	if err := w.removeStale(path.Join(tile.OutputDir(), tile.Path(), tile.Name())); err != nil {
+		return err
+	}
+	if w.store != nil {
+		return w.store.Write(path.Join(tile.Path(), tile.Name()), tile.Body())
+	}
+	dir := path.Join(tile.OutputDir(), tile.Path())
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	// Tile is replaced atomically, as it may be a link to the placeholder or to a blob of
+	// deduplicated tiles.
+	return atomicfile.WriteFile(path.Join(dir, tile.Name()), tile.Body())
+}
+
+// linkPlaceholder saves the tile as a hard link to the placeholder shared by all empty
+// tiles of its colour: transparent tiles (and tiles without image) are linked to a fully
+// transparent image, uniform colour tiles to an image of that colour. Placeholders are
+// created with the first tile linked to them. In mixed format placeholders are PNG, so are
+// links to them, and like write, they replace the tile saved earlier with the other
+// extension.
+func (w *tileWriter) linkPlaceholder(tile *wms.Tile) error {
+	c, err := emptyColor(tile)
+	if err != nil {
+		return err
+	}
+	placeholder, err := w.createPlaceholder(tile, c)
+	if err != nil {
+		return err
+	}
+
+	dir := path.Join(tile.OutputDir(), tile.Path())
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	name := path.Join(dir, tile.Name())
+	if w.mixed {
+		name = strings.TrimSuffix(name, path.Ext(name)) + path.Ext(placeholder)
+	}
+	if err := w.removeStale(name); err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.Link(placeholder, name)
+}
+
+// createPlaceholder returns the name of the placeholder of given colour for tiles like the
+// tile, created unless it exists.
+func (w *tileWriter) createPlaceholder(tile *wms.Tile, c color.NRGBA) (string, error) {
+	format := tile.OutputFormat()
+	if w.mixed {
+		format = imaging.PNG
+	}
+	name := placeholderName
+	if c.A != 0 {
+		name += fmt.Sprintf("-%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+	}
+	name = path.Join(tile.OutputDir(), name+imaging.Extension(format))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.placeholders[name] {
+		return name, nil
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, tile.Width(), tile.Height()))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	body, err := imaging.Encode(img, format)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(tile.OutputDir(), os.ModePerm); err != nil {
+		return "", err
+	}
+	if err := atomicfile.WriteFile(name, body); err != nil {
+		return "", err
+	}
+	if w.placeholders == nil {
+		w.placeholders = map[string]bool{}
+	}
+	w.placeholders[name] = true
+	return name, nil
+}
+
+// emptyColor returns colour of the empty tile, the colour of its first pixel, or
+// transparent for tiles without image.
+func emptyColor(tile *wms.Tile) (color.NRGBA, error) {
+	if len(tile.Body()) == 0 {
+		return color.NRGBA{}, nil
+	}
+	img, err := imaging.Decode(tile.Body())
+	if err != nil {
+		return color.NRGBA{}, err
+	}
+	b := img.Bounds()
+	if b.Empty() {
+		return color.NRGBA{}, nil
+	}
+	c := color.NRGBAModel.Convert(img.At(b.Min.X, b.Min.Y)).(color.NRGBA)
+	if c.A == 0 {
+		return color.NRGBA{}, nil
+	}
+	return c, nil
+}
+
+// record appends the tile to the sidecar file listing empty tiles.
+func (w *tileWriter) record(tile *wms.Tile) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.sidecar == nil {
+		if err := os.MkdirAll(tile.OutputDir(), os.ModePerm); err != nil {
+			return err
+		}
+		f, err := os.Create(path.Join(tile.OutputDir(), sidecarName))
+		if err != nil {
+			return err
+		}
+		w.sidecar = f
+	}
+	_, err := fmt.Fprintf(w.sidecar, "%d/%d/%d\n", tile.Z(), tile.X(), tile.Y())
+	return err
+}
+
+func (w *tileWriter) fail(err error) {
+	w.failed.Add(1)
+	fmt.Printf("ERR: %s\n", err)
+}
+
+// close closes the sidecar file (and the store), writes TileJSON metadata, the list of
+// overzoomed tiles and the run summary.
+func (w *tileWriter) close(out io.Writer) {
+	if w.sidecar != nil {
+		if err := w.sidecar.Close(); err != nil {
+			fmt.Printf("ERR: %s\n", err)
+		}
+	}
+	if w.store != nil {
+		if err := w.store.Close(); err != nil {
+			fmt.Printf("ERR: %s\n", err)
+		}
+	}
+	if w.tileSet != nil {
+		if err := w.tileSet.write(); err != nil {
+			fmt.Printf("ERR: %s\n", err)
+		}
+	}
+	if w.overzoomed != nil {
+		if err := w.overzoomed.write(); err != nil {
+			fmt.Printf("ERR: %s\n", err)
+		}
+	}
+	fmt.Fprintf(
+		out, "\nSaved: %d, empty: %d (%s), pruned: %d, failed: %d\n",
+		w.saved.Load(), w.empty.Load(), w.policy, w.pruned.Load(), w.failed.Load(),
+	)
+	if w.store != nil {
+		writeDedupeStats(out, w.store.Stats())
+	}
+}
@@ -0,0 +1,323 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/dedupe"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/wms"
+)
+
+// testTile returns tile of uniform colour saved in the directory.
+func testTile(t *testing.T, dir string, id mercantile.TileID, c color.Color, options ...wms.TileOption) *wms.Tile {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	// Tiles with data differ in one pixel, so that they are not uniform.
+	if c != (color.NRGBA{}) {
+		img.Set(0, 0, color.NRGBA{A: 255})
+	}
+	tile := wms.NewTile(id, append([]wms.TileOption{wms.WithOutputDir(dir)}, options...)...)
+	assert.NoError(t, tile.SetImage(img))
+	return tile
+}
+
+// readTile returns body of the tile saved in the directory.
+func readTile(t *testing.T, dir string, tile *wms.Tile) []byte {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join(dir, tile.Path(), tile.Name()))
+	assert.NoError(t, err)
+	return body
+}
+
+func TestTileWriter_ReplacePlaceholderLink(t *testing.T) {
+	dir := t.TempDir()
+	w := &tileWriter{policy: emptyPlaceholder}
+
+	empty := testTile(t, dir, mercantile.TileID{X: 1, Y: 1, Z: 1}, color.NRGBA{})
+	other := testTile(t, dir, mercantile.TileID{X: 0, Y: 1, Z: 1}, color.NRGBA{})
+	assert.True(t, w.save(empty))
+	assert.True(t, w.save(other))
+	placeholder, err := os.ReadFile(filepath.Join(dir, placeholderName+".png"))
+	assert.NoError(t, err)
+
+	// The tile linked to the placeholder gets data on the next run.
+	tile := testTile(t, dir, mercantile.TileID{X: 1, Y: 1, Z: 1}, color.NRGBA{R: 255, A: 255})
+	assert.False(t, w.save(tile))
+
+	assert.Equal(t, tile.Body(), readTile(t, dir, tile))
+	assert.Equal(t, placeholder, readTile(t, dir, other))
+	body, err := os.ReadFile(filepath.Join(dir, placeholderName+".png"))
+	assert.NoError(t, err)
+	assert.Equal(t, placeholder, body)
+	assert.Equal(t, int64(1), w.saved.Load())
+	assert.Equal(t, int64(2), w.empty.Load())
+}
+
+func TestTileWriter_KeepDeduplicatedTiles(t *testing.T) {
+	for _, mode := range []string{dedupe.Hardlink, dedupe.Symlink} {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := dedupe.NewStore(dir, mode)
+			assert.NoError(t, err)
+			deduplicated := &tileWriter{policy: emptyOff, store: store}
+			first := testTile(t, dir, mercantile.TileID{X: 0, Y: 0, Z: 1}, color.NRGBA{G: 255, A: 255})
+			second := testTile(t, dir, mercantile.TileID{X: 1, Y: 0, Z: 1}, color.NRGBA{G: 255, A: 255})
+			assert.False(t, deduplicated.save(first))
+			assert.False(t, deduplicated.save(second))
+			assert.NoError(t, store.Close())
+
+			// The next run saves tiles without deduplication.
+			w := &tileWriter{policy: emptyOff}
+			tile := testTile(t, dir, mercantile.TileID{X: 0, Y: 0, Z: 1}, color.NRGBA{R: 255, A: 255})
+			assert.False(t, w.save(tile))
+
+			assert.Equal(t, tile.Body(), readTile(t, dir, tile))
+			assert.Equal(t, second.Body(), readTile(t, dir, second))
+		})
+	}
+}
+
+func TestTileWriter_EmptyPolicies(t *testing.T) {
+	tests := map[string]struct {
+		Policy      string
+		Saved       bool
+		NoDataSaved bool
+		Sidecar     string
+		Counts      [2]int64
+	}{
+		"Off":         {Policy: emptyOff, Saved: true, Counts: [2]int64{1, 1}},
+		"Skip":        {Policy: emptySkip, Counts: [2]int64{0, 2}},
+		"Write":       {Policy: emptyWrite, Saved: true, Counts: [2]int64{0, 2}},
+		"Placeholder": {Policy: emptyPlaceholder, Saved: true, NoDataSaved: true, Counts: [2]int64{0, 2}},
+		"Sidecar":     {Policy: emptySidecar, Sidecar: "1/1/1\n1/0/1\n", Counts: [2]int64{0, 2}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			w := &tileWriter{policy: test.Policy}
+			tile := testTile(t, dir, mercantile.TileID{X: 1, Y: 1, Z: 1}, color.NRGBA{})
+			w.save(tile)
+			// Tiles the server has no data for have no image to write.
+			noData := wms.NewTile(mercantile.TileID{X: 0, Y: 1, Z: 1}, wms.WithOutputDir(dir))
+			assert.True(t, w.handle(noData, wms.ErrNoData))
+			w.close(io.Discard)
+
+			_, err := os.Stat(filepath.Join(dir, tile.Path(), tile.Name()))
+			assert.Equal(t, test.Saved, err == nil)
+			_, err = os.Stat(filepath.Join(dir, noData.Path(), noData.Name()))
+			assert.Equal(t, test.NoDataSaved, err == nil)
+			sidecar, _ := os.ReadFile(filepath.Join(dir, sidecarName))
+			assert.Equal(t, test.Sidecar, string(sidecar))
+			assert.Equal(t, test.Counts, [2]int64{w.saved.Load(), w.empty.Load()})
+		})
+	}
+}
+
+func TestTileWriter_ColourPlaceholders(t *testing.T) {
+	dir := t.TempDir()
+	w := &tileWriter{policy: emptyPlaceholder}
+	uniform := func(id mercantile.TileID, c color.NRGBA) *wms.Tile {
+		img := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+		draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+		tile := wms.NewTile(id, wms.WithOutputDir(dir))
+		assert.NoError(t, tile.SetImage(img))
+		return tile
+	}
+	sea, land := color.NRGBA{R: 0xaa, G: 0xd3, B: 0xdf, A: 0xff}, color.NRGBA{R: 0xf2, G: 0xef, B: 0xe9, A: 0xff}
+
+	tiles := map[string]*wms.Tile{
+		placeholderName + ".png":          uniform(mercantile.TileID{X: 0, Y: 0, Z: 1}, color.NRGBA{}),
+		placeholderName + "-aad3dfff.png": uniform(mercantile.TileID{X: 1, Y: 0, Z: 1}, sea),
+		placeholderName + "-f2efe9ff.png": uniform(mercantile.TileID{X: 0, Y: 1, Z: 1}, land),
+	}
+	for _, tile := range tiles {
+		assert.True(t, w.save(tile))
+	}
+	// Another sea tile shares the placeholder.
+	other := uniform(mercantile.TileID{X: 1, Y: 1, Z: 1}, sea)
+	assert.True(t, w.save(other))
+	assert.Equal(t, readTile(t, dir, tiles[placeholderName+"-aad3dfff.png"]), readTile(t, dir, other))
+
+	for name, tile := range tiles {
+		placeholder, err := os.Stat(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		linked, err := os.Stat(filepath.Join(dir, tile.Path(), tile.Name()))
+		assert.NoError(t, err)
+		assert.True(t, os.SameFile(placeholder, linked), name)
+		// Uniform colour tiles keep their colour.
+		assert.Equal(t, tile.Body(), readTile(t, dir, tile), name)
+	}
+}
+
+func TestTileWriter_MixedPlaceholder(t *testing.T) {
+	dir := t.TempDir()
+	w := &tileWriter{policy: emptyPlaceholder, tolerance: 8, mixed: true}
+	mixed := wms.WithOutputFormat(imaging.Mixed)
+
+	// Uniform opaque tile is encoded as JPEG, but linked to PNG placeholder of its colour.
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{B: 255, A: 255}), image.Point{}, draw.Src)
+	uniform := wms.NewTile(mercantile.TileID{X: 0, Y: 0, Z: 1}, wms.WithOutputDir(dir), mixed)
+	assert.NoError(t, uniform.SetImage(img))
+	assert.Equal(t, "0.jpg", uniform.Name())
+	assert.True(t, w.save(uniform))
+	body, err := os.ReadFile(filepath.Join(dir, "1/0/0.png"))
+	assert.NoError(t, err)
+	linked, err := imaging.Decode(body)
+	assert.NoError(t, err)
+	r, g, b, a := linked.At(128, 128).RGBA()
+	assert.InDelta(t, 0, r>>8, 8)
+	assert.InDelta(t, 0, g>>8, 8)
+	assert.InDelta(t, 255, b>>8, 8)
+	assert.Equal(t, uint32(0xffff), a)
+
+	// The opaque tile saved as JPEG has no data on the next run.
+	tile := testTile(t, dir, mercantile.TileID{X: 1, Y: 0, Z: 1}, color.NRGBA{R: 255, A: 255}, mixed)
+	assert.False(t, w.save(tile))
+	_, err = os.Stat(filepath.Join(dir, "1/1/0.jpg"))
+	assert.NoError(t, err)
+	noData := wms.NewTile(mercantile.TileID{X: 1, Y: 0, Z: 1}, wms.WithOutputDir(dir), mixed)
+	assert.True(t, w.handle(noData, wms.ErrNoData))
+
+	_, err = os.Stat(filepath.Join(dir, "1/1/0.jpg"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(filepath.Join(dir, "1/1/0.png"))
+	assert.NoError(t, err)
+}
+
+func TestTileWriter_ReplaceOtherFormats(t *testing.T) {
+	dir := t.TempDir()
+	jpeg := testTile(t, dir, mercantile.TileID{X: 1, Y: 0, Z: 1}, color.NRGBA{R: 255, A: 255}, wms.WithOutputFormat(imaging.JPEG))
+	assert.False(t, (&tileWriter{policy: emptyOff}).save(jpeg))
+
+	// Built tile replaces the downloaded one saved in other format.
+	w := &tileWriter{policy: emptyOff, replace: true}
+	png := testTile(t, dir, mercantile.TileID{X: 1, Y: 0, Z: 1}, color.NRGBA{G: 255, A: 255})
+	assert.False(t, w.save(png))
+	_, err := os.Stat(filepath.Join(dir, "1/1/0.jpg"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(filepath.Join(dir, "1/1/0.png"))
+	assert.NoError(t, err)
+}
+
+func TestTileWriter_TileJSON(t *testing.T) {
+	dir := t.TempDir()
+	mixed := &tileWriter{policy: emptyPlaceholder, mixed: true}
+	mixed.tileSet = &tileSet{url: "https://tiles.example.com/layer/", output: dir, mixed: true}
+	opaque := mercantile.TileID{X: 1, Y: 2, Z: 2}
+	transparent := mercantile.TileID{X: 7, Y: 1, Z: 3}
+	assert.False(t, mixed.save(testTile(t, dir, opaque, color.NRGBA{R: 255, A: 255}, wms.WithOutputFormat(imaging.Mixed))))
+	assert.True(t, mixed.save(testTile(t, dir, transparent, color.NRGBA{}, wms.WithOutputFormat(imaging.Mixed))))
+	// Tiles not saved are not described.
+	assert.False(t, mixed.handle(wms.NewTile(mercantile.TileID{X: 0, Y: 0, Z: 5}, wms.WithOutputDir(dir)), errors.New("timeout")))
+	mixed.close(io.Discard)
+
+	read := func() map[string]any {
+		body, err := os.ReadFile(filepath.Join(dir, tileJSONName))
+		assert.NoError(t, err)
+		doc := map[string]any{}
+		assert.NoError(t, json.Unmarshal(body, &doc))
+		return doc
+	}
+	bounds := func(tiles ...mercantile.TileID) []any {
+		b := mercantile.Bounds(tiles[0])
+		for _, tile := range tiles[1:] {
+			tb := mercantile.Bounds(tile)
+			b = mercantile.LngLatBbox{West: min(b.West, tb.West), South: min(b.South, tb.South), East: max(b.East, tb.East), North: max(b.North, tb.North)}
+		}
+		return []any{b.West, b.South, b.East, b.North}
+	}
+	doc := read()
+	// Extensions of tiles in mixed format differ, URL template has none.
+	assert.Equal(t, []any{"https://tiles.example.com/layer/{z}/{x}/{y}"}, doc["tiles"])
+	assert.Equal(t, "3.0.0", doc["tilejson"])
+	assert.Equal(t, 2.0, doc["minzoom"])
+	assert.Equal(t, 3.0, doc["maxzoom"])
+	assert.Equal(t, bounds(opaque, transparent), doc["bounds"])
+
+	// The next run extends zoom levels and bounds, and keeps other fields.
+	doc["attribution"] = "© Example"
+	body, err := json.Marshal(doc)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, tileJSONName), body, 0o644))
+	hidpi := &tileWriter{policy: emptyOff}
+	hidpi.tileSet = &tileSet{url: "https://tiles.example.com/layer", output: dir}
+	parent := mercantile.TileID{X: 0, Y: 0, Z: 1}
+	assert.False(t, hidpi.save(testTile(t, dir, parent, color.NRGBA{G: 255, A: 255}, wms.WithScale(2))))
+	hidpi.close(io.Discard)
+
+	doc = read()
+	assert.Equal(t, []any{"https://tiles.example.com/layer/{z}/{x}/{y}@2x.png"}, doc["tiles"])
+	assert.Equal(t, 1.0, doc["minzoom"])
+	assert.Equal(t, 3.0, doc["maxzoom"])
+	assert.Equal(t, bounds(opaque, transparent, parent), doc["bounds"])
+	assert.Equal(t, "© Example", doc["attribution"])
+}
+
+func TestTileWriter_MixedTileJSONServable(t *testing.T) {
+	dir := t.TempDir()
+	// Static server resolving extension of tiles in mixed format, like nginx with
+	// try_files $uri.jpg $uri.png =404.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, ext := range []string{"", ".jpg", ".png"} {
+			name := filepath.Join(dir, filepath.FromSlash(r.URL.Path)+ext)
+			if info, err := os.Stat(name); err == nil && info.Mode().IsRegular() {
+				http.ServeFile(w, r, name)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	w := &tileWriter{policy: emptyPlaceholder, mixed: true}
+	w.tileSet = &tileSet{url: server.URL, output: dir, mixed: true}
+	opaque := testTile(t, dir, mercantile.TileID{X: 1, Y: 2, Z: 2}, color.NRGBA{R: 255, A: 255}, wms.WithOutputFormat(imaging.Mixed))
+	transparent := testTile(t, dir, mercantile.TileID{X: 7, Y: 1, Z: 3}, color.NRGBA{}, wms.WithOutputFormat(imaging.Mixed))
+	assert.False(t, w.save(opaque))
+	assert.True(t, w.save(transparent))
+	w.close(io.Discard)
+
+	body, err := os.ReadFile(filepath.Join(dir, tileJSONName))
+	assert.NoError(t, err)
+	var doc struct {
+		Tiles []string `json:"tiles"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &doc))
+	assert.Len(t, doc.Tiles, 1)
+
+	// Every tile is served under the URL template, whichever its extension.
+	for _, tile := range []*wms.Tile{opaque, transparent} {
+		url := strings.NewReplacer(
+			"{z}", strconv.Itoa(tile.Z()), "{x}", strconv.Itoa(tile.X()), "{y}", strconv.Itoa(tile.Y()),
+		).Replace(doc.Tiles[0])
+		res, err := http.Get(url)
+		assert.NoError(t, err)
+		served, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode, url)
+		assert.Equal(t, readTile(t, dir, tile), served, url)
+	}
+}
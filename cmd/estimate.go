@@ -0,0 +1,288 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/wms"
+)
+
+// blockSize is the typical file system block size, every tile occupies a whole number
+// of blocks on disk.
+const blockSize = 4096
+
+var estimateCmd = &cobra.Command{
+	Use:   "estimate",
+	Short: "Estimate number of tiles, disk space and download time",
+	Long: `Estimate number of tiles per zoom level, disk space and download time. Size of
+tiles and latency of the WMS server are measured on a random sample of tiles
+downloaded on every zoom level.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		tileIDs, counts, matrixSet, err := tilesFromFlags(cmd)
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+			return
+		}
+		sampleSize, err := cmd.Flags().GetInt("sample")
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+		}
+		concurrency, err := cmd.Flags().GetInt("concurrency")
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+		}
+		rateLimit, err := cmd.Flags().GetFloat64("rate-limit")
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+		}
+		timeout, err := cmd.Flags().GetInt("timeout")
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+		}
+		// Sample requests are paced here rather than by the client, so that measured
+		// latency does not include waiting for the rate limit.
+		WMSClient, err := clientFromFlags(cmd, matrixSet, wms.WithRateLimit(0))
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+			return
+		}
+		tileOptions, err := tileOptionsFromFlags(cmd, matrixSet)
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+			return
+		}
+
+		// Download random sample of tiles on every zoom level.
+		stats := map[int]*zoomStats{}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		sem := make(chan bool, max(concurrency, 1))
+		var pace <-chan time.Time
+		if rateLimit > 0 {
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / rateLimit))
+			defer ticker.Stop()
+			pace = ticker.C
+		}
+		for i, tileID := range enumerate(sampleTiles(tileIDs, counts, sampleSize)) {
+			if pace != nil && i > 0 {
+				<-pace
+			}
+			sem <- true
+			wg.Add(1)
+			go func(tileID mercantile.TileID) {
+				defer func() { wg.Done(); <-sem }()
+
+				start := time.Now()
+				tile, err := WMSClient.GetTile(ctx, tileID, timeout, tileOptions...)
+				latency := time.Since(start)
+
+				mu.Lock()
+				defer mu.Unlock()
+				s, ok := stats[tileID.Z]
+				if !ok {
+					s = &zoomStats{}
+					stats[tileID.Z] = s
+				}
+				if err != nil {
+					s.failed++
+					return
+				}
+				s.sampled++
+				s.bytes += len(tile.Body())
+				s.blocks += (len(tile.Body()) + blockSize - 1) / blockSize
+				s.latency += latency
+			}(tileID)
+		}
+		wg.Wait()
+
+		writeEstimate(cmd, counts, stats, concurrency, rateLimit)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(estimateCmd)
+
+	// Required args/flags
+	addRequestFlags(estimateCmd)
+	requireRequestFlags(estimateCmd)
+	estimateCmd.Flags().StringSliceP(
+		"zoom", "z", nil, "Comma-separated list of zooms or zoom ranges, e.g. 0-12,14",
+	)
+	addAreaFlags(estimateCmd)
+	estimateCmd.MarkFlagsOneRequired("zoom", "tiles-file")
+
+	// Optional args/flags
+	estimateCmd.Flags().Int(
+		"sample", 10, "Number of random tiles downloaded on every zoom level (0 to only count tiles)",
+	)
+}
+
+// zoomStats holds measurements of sample tiles downloaded on a zoom level.
+type zoomStats struct {
+	sampled int
+	failed  int
+	bytes   int
+	blocks  int
+	latency time.Duration
+}
+
+// sampleTiles yields up to size randomly chosen tiles of every zoom level. Tiles are
+// enumerated only until the last chosen one is found.
+func sampleTiles(tileIDs iter.Seq[mercantile.TileID], counts map[int]int, size int) iter.Seq[mercantile.TileID] {
+	return func(yield func(mercantile.TileID) bool) {
+		chosen := map[int]map[int]bool{}
+		remaining := 0
+		for z, count := range counts {
+			chosen[z] = randomIndexes(count, min(size, count))
+			remaining += len(chosen[z])
+		}
+		if remaining == 0 {
+			return
+		}
+
+		index := map[int]int{}
+		for tile := range tileIDs {
+			i := index[tile.Z]
+			index[tile.Z]++
+			if !chosen[tile.Z][i] {
+				continue
+			}
+			if !yield(tile) {
+				return
+			}
+			if remaining--; remaining == 0 {
+				return
+			}
+		}
+	}
+}
+
+// enumerate yields tiles with their indexes.
+func enumerate(tileIDs iter.Seq[mercantile.TileID]) iter.Seq2[int, mercantile.TileID] {
+	return func(yield func(int, mercantile.TileID) bool) {
+		i := 0
+		for tile := range tileIDs {
+			if !yield(i, tile) {
+				return
+			}
+			i++
+		}
+	}
+}
+
+// randomIndexes chooses k distinct random numbers from range [0, n) (Floyd's algorithm).
+func randomIndexes(n, k int) map[int]bool {
+	chosen := make(map[int]bool, k)
+	for j := n - k; j < n; j++ {
+		if t := rand.IntN(j + 1); !chosen[t] {
+			chosen[t] = true
+		} else {
+			chosen[j] = true
+		}
+	}
+	return chosen
+}
+
+// writeEstimate writes table with number of tiles, their size per zoom level and
+// projected download time. Size of tiles on zoom levels without successful samples
+// is estimated with average of all samples.
+func writeEstimate(cmd *cobra.Command, counts map[int]int, stats map[int]*zoomStats, concurrency int, rateLimit float64) {
+	var total zoomStats
+	for _, s := range stats {
+		total.sampled += s.sampled
+		total.failed += s.failed
+		total.bytes += s.bytes
+		total.blocks += s.blocks
+		total.latency += s.latency
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "ZOOM\tTILES\tSAMPLED\tFAILED\tAVG SIZE\tSIZE\tDISK USAGE\t")
+	zooms := make([]int, 0, len(counts))
+	for z := range counts {
+		zooms = append(zooms, z)
+	}
+	slices.Sort(zooms)
+	tiles, size, disk := 0, 0.0, 0.0
+	for _, z := range zooms {
+		s := stats[z]
+		if s == nil || s.sampled == 0 {
+			s = &zoomStats{sampled: total.sampled, bytes: total.bytes, blocks: total.blocks}
+			if stats[z] != nil {
+				s.failed = stats[z].failed
+			}
+		}
+		avgSize, avgDisk := 0.0, 0.0
+		if s.sampled > 0 {
+			avgSize = float64(s.bytes) / float64(s.sampled)
+			avgDisk = float64(s.blocks*blockSize) / float64(s.sampled)
+		}
+		sampled := 0
+		if stats[z] != nil {
+			sampled = stats[z].sampled
+		}
+		tiles += counts[z]
+		size += avgSize * float64(counts[z])
+		disk += avgDisk * float64(counts[z])
+		if s.sampled == 0 {
+			fmt.Fprintf(w, "%d\t%d\t%d\t%d\t-\t-\t-\t\n", z, counts[z], sampled, s.failed)
+			continue
+		}
+		fmt.Fprintf(
+			w, "%d\t%d\t%d\t%d\t%s\t%s\t%s\t\n", z, counts[z], sampled, s.failed,
+			formatBytes(avgSize), formatBytes(avgSize*float64(counts[z])), formatBytes(avgDisk*float64(counts[z])),
+		)
+	}
+	if total.sampled == 0 {
+		fmt.Fprintf(w, "TOTAL\t%d\t%d\t%d\t\t-\t-\t\n", tiles, total.sampled, total.failed)
+	} else {
+		fmt.Fprintf(
+			w, "TOTAL\t%d\t%d\t%d\t\t%s\t%s\t\n", tiles, total.sampled, total.failed, formatBytes(size), formatBytes(disk),
+		)
+	}
+	w.Flush()
+
+	out := cmd.OutOrStdout()
+	if total.sampled == 0 {
+		fmt.Fprintln(out, "\nNo sample tiles downloaded, size and duration are unknown.")
+		return
+	}
+	// Requests are limited either by latency of the server and concurrency or by rate limit.
+	latency := total.latency / time.Duration(total.sampled)
+	throughput := float64(max(concurrency, 1)) / latency.Seconds()
+	if rateLimit > 0 {
+		throughput = math.Min(throughput, rateLimit)
+	}
+	duration := time.Duration(float64(tiles) / throughput * float64(time.Second))
+	fmt.Fprintf(out, "\nAverage latency: %s\n", latency.Round(time.Millisecond))
+	fmt.Fprintf(out, "Throughput: %.1f tiles/s (concurrency %d", throughput, concurrency)
+	if rateLimit > 0 {
+		fmt.Fprintf(out, ", rate limit %g/s", rateLimit)
+	}
+	fmt.Fprintf(out, ")\nEstimated duration: %s\n", duration.Round(time.Second))
+}
+
+// formatBytes formats size in bytes using binary units, e.g. 1.5 MiB.
+func formatBytes(size float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", size, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", size, units[i])
+}
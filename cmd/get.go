@@ -2,12 +2,19 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"iter"
+	"os"
+	"slices"
 
 	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
 
 	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/overview"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tilestore"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tms"
 	"github.com/lmikolajczak/wms-tiles-downloader/pkg/wms"
 )
 
@@ -16,164 +23,314 @@ var getCmd = &cobra.Command{
 	Short: "Download tiles",
 	Long:  "Download tiles from WMS server based on provided options.",
 	Run: func(cmd *cobra.Command, args []string) {
-		ctx := context.Background()
-		// Get IDs of tiles that are intersecting given bbox on provided zoom levels.
-		bbox, err := cmd.Flags().GetFloat64Slice("bbox")
+		// Get IDs of tiles that are intersecting given area on provided zoom levels.
+		tileIDs, counts, matrixSet, err := tilesFromFlags(cmd)
 		if err != nil {
 			fmt.Printf("ERR: %s\n", err)
+			return
 		}
-		zoom, err := cmd.Flags().GetIntSlice("zoom")
-		if err != nil {
-			fmt.Printf("ERR: %s\n", err)
-		}
-		tileIDs := mercantile.Tiles(bbox[0], bbox[1], bbox[2], bbox[3], zoom)
-		bar := progressbar.Default(int64(len(tileIDs)))
 
-		// Initialize new WMS client
-		url, err := cmd.Flags().GetString("url")
+		downloadTiles(cmd, tileIDs, counts, matrixSet)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+
+	// Required args/flags
+	addRequestFlags(getCmd)
+	requireRequestFlags(getCmd)
+	getCmd.Flags().StringSliceP(
+		"zoom", "z", nil, "Comma-separated list of zooms or zoom ranges, e.g. 0-12,14",
+	)
+	addAreaFlags(getCmd)
+	getCmd.MarkFlagsOneRequired("zoom", "tiles-file")
+
+	// Optional args/flags
+	addDownloadFlags(getCmd)
+}
+
+// addDownloadFlags registers flags controlling how downloaded tiles are saved.
+func addDownloadFlags(cmd *cobra.Command) {
+	addTileWriterFlags(cmd, "Output directory for downloaded tiles")
+	cmd.Flags().Int(
+		"metatile", 1, "Request blocks of NxN tiles with a single GetMap request and slice them locally",
+	)
+	cmd.Flags().Int(
+		"max-width", 0, "Maximum width of images served by the server (default MaxWidth from its capabilities)",
+	)
+	cmd.Flags().Int(
+		"max-height", 0, "Maximum height of images served by the server (default MaxHeight from its capabilities)",
+	)
+	cmd.Flags().Bool(
+		"prune-empty", false, "Download zoom level after zoom level and skip descendants of empty tiles (requires --empty)",
+	)
+	cmd.Flags().Int(
+		"prune-min-zoom", 0, "Skip only descendants of empty tiles on this zoom level or deeper",
+	)
+	cmd.Flags().Int(
+		"overzoom", 0, "Maximum zoom level served by the server, tiles of deeper zoom levels are synthesised by cropping and upscaling their nearest saved ancestor",
+	)
+	cmd.Flags().String(
+		"overzoom-resampling", overview.Bilinear.String(), "Resampling of overzoomed tiles: bilinear, average, nearest or mode (for categorical maps)",
+	)
+	cmd.Flags().Bool(
+		"dry-run", false, "Write planned tiles with their bbox and GetMap URL instead of downloading them",
+	)
+	cmd.Flags().String(
+		"dry-run-format", planText, "Output format of dry run (text, csv, jsonl)",
+	)
+}
+
+// downloadTiles downloads tiles from WMS server configured by request flags and saves
+// them in output directory (or only lists them in dry run mode).
+func downloadTiles(cmd *cobra.Command, tileIDs iter.Seq[mercantile.TileID], counts map[int]int, matrixSet *tms.TileMatrixSet) {
+	ctx := context.Background()
+
+	// Initialize new WMS client
+	WMSClient, err := clientFromFlags(cmd, matrixSet)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return
+	}
+
+	timeout, err := cmd.Flags().GetInt("timeout")
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+	}
+	tileOptions, err := tileOptionsFromFlags(cmd, matrixSet)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return
+	}
+	metatileSize, err := metatileSizeFromFlags(ctx, cmd, WMSClient, timeout, tileOptions)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return
+	}
+
+	// Tiles deeper than the maximum zoom level of the server are synthesised from ancestors.
+	overzoom, err := overzoomerFromFlags(cmd, matrixSet)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return
+	}
+	allTileIDs := tileIDs
+	if overzoom != nil {
+		tileIDs = overzoom.requested(tileIDs)
+	}
+
+	// In dry run mode only list tiles and requests which would be sent.
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+	}
+	if dryRun {
+		format, err := cmd.Flags().GetString("dry-run-format")
 		if err != nil {
 			fmt.Printf("ERR: %s\n", err)
 		}
-		params, err := cmd.Flags().GetStringToString("params")
+		err = writePlan(cmd.OutOrStdout(), WMSClient, tileIDs, format, metatileSize, matrixSet, tileOptions...)
 		if err != nil {
-			fmt.Printf("ERR: %s\n", err)
+			fmt.Fprintf(os.Stderr, "ERR: %s\n", err)
 		}
-		version, err := cmd.Flags().GetString("version")
-		if err != nil {
-			fmt.Printf("ERR: %s\n", err)
+		return
+	}
+	writer, err := tileWriterFromFlags(cmd)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return
+	}
+	pruner, err := prunerFromFlags(cmd, matrixSet)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return
+	}
+	bar := progressbar.Default(int64(totalCount(counts)))
+
+	// Use semaphore pattern to limit concurrency. We don't want to flood WMS
+	// server with too many requests.
+	concurrency, err := cmd.Flags().GetInt("concurrency")
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+	}
+	sem := make(chan bool, concurrency)
+	// Make sure we wait for all goroutines to finish, attempt to fill the
+	// semaphore back up to its capacity.
+	wait := func() {
+		for i := 0; i < cap(sem); i++ {
+			sem <- true
 		}
-		auth, err := cmd.Flags().GetString("auth")
-		if err != nil {
-			fmt.Printf("ERR: %s\n", err)
+		for i := 0; i < cap(sem); i++ {
+			<-sem
 		}
-		WMSClient, err := wms.NewClient(
-			url, wms.WithBasicAuth(auth), wms.WithQueryString(params), wms.WithVersion(version),
-		)
-		if err != nil {
-			fmt.Printf("ERR: %s\n", err)
+	}
+	// Empty tiles prune their descendants on next zoom levels, and have no descendants to
+	// synthesise.
+	saved := func(tileID mercantile.TileID, empty bool) {
+		if empty && pruner != nil {
+			pruner.add(tileID)
 		}
-
-		// Use semaphore pattern to limit concurrency. We don't want to flood WMS
-		// server with too many requests.
-		concurrency, err := cmd.Flags().GetInt("concurrency")
-		if err != nil {
-			fmt.Printf("ERR: %s\n", err)
+		if empty && overzoom != nil {
+			overzoom.addEmpty(tileID)
 		}
-		sem := make(chan bool, concurrency)
+	}
 
-		// Download tiles from WMS server and save them on a hard drive.
-		layer, err := cmd.Flags().GetString("layer")
-		if err != nil {
-			fmt.Printf("ERR: %s\n", err)
-		}
-		style, err := cmd.Flags().GetString("style")
-		if err != nil {
-			fmt.Printf("ERR: %s\n", err)
-		}
-		width, err := cmd.Flags().GetInt("width")
-		if err != nil {
-			fmt.Printf("ERR: %s\n", err)
+	// Download tiles from WMS server and save them on a hard drive.
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+	}
+	tileOptions = append(tileOptions, wms.WithOutputDir(output))
+	download := func(tileIDs iter.Seq[mercantile.TileID]) {
+		// Tiles are computed lazily, as they are downloaded.
+		if metatileSize > 1 {
+			for metatile := range wms.Metatiles(tileIDs, metatileSize, matrixSet) {
+				sem <- true
+				go func(metatile wms.Metatile) {
+					defer func() { bar.Add(len(metatile.Tiles)); <-sem }()
+
+					tiles, err := WMSClient.GetMetatile(ctx, metatile, timeout, tileOptions...)
+					if errors.Is(err, wms.ErrNoData) {
+						// The server has no data for any tile of the metatile.
+						for _, tileID := range metatile.Tiles {
+							saved(tileID, writer.handle(wms.NewTile(tileID, tileOptions...), err))
+						}
+						return
+					}
+					if err != nil {
+						writer.fail(err)
+						return
+					}
+					for _, tile := range tiles {
+						saved(mercantile.TileID{X: tile.X(), Y: tile.Y(), Z: tile.Z()}, writer.save(tile))
+					}
+				}(metatile)
+			}
+		} else {
+			for tileID := range tileIDs {
+				sem <- true
+				go func(tileID mercantile.TileID) {
+					defer func() { bar.Add(1); <-sem }()
+
+					tile, err := WMSClient.GetTile(ctx, tileID, timeout, tileOptions...)
+					if errors.Is(err, wms.ErrNoData) {
+						tile = wms.NewTile(tileID, tileOptions...)
+					}
+					saved(tileID, writer.handle(tile, err))
+				}(tileID)
+			}
 		}
-		height, err := cmd.Flags().GetInt("height")
-		if err != nil {
-			fmt.Printf("ERR: %s\n", err)
+	}
+	if pruner == nil {
+		download(tileIDs)
+	} else {
+		// Tiles are downloaded zoom level after zoom level, so that descendants of empty
+		// tiles are known before their zoom level is requested.
+		for level := range mercantile.ZoomLevels(tileIDs) {
+			download(pruner.filter(level, func(mercantile.TileID) {
+				writer.pruned.Add(1)
+				bar.Add(1)
+			}))
+			wait()
 		}
-		format, err := cmd.Flags().GetString("format")
+	}
+	wait()
+	if overzoom != nil {
+		// Ancestors missing in the output directory are downloaded before tiles are
+		// synthesised from them.
+		missing, err := overzoom.missingAncestors(overzoom.deeper(allTileIDs))
 		if err != nil {
 			fmt.Printf("ERR: %s\n", err)
+			return
 		}
-		output, err := cmd.Flags().GetString("output")
-		if err != nil {
+		bar.AddMax(len(missing))
+		download(slices.Values(missing))
+		wait()
+
+		if err := os.MkdirAll(output, os.ModePerm); err != nil {
 			fmt.Printf("ERR: %s\n", err)
+			return
 		}
-		timeout, err := cmd.Flags().GetInt("timeout")
+		reader, err := tilestore.Open(output, tilestore.WithScale(overzoom.scale))
 		if err != nil {
 			fmt.Printf("ERR: %s\n", err)
+			return
 		}
-		for _, tileID := range tileIDs {
+		for tileID := range overzoom.deeper(allTileIDs) {
 			sem <- true
 			go func(tileID mercantile.TileID) {
 				defer func() { bar.Add(1); <-sem }()
 
-				tile, err := WMSClient.GetTile(
-					ctx,
-					tileID,
-					timeout,
-					wms.WithLayers(layer),
-					wms.WithStyles(style),
-					wms.WithWidth(width),
-					wms.WithHeight(height),
-					wms.WithFormat(format),
-					wms.WithOutputDir(output),
-				)
+				tile := wms.NewTile(tileID, tileOptions...)
+				found, err := overzoom.fill(reader, tile)
 				if err != nil {
-					fmt.Printf("ERR: %s\n", err)
+					writer.fail(err)
 					return
 				}
-				err = WMSClient.SaveTile(tile)
-				if err != nil {
-					fmt.Printf("ERR: %s\n", err)
+				// Without saved ancestor there is no data for the tile.
+				if !found {
+					writer.handle(tile, wms.ErrNoData)
+					return
+				}
+				if !writer.save(tile) {
+					overzoom.record(writer, tile)
 				}
 			}(tileID)
 		}
-		// Make sure we wait for all goroutines to finish, attempt to fill the
-		// semaphore back up to its capacity.
-		for i := 0; i < cap(sem); i++ {
-			sem <- true
-		}
-	},
+		wait()
+		reader.Close()
+	}
+	writer.close(cmd.OutOrStdout())
+	if overzoom != nil {
+		overzoom.close(cmd.OutOrStdout())
+	}
 }
 
-func init() {
-	rootCmd.AddCommand(getCmd)
+// metatileSizeFromFlags returns size of metatiles, capped so that their images do not exceed
+// maximum size of images served by the server. Unless given by flags, the maximum size is read
+// from capabilities of the server (except in dry run mode).
+func metatileSizeFromFlags(
+	ctx context.Context, cmd *cobra.Command, client *wms.Client, timeout int, tileOptions []wms.TileOption,
+) (int, error) {
+	size, err := cmd.Flags().GetInt("metatile")
+	if err != nil {
+		return 0, err
+	}
+	if size <= 1 {
+		return 1, nil
+	}
+	maxWidth, err := cmd.Flags().GetInt("max-width")
+	if err != nil {
+		return 0, err
+	}
+	maxHeight, err := cmd.Flags().GetInt("max-height")
+	if err != nil {
+		return 0, err
+	}
+	// Dry run makes no requests, blocks are capped only by the maximum size given by flags.
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return 0, err
+	}
+	if maxWidth == 0 && maxHeight == 0 && !dryRun {
+		if maxWidth, maxHeight, err = client.GetMaxSize(ctx, timeout); err != nil {
+			return 0, fmt.Errorf("error reading maximum image size from capabilities (set --max-width and --max-height): %w", err)
+		}
+	}
 
-	// Required args/flags
-	getCmd.Flags().StringP(
-		"url", "u", "", "WMS server url",
-	)
-	getCmd.MarkFlagRequired("url")
-	getCmd.Flags().StringP(
-		"layer", "l", "", "Layer name",
-	)
-	getCmd.MarkFlagRequired("layer")
-	getCmd.Flags().IntSliceP(
-		"zoom", "z", nil, "Comma-separated list of zooms",
-	)
-	getCmd.MarkFlagRequired("zoom")
-	getCmd.Flags().Float64SliceP(
-		"bbox", "b", nil, "Comma-separated list of bbox coords",
-	)
-	getCmd.MarkFlagRequired("bbox")
+	// Gutter is added around the whole metatile image.
+	gutter, err := cmd.Flags().GetInt("buffer-px")
+	if err != nil {
+		return 0, err
+	}
+	if maxWidth > 0 {
+		maxWidth = max(maxWidth-2*gutter, 1)
+	}
+	if maxHeight > 0 {
+		maxHeight = max(maxHeight-2*gutter, 1)
+	}
 
-	// Optional args/flags
-	getCmd.Flags().StringP(
-		"style", "s", "", "Layer style",
-	)
-	getCmd.Flags().Int(
-		"width", 256, "Tile width",
-	)
-	getCmd.Flags().Int(
-		"height", 256, "Tile height",
-	)
-	getCmd.Flags().String(
-		"format", "image/png", "Tile format",
-	)
-	getCmd.Flags().String(
-		"version", "1.3.0", "WMS server version",
-	)
-	getCmd.Flags().StringP(
-		"output", "o", "", "Output directory for downloaded tiles",
-	)
-	getCmd.Flags().IntP(
-		"timeout", "t", 10000, "HTTP request timeout (in milliseconds)",
-	)
-	getCmd.Flags().Int(
-		"concurrency", 16, "Limit of concurrent requests to the WMS server",
-	)
-	getCmd.Flags().StringToString(
-		"params", nil, "Custom query string params",
-	)
-	getCmd.Flags().String(
-		"auth", "", "Basic HTTP auth credentials separated by semicolon (username:password)",
-	)
+	tile := wms.NewTile(mercantile.TileID{}, tileOptions...)
+	return wms.MetatileSize(size, tile.Width(), tile.Height(), maxWidth, maxHeight), nil
 }
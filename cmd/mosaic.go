@@ -0,0 +1,293 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/aoi"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mosaic"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tilestore"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/wms"
+)
+
+var mosaicCmd = &cobra.Command{
+	Use:   "mosaic",
+	Short: "Stitch tiles into a georeferenced image",
+	Long: `Stitch tiles of a zoom level into a single image cropped to bbox (or bounds of area of
+interest), saved as PNG or JPEG with a world file (.pgw or .jgw) and .prj file in Web Mercator
+(EPSG:3857). Tiles are read from output directory or zip archive of downloaded tiles, tiles
+missing there are downloaded from WMS server when its url is given. Bbox with west greater
+than east crosses the antimeridian.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := writeMosaic(cmd); err != nil {
+			fmt.Printf("ERR: %s\n", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mosaicCmd)
+
+	// Required args/flags
+	mosaicCmd.Flags().IntP(
+		"zoom", "z", 0, "Zoom level of tiles",
+	)
+	mosaicCmd.MarkFlagRequired("zoom")
+	mosaicCmd.Flags().StringP(
+		"output", "o", "", "Output image (.png, .jpg or .jpeg)",
+	)
+	mosaicCmd.MarkFlagRequired("output")
+	addExtentFlags(mosaicCmd)
+
+	// Optional args/flags
+	mosaicCmd.Flags().StringP(
+		"input", "i", "", "Output directory or zip archive of downloaded tiles",
+	)
+	addRequestFlags(mosaicCmd)
+}
+
+// addExtentFlags registers flags describing extent of stitched tiles: bbox or bounds of area
+// of interest.
+func addExtentFlags(cmd *cobra.Command) {
+	cmd.Flags().Float64SliceP(
+		"bbox", "b", nil, "Comma-separated list of bbox coords (WGS84)",
+	)
+	cmd.Flags().String(
+		"aoi", "", "Area of interest file (GeoJSON, Shapefile, zipped Shapefile, KML, KMZ or WKT), its bounds are used in place of bbox",
+	)
+	cmd.Flags().String(
+		"aoi-wkt", "", "Area of interest as WKT geometry, its bounds are used in place of bbox",
+	)
+	cmd.Flags().StringToString(
+		"aoi-filter", nil, "Use only features of aoi file with given attribute values, e.g. name=Warsaw",
+	)
+	cmd.MarkFlagsOneRequired("bbox", "aoi", "aoi-wkt")
+	cmd.MarkFlagsMutuallyExclusive("bbox", "aoi", "aoi-wkt")
+}
+
+// writeMosaic stitches tiles configured by flags and writes the image with its world file
+// and .prj file.
+func writeMosaic(cmd *cobra.Command) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	ext := strings.ToLower(filepath.Ext(output))
+	var format string
+	switch ext {
+	case ".png":
+		format = imaging.PNG
+	case ".jpg", ".jpeg":
+		format = imaging.JPEG
+	default:
+		return fmt.Errorf("unsupported mosaic format: %q (use .png, .jpg or .jpeg)", ext)
+	}
+	quality, err := cmd.Flags().GetInt("quality")
+	if err != nil {
+		return err
+	}
+	background, err := backgroundFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	bbox, err := extentFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	// Zoom levels of 512px grid are shifted as for downloaded tiles.
+	zoom, err := cmd.Flags().GetInt("zoom")
+	if err != nil {
+		return err
+	}
+	offset, err := zoomOffset(cmd)
+	if err != nil {
+		return err
+	}
+	if zoom += offset; zoom < 0 {
+		return fmt.Errorf("invalid zoom: %d", zoom-offset)
+	}
+	tileSize, err := cmd.Flags().GetInt("tile-size")
+	if err != nil {
+		return err
+	}
+	scale, err := cmd.Flags().GetInt("scale")
+	if err != nil {
+		return err
+	}
+	if scale < 1 {
+		return fmt.Errorf("invalid scale: %d", scale)
+	}
+
+	reader, fetch, err := mosaicSourcesFromFlags(cmd, scale)
+	if err != nil {
+		return err
+	}
+	if reader != nil {
+		defer reader.Close()
+	}
+
+	var stitched, fetched, missing int
+	m, err := mosaic.Build(bbox, zoom, tileSize*scale, func(tileID mercantile.TileID) (image.Image, error) {
+		stitched++
+		var body []byte
+		var err error
+		if reader != nil {
+			body, err = reader.ReadTile(tileID)
+		}
+		if reader == nil || errors.Is(err, tilestore.ErrNotFound) {
+			if fetch == nil {
+				missing++
+				return nil, nil
+			}
+			body, err = fetch(tileID)
+			if errors.Is(err, wms.ErrNoData) {
+				missing++
+				return nil, nil
+			}
+			fetched++
+		}
+		if err != nil {
+			return nil, err
+		}
+		return imaging.Decode(body)
+	})
+	if err != nil {
+		return err
+	}
+
+	body, err := imaging.Encode(m.Image, format, imaging.WithQuality(quality), imaging.WithBackground(background))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(output, body, 0o644); err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(output, filepath.Ext(output))
+	if err := os.WriteFile(base+mosaic.WorldFileExtension(ext), []byte(m.WorldFile()), 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(base+".prj", []byte(mosaic.PseudoMercatorPRJ), 0o644); err != nil {
+		return err
+	}
+
+	size := m.Image.Bounds().Size()
+	fmt.Fprintf(
+		cmd.OutOrStdout(), "Tiles: %d, downloaded: %d, missing: %d\nSaved %s (%dx%d)\n",
+		stitched, fetched, missing, output, size.X, size.Y,
+	)
+	return nil
+}
+
+// extentFromFlags returns extent given by flags: bbox or bounds of area of interest, with
+// west > east when it crosses the antimeridian.
+func extentFromFlags(cmd *cobra.Command) (mercantile.LngLatBbox, error) {
+	bbox, err := cmd.Flags().GetFloat64Slice("bbox")
+	if err != nil {
+		return mercantile.LngLatBbox{}, err
+	}
+	if len(bbox) > 0 {
+		if len(bbox) != 4 {
+			return mercantile.LngLatBbox{}, errors.New("bbox requires 4 coords")
+		}
+		return mercantile.LngLatBbox{West: bbox[0], South: bbox[1], East: bbox[2], North: bbox[3]}, nil
+	}
+
+	path, err := cmd.Flags().GetString("aoi")
+	if err != nil {
+		return mercantile.LngLatBbox{}, err
+	}
+	wkt, err := cmd.Flags().GetString("aoi-wkt")
+	if err != nil {
+		return mercantile.LngLatBbox{}, err
+	}
+	filter, err := cmd.Flags().GetStringToString("aoi-filter")
+	if err != nil {
+		return mercantile.LngLatBbox{}, err
+	}
+	features, err := loadFeatures(path, wkt, filter)
+	if err != nil {
+		return mercantile.LngLatBbox{}, err
+	}
+	polygons, err := aoi.Polygons(features)
+	if err != nil {
+		return mercantile.LngLatBbox{}, err
+	}
+	return mercantile.PolygonBounds(polygons), nil
+}
+
+// mosaicSourcesFromFlags returns reader of the tile store given by input flag and function
+// downloading tiles from WMS server given by request flags, either of which may be nil.
+// Downloaded tiles are saved in the input directory, unless it is an archive.
+func mosaicSourcesFromFlags(cmd *cobra.Command, scale int) (tilestore.Reader, func(mercantile.TileID) ([]byte, error), error) {
+	input, err := cmd.Flags().GetString("input")
+	if err != nil {
+		return nil, nil, err
+	}
+	url, err := cmd.Flags().GetString("url")
+	if err != nil {
+		return nil, nil, err
+	}
+	if input == "" && url == "" {
+		return nil, nil, errors.New("either input or url is required")
+	}
+
+	// Input directory is created for downloaded tiles when it does not exist yet.
+	_, statErr := os.Stat(input)
+	var reader tilestore.Reader
+	if input != "" && (url == "" || statErr == nil) {
+		if reader, err = tilestore.Open(input, tilestore.WithScale(scale)); err != nil {
+			return nil, nil, err
+		}
+	}
+	if url == "" {
+		return reader, nil, nil
+	}
+
+	layer, err := cmd.Flags().GetString("layer")
+	if err != nil {
+		return nil, nil, err
+	}
+	if layer == "" {
+		return nil, nil, errors.New("layer is required to download tiles")
+	}
+	client, err := clientFromFlags(cmd, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	tileOptions, err := tileOptionsFromFlags(cmd, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	timeout, err := cmd.Flags().GetInt("timeout")
+	if err != nil {
+		return nil, nil, err
+	}
+	save := input != "" && !strings.EqualFold(filepath.Ext(input), ".zip")
+	if save {
+		tileOptions = append(tileOptions, wms.WithOutputDir(input))
+	}
+
+	fetch := func(tileID mercantile.TileID) ([]byte, error) {
+		tile, err := client.GetTile(context.Background(), tileID, timeout, tileOptions...)
+		if err != nil {
+			return nil, err
+		}
+		if save {
+			if err := client.SaveTile(tile); err != nil {
+				return nil, err
+			}
+		}
+		return tile.Body(), nil
+	}
+	return reader, fetch, nil
+}
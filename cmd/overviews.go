@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+
+	"github.com/schollz/progressbar/v3"
+	"github.com/spf13/cobra"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/overview"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tilestore"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/wms"
+)
+
+var buildOverviewsCmd = &cobra.Command{
+	Use:   "build-overviews",
+	Short: "Build tiles of lower zoom levels from downloaded tiles",
+	Long: `Build tiles of lower zoom levels locally, instead of requesting them from WMS server. For a
+zoom range, e.g. 10-14, tiles of the maximum zoom level found in the output directory are
+composed by four and downsampled into tiles of zoom level 13, these into tiles of zoom level
+12, and so on down to the minimum zoom level. Existing tiles of built zoom levels are
+replaced, also ones in other formats. Built tiles are saved as downloaded ones, with the same empty tiles policy and
+deduplication.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := buildOverviews(cmd); err != nil {
+			fmt.Printf("ERR: %s\n", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(buildOverviewsCmd)
+
+	// Required args/flags
+	addTileWriterFlags(buildOverviewsCmd, "Output directory of downloaded tiles, built tiles are saved in it")
+	buildOverviewsCmd.MarkFlagRequired("output")
+	buildOverviewsCmd.Flags().StringP(
+		"zoom", "z", "", "Zoom range, e.g. 10-14: tiles of the maximum zoom level are used to build the lower ones",
+	)
+	buildOverviewsCmd.MarkFlagRequired("zoom")
+
+	// Optional args/flags
+	buildOverviewsCmd.Flags().String(
+		"resampling", overview.Average.String(), "Resampling method: nearest, average, bilinear or mode (for categorical maps)",
+	)
+	buildOverviewsCmd.Flags().String(
+		"output-format", "", "Format of built tiles: png, png8, jpeg, gif, webp (lossless), mixed (JPEG or PNG for transparent tiles) or MIME type (default format of tiles of the maximum zoom level)",
+	)
+	buildOverviewsCmd.Flags().Int(
+		"quality", jpeg.DefaultQuality, "Quality (1-100) of JPEG tiles",
+	)
+	buildOverviewsCmd.Flags().String(
+		"background", "ffffff", "Colour (RRGGBB) transparent pixels are blended with in JPEG tiles, which have no alpha channel",
+	)
+	buildOverviewsCmd.Flags().Int(
+		"tile-size", 256, "Tile grid size: 256 or 512 (512px grid is displayed with zoom offset -1)",
+	)
+	buildOverviewsCmd.Flags().Int(
+		"scale", 1, "Scale of HiDPI tiles, e.g. 2 for {y}@2x tiles",
+	)
+	buildOverviewsCmd.Flags().Int(
+		"concurrency", 8, "Number of tiles built at once",
+	)
+}
+
+// buildOverviews builds tiles of zoom levels configured by flags, zoom level after zoom level.
+func buildOverviews(cmd *cobra.Command) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(output); err != nil || !info.IsDir() {
+		return fmt.Errorf("output directory not found: %s", output)
+	}
+	zoomRange, err := cmd.Flags().GetString("zoom")
+	if err != nil {
+		return err
+	}
+	minZoom, maxZoom, err := parseZoomRange(zoomRange)
+	if err != nil {
+		return err
+	}
+	offset, err := zoomOffset(cmd)
+	if err != nil {
+		return err
+	}
+	if minZoom += offset; minZoom < 0 {
+		return fmt.Errorf("invalid zoom range: %q", zoomRange)
+	}
+	maxZoom += offset
+	resamplingName, err := cmd.Flags().GetString("resampling")
+	if err != nil {
+		return err
+	}
+	resampling, err := overview.ParseResampling(resamplingName)
+	if err != nil {
+		return err
+	}
+	tileSize, err := cmd.Flags().GetInt("tile-size")
+	if err != nil {
+		return err
+	}
+	scale, err := cmd.Flags().GetInt("scale")
+	if err != nil {
+		return err
+	}
+	if scale < 1 {
+		return fmt.Errorf("invalid scale: %d", scale)
+	}
+	outputFormat, err := cmd.Flags().GetString("output-format")
+	if err != nil {
+		return err
+	}
+	if outputFormat == "" {
+		if outputFormat, err = tilesFormat(output, maxZoom, scale); err != nil {
+			return err
+		}
+	}
+	format, err := imaging.ParseFormat(outputFormat)
+	if err != nil {
+		return err
+	}
+	quality, err := cmd.Flags().GetInt("quality")
+	if err != nil {
+		return err
+	}
+	if quality < 1 || quality > 100 {
+		return fmt.Errorf("invalid quality: %d (use 1-100)", quality)
+	}
+	background, err := backgroundFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	concurrency, err := cmd.Flags().GetInt("concurrency")
+	if err != nil {
+		return err
+	}
+	writer, err := tileWriterFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	writer.replace = true
+	tileOptions := []wms.TileOption{
+		wms.WithOutputDir(output),
+		wms.WithWidth(tileSize),
+		wms.WithHeight(tileSize),
+		wms.WithScale(scale),
+		wms.WithOutputFormat(format, imaging.WithQuality(quality), imaging.WithBackground(background)),
+	}
+
+	sem := make(chan bool, max(concurrency, 1))
+	for z := maxZoom - 1; z >= minZoom; z-- {
+		// The store is opened for every zoom level, to read tiles built on the previous one
+		// (and listed in the index of deduplicated blobs).
+		reader, err := tilestore.Open(output, tilestore.WithScale(scale))
+		if err != nil {
+			return err
+		}
+		children, err := reader.Tiles(z + 1)
+		if err != nil {
+			reader.Close()
+			return err
+		}
+		parents := mercantile.Unique(parentTiles(children))
+		bar := progressbar.Default(int64(len(parents)), fmt.Sprintf("zoom %d", z))
+
+		for _, parent := range parents {
+			sem <- true
+			go func(parent mercantile.TileID) {
+				defer func() { bar.Add(1); <-sem }()
+
+				img, err := buildOverviewTile(reader, parent, tileSize*scale, resampling)
+				if err != nil {
+					writer.fail(err)
+					return
+				}
+				tile := wms.NewTile(parent, tileOptions...)
+				if err := tile.SetImage(img); err != nil {
+					writer.fail(err)
+					return
+				}
+				writer.save(tile)
+			}(parent)
+		}
+		// Tiles of the zoom level are saved before the next one is built.
+		for i := 0; i < cap(sem); i++ {
+			sem <- true
+		}
+		for i := 0; i < cap(sem); i++ {
+			<-sem
+		}
+		reader.Close()
+	}
+	writer.close(cmd.OutOrStdout())
+	return nil
+}
+
+// tilesFormat returns format of the first tile of the zoom level in the output directory,
+// PNG when there are no tiles.
+func tilesFormat(output string, zoom, scale int) (string, error) {
+	reader, err := tilestore.Open(output, tilestore.WithScale(scale))
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	tiles, err := reader.Tiles(zoom)
+	if err != nil {
+		return "", err
+	}
+	if len(tiles) == 0 {
+		return imaging.PNG, nil
+	}
+	body, err := reader.ReadTile(tiles[0])
+	if err != nil {
+		return "", err
+	}
+	_, format, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("error reading tile %v: %w", tiles[0], err)
+	}
+	return format, nil
+}
+
+// parentTiles returns parents of tiles, one per tile.
+func parentTiles(tiles []mercantile.TileID) []mercantile.TileID {
+	parents := make([]mercantile.TileID, 0, len(tiles))
+	for _, tile := range tiles {
+		parents = append(parents, mercantile.TileID{X: tile.X / 2, Y: tile.Y / 2, Z: tile.Z - 1})
+	}
+	return parents
+}
+
+// buildOverviewTile downsamples four children of the tile read from the store, missing
+// children are transparent.
+func buildOverviewTile(reader tilestore.Reader, tile mercantile.TileID, size int, resampling overview.Resampling) (image.Image, error) {
+	var children [4]image.Image
+	for i := range children {
+		child := mercantile.TileID{X: 2*tile.X + i%2, Y: 2*tile.Y + i/2, Z: tile.Z + 1}
+		body, err := reader.ReadTile(child)
+		if errors.Is(err, tilestore.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if children[i], err = imaging.Decode(body); err != nil {
+			return nil, fmt.Errorf("error reading tile %v: %w", child, err)
+		}
+	}
+	img, err := overview.Build(children, size, resampling)
+	if err != nil {
+		return nil, fmt.Errorf("error building tile %v: %w", tile, err)
+	}
+	return img, nil
+}
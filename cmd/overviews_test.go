@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/wms"
+)
+
+func TestTilesFormat(t *testing.T) {
+	dir := t.TempDir()
+	w := &tileWriter{policy: emptyOff}
+	tile := testTile(t, dir, mercantile.TileID{X: 1, Y: 0, Z: 1}, color.NRGBA{R: 255, A: 255}, wms.WithOutputFormat(imaging.JPEG))
+	assert.False(t, w.save(tile))
+
+	tests := map[string]struct {
+		Zoom           int
+		ExpectedFormat string
+	}{
+		"downloaded tiles": {Zoom: 1, ExpectedFormat: "jpeg"},
+		"no tiles":         {Zoom: 2, ExpectedFormat: imaging.PNG},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			format, err := tilesFormat(dir, test.Zoom, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, test.ExpectedFormat, format)
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/atomicfile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/overview"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tilestore"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tms"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/wms"
+)
+
+// overzoomName is the name of the file listing tiles synthesised from their ancestors, in
+// z/x/y format.
+const overzoomName = "overzoomed-tiles.txt"
+
+// overzoomer synthesises tiles deeper than the maximum zoom level served by the server, by
+// cropping and upscaling their nearest ancestors (from the maximum zoom level up) saved in
+// the output directory, and lists them in the overzoomed tiles list.
+type overzoomer struct {
+	maxZoom    int
+	resampling overview.Resampling
+	output     string
+	scale      int
+
+	mu sync.Mutex
+	// empty are empty tiles downloaded in this run.
+	empty map[mercantile.TileID]bool
+
+	synthesised atomic.Int64
+}
+
+// overzoomerFromFlags returns overzoomer configured by download flags, or nil when overzoom
+// is disabled.
+func overzoomerFromFlags(cmd *cobra.Command, matrixSet *tms.TileMatrixSet) (*overzoomer, error) {
+	if !cmd.Flags().Changed("overzoom") {
+		return nil, nil
+	}
+	maxZoom, err := cmd.Flags().GetInt("overzoom")
+	if err != nil {
+		return nil, err
+	}
+	offset, err := zoomOffset(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if maxZoom += offset; maxZoom < 0 {
+		return nil, fmt.Errorf("invalid overzoom: %d", maxZoom-offset)
+	}
+	name, err := cmd.Flags().GetString("overzoom-resampling")
+	if err != nil {
+		return nil, err
+	}
+	resampling, err := overview.ParseResampling(name)
+	if err != nil {
+		return nil, err
+	}
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return nil, err
+	}
+	scale, err := cmd.Flags().GetInt("scale")
+	if err != nil {
+		return nil, err
+	}
+	// Ancestors of tiles are known only in quadtree grid.
+	if matrixSet != nil {
+		return nil, errors.New("overzoom is supported only on Web Mercator grid")
+	}
+
+	return &overzoomer{
+		maxZoom: maxZoom, resampling: resampling, output: output, scale: scale, empty: map[mercantile.TileID]bool{},
+	}, nil
+}
+
+// addEmpty records empty tile, so that ancestors of synthesised tiles found empty are not
+// requested again as missing ones, nor skipped for their coarser ancestors.
+func (o *overzoomer) addEmpty(tile mercantile.TileID) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.empty[tile] = true
+}
+
+// requested returns tiles requested from the server, up to its maximum zoom level.
+func (o *overzoomer) requested(tiles iter.Seq[mercantile.TileID]) iter.Seq[mercantile.TileID] {
+	return func(yield func(mercantile.TileID) bool) {
+		for tile := range tiles {
+			if tile.Z <= o.maxZoom && !yield(tile) {
+				return
+			}
+		}
+	}
+}
+
+// deeper returns tiles synthesised from their ancestors, deeper than the maximum zoom level.
+func (o *overzoomer) deeper(tiles iter.Seq[mercantile.TileID]) iter.Seq[mercantile.TileID] {
+	return func(yield func(mercantile.TileID) bool) {
+		for tile := range tiles {
+			if tile.Z > o.maxZoom && !yield(tile) {
+				return
+			}
+		}
+	}
+}
+
+// missingAncestors returns ancestors of tiles on the maximum zoom level, which are not saved
+// in the output directory yet. Ancestors found empty in this run are not missing.
+func (o *overzoomer) missingAncestors(tiles iter.Seq[mercantile.TileID]) ([]mercantile.TileID, error) {
+	// Ancestors are known when saved or empty.
+	o.mu.Lock()
+	known := maps.Clone(o.empty)
+	o.mu.Unlock()
+	if _, err := os.Stat(o.output); err == nil {
+		reader, err := tilestore.Open(o.output, tilestore.WithScale(o.scale))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		savedTiles, err := reader.Tiles(o.maxZoom)
+		if err != nil {
+			return nil, err
+		}
+		for _, tile := range savedTiles {
+			known[tile] = true
+		}
+	}
+
+	var missing []mercantile.TileID
+	for tile := range tiles {
+		ancestor, err := mercantile.Parent(tile, o.maxZoom)
+		if err != nil {
+			return nil, err
+		}
+		if !known[ancestor] {
+			known[ancestor] = true
+			missing = append(missing, ancestor)
+		}
+	}
+	return missing, nil
+}
+
+// fill sets image of the tile synthesised from its nearest ancestor read from the store,
+// starting on the maximum zoom level. It reports whether such ancestor is saved: ancestors
+// not saved are skipped (e.g. ones the server failed on), unless they were found empty in
+// this run, as then there is no data for their descendants.
+func (o *overzoomer) fill(reader tilestore.Reader, tile *wms.Tile) (bool, error) {
+	tileID := mercantile.TileID{X: tile.X(), Y: tile.Y(), Z: tile.Z()}
+	for z := o.maxZoom; z >= 0; z-- {
+		ancestor, err := mercantile.Parent(tileID, z)
+		if err != nil {
+			return false, err
+		}
+		body, err := reader.ReadTile(ancestor)
+		if errors.Is(err, tilestore.ErrNotFound) {
+			o.mu.Lock()
+			empty := o.empty[ancestor]
+			o.mu.Unlock()
+			if empty {
+				return false, nil
+			}
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		img, err := imaging.Decode(body)
+		if err != nil {
+			return false, fmt.Errorf("error reading tile %v: %w", ancestor, err)
+		}
+		dz := tileID.Z - z
+		mask := 1<<dz - 1
+		overzoomed, err := overview.Overzoom(img, dz, tileID.X&mask, tileID.Y&mask, o.resampling)
+		if err != nil {
+			return false, fmt.Errorf("error overzooming tile %v: %w", ancestor, err)
+		}
+		return true, tile.SetImage(overzoomed)
+	}
+	return false, nil
+}
+
+// record adds the synthesised tile to the list of overzoomed tiles of the writer.
+func (o *overzoomer) record(writer *tileWriter, tile *wms.Tile) {
+	o.synthesised.Add(1)
+	if writer.overzoomed != nil {
+		writer.overzoomed.add(mercantile.TileID{X: tile.X(), Y: tile.Y(), Z: tile.Z()})
+	}
+}
+
+// close writes the number of synthesised tiles.
+func (o *overzoomer) close(out io.Writer) {
+	fmt.Fprintf(out, "Overzoomed: %d (listed in %s)\n", o.synthesised.Load(), overzoomName)
+}
+
+// overzoomList lists tiles synthesised from their ancestors in the output directory, kept
+// across runs: tiles synthesised in this run are added, tiles written otherwise (e.g.
+// downloaded from a server serving deeper zoom levels) are removed.
+type overzoomList struct {
+	name string
+
+	mu      sync.Mutex
+	tiles   map[mercantile.TileID]bool
+	changed bool
+}
+
+// readOverzoomList reads the list of overzoomed tiles in the output directory, empty when
+// there is none.
+func readOverzoomList(output string) (*overzoomList, error) {
+	l := &overzoomList{name: path.Join(output, overzoomName), tiles: map[mercantile.TileID]bool{}}
+	f, err := os.Open(l.name)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tiles, err := mercantile.ReadTileList(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", l.name, err)
+	}
+	for _, tile := range tiles {
+		l.tiles[tile] = true
+	}
+	return l, nil
+}
+
+// add adds the synthesised tile to the list.
+func (l *overzoomList) add(tile mercantile.TileID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.tiles[tile] {
+		l.tiles[tile] = true
+		l.changed = true
+	}
+}
+
+// remove removes the tile written otherwise than synthesised from the list.
+func (l *overzoomList) remove(tile mercantile.TileID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tiles[tile] {
+		delete(l.tiles, tile)
+		l.changed = true
+	}
+}
+
+// write replaces the list file with tiles sorted by zoom level, the file is removed when no
+// tiles are left.
+func (l *overzoomList) write() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.changed {
+		return nil
+	}
+	if len(l.tiles) == 0 {
+		if err := os.Remove(l.name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	tiles := slices.SortedFunc(maps.Keys(l.tiles), func(a, b mercantile.TileID) int {
+		return cmp.Or(cmp.Compare(a.Z, b.Z), cmp.Compare(a.X, b.X), cmp.Compare(a.Y, b.Y))
+	})
+	var body bytes.Buffer
+	for _, tile := range tiles {
+		fmt.Fprintf(&body, "%d/%d/%d\n", tile.Z, tile.X, tile.Y)
+	}
+	if err := os.MkdirAll(path.Dir(l.name), os.ModePerm); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(l.name, body.Bytes())
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/overview"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tilestore"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/wms"
+)
+
+func TestOverzoomer_Fill(t *testing.T) {
+	dir := t.TempDir()
+	w := &tileWriter{policy: emptyOff}
+	// Tile on the maximum zoom level and the parent of an ancestor which is not saved (e.g.
+	// the server failed on it) and of an empty one.
+	assert.False(t, w.save(testTile(t, dir, mercantile.TileID{X: 0, Y: 0, Z: 2}, color.NRGBA{R: 255, A: 255})))
+	assert.False(t, w.save(testTile(t, dir, mercantile.TileID{X: 1, Y: 0, Z: 1}, color.NRGBA{G: 255, A: 255})))
+	reader, err := tilestore.Open(dir)
+	assert.NoError(t, err)
+	defer reader.Close()
+	o := &overzoomer{maxZoom: 2, resampling: overview.Nearest, output: dir, scale: 1, empty: map[mercantile.TileID]bool{}}
+	o.addEmpty(mercantile.TileID{X: 2, Y: 0, Z: 2})
+
+	tests := map[string]struct {
+		Tile          mercantile.TileID
+		ExpectedFound bool
+		ExpectedColor color.Color
+	}{
+		"saved ancestor":    {Tile: mercantile.TileID{X: 1, Y: 1, Z: 4}, ExpectedFound: true, ExpectedColor: color.RGBA{R: 255, A: 255}},
+		"coarser ancestor":  {Tile: mercantile.TileID{X: 6, Y: 1, Z: 3}, ExpectedFound: true, ExpectedColor: color.RGBA{G: 255, A: 255}},
+		"no ancestor saved": {Tile: mercantile.TileID{X: 0, Y: 12, Z: 4}},
+		"empty ancestor":    {Tile: mercantile.TileID{X: 5, Y: 1, Z: 3}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tile := wms.NewTile(test.Tile, wms.WithOutputDir(dir))
+			found, err := o.fill(reader, tile)
+			assert.NoError(t, err)
+			assert.Equal(t, test.ExpectedFound, found)
+			if !test.ExpectedFound {
+				assert.Empty(t, tile.Body())
+				return
+			}
+			// The tile is cropped from the ancestor part without its black corner pixel.
+			uniform, err := tile.IsEmpty(0)
+			assert.NoError(t, err)
+			assert.True(t, uniform)
+			img, err := imaging.Decode(tile.Body())
+			assert.NoError(t, err)
+			assert.Equal(t, test.ExpectedColor, color.RGBAModel.Convert(img.At(128, 128)))
+		})
+	}
+}
+
+func TestOverzoomer_MissingAncestors(t *testing.T) {
+	dir := t.TempDir()
+	w := &tileWriter{policy: emptyOff}
+	assert.False(t, w.save(testTile(t, dir, mercantile.TileID{X: 0, Y: 0, Z: 2}, color.NRGBA{R: 255, A: 255})))
+	o := &overzoomer{maxZoom: 2, output: dir, scale: 1, empty: map[mercantile.TileID]bool{}}
+	// Ancestors found empty are not missing.
+	o.addEmpty(mercantile.TileID{X: 1, Y: 0, Z: 2})
+
+	tiles := []mercantile.TileID{
+		{X: 0, Y: 0, Z: 3}, {X: 1, Y: 1, Z: 4}, // saved ancestor
+		{X: 2, Y: 0, Z: 3},                                         // empty ancestor
+		{X: 4, Y: 0, Z: 3}, {X: 5, Y: 1, Z: 3}, {X: 8, Y: 0, Z: 4}, // missing ancestor
+	}
+	missing, err := o.missingAncestors(slices.Values(tiles))
+	assert.NoError(t, err)
+	assert.Equal(t, []mercantile.TileID{{X: 2, Y: 0, Z: 2}}, missing)
+}
+
+func TestOverzoomList(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, overzoomName)
+	assert.NoError(t, os.WriteFile(name, []byte("3/1/1\n3/0/0\n"), 0o644))
+	list, err := readOverzoomList(dir)
+	assert.NoError(t, err)
+	w := &tileWriter{policy: emptyOff, overzoomed: list}
+	o := &overzoomer{maxZoom: 2}
+
+	// Tiles synthesised in earlier runs are kept, tiles downloaded from the server are removed.
+	o.record(w, wms.NewTile(mercantile.TileID{X: 0, Y: 0, Z: 4}))
+	o.record(w, wms.NewTile(mercantile.TileID{X: 0, Y: 0, Z: 3}))
+	assert.False(t, w.save(testTile(t, dir, mercantile.TileID{X: 1, Y: 1, Z: 3}, color.NRGBA{R: 255, A: 255})))
+	w.close(io.Discard)
+	body, err := os.ReadFile(name)
+	assert.NoError(t, err)
+	assert.Equal(t, "3/0/0\n4/0/0\n", string(body))
+
+	// The list is removed when no synthesised tiles are left.
+	list, err = readOverzoomList(dir)
+	assert.NoError(t, err)
+	w = &tileWriter{policy: emptyOff, overzoomed: list}
+	for _, id := range []mercantile.TileID{{X: 0, Y: 0, Z: 3}, {X: 0, Y: 0, Z: 4}} {
+		assert.False(t, w.save(testTile(t, dir, id, color.NRGBA{R: 255, A: 255})))
+	}
+	w.close(io.Discard)
+	_, err = os.Stat(name)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"errors"
+	"iter"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tms"
+)
+
+// pruner skips descendants of empty tiles, when tiles are downloaded zoom level after zoom
+// level. Only empty tiles on minZoom or deeper prune their descendants, as tiles of low
+// zoom levels are often generalised.
+type pruner struct {
+	minZoom int
+
+	mu    sync.Mutex
+	empty map[mercantile.TileID]bool
+}
+
+// prunerFromFlags returns pruner configured by download flags, or nil when pruning is
+// disabled.
+func prunerFromFlags(cmd *cobra.Command, matrixSet *tms.TileMatrixSet) (*pruner, error) {
+	prune, err := cmd.Flags().GetBool("prune-empty")
+	if err != nil {
+		return nil, err
+	}
+	if !prune {
+		return nil, nil
+	}
+	minZoom, err := cmd.Flags().GetInt("prune-min-zoom")
+	if err != nil {
+		return nil, err
+	}
+	policy, err := cmd.Flags().GetString("empty")
+	if err != nil {
+		return nil, err
+	}
+	if policy == emptyOff {
+		return nil, errors.New("prune-empty requires empty tiles policy (set --empty)")
+	}
+	// Children of tiles are known only in quadtree grid.
+	if matrixSet != nil {
+		return nil, errors.New("prune-empty is supported only on Web Mercator grid")
+	}
+
+	return &pruner{minZoom: minZoom, empty: map[mercantile.TileID]bool{}}, nil
+}
+
+// add records empty tile.
+func (p *pruner) add(tile mercantile.TileID) {
+	if tile.Z < p.minZoom {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.empty[tile] = true
+}
+
+// filter skips tiles with empty ancestors, calling skip for each of them.
+func (p *pruner) filter(tiles iter.Seq[mercantile.TileID], skip func(mercantile.TileID)) iter.Seq[mercantile.TileID] {
+	return func(yield func(mercantile.TileID) bool) {
+		for tile := range tiles {
+			if p.pruned(tile) {
+				skip(tile)
+				continue
+			}
+			if !yield(tile) {
+				return
+			}
+		}
+	}
+}
+
+// pruned reports whether any ancestor of the tile is empty.
+func (p *pruner) pruned(tile mercantile.TileID) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for z := tile.Z - 1; z >= p.minZoom; z-- {
+		if parent, _ := mercantile.Parent(tile, z); p.empty[parent] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+)
+
+func TestPruner(t *testing.T) {
+	p := &pruner{minZoom: 2, empty: map[mercantile.TileID]bool{}}
+	// Empty tiles above the minimum zoom level do not prune their descendants.
+	p.add(mercantile.TileID{X: 0, Y: 0, Z: 1})
+	p.add(mercantile.TileID{X: 1, Y: 1, Z: 2})
+
+	tiles := []mercantile.TileID{
+		{X: 0, Y: 0, Z: 3}, {X: 2, Y: 2, Z: 3}, {X: 3, Y: 3, Z: 3}, {X: 4, Y: 4, Z: 4}, {X: 8, Y: 0, Z: 4},
+	}
+	var skipped []mercantile.TileID
+	kept := slices.Collect(p.filter(slices.Values(tiles), func(tile mercantile.TileID) {
+		skipped = append(skipped, tile)
+	}))
+
+	assert.Equal(t, []mercantile.TileID{{X: 0, Y: 0, Z: 3}, {X: 8, Y: 0, Z: 4}}, kept)
+	assert.Equal(t, []mercantile.TileID{{X: 2, Y: 2, Z: 3}, {X: 3, Y: 3, Z: 3}, {X: 4, Y: 4, Z: 4}}, skipped)
+}
+
+func TestParseZooms(t *testing.T) {
+	tests := map[string]struct {
+		Values []string
+		Zooms  []int
+	}{
+		"Ranges":               {Values: []string{"0-2", "5"}, Zooms: []int{0, 1, 2, 5}},
+		"Descending":           {Values: []string{"14", "10"}, Zooms: []int{10, 14}},
+		"Overlapping ranges":   {Values: []string{"3-5", "1-4"}, Zooms: []int{1, 2, 3, 4, 5}},
+		"Duplicated zoom":      {Values: []string{"7", "7"}, Zooms: []int{7}},
+		"No zoom levels given": {Values: nil, Zooms: nil},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			zooms, err := parseZooms(test.Values)
+			assert.NoError(t, err)
+			assert.Equal(t, test.Zooms, zooms)
+		})
+	}
+}
+
+// testAreaCommand returns command with request and area flags set to given values.
+func testAreaCommand(t *testing.T, values map[string]string) *cobra.Command {
+	t.Helper()
+	cmd := &cobra.Command{}
+	addRequestFlags(cmd)
+	addAreaFlags(cmd)
+	cmd.Flags().StringSliceP("zoom", "z", nil, "")
+	for name, value := range values {
+		assert.NoError(t, cmd.Flags().Set(name, value))
+	}
+	return cmd
+}
+
+func TestTilesFromFlagsZoomOrder(t *testing.T) {
+	tilesFile := filepath.Join(t.TempDir(), "tiles.txt")
+	assert.NoError(t, os.WriteFile(tilesFile, []byte("3/4/2\n1/0/0\n3/5/3\n"), 0o644))
+
+	tests := map[string]struct {
+		Flags map[string]string
+		Zooms []int
+	}{
+		"Descending zoom levels": {
+			Flags: map[string]string{"bbox": "20,50,21,51", "zoom": "6,4,5"},
+			Zooms: []int{4, 5, 6},
+		},
+		"Extents": {
+			Flags: map[string]string{"bbox": "20,50,21,51", "zoom": "2-6", "zoom-bbox": "3-4:20,50,20.5,50.5"},
+			Zooms: []int{2, 3, 4, 5, 6},
+		},
+		"Antimeridian": {
+			Flags: map[string]string{"bbox": "170,-10,-170,10", "zoom": "0-3"},
+			Zooms: []int{0, 1, 2, 3},
+		},
+		"Tiles file": {
+			Flags: map[string]string{"tiles-file": tilesFile},
+			Zooms: []int{1, 3},
+		},
+		"Tiles file with cascade": {
+			Flags: map[string]string{"tiles-file": tilesFile, "cascade": "0-4"},
+			Zooms: []int{0, 1, 2, 3, 4},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tileIDs, _, _, err := tilesFromFlags(testAreaCommand(t, test.Flags))
+			assert.NoError(t, err)
+			// Every zoom level is enumerated once, from the lowest one.
+			var zooms []int
+			for level := range mercantile.ZoomLevels(tileIDs) {
+				for tile := range level {
+					zooms = append(zooms, tile.Z)
+					break
+				}
+			}
+			assert.Equal(t, test.Zooms, zooms)
+		})
+	}
+}
+
+func TestTilesFromFlagsOverlappingExtents(t *testing.T) {
+	tests := map[string]struct {
+		Flags      map[string]string
+		ZoomBBoxes []string
+		Zooms      int
+	}{
+		"Extents": {
+			Flags:      map[string]string{"bbox": "20,50,21,51", "zoom": "6-10"},
+			ZoomBBoxes: []string{"7-9:20,50,20.6,50.6", "8-10:20.4,50.4,21,51"},
+			Zooms:      5,
+		},
+		"Antimeridian": {
+			Flags:      map[string]string{"zoom": "0-1"},
+			ZoomBBoxes: []string{"0-1:170,-10,-170,10", "0-1:-175,-5,-172,5"},
+			Zooms:      2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmd := testAreaCommand(t, test.Flags)
+			for _, value := range test.ZoomBBoxes {
+				assert.NoError(t, cmd.Flags().Set("zoom-bbox", value))
+			}
+
+			tileIDs, counts, _, err := tilesFromFlags(cmd)
+			assert.NoError(t, err)
+			// Tiles of zoom levels shared by extents are enumerated and counted without
+			// duplicates.
+			seen := map[mercantile.TileID]bool{}
+			enumerated := map[int]int{}
+			for tile := range tileIDs {
+				assert.False(t, seen[tile], tile)
+				seen[tile] = true
+				enumerated[tile.Z]++
+			}
+			assert.Equal(t, enumerated, counts)
+			assert.Len(t, counts, test.Zooms)
+		})
+	}
+}
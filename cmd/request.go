@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"fmt"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tms"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/warp"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/wms"
+)
+
+// addRequestFlags registers flags describing requests sent to WMS server.
+func addRequestFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP(
+		"url", "u", "", "WMS server url",
+	)
+	cmd.Flags().StringP(
+		"layer", "l", "", "Layer name",
+	)
+	cmd.Flags().StringP(
+		"style", "s", "", "Layer style",
+	)
+	cmd.Flags().Int(
+		"width", 256, "Tile width",
+	)
+	cmd.Flags().Int(
+		"height", 256, "Tile height",
+	)
+	cmd.Flags().String(
+		"format", "image/png", "Tile format",
+	)
+	cmd.Flags().String(
+		"output-format", "", "Transcode tiles to this format: png, png8, jpeg, gif, webp (lossless), mixed (JPEG or PNG for transparent tiles) or MIME type (default requested format)",
+	)
+	cmd.Flags().Int(
+		"quality", jpeg.DefaultQuality, "Quality (1-100) of transcoded JPEG tiles",
+	)
+	cmd.Flags().String(
+		"background", "ffffff", "Colour (RRGGBB) transparent pixels are blended with in JPEG tiles, which have no alpha channel",
+	)
+	cmd.Flags().Bool(
+		"recompress", false, "Re-encode PNG tiles with the best compression",
+	)
+	cmd.Flags().Bool(
+		"strip-metadata", false, "Re-encode tiles to drop metadata of images served by the server",
+	)
+	cmd.Flags().Int(
+		"tile-size", 256, "Tile grid size: 256 or 512 (512px grid is displayed with zoom offset -1)",
+	)
+	cmd.Flags().Int(
+		"scale", 1, "Scale of HiDPI tiles, e.g. 2 for {y}@2x tiles of double size rendered at double DPI",
+	)
+	cmd.Flags().String(
+		"dpi-mode", wms.DPIModeAll, "Vendor params requesting scaled DPI: all, geoserver, mapserver, qgis or off",
+	)
+	cmd.Flags().Int(
+		"buffer-px", 0, "Gutter (in pixels) rendered around each tile or metatile and cropped before saving",
+	)
+	cmd.Flags().String(
+		"version", "1.3.0", "WMS server version",
+	)
+	cmd.Flags().IntP(
+		"timeout", "t", 10000, "HTTP request timeout (in milliseconds)",
+	)
+	cmd.Flags().Int(
+		"concurrency", 16, "Limit of concurrent requests to the WMS server",
+	)
+	cmd.Flags().Float64(
+		"rate-limit", 0, "Limit of requests per second sent to the WMS server (0 for no limit)",
+	)
+	cmd.Flags().IntSlice(
+		"no-data-status", nil, "HTTP status codes of responses without data (e.g. 204,404), counted as empty tiles instead of errors",
+	)
+	cmd.Flags().StringToString(
+		"params", nil, "Custom query string params",
+	)
+	cmd.Flags().String(
+		"source-crs", "", "Request images in this CRS (e.g. EPSG:2180) and reproject them locally into tiles",
+	)
+	cmd.Flags().String(
+		"resampling", "bilinear", "Resampling method used for reprojection (nearest, bilinear)",
+	)
+	cmd.Flags().Int(
+		"reprojection-margin", 8, "Margin (in pixels) of source images requested for reprojection",
+	)
+	cmd.Flags().String(
+		"auth", "", "Basic HTTP auth credentials separated by semicolon (username:password)",
+	)
+}
+
+// requireRequestFlags marks flags of WMS server and layer as required.
+func requireRequestFlags(cmd *cobra.Command) {
+	cmd.MarkFlagRequired("url")
+	cmd.MarkFlagRequired("layer")
+}
+
+// clientFromFlags returns WMS client configured by request flags. CRS of requests
+// follows the tile matrix set, if any. Additional options are applied last.
+func clientFromFlags(cmd *cobra.Command, matrixSet *tms.TileMatrixSet, options ...wms.ClientOption) (*wms.Client, error) {
+	url, err := cmd.Flags().GetString("url")
+	if err != nil {
+		return nil, err
+	}
+	params, err := cmd.Flags().GetStringToString("params")
+	if err != nil {
+		return nil, err
+	}
+	version, err := cmd.Flags().GetString("version")
+	if err != nil {
+		return nil, err
+	}
+	auth, err := cmd.Flags().GetString("auth")
+	if err != nil {
+		return nil, err
+	}
+	rateLimit, err := cmd.Flags().GetFloat64("rate-limit")
+	if err != nil {
+		return nil, err
+	}
+	noDataStatus, err := cmd.Flags().GetIntSlice("no-data-status")
+	if err != nil {
+		return nil, err
+	}
+	clientOptions := []wms.ClientOption{
+		wms.WithBasicAuth(auth), wms.WithQueryString(params), wms.WithVersion(version), wms.WithRateLimit(rateLimit),
+		wms.WithNoDataStatus(noDataStatus...),
+	}
+	if matrixSet != nil {
+		clientOptions = append(clientOptions, wms.WithCRS(matrixSet.CRS()))
+	}
+	// Servers without support for CRS of the grid are asked for images in their
+	// own CRS, which are then warped locally.
+	sourceCRS, err := cmd.Flags().GetString("source-crs")
+	if err != nil {
+		return nil, err
+	}
+	if sourceCRS != "" {
+		resamplingName, err := cmd.Flags().GetString("resampling")
+		if err != nil {
+			return nil, err
+		}
+		resampling, err := warp.ParseResampling(resamplingName)
+		if err != nil {
+			return nil, err
+		}
+		margin, err := cmd.Flags().GetInt("reprojection-margin")
+		if err != nil {
+			return nil, err
+		}
+		clientOptions = append(
+			clientOptions, wms.WithCRS(sourceCRS), wms.WithReprojection(resampling, margin),
+		)
+	}
+
+	return wms.NewClient(url, append(clientOptions, options...)...)
+}
+
+// tileOptionsFromFlags returns options of requested tiles configured by request flags.
+func tileOptionsFromFlags(cmd *cobra.Command, matrixSet *tms.TileMatrixSet) ([]wms.TileOption, error) {
+	layer, err := cmd.Flags().GetString("layer")
+	if err != nil {
+		return nil, err
+	}
+	style, err := cmd.Flags().GetString("style")
+	if err != nil {
+		return nil, err
+	}
+	width, err := cmd.Flags().GetInt("width")
+	if err != nil {
+		return nil, err
+	}
+	height, err := cmd.Flags().GetInt("height")
+	if err != nil {
+		return nil, err
+	}
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return nil, err
+	}
+	gutter, err := cmd.Flags().GetInt("buffer-px")
+	if err != nil {
+		return nil, err
+	}
+	tileSize, err := cmd.Flags().GetInt("tile-size")
+	if err != nil {
+		return nil, err
+	}
+	scale, err := cmd.Flags().GetInt("scale")
+	if err != nil {
+		return nil, err
+	}
+	if scale < 1 {
+		return nil, fmt.Errorf("invalid scale: %d", scale)
+	}
+	dpiMode, err := cmd.Flags().GetString("dpi-mode")
+	if err != nil {
+		return nil, err
+	}
+	switch dpiMode {
+	case wms.DPIModeAll, wms.DPIModeOff, wms.DPIModeGeoServer, wms.DPIModeMapServer, wms.DPIModeQGIS:
+	default:
+		return nil, fmt.Errorf("unsupported DPI mode: %s", dpiMode)
+	}
+	transcodeOption, err := transcodeOptionFromFlags(cmd, format)
+	if err != nil {
+		return nil, err
+	}
+	// Tiles of 512px grid are 512px wide, unless the size is given explicitly.
+	if tileSize == 512 {
+		if !cmd.Flags().Changed("width") {
+			width = 512
+		}
+		if !cmd.Flags().Changed("height") {
+			height = 512
+		}
+	}
+	tileOptions := []wms.TileOption{
+		wms.WithLayers(layer),
+		wms.WithStyles(style),
+		wms.WithFormat(format),
+		wms.WithGutter(gutter),
+	}
+	if matrixSet != nil {
+		tileOptions = append(tileOptions, wms.WithTileMatrixSet(matrixSet))
+	}
+	// Tile size defaults to the size defined by tile matrix set, if any.
+	if matrixSet == nil || cmd.Flags().Changed("width") {
+		tileOptions = append(tileOptions, wms.WithWidth(width))
+	}
+	if matrixSet == nil || cmd.Flags().Changed("height") {
+		tileOptions = append(tileOptions, wms.WithHeight(height))
+	}
+	// Scale multiplies tile size, so it goes after options setting the size.
+	tileOptions = append(tileOptions, wms.WithScale(scale), wms.WithDPIMode(dpiMode))
+	if transcodeOption != nil {
+		tileOptions = append(tileOptions, transcodeOption)
+	}
+
+	return tileOptions, nil
+}
+
+// transcodeOptionFromFlags returns option transcoding downloaded tiles configured by flags, or
+// nil when tiles are saved as served. Recompressing and stripping metadata re-encode tiles
+// in the requested format, unless output format is given.
+func transcodeOptionFromFlags(cmd *cobra.Command, requestFormat string) (wms.TileOption, error) {
+	outputFormat, err := cmd.Flags().GetString("output-format")
+	if err != nil {
+		return nil, err
+	}
+	quality, err := cmd.Flags().GetInt("quality")
+	if err != nil {
+		return nil, err
+	}
+	if quality < 1 || quality > 100 {
+		return nil, fmt.Errorf("invalid quality: %d (use 1-100)", quality)
+	}
+	recompress, err := cmd.Flags().GetBool("recompress")
+	if err != nil {
+		return nil, err
+	}
+	strip, err := cmd.Flags().GetBool("strip-metadata")
+	if err != nil {
+		return nil, err
+	}
+	if outputFormat == "" {
+		if !recompress && !strip {
+			return nil, nil
+		}
+		outputFormat = requestFormat
+	}
+	format, err := imaging.ParseFormat(outputFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	background, err := backgroundFromFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []imaging.EncodeOption{imaging.WithQuality(quality), imaging.WithBackground(background)}
+	if recompress {
+		options = append(options, imaging.WithCompression(png.BestCompression))
+	}
+	return wms.WithOutputFormat(format, options...), nil
+}
+
+// backgroundFromFlags returns colour of the background of JPEG images.
+func backgroundFromFlags(cmd *cobra.Command) (color.Color, error) {
+	background, err := cmd.Flags().GetString("background")
+	if err != nil {
+		return nil, err
+	}
+	return imaging.ParseColor(background)
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/accesslog"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+)
+
+var seedFromLogsCmd = &cobra.Command{
+	Use:   "seed-from-logs [log files]",
+	Short: "Download tiles requested in access logs",
+	Long: `Download the most requested tiles found in web server access logs (combined log format
+of nginx and Apache by default). Logs are read from given files (gzipped ones are decompressed)
+or from stdin. Tiles are downloaded from the most requested ones.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		parser, err := parserFromFlags(cmd)
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+			return
+		}
+
+		hits := accesslog.Hits{}
+		if len(args) == 0 {
+			args = []string{"-"}
+		}
+		for _, name := range args {
+			if err := readAccessLog(cmd, parser, name, hits); err != nil {
+				fmt.Printf("ERR: %s\n", err)
+				return
+			}
+		}
+
+		top, err := cmd.Flags().GetInt("top")
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+		}
+		minHits, err := cmd.Flags().GetInt("min-hits")
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+		}
+		tiles := hits.Top(top, minHits)
+		// Empty tiles prune their descendants and tiles are grouped into metatiles only when
+		// tiles are given zoom level after zoom level. Then the most requested tiles are
+		// downloaded first within each zoom level.
+		prune, err := cmd.Flags().GetBool("prune-empty")
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+		}
+		metatile, err := cmd.Flags().GetInt("metatile")
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+		}
+		if prune || metatile > 1 {
+			slices.SortStableFunc(tiles, func(a, b accesslog.TileHits) int { return a.Tile.Z - b.Tile.Z })
+		}
+		tileIDs := func(yield func(mercantile.TileID) bool) {
+			for _, tile := range tiles {
+				if !yield(tile.Tile) {
+					return
+				}
+			}
+		}
+
+		downloadTiles(cmd, tileIDs, countTiles(tileIDs), nil)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(seedFromLogsCmd)
+
+	// Required args/flags
+	addRequestFlags(seedFromLogsCmd)
+	requireRequestFlags(seedFromLogsCmd)
+
+	// Optional args/flags
+	seedFromLogsCmd.Flags().String(
+		"log-format", "combined", "Log format: combined or regular expression with path (and time) groups",
+	)
+	seedFromLogsCmd.Flags().String(
+		"time-layout", accesslog.CombinedTimeLayout, "Layout of time in logs (Go time layout)",
+	)
+	seedFromLogsCmd.Flags().String(
+		"tile-pattern", accesslog.TilePattern.String(), "Regular expression matching tile paths with z, x and y groups",
+	)
+	seedFromLogsCmd.Flags().String(
+		"since", "", "Use only requests made since given time (RFC 3339) or duration ago, e.g. 24h",
+	)
+	seedFromLogsCmd.Flags().String(
+		"until", "", "Use only requests made before given time (RFC 3339) or duration ago, e.g. 1h",
+	)
+	seedFromLogsCmd.Flags().Int(
+		"top", 0, "Download only given number of the most requested tiles (0 for all)",
+	)
+	seedFromLogsCmd.Flags().Int(
+		"min-hits", 1, "Download only tiles requested at least given number of times",
+	)
+	addDownloadFlags(seedFromLogsCmd)
+}
+
+// parserFromFlags returns access log parser configured by flags.
+func parserFromFlags(cmd *cobra.Command) (*accesslog.Parser, error) {
+	logFormat, err := cmd.Flags().GetString("log-format")
+	if err != nil {
+		return nil, err
+	}
+	timeLayout, err := cmd.Flags().GetString("time-layout")
+	if err != nil {
+		return nil, err
+	}
+	tilePattern, err := cmd.Flags().GetString("tile-pattern")
+	if err != nil {
+		return nil, err
+	}
+	sinceFlag, err := cmd.Flags().GetString("since")
+	if err != nil {
+		return nil, err
+	}
+	untilFlag, err := cmd.Flags().GetString("until")
+	if err != nil {
+		return nil, err
+	}
+
+	var options []accesslog.ParserOption
+	if logFormat != "combined" {
+		format, err := regexp.Compile(logFormat)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log format: %w", err)
+		}
+		options = append(options, accesslog.WithFormat(format, timeLayout))
+	}
+	pattern, err := regexp.Compile(tilePattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tile pattern: %w", err)
+	}
+	options = append(options, accesslog.WithTilePattern(pattern))
+
+	now := time.Now()
+	since, err := parseTimeFlag(sinceFlag, now)
+	if err != nil {
+		return nil, err
+	}
+	until, err := parseTimeFlag(untilFlag, now)
+	if err != nil {
+		return nil, err
+	}
+	options = append(options, accesslog.WithTimeRange(since, until))
+
+	return accesslog.NewParser(options...)
+}
+
+// parseTimeFlag parses time given either in RFC 3339 format or as duration before now.
+// Empty value gives zero time.
+func parseTimeFlag(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time: %q (use RFC 3339 time or duration, e.g. 24h)", value)
+	}
+	return now.Add(-d), nil
+}
+
+// readAccessLog counts tile requests of access log file (- for stdin), gzipped files are
+// decompressed.
+func readAccessLog(cmd *cobra.Command, parser *accesslog.Parser, name string, hits accesslog.Hits) error {
+	var r io.Reader = cmd.InOrStdin()
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", name, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return parser.Read(r, hits)
+}
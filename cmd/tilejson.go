@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/atomicfile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/wms"
+)
+
+// tileJSONName is the name of TileJSON metadata of tiles saved in the output directory.
+const tileJSONName = "tilejson.json"
+
+// tileSet collects zoom levels and bounds of saved tiles, written as TileJSON metadata with
+// URL template of tiles under the base URL.
+type tileSet struct {
+	url    string
+	output string
+	// mixed is set when tiles are stored in mixed format: extension of each tile is either
+	// .jpg or .png, so the URL template has none and the tile server has to resolve it
+	// (e.g. nginx with try_files).
+	mixed bool
+
+	mu     sync.Mutex
+	suffix string
+	tiles  int
+	zooms  [2]int
+	bounds mercantile.LngLatBbox
+}
+
+// add adds the saved tile to the tile set.
+func (s *tileSet) add(tile *wms.Tile) {
+	bounds := mercantile.Bounds(mercantile.TileID{X: tile.X(), Y: tile.Y(), Z: tile.Z()})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tiles == 0 {
+		// Name of tile, e.g. 5@2x.png, is its row followed by suffix of all tiles.
+		s.suffix = strings.TrimPrefix(tile.Name(), strconv.Itoa(tile.Y()))
+		if s.mixed {
+			s.suffix = strings.TrimSuffix(s.suffix, path.Ext(s.suffix))
+		}
+		s.zooms = [2]int{tile.Z(), tile.Z()}
+		s.bounds = bounds
+	}
+	s.tiles++
+	s.zooms = [2]int{min(s.zooms[0], tile.Z()), max(s.zooms[1], tile.Z())}
+	s.bounds = mercantile.LngLatBbox{
+		West:  min(s.bounds.West, bounds.West),
+		South: min(s.bounds.South, bounds.South),
+		East:  max(s.bounds.East, bounds.East),
+		North: max(s.bounds.North, bounds.North),
+	}
+}
+
+// write writes TileJSON of the tile set. Zoom levels and bounds of TileJSON written by
+// previous runs are extended, other fields (e.g. attribution) are kept.
+func (s *tileSet) write() error {
+	if s.tiles == 0 {
+		return nil
+	}
+	name := path.Join(s.output, tileJSONName)
+	doc := map[string]any{}
+	body, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var previous struct {
+			MinZoom *int      `json:"minzoom"`
+			MaxZoom *int      `json:"maxzoom"`
+			Bounds  []float64 `json:"bounds"`
+		}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return fmt.Errorf("error reading %s: %w", name, err)
+		}
+		if err := json.Unmarshal(body, &previous); err != nil {
+			return fmt.Errorf("error reading %s: %w", name, err)
+		}
+		if previous.MinZoom != nil && previous.MaxZoom != nil {
+			s.zooms = [2]int{min(s.zooms[0], *previous.MinZoom), max(s.zooms[1], *previous.MaxZoom)}
+		}
+		if b := previous.Bounds; len(b) == 4 {
+			s.bounds = mercantile.LngLatBbox{
+				West:  min(s.bounds.West, b[0]),
+				South: min(s.bounds.South, b[1]),
+				East:  max(s.bounds.East, b[2]),
+				North: max(s.bounds.North, b[3]),
+			}
+		}
+	}
+
+	doc["tilejson"] = "3.0.0"
+	doc["tiles"] = []string{strings.TrimSuffix(s.url, "/") + "/{z}/{x}/{y}" + s.suffix}
+	doc["minzoom"] = s.zooms[0]
+	doc["maxzoom"] = s.zooms[1]
+	doc["bounds"] = []float64{s.bounds.West, s.bounds.South, s.bounds.East, s.bounds.North}
+	body, err = json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(name, append(body, '\n'))
+}
@@ -0,0 +1,358 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+)
+
+// maxLineSize limits length of a single line (e.g. GeoJSON feature) read from stdin.
+const maxLineSize = 64 * 1024 * 1024
+
+var tilesCmd = &cobra.Command{
+	Use:   "tiles",
+	Short: "Web Mercator tile utilities",
+	Long: `Web Mercator tile utilities compatible with mercantile CLI. Commands read
+JSON texts (one per line) from stdin and write results to stdout. Tiles are
+written as [x, y, z] arrays.`,
+}
+
+var tilesShapesCmd = &cobra.Command{
+	Use:   "shapes",
+	Short: "Write shapes of input tiles as GeoJSON",
+	Long:  "Write shapes of input tiles ([x, y, z] arrays) as GeoJSON features or extents.",
+	Run: func(cmd *cobra.Command, args []string) {
+		precision, err := cmd.Flags().GetInt("precision")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %s\n", err)
+		}
+		mercator, err := cmd.Flags().GetBool("mercator")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %s\n", err)
+		}
+		buffer, err := cmd.Flags().GetFloat64("buffer")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %s\n", err)
+		}
+		collect, err := cmd.Flags().GetBool("collect")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %s\n", err)
+		}
+		extents, err := cmd.Flags().GetBool("extents")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %s\n", err)
+		}
+		options := []mercantile.FeatureOption{mercantile.WithPrecision(precision), mercantile.WithBuffer(buffer)}
+		if mercator {
+			options = append(options, mercantile.WithMercator())
+		}
+
+		out := cmd.OutOrStdout()
+		collection := mercantile.FeatureCollection{Type: "FeatureCollection", Features: []mercantile.Feature{}}
+		err = readLines(cmd.InOrStdin(), func(line string) error {
+			tile, err := parseTile(line)
+			if err != nil {
+				return err
+			}
+			feature := mercantile.TileFeature(tile, options...)
+			switch {
+			case extents:
+				b := feature.Bbox
+				fmt.Fprintf(out, "%v %v %v %v\n", b[0], b[1], b[2], b[3])
+			case collect:
+				collection.Features = append(collection.Features, feature)
+			default:
+				return writeJSON(out, feature)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %s\n", err)
+			return
+		}
+		if collect && !extents {
+			if err := writeJSON(out, collection); err != nil {
+				fmt.Fprintf(os.Stderr, "ERR: %s\n", err)
+			}
+		}
+	},
+}
+
+var tilesTilesCmd = &cobra.Command{
+	Use:   "tiles <zoom>",
+	Short: "Write tiles intersecting input shapes",
+	Long: `Write tiles on given zoom level (or zoom range, e.g. 10-12) intersecting input
+points ([lng, lat]), bounding boxes ([west, south, east, north]), tiles ([x, y, z])
+or GeoJSON objects (their "bbox" member or extent of their coordinates).`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		zooms, err := parseZooms([]string{args[0]})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %s\n", err)
+			return
+		}
+
+		out := cmd.OutOrStdout()
+		err = readLines(cmd.InOrStdin(), func(line string) error {
+			bboxes, err := parseExtents(line)
+			if err != nil {
+				return err
+			}
+			for _, b := range bboxes {
+				for tile := range mercantile.TilesSeq(b.West, b.South, b.East, b.North, zooms) {
+					writeTile(out, tile)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %s\n", err)
+		}
+	},
+}
+
+var tilesParentCmd = &cobra.Command{
+	Use:   "parent",
+	Short: "Write parents of input tiles",
+	Run: func(cmd *cobra.Command, args []string) {
+		depth, err := cmd.Flags().GetInt("depth")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %s\n", err)
+		}
+
+		out := cmd.OutOrStdout()
+		err = readLines(cmd.InOrStdin(), func(line string) error {
+			tile, err := parseTile(line)
+			if err != nil {
+				return err
+			}
+			parent, err := mercantile.Parent(tile, tile.Z-depth)
+			if err != nil {
+				return err
+			}
+			writeTile(out, parent)
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %s\n", err)
+		}
+	},
+}
+
+var tilesChildrenCmd = &cobra.Command{
+	Use:   "children",
+	Short: "Write children of input tiles",
+	Run: func(cmd *cobra.Command, args []string) {
+		depth, err := cmd.Flags().GetInt("depth")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %s\n", err)
+		}
+
+		out := cmd.OutOrStdout()
+		err = readLines(cmd.InOrStdin(), func(line string) error {
+			tile, err := parseTile(line)
+			if err != nil {
+				return err
+			}
+			children, err := mercantile.Children(tile, tile.Z+depth)
+			if err != nil {
+				return err
+			}
+			for _, child := range children {
+				writeTile(out, child)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %s\n", err)
+		}
+	},
+}
+
+var tilesQuadkeyCmd = &cobra.Command{
+	Use:   "quadkey",
+	Short: "Convert tiles to quadkeys and quadkeys to tiles",
+	Long:  "Write quadkeys of input tiles ([x, y, z] arrays) and tiles of input quadkeys.",
+	Run: func(cmd *cobra.Command, args []string) {
+		out := cmd.OutOrStdout()
+		err := readLines(cmd.InOrStdin(), func(line string) error {
+			if strings.HasPrefix(line, "[") {
+				tile, err := parseTile(line)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(out, mercantile.Quadkey(tile))
+				return nil
+			}
+			tile, err := mercantile.QuadkeyToTile(strings.Trim(line, `"`))
+			if err != nil {
+				return err
+			}
+			writeTile(out, tile)
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %s\n", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tilesCmd)
+	tilesCmd.AddCommand(tilesShapesCmd, tilesTilesCmd, tilesParentCmd, tilesChildrenCmd, tilesQuadkeyCmd)
+
+	tilesShapesCmd.Flags().Int(
+		"precision", -1, "Decimal precision of coordinates (-1 for full precision)",
+	)
+	tilesShapesCmd.Flags().Bool(
+		"mercator", false, "Output coordinates in Web Mercator meters instead of longitude and latitude",
+	)
+	tilesShapesCmd.Flags().Float64(
+		"buffer", 0, "Shift shape edges outwards by given distance (in units of output coordinates)",
+	)
+	tilesShapesCmd.Flags().Bool(
+		"collect", false, "Write single GeoJSON FeatureCollection instead of features",
+	)
+	tilesShapesCmd.Flags().Bool(
+		"extents", false, "Write only extents of shapes (west south east north)",
+	)
+	tilesParentCmd.Flags().Int(
+		"depth", 1, "Number of zoom levels to go up",
+	)
+	tilesChildrenCmd.Flags().Int(
+		"depth", 1, "Number of zoom levels to go down",
+	)
+}
+
+// readLines calls handle for every non-empty line of input. RS characters of GeoJSON
+// text sequences are ignored.
+func readLines(r io.Reader, handle func(line string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\x1e"))
+		if line == "" {
+			continue
+		}
+		if err := handle(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func writeTile(w io.Writer, tile mercantile.TileID) {
+	fmt.Fprintf(w, "[%d, %d, %d]\n", tile.X, tile.Y, tile.Z)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// parseTile parses tile given as [x, y, z] array.
+func parseTile(line string) (mercantile.TileID, error) {
+	var values []float64
+	if err := json.Unmarshal([]byte(line), &values); err != nil || len(values) != 3 {
+		return mercantile.TileID{}, fmt.Errorf("invalid tile: %s", line)
+	}
+	return mercantile.TileID{X: int(values[0]), Y: int(values[1]), Z: int(values[2])}, nil
+}
+
+// parseExtents parses point, bbox or tile array or GeoJSON object into geographic bounding
+// boxes. Features of GeoJSON FeatureCollection have separate bounding boxes.
+func parseExtents(line string) ([]mercantile.LngLatBbox, error) {
+	if strings.HasPrefix(line, "[") {
+		var values []float64
+		if err := json.Unmarshal([]byte(line), &values); err != nil {
+			return nil, fmt.Errorf("invalid input: %s", line)
+		}
+		switch len(values) {
+		case 2:
+			return []mercantile.LngLatBbox{{West: values[0], South: values[1], East: values[0], North: values[1]}}, nil
+		case 3:
+			tile := mercantile.TileID{X: int(values[0]), Y: int(values[1]), Z: int(values[2])}
+			return []mercantile.LngLatBbox{mercantile.Bounds(tile)}, nil
+		case 4:
+			return []mercantile.LngLatBbox{{West: values[0], South: values[1], East: values[2], North: values[3]}}, nil
+		}
+		return nil, fmt.Errorf("invalid input: %s", line)
+	}
+
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(line), &obj); err != nil {
+		return nil, fmt.Errorf("invalid input: %s", line)
+	}
+	if features, ok := obj["features"].([]any); ok {
+		var bboxes []mercantile.LngLatBbox
+		for _, f := range features {
+			if feature, ok := f.(map[string]any); ok {
+				if b, ok := geoJSONExtent(feature); ok {
+					bboxes = append(bboxes, b)
+				}
+			}
+		}
+		return bboxes, nil
+	}
+	b, ok := geoJSONExtent(obj)
+	if !ok {
+		return nil, errors.New("GeoJSON object has no coordinates")
+	}
+	return []mercantile.LngLatBbox{b}, nil
+}
+
+// geoJSONExtent returns "bbox" member of GeoJSON object or extent of all its coordinates.
+func geoJSONExtent(obj map[string]any) (mercantile.LngLatBbox, bool) {
+	if bbox, ok := obj["bbox"].([]any); ok && len(bbox) >= 4 {
+		values := make([]float64, 0, 4)
+		for _, v := range bbox[:4] {
+			if f, ok := v.(float64); ok {
+				values = append(values, f)
+			}
+		}
+		if len(values) == 4 {
+			return mercantile.LngLatBbox{West: values[0], South: values[1], East: values[2], North: values[3]}, true
+		}
+	}
+
+	b := mercantile.LngLatBbox{West: math.Inf(1), South: math.Inf(1), East: math.Inf(-1), North: math.Inf(-1)}
+	var walk func(v any)
+	walk = func(v any) {
+		switch value := v.(type) {
+		case []any:
+			if len(value) >= 2 {
+				lng, okLng := value[0].(float64)
+				lat, okLat := value[1].(float64)
+				if okLng && okLat {
+					b.West, b.East = math.Min(b.West, lng), math.Max(b.East, lng)
+					b.South, b.North = math.Min(b.South, lat), math.Max(b.North, lat)
+					return
+				}
+			}
+			for _, item := range value {
+				walk(item)
+			}
+		case map[string]any:
+			for key, item := range value {
+				if key == "coordinates" || key == "geometry" || key == "geometries" {
+					walk(item)
+				}
+			}
+		}
+	}
+	walk(obj)
+	return b, b.West <= b.East
+}
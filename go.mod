@@ -6,6 +6,7 @@ require (
 	github.com/schollz/progressbar/v3 v3.18.0
 	github.com/spf13/cobra v1.9.1
 	github.com/stretchr/testify v1.9.0
+	golang.org/x/image v0.30.0
 )
 
 require (
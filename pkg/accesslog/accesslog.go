@@ -0,0 +1,178 @@
+/*
+Package accesslog counts tile requests found in web server access logs.
+*/
+
+package accesslog
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+)
+
+// CombinedFormat matches lines of combined (and common) log format of nginx and Apache, e.g.
+// 127.0.0.1 - - [10/Oct/2024:13:55:36 +0200] "GET /tiles/14/9056/5384.png HTTP/1.1" 200 2326 "-" "Mozilla/5.0".
+var CombinedFormat = regexp.MustCompile(`^\S+ \S+ \S+ \[(?P<time>[^\]]+)\] "\S+ (?P<path>\S+)[^"]*" \d{3} `)
+
+// CombinedTimeLayout is the layout of time in combined log format.
+const CombinedTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// TilePattern matches {z}/{x}/{y} tile paths, e.g. /tiles/14/9056/5384.png or /14/9056/5384@2x.png.
+var TilePattern = regexp.MustCompile(`/(?P<z>\d+)/(?P<x>\d+)/(?P<y>\d+)(?:@\d+x)?\.[A-Za-z0-9]+(?:\?|$)`)
+
+// Hits holds number of requests of each tile.
+type Hits map[mercantile.TileID]int
+
+// TileHits is a tile with number of its requests.
+type TileHits struct {
+	Tile mercantile.TileID
+	Hits int
+}
+
+// Top returns tiles requested at least minHits times, ordered from the most requested
+// ones (tiles with equal number of requests are ordered by zoom, x and y). With n greater
+// than zero only n most requested tiles are returned.
+func (h Hits) Top(n, minHits int) []TileHits {
+	var top []TileHits
+	for tile, hits := range h {
+		if hits >= minHits {
+			top = append(top, TileHits{Tile: tile, Hits: hits})
+		}
+	}
+	slices.SortFunc(top, func(a, b TileHits) int {
+		return cmp.Or(
+			cmp.Compare(b.Hits, a.Hits),
+			cmp.Compare(a.Tile.Z, b.Tile.Z),
+			cmp.Compare(a.Tile.X, b.Tile.X),
+			cmp.Compare(a.Tile.Y, b.Tile.Y),
+		)
+	})
+	if n > 0 && len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// Parser extracts tile requests from access log lines.
+type Parser struct {
+	format      *regexp.Regexp
+	timeLayout  string
+	tilePattern *regexp.Regexp
+	since       time.Time
+	until       time.Time
+}
+
+type ParserOption func(p *Parser)
+
+// WithFormat sets regular expression matching log lines, CombinedFormat by default.
+// Tile paths are searched in its "path" group (or in the whole line without such group),
+// "time" group, parsed with given layout, is required to filter requests by time.
+func WithFormat(format *regexp.Regexp, timeLayout string) ParserOption {
+	return func(p *Parser) {
+		p.format = format
+		p.timeLayout = timeLayout
+	}
+}
+
+// WithTilePattern sets regular expression matching tile paths with "z", "x" and "y"
+// groups, TilePattern by default.
+func WithTilePattern(pattern *regexp.Regexp) ParserOption {
+	return func(p *Parser) {
+		p.tilePattern = pattern
+	}
+}
+
+// WithTimeRange limits counted requests to the ones made in [since, until) time range.
+// Zero time leaves given side of the range open.
+func WithTimeRange(since, until time.Time) ParserOption {
+	return func(p *Parser) {
+		p.since = since
+		p.until = until
+	}
+}
+
+func NewParser(options ...ParserOption) (*Parser, error) {
+	p := &Parser{
+		format:      CombinedFormat,
+		timeLayout:  CombinedTimeLayout,
+		tilePattern: TilePattern,
+	}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	for _, group := range []string{"z", "x", "y"} {
+		if p.tilePattern.SubexpIndex(group) < 0 {
+			return nil, fmt.Errorf("tile pattern has no %q group", group)
+		}
+	}
+	if (!p.since.IsZero() || !p.until.IsZero()) && p.format.SubexpIndex("time") < 0 {
+		return nil, errors.New("log format has no \"time\" group required to filter requests by time")
+	}
+
+	return p, nil
+}
+
+// Read counts tile requests found in log lines. Lines not matching the log format or
+// without tile paths are skipped.
+func (p *Parser) Read(r io.Reader, hits Hits) error {
+	timeGroup := p.format.SubexpIndex("time")
+	pathGroup := p.format.SubexpIndex("path")
+	filterTime := !p.since.IsZero() || !p.until.IsZero()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		match := p.format.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		if filterTime {
+			t, err := time.Parse(p.timeLayout, match[timeGroup])
+			if err != nil || (!p.since.IsZero() && t.Before(p.since)) || (!p.until.IsZero() && !t.Before(p.until)) {
+				continue
+			}
+		}
+		path := match[0]
+		if pathGroup >= 0 {
+			path = match[pathGroup]
+		}
+		if tile, ok := p.tile(path); ok {
+			hits[tile]++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading access log: %w", err)
+	}
+	return nil
+}
+
+// tile extracts tile from request path.
+func (p *Parser) tile(path string) (mercantile.TileID, bool) {
+	match := p.tilePattern.FindStringSubmatch(path)
+	if match == nil {
+		return mercantile.TileID{}, false
+	}
+	var coords [3]int
+	for i, group := range []string{"z", "x", "y"} {
+		value, err := strconv.Atoi(match[p.tilePattern.SubexpIndex(group)])
+		if err != nil {
+			return mercantile.TileID{}, false
+		}
+		coords[i] = value
+	}
+	tile := mercantile.TileID{X: coords[1], Y: coords[2], Z: coords[0]}
+	if tile.Z > 30 || tile.X >= 1<<tile.Z || tile.Y >= 1<<tile.Z {
+		return mercantile.TileID{}, false
+	}
+	return tile, true
+}
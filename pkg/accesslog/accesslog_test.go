@@ -0,0 +1,130 @@
+package accesslog_test
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/accesslog"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+)
+
+func TestParser_Read(t *testing.T) {
+	tests := map[string]struct {
+		Options []accesslog.ParserOption
+		Hits    accesslog.Hits
+	}{
+		"combined log": {
+			Hits: accesslog.Hits{
+				{X: 9056, Y: 5384, Z: 14}:   3,
+				{X: 9057, Y: 5384, Z: 14}:   1,
+				{X: 18112, Y: 10768, Z: 15}: 1,
+			},
+		},
+		"time range": {
+			Options: []accesslog.ParserOption{accesslog.WithTimeRange(
+				time.Date(2024, 10, 10, 12, 0, 0, 0, time.UTC),
+				time.Date(2024, 10, 11, 7, 0, 0, 0, time.UTC),
+			)},
+			// The end of the range is exclusive.
+			Hits: accesslog.Hits{
+				{X: 9056, Y: 5384, Z: 14}: 1,
+				{X: 9057, Y: 5384, Z: 14}: 1,
+			},
+		},
+		"custom tile pattern": {
+			Options: []accesslog.ParserOption{accesslog.WithTilePattern(
+				regexp.MustCompile(`/tiles/(?P<z>\d+)/(?P<x>\d+)/(?P<y>\d+)\.png$`),
+			)},
+			Hits: accesslog.Hits{
+				{X: 9056, Y: 5384, Z: 14}: 3,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open("testdata/access.log")
+			assert.NoError(t, err)
+			defer f.Close()
+
+			parser, err := accesslog.NewParser(test.Options...)
+			assert.NoError(t, err)
+			hits := accesslog.Hits{}
+			assert.NoError(t, parser.Read(f, hits))
+			assert.Equal(t, test.Hits, hits)
+		})
+	}
+}
+
+func TestParser_ReadCustomFormat(t *testing.T) {
+	parser, err := accesslog.NewParser(accesslog.WithFormat(
+		regexp.MustCompile(`^(?P<time>\S+) (?P<path>\S+)`), time.RFC3339,
+	), accesslog.WithTimeRange(time.Date(2024, 10, 10, 0, 0, 0, 0, time.UTC), time.Time{}))
+	assert.NoError(t, err)
+
+	hits := accesslog.Hits{}
+	err = parser.Read(strings.NewReader(
+		"2024-10-09T10:00:00Z /1/0/0.png\n2024-10-10T10:00:00Z /1/1/0.png\n2024-10-10T11:00:00Z /1/1/0.png\n",
+	), hits)
+	assert.NoError(t, err)
+	assert.Equal(t, accesslog.Hits{{X: 1, Y: 0, Z: 1}: 2}, hits)
+}
+
+func TestNewParser_InvalidPatterns(t *testing.T) {
+	_, err := accesslog.NewParser(accesslog.WithTilePattern(regexp.MustCompile(`/(?P<z>\d+)/(\d+)/(\d+)`)))
+	assert.EqualError(t, err, `tile pattern has no "x" group`)
+
+	_, err = accesslog.NewParser(
+		accesslog.WithFormat(regexp.MustCompile(`^(?P<path>\S+)`), ""),
+		accesslog.WithTimeRange(time.Now(), time.Time{}),
+	)
+	assert.EqualError(t, err, `log format has no "time" group required to filter requests by time`)
+}
+
+func TestHits_Top(t *testing.T) {
+	hits := accesslog.Hits{
+		{X: 0, Y: 0, Z: 1}: 5,
+		{X: 1, Y: 0, Z: 1}: 2,
+		{X: 0, Y: 1, Z: 1}: 5,
+		{X: 0, Y: 0, Z: 0}: 1,
+	}
+
+	tests := map[string]struct {
+		N, MinHits int
+		Want       []accesslog.TileHits
+	}{
+		"all": {
+			Want: []accesslog.TileHits{
+				{Tile: mercantile.TileID{X: 0, Y: 0, Z: 1}, Hits: 5},
+				{Tile: mercantile.TileID{X: 0, Y: 1, Z: 1}, Hits: 5},
+				{Tile: mercantile.TileID{X: 1, Y: 0, Z: 1}, Hits: 2},
+				{Tile: mercantile.TileID{X: 0, Y: 0, Z: 0}, Hits: 1},
+			},
+		},
+		"top": {
+			N: 1,
+			Want: []accesslog.TileHits{
+				{Tile: mercantile.TileID{X: 0, Y: 0, Z: 1}, Hits: 5},
+			},
+		},
+		"threshold": {
+			MinHits: 2,
+			Want: []accesslog.TileHits{
+				{Tile: mercantile.TileID{X: 0, Y: 0, Z: 1}, Hits: 5},
+				{Tile: mercantile.TileID{X: 0, Y: 1, Z: 1}, Hits: 5},
+				{Tile: mercantile.TileID{X: 1, Y: 0, Z: 1}, Hits: 2},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.Want, hits.Top(test.N, test.MinHits))
+		})
+	}
+}
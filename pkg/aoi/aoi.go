@@ -0,0 +1,150 @@
+/*
+Package aoi loads areas of interest (polygons in WGS84 longitude and latitude) used to select
+tiles for download.
+*/
+
+package aoi
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/geom"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/proj"
+)
+
+// Feature represents single geometry with its attributes. Polygonal and linear parts
+// of the geometry are kept separately.
+type Feature struct {
+	Properties map[string]any
+	Polygons   geom.MultiPolygon
+	Lines      geom.MultiLineString
+}
+
+// Load reads area of interest from a file. Format is detected from file extension.
+func Load(name string) (geom.MultiPolygon, error) {
+	features, err := LoadFeatures(name)
+	if err != nil {
+		return nil, err
+	}
+	return Polygons(features)
+}
+
+// LoadFeatures reads features from a file. Format is detected from file extension.
+func LoadFeatures(name string) ([]Feature, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".geojson", ".json":
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ReadGeoJSON(f)
+	case ".gpx":
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ReadGPX(f)
+	case ".kml":
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ReadKML(f)
+	case ".kmz":
+		return loadKMZ(name)
+	case ".shp":
+		return loadShapefile(name)
+	case ".zip":
+		return loadZippedShapefile(name)
+	case ".wkt":
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		return ReadWKT(string(data))
+	}
+	return nil, fmt.Errorf("unsupported area of interest format: %s", name)
+}
+
+// LoadRoute reads route (line strings) from a file. Format is detected from file extension.
+func LoadRoute(name string) (geom.MultiLineString, error) {
+	features, err := LoadFeatures(name)
+	if err != nil {
+		return nil, err
+	}
+	return Lines(features)
+}
+
+// Lines merges line strings of all features into single multi line string.
+func Lines(features []Feature) (geom.MultiLineString, error) {
+	var ml geom.MultiLineString
+	for _, f := range features {
+		ml = append(ml, f.Lines...)
+	}
+	if len(ml) == 0 {
+		return nil, errors.New("route contains no lines")
+	}
+	return ml, nil
+}
+
+// Polygons merges polygons of all features into single multipolygon.
+func Polygons(features []Feature) (geom.MultiPolygon, error) {
+	var mp geom.MultiPolygon
+	for _, f := range features {
+		mp = append(mp, f.Polygons...)
+	}
+	if len(mp) == 0 {
+		return nil, errors.New("area of interest contains no polygons")
+	}
+	return mp, nil
+}
+
+// Where returns features whose property with given key is equal to given value.
+// Values are compared using their default string representation.
+func Where(features []Feature, key, value string) []Feature {
+	var filtered []Feature
+	for _, f := range features {
+		v, ok := f.Properties[key]
+		if ok && fmt.Sprint(v) == value {
+			filtered = append(filtered, f)
+		}
+	}
+	return filtered
+}
+
+// reproject transforms coordinates of features from given CRS to WGS84 in place.
+func reproject(features []Feature, crs *proj.CRS) error {
+	transform := func(points []geom.Point) error {
+		for i, p := range points {
+			lon, lat, err := crs.ToWGS84(p.X, p.Y)
+			if err != nil {
+				return fmt.Errorf("error reprojecting area of interest to WGS84: %w", err)
+			}
+			points[i] = geom.Point{X: lon, Y: lat}
+		}
+		return nil
+	}
+
+	for _, f := range features {
+		for _, polygon := range f.Polygons {
+			for _, ring := range polygon {
+				if err := transform(ring); err != nil {
+					return err
+				}
+			}
+		}
+		for _, line := range f.Lines {
+			if err := transform(line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
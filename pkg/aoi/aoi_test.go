@@ -0,0 +1,254 @@
+package aoi_test
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/aoi"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/geom"
+)
+
+func TestLoad(t *testing.T) {
+	polygons, err := aoi.Load("testdata/aoi.geojson")
+	assert.NoError(t, err)
+
+	assert.Len(t, polygons, 2)
+	assert.Equal(t, geom.Rect{MinX: 19.79, MinY: 49.97, MaxX: 21.27, MaxY: 52.37}, polygons.Bounds())
+}
+
+func TestLoad_UnsupportedFormat(t *testing.T) {
+	_, err := aoi.Load("testdata/aoi.txt")
+	assert.EqualError(t, err, "unsupported area of interest format: testdata/aoi.txt")
+}
+
+func TestReadGeoJSON(t *testing.T) {
+	tests := map[string]struct {
+		GeoJSON  string
+		Features int
+		WantErr  string
+	}{
+		"bare geometry": {
+			GeoJSON:  `{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}`,
+			Features: 1,
+		},
+		"feature": {
+			GeoJSON:  `{"type": "Feature", "properties": {"a": 1}, "geometry": {"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}}`,
+			Features: 1,
+		},
+		"invalid ring": {
+			GeoJSON: `{"type": "Polygon", "coordinates": [[[0, 0], [1, 0]]]}`,
+			WantErr: "error decoding GeoJSON: polygon ring needs at least 3 positions",
+		},
+		"unsupported geometry": {
+			GeoJSON: `{"type": "Circle", "coordinates": [0, 0]}`,
+			WantErr: `error decoding GeoJSON: unsupported geometry type "Circle"`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			features, err := aoi.ReadGeoJSON(strings.NewReader(test.GeoJSON))
+			if test.WantErr != "" {
+				assert.EqualError(t, err, test.WantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, features, test.Features)
+		})
+	}
+}
+
+func TestLoadRoute(t *testing.T) {
+	tests := map[string]struct {
+		Name  string
+		Lines int
+	}{
+		"GPX tracks and routes": {Name: "testdata/route.gpx", Lines: 3},
+		"GeoJSON LineString":    {Name: "testdata/aoi.geojson", Lines: 1},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			lines, err := aoi.LoadRoute(test.Name)
+			assert.NoError(t, err)
+			assert.Len(t, lines, test.Lines)
+		})
+	}
+}
+
+func TestReadGPX(t *testing.T) {
+	features, err := aoi.ReadGPX(strings.NewReader(`<gpx><trk><name>a</name><trkseg>` +
+		`<trkpt lat="52.0" lon="21.0"/><trkpt lat="52.5" lon="21.5"/></trkseg></trk></gpx>`))
+	assert.NoError(t, err)
+
+	assert.Len(t, features, 1)
+	assert.Equal(t, "a", features[0].Properties["name"])
+	assert.Equal(t, geom.LineString{{X: 21.0, Y: 52.0}, {X: 21.5, Y: 52.5}}, features[0].Lines[0])
+}
+
+func TestLoadFeatures(t *testing.T) {
+	tests := map[string]struct {
+		Name     string
+		Features int
+		Polygons int
+		Lines    int
+		Bounds   geom.Rect
+	}{
+		"Shapefile": {
+			Name: "testdata/aoi.shp", Features: 3, Polygons: 2, Lines: 1,
+			Bounds: geom.Rect{MinX: 20.75, MinY: 52.08, MaxX: 21.27, MaxY: 52.26},
+		},
+		"zipped Shapefile": {
+			Name: "testdata/aoi.zip", Features: 3, Polygons: 2, Lines: 1,
+			Bounds: geom.Rect{MinX: 20.75, MinY: 52.08, MaxX: 21.27, MaxY: 52.26},
+		},
+		"KML": {
+			Name: "testdata/aoi.kml", Features: 2, Polygons: 2, Lines: 1,
+			Bounds: geom.Rect{MinX: 19.9, MinY: 50.0, MaxX: 21.1, MaxY: 52.3},
+		},
+		"KMZ": {
+			Name: "testdata/aoi.kmz", Features: 2, Polygons: 2, Lines: 1,
+			Bounds: geom.Rect{MinX: 19.9, MinY: 50.0, MaxX: 21.1, MaxY: 52.3},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			features, err := aoi.LoadFeatures(test.Name)
+			assert.NoError(t, err)
+			assert.Len(t, features, test.Features)
+
+			polygons, err := aoi.Polygons(features)
+			assert.NoError(t, err)
+			assert.Len(t, polygons, test.Polygons)
+			lines, err := aoi.Lines(features)
+			assert.NoError(t, err)
+			assert.Len(t, lines, test.Lines)
+
+			bounds := polygons.Bounds().Union(lines.Bounds())
+			assert.InDelta(t, test.Bounds.MinX, bounds.MinX, 0.01)
+			assert.InDelta(t, test.Bounds.MinY, bounds.MinY, 0.01)
+			assert.InDelta(t, test.Bounds.MaxX, bounds.MaxX, 0.01)
+			assert.InDelta(t, test.Bounds.MaxY, bounds.MaxY, 0.01)
+		})
+	}
+}
+
+func TestReadShapefile_Attributes(t *testing.T) {
+	features, err := aoi.LoadFeatures("testdata/aoi.shp")
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]any{"NAME": "north", "AREA": 100.0}, features[0].Properties)
+	// The first polygon has a hole.
+	assert.Len(t, features[0].Polygons[0], 2)
+}
+
+func TestReadShapefile_InvalidDbf(t *testing.T) {
+	dir := t.TempDir()
+	for _, ext := range []string{".shp", ".shx", ".prj"} {
+		data, err := os.ReadFile("testdata/aoi" + ext)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "aoi"+ext), data, 0o644))
+	}
+	dbf, err := os.ReadFile("testdata/aoi.dbf")
+	assert.NoError(t, err)
+	// Record length shorter than its fields.
+	binary.LittleEndian.PutUint16(dbf[10:12], 10)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "aoi.dbf"), dbf, 0o644))
+
+	_, err = aoi.LoadFeatures(filepath.Join(dir, "aoi.shp"))
+	assert.EqualError(t, err, "error decoding dbf: fields longer than record")
+}
+
+func TestReadKML_Attributes(t *testing.T) {
+	features, err := aoi.LoadFeatures("testdata/aoi.kml")
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]any{"name": "Warsaw", "district": "Srodmiescie"}, features[0].Properties)
+	assert.Equal(t, map[string]any{"name": "Cracow", "district": "Stare Miasto"}, features[1].Properties)
+}
+
+func TestReadWKT(t *testing.T) {
+	tests := map[string]struct {
+		WKT      string
+		Polygons int
+		Lines    int
+		Bounds   geom.Rect
+		WantErr  string
+	}{
+		"polygon": {
+			WKT:      "POLYGON ((20 50, 21 50, 21 51, 20 50))",
+			Polygons: 1,
+			Bounds:   geom.Rect{MinX: 20, MinY: 50, MaxX: 21, MaxY: 51},
+		},
+		"multipolygon with hole": {
+			WKT:      "MULTIPOLYGON (((0 0, 10 0, 10 10, 0 0), (1 1, 2 1, 2 2, 1 1)), ((20 20, 21 20, 21 21, 20 20)))",
+			Polygons: 2,
+			Bounds:   geom.Rect{MinX: 0, MinY: 0, MaxX: 21, MaxY: 21},
+		},
+		"geometry collection": {
+			WKT:    "GEOMETRYCOLLECTION (POINT (1 1), LINESTRING Z (0 0 5, 1 1 5), MULTILINESTRING ((2 2, 3 3), (4 4, 5 5)))",
+			Lines:  3,
+			Bounds: geom.Rect{MinX: 0, MinY: 0, MaxX: 5, MaxY: 5},
+		},
+		"EWKT": {
+			WKT:    "SRID=3857;LINESTRING (0 0, 1113194.9079 0)",
+			Lines:  1,
+			Bounds: geom.Rect{MinX: 0, MinY: 0, MaxX: 10, MaxY: 0},
+		},
+		"unsupported geometry": {
+			WKT:     "CIRCULARSTRING (0 0, 1 1, 2 0)",
+			WantErr: `error decoding WKT: unsupported geometry type "CIRCULARSTRING"`,
+		},
+		"trailing characters": {
+			WKT:     "LINESTRING (0 0, 1 1))",
+			WantErr: `error decoding WKT: unexpected ')' at position 21`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			features, err := aoi.ReadWKT(test.WKT)
+			if test.WantErr != "" {
+				assert.EqualError(t, err, test.WantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, features, 1)
+			assert.Len(t, features[0].Polygons, test.Polygons)
+			assert.Len(t, features[0].Lines, test.Lines)
+
+			bounds := features[0].Polygons.Bounds().Union(features[0].Lines.Bounds())
+			assert.InDelta(t, test.Bounds.MinX, bounds.MinX, 1e-6)
+			assert.InDelta(t, test.Bounds.MinY, bounds.MinY, 1e-6)
+			assert.InDelta(t, test.Bounds.MaxX, bounds.MaxX, 1e-6)
+			assert.InDelta(t, test.Bounds.MaxY, bounds.MaxY, 1e-6)
+		})
+	}
+}
+
+func TestReadGeoJSON_NamedCRS(t *testing.T) {
+	features, err := aoi.ReadGeoJSON(strings.NewReader(`{"type": "LineString",` +
+		`"crs": {"type": "name", "properties": {"name": "urn:ogc:def:crs:EPSG::3857"}},` +
+		`"coordinates": [[0, 0], [1113194.9079, 0]]}`))
+	assert.NoError(t, err)
+
+	assert.InDelta(t, 10.0, features[0].Lines[0][1].X, 1e-6)
+}
+
+func TestWhere(t *testing.T) {
+	features := []aoi.Feature{
+		{Properties: map[string]any{"name": "a", "id": 1.0}},
+		{Properties: map[string]any{"name": "b", "id": 2.0}},
+		{Properties: map[string]any{"id": 3.0}},
+	}
+
+	assert.Equal(t, features[1:2], aoi.Where(features, "name", "b"))
+	assert.Equal(t, features[2:3], aoi.Where(features, "id", "3"))
+	assert.Empty(t, aoi.Where(features, "name", "c"))
+}
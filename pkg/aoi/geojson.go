@@ -0,0 +1,185 @@
+package aoi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/geom"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/proj"
+)
+
+type geoJSONObject struct {
+	Type        string          `json:"type"`
+	Features    []geoJSONObject `json:"features"`
+	Geometry    *geoJSONObject  `json:"geometry"`
+	Geometries  []geoJSONObject `json:"geometries"`
+	Properties  map[string]any  `json:"properties"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	CRS         *geoJSONCRS     `json:"crs"`
+}
+
+// geoJSONCRS represents named CRS member of GeoJSON 2008 specification. It is no longer
+// part of RFC 7946, but is still written by many tools.
+type geoJSONCRS struct {
+	Type       string `json:"type"`
+	Properties struct {
+		Name string `json:"name"`
+	} `json:"properties"`
+}
+
+// ReadGeoJSON reads features from GeoJSON FeatureCollection, Feature or bare geometry.
+// Polygon, MultiPolygon, LineString and MultiLineString geometries (also inside
+// GeometryCollections) are used, points are ignored. Coordinates are reprojected to WGS84
+// if the object has named "crs" member.
+func ReadGeoJSON(r io.Reader) ([]Feature, error) {
+	var obj geoJSONObject
+	if err := json.NewDecoder(r).Decode(&obj); err != nil {
+		return nil, fmt.Errorf("error decoding GeoJSON: %w", err)
+	}
+
+	features, err := geoJSONFeatures(obj)
+	if err != nil {
+		return nil, err
+	}
+	if obj.CRS != nil && obj.CRS.Properties.Name != "" {
+		crs, err := proj.Lookup(obj.CRS.Properties.Name)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding GeoJSON: %w", err)
+		}
+		if err := reproject(features, crs); err != nil {
+			return nil, err
+		}
+	}
+	return features, nil
+}
+
+func geoJSONFeatures(obj geoJSONObject) ([]Feature, error) {
+	switch obj.Type {
+	case "FeatureCollection":
+		features := make([]Feature, 0, len(obj.Features))
+		for _, f := range obj.Features {
+			feature, err := geoJSONFeature(f)
+			if err != nil {
+				return nil, err
+			}
+			features = append(features, feature)
+		}
+		return features, nil
+	case "Feature":
+		feature, err := geoJSONFeature(obj)
+		if err != nil {
+			return nil, err
+		}
+		return []Feature{feature}, nil
+	default:
+		feature := Feature{Properties: map[string]any{}}
+		if err := geoJSONGeometry(obj, &feature); err != nil {
+			return nil, err
+		}
+		return []Feature{feature}, nil
+	}
+}
+
+func geoJSONFeature(obj geoJSONObject) (Feature, error) {
+	if obj.Type != "Feature" {
+		return Feature{}, fmt.Errorf("error decoding GeoJSON: unexpected %q object in feature collection", obj.Type)
+	}
+	feature := Feature{Properties: obj.Properties}
+	if feature.Properties == nil {
+		feature.Properties = map[string]any{}
+	}
+	if obj.Geometry == nil {
+		return feature, nil
+	}
+	if err := geoJSONGeometry(*obj.Geometry, &feature); err != nil {
+		return Feature{}, err
+	}
+	return feature, nil
+}
+
+// geoJSONGeometry decodes geometry and appends its parts to the feature.
+func geoJSONGeometry(obj geoJSONObject, feature *Feature) error {
+	switch obj.Type {
+	case "Polygon":
+		var coords [][][]float64
+		if err := json.Unmarshal(obj.Coordinates, &coords); err != nil {
+			return fmt.Errorf("error decoding GeoJSON Polygon: %w", err)
+		}
+		polygon, err := geoJSONPolygon(coords)
+		if err != nil {
+			return err
+		}
+		feature.Polygons = append(feature.Polygons, polygon)
+	case "MultiPolygon":
+		var coords [][][][]float64
+		if err := json.Unmarshal(obj.Coordinates, &coords); err != nil {
+			return fmt.Errorf("error decoding GeoJSON MultiPolygon: %w", err)
+		}
+		for _, c := range coords {
+			polygon, err := geoJSONPolygon(c)
+			if err != nil {
+				return err
+			}
+			feature.Polygons = append(feature.Polygons, polygon)
+		}
+	case "LineString":
+		var coords [][]float64
+		if err := json.Unmarshal(obj.Coordinates, &coords); err != nil {
+			return fmt.Errorf("error decoding GeoJSON LineString: %w", err)
+		}
+		line, err := geoJSONPoints(coords)
+		if err != nil {
+			return err
+		}
+		feature.Lines = append(feature.Lines, geom.LineString(line))
+	case "MultiLineString":
+		var coords [][][]float64
+		if err := json.Unmarshal(obj.Coordinates, &coords); err != nil {
+			return fmt.Errorf("error decoding GeoJSON MultiLineString: %w", err)
+		}
+		for _, c := range coords {
+			line, err := geoJSONPoints(c)
+			if err != nil {
+				return err
+			}
+			feature.Lines = append(feature.Lines, geom.LineString(line))
+		}
+	case "GeometryCollection":
+		for _, g := range obj.Geometries {
+			if err := geoJSONGeometry(g, feature); err != nil {
+				return err
+			}
+		}
+	case "Point", "MultiPoint":
+	default:
+		return fmt.Errorf("error decoding GeoJSON: unsupported geometry type %q", obj.Type)
+	}
+	return nil
+}
+
+func geoJSONPoints(coords [][]float64) ([]geom.Point, error) {
+	points := make([]geom.Point, 0, len(coords))
+	for _, c := range coords {
+		if len(c) < 2 {
+			return nil, fmt.Errorf("error decoding GeoJSON: invalid position %v", c)
+		}
+		points = append(points, geom.Point{X: c[0], Y: c[1]})
+	}
+	return points, nil
+}
+
+func geoJSONPolygon(coords [][][]float64) (geom.Polygon, error) {
+	polygon := make(geom.Polygon, 0, len(coords))
+	for _, ring := range coords {
+		r, err := geoJSONPoints(ring)
+		if err != nil {
+			return nil, err
+		}
+		if len(r) < 3 {
+			return nil, fmt.Errorf("error decoding GeoJSON: polygon ring needs at least 3 positions")
+		}
+		polygon = append(polygon, r)
+	}
+	return polygon, nil
+}
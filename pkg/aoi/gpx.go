@@ -0,0 +1,63 @@
+package aoi
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/geom"
+)
+
+type gpxPoint struct {
+	Lat float64 `xml:"lat,attr"`
+	Lon float64 `xml:"lon,attr"`
+}
+
+type gpxDocument struct {
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+	Routes []struct {
+		Name   string     `xml:"name"`
+		Points []gpxPoint `xml:"rtept"`
+	} `xml:"rte"`
+}
+
+// ReadGPX reads tracks (each track segment becomes a line) and routes from GPX document.
+// Every track and route becomes a separate feature with its name as "name" property.
+func ReadGPX(r io.Reader) ([]Feature, error) {
+	var doc gpxDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error decoding GPX: %w", err)
+	}
+
+	var features []Feature
+	for _, track := range doc.Tracks {
+		feature := Feature{Properties: map[string]any{"name": track.Name}}
+		for _, segment := range track.Segments {
+			if line := gpxLine(segment.Points); len(line) > 0 {
+				feature.Lines = append(feature.Lines, line)
+			}
+		}
+		features = append(features, feature)
+	}
+	for _, route := range doc.Routes {
+		feature := Feature{Properties: map[string]any{"name": route.Name}}
+		if line := gpxLine(route.Points); len(line) > 0 {
+			feature.Lines = append(feature.Lines, line)
+		}
+		features = append(features, feature)
+	}
+	return features, nil
+}
+
+func gpxLine(points []gpxPoint) geom.LineString {
+	line := make(geom.LineString, 0, len(points))
+	for _, p := range points {
+		line = append(line, geom.Point{X: p.Lon, Y: p.Lat})
+	}
+	return line
+}
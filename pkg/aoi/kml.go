@@ -0,0 +1,160 @@
+package aoi
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/geom"
+)
+
+type kmlCoordinates string
+
+type kmlPolygon struct {
+	Outer  kmlCoordinates   `xml:"outerBoundaryIs>LinearRing>coordinates"`
+	Inners []kmlCoordinates `xml:"innerBoundaryIs>LinearRing>coordinates"`
+}
+
+type kmlGeometry struct {
+	Polygons      []kmlPolygon     `xml:"Polygon"`
+	LineStrings   []kmlCoordinates `xml:"LineString>coordinates"`
+	MultiGeometry []kmlGeometry    `xml:"MultiGeometry"`
+}
+
+type kmlPlacemark struct {
+	kmlGeometry
+	Name         string `xml:"name"`
+	ExtendedData struct {
+		Data []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:"value"`
+		} `xml:"Data"`
+		SimpleData []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"SchemaData>SimpleData"`
+	} `xml:"ExtendedData"`
+}
+
+// ReadKML reads placemarks from KML document (at any depth of folders). Polygons and
+// line strings (also inside MultiGeometry) are used, points are ignored. Placemark name
+// and extended data become feature properties.
+func ReadKML(r io.Reader) ([]Feature, error) {
+	var features []Feature
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error decoding KML: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Placemark" {
+			continue
+		}
+
+		var placemark kmlPlacemark
+		if err := decoder.DecodeElement(&placemark, &start); err != nil {
+			return nil, fmt.Errorf("error decoding KML: %w", err)
+		}
+		feature := Feature{Properties: map[string]any{}}
+		if placemark.Name != "" {
+			feature.Properties["name"] = placemark.Name
+		}
+		for _, data := range placemark.ExtendedData.Data {
+			feature.Properties[data.Name] = strings.TrimSpace(data.Value)
+		}
+		for _, data := range placemark.ExtendedData.SimpleData {
+			feature.Properties[data.Name] = strings.TrimSpace(data.Value)
+		}
+		if err := kmlFeatureGeometry(placemark.kmlGeometry, &feature); err != nil {
+			return nil, err
+		}
+		features = append(features, feature)
+	}
+	return features, nil
+}
+
+func kmlFeatureGeometry(g kmlGeometry, feature *Feature) error {
+	for _, p := range g.Polygons {
+		outer, err := p.Outer.points()
+		if err != nil {
+			return err
+		}
+		if len(outer) < 3 {
+			return errors.New("error decoding KML: polygon ring needs at least 3 positions")
+		}
+		polygon := geom.Polygon{outer}
+		for _, inner := range p.Inners {
+			ring, err := inner.points()
+			if err != nil {
+				return err
+			}
+			polygon = append(polygon, ring)
+		}
+		feature.Polygons = append(feature.Polygons, polygon)
+	}
+	for _, l := range g.LineStrings {
+		line, err := l.points()
+		if err != nil {
+			return err
+		}
+		feature.Lines = append(feature.Lines, geom.LineString(line))
+	}
+	for _, m := range g.MultiGeometry {
+		if err := kmlFeatureGeometry(m, feature); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// points parses KML coordinates: whitespace separated lon,lat[,alt] tuples.
+func (c kmlCoordinates) points() ([]geom.Point, error) {
+	tuples := strings.Fields(string(c))
+	points := make([]geom.Point, 0, len(tuples))
+	for _, tuple := range tuples {
+		parts := strings.Split(tuple, ",")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("error decoding KML: invalid coordinates %q", tuple)
+		}
+		lon, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding KML: invalid coordinates %q", tuple)
+		}
+		lat, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding KML: invalid coordinates %q", tuple)
+		}
+		points = append(points, geom.Point{X: lon, Y: lat})
+	}
+	return points, nil
+}
+
+// loadKMZ reads the first KML document found in KMZ (zip) archive.
+func loadKMZ(name string) ([]Feature, error) {
+	archive, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	for _, f := range archive.File {
+		if !strings.HasSuffix(strings.ToLower(f.Name), ".kml") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ReadKML(rc)
+	}
+	return nil, fmt.Errorf("no KML document found in %s", name)
+}
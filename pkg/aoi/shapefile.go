@@ -0,0 +1,335 @@
+package aoi
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/geom"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/proj"
+)
+
+// Shape types of ESRI Shapefile which are read, Z and M variants share 2D layout.
+const (
+	shapeNull       = 0
+	shapePolyLine   = 3
+	shapePolygon    = 5
+	shapePolyLineZ  = 13
+	shapePolygonZ   = 15
+	shapePolyLineM  = 23
+	shapePolygonM   = 25
+	shapefileHeader = 100
+)
+
+// ReadShapefile reads features from shapefile components: geometries from .shp, attributes
+// from .dbf (optional) and CRS from .prj (optional). Geometries are reprojected to WGS84
+// when CRS is given.
+func ReadShapefile(shp, dbf io.Reader, prj string) ([]Feature, error) {
+	shpData, err := io.ReadAll(shp)
+	if err != nil {
+		return nil, err
+	}
+	features, err := readShp(shpData)
+	if err != nil {
+		return nil, err
+	}
+
+	if dbf != nil {
+		records, err := readDbf(dbf)
+		if err != nil {
+			return nil, err
+		}
+		for i := range features {
+			if i < len(records) {
+				features[i].Properties = records[i]
+			}
+		}
+	}
+
+	if strings.TrimSpace(prj) != "" {
+		crs, err := proj.ParseWKT(prj)
+		if err != nil {
+			return nil, err
+		}
+		if err := reproject(features, crs); err != nil {
+			return nil, err
+		}
+	}
+	return features, nil
+}
+
+// loadShapefile reads shapefile with its .dbf and .prj siblings.
+func loadShapefile(name string) ([]Feature, error) {
+	shp, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer shp.Close()
+
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	var dbf io.Reader
+	if f, err := openSibling(base, ".dbf"); err == nil {
+		defer f.Close()
+		dbf = f
+	}
+	var prj string
+	if f, err := openSibling(base, ".prj"); err == nil {
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		prj = string(data)
+	}
+	return ReadShapefile(shp, dbf, prj)
+}
+
+// openSibling opens file with the same base name and given extension (in lower or upper case).
+func openSibling(base, ext string) (*os.File, error) {
+	f, err := os.Open(base + ext)
+	if err == nil {
+		return f, nil
+	}
+	return os.Open(base + strings.ToUpper(ext))
+}
+
+// loadZippedShapefile reads the first shapefile found in a zip archive.
+func loadZippedShapefile(name string) ([]Feature, error) {
+	archive, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	files := map[string]*zip.File{}
+	var shpName string
+	for _, f := range archive.File {
+		lower := strings.ToLower(f.Name)
+		files[lower] = f
+		if shpName == "" && strings.HasSuffix(lower, ".shp") && !strings.HasPrefix(filepath.Base(lower), ".") {
+			shpName = lower
+		}
+	}
+	if shpName == "" {
+		return nil, fmt.Errorf("no shapefile found in %s", name)
+	}
+	base := strings.TrimSuffix(shpName, ".shp")
+
+	read := func(name string) ([]byte, error) {
+		f, ok := files[name]
+		if !ok {
+			return nil, nil
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	shp, err := read(shpName)
+	if err != nil {
+		return nil, err
+	}
+	dbfData, err := read(base + ".dbf")
+	if err != nil {
+		return nil, err
+	}
+	prj, err := read(base + ".prj")
+	if err != nil {
+		return nil, err
+	}
+	var dbf io.Reader
+	if dbfData != nil {
+		dbf = bytes.NewReader(dbfData)
+	}
+	return ReadShapefile(bytes.NewReader(shp), dbf, string(prj))
+}
+
+func readShp(data []byte) ([]Feature, error) {
+	if len(data) < shapefileHeader || binary.BigEndian.Uint32(data[0:4]) != 9994 {
+		return nil, errors.New("error decoding shapefile: invalid header")
+	}
+
+	var features []Feature
+	for pos := shapefileHeader; pos+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos+4:pos+8])) * 2
+		content := data[pos+8:]
+		if length > len(content) {
+			return nil, errors.New("error decoding shapefile: truncated record")
+		}
+		content = content[:length]
+		pos += 8 + length
+
+		feature, err := readShpRecord(content)
+		if err != nil {
+			return nil, err
+		}
+		features = append(features, feature)
+	}
+	return features, nil
+}
+
+func readShpRecord(content []byte) (Feature, error) {
+	feature := Feature{Properties: map[string]any{}}
+	if len(content) < 4 {
+		return feature, errors.New("error decoding shapefile: truncated record")
+	}
+	shapeType := binary.LittleEndian.Uint32(content[0:4])
+	switch shapeType {
+	case shapePolygon, shapePolygonZ, shapePolygonM, shapePolyLine, shapePolyLineZ, shapePolyLineM:
+	default:
+		// Null shapes and points do not describe areas.
+		return feature, nil
+	}
+
+	if len(content) < 44 {
+		return feature, errors.New("error decoding shapefile: truncated record")
+	}
+	numParts := int(binary.LittleEndian.Uint32(content[36:40]))
+	numPoints := int(binary.LittleEndian.Uint32(content[40:44]))
+	partsEnd := 44 + 4*numParts
+	if len(content) < partsEnd+16*numPoints {
+		return feature, errors.New("error decoding shapefile: truncated record")
+	}
+
+	var parts [][]geom.Point
+	for i := 0; i < numParts; i++ {
+		start := int(binary.LittleEndian.Uint32(content[44+4*i:]))
+		end := numPoints
+		if i+1 < numParts {
+			end = int(binary.LittleEndian.Uint32(content[44+4*(i+1):]))
+		}
+		if start > end || end > numPoints {
+			return feature, errors.New("error decoding shapefile: invalid part index")
+		}
+		part := make([]geom.Point, 0, end-start)
+		for j := start; j < end; j++ {
+			offset := partsEnd + 16*j
+			part = append(part, geom.Point{
+				X: math.Float64frombits(binary.LittleEndian.Uint64(content[offset:])),
+				Y: math.Float64frombits(binary.LittleEndian.Uint64(content[offset+8:])),
+			})
+		}
+		parts = append(parts, part)
+	}
+
+	switch shapeType {
+	case shapePolyLine, shapePolyLineZ, shapePolyLineM:
+		for _, part := range parts {
+			feature.Lines = append(feature.Lines, geom.LineString(part))
+		}
+	default:
+		feature.Polygons = assemblePolygons(parts)
+	}
+	return feature, nil
+}
+
+// assemblePolygons groups shapefile rings into polygons. Outer rings are clockwise, holes
+// are counter-clockwise and belong to the outer ring containing them.
+func assemblePolygons(rings [][]geom.Point) geom.MultiPolygon {
+	var mp geom.MultiPolygon
+	var holes []geom.Ring
+	for _, r := range rings {
+		ring := geom.Ring(r)
+		if signedArea(ring) <= 0 {
+			mp = append(mp, geom.Polygon{ring})
+		} else {
+			holes = append(holes, ring)
+		}
+	}
+	for _, hole := range holes {
+		assigned := false
+		for i, polygon := range mp {
+			if len(hole) > 0 && (geom.MultiPolygon{{polygon[0]}}).Contains(hole[0]) {
+				mp[i] = append(mp[i], hole)
+				assigned = true
+				break
+			}
+		}
+		if !assigned {
+			// Ring orientation is wrong, treat it as an outer ring.
+			mp = append(mp, geom.Polygon{hole})
+		}
+	}
+	return mp
+}
+
+// signedArea returns ring area, positive for counter-clockwise rings.
+func signedArea(r geom.Ring) float64 {
+	area := 0.0
+	for i := range r {
+		a, b := r[i], r[(i+1)%len(r)]
+		area += a.X*b.Y - b.X*a.Y
+	}
+	return area / 2
+}
+
+// readDbf reads attribute records of dBASE table.
+func readDbf(r io.Reader) ([]map[string]any, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 32 {
+		return nil, errors.New("error decoding dbf: invalid header")
+	}
+	numRecords := int(binary.LittleEndian.Uint32(data[4:8]))
+	headerLength := int(binary.LittleEndian.Uint16(data[8:10]))
+	recordLength := int(binary.LittleEndian.Uint16(data[10:12]))
+
+	type field struct {
+		name   string
+		kind   byte
+		length int
+	}
+	var fields []field
+	for pos := 32; pos+32 <= len(data) && pos < headerLength && data[pos] != 0x0D; pos += 32 {
+		name := string(bytes.TrimRight(data[pos:pos+11], "\x00 "))
+		fields = append(fields, field{name: name, kind: data[pos+11], length: int(data[pos+16])})
+	}
+	// Fields follow the deletion flag and have to fit in the record.
+	fieldsLength := 0
+	for _, f := range fields {
+		fieldsLength += f.length
+	}
+	if fieldsLength > recordLength-1 {
+		return nil, errors.New("error decoding dbf: fields longer than record")
+	}
+
+	records := make([]map[string]any, 0, numRecords)
+	for i := 0; i < numRecords; i++ {
+		start := headerLength + i*recordLength
+		if start+recordLength > len(data) {
+			return nil, errors.New("error decoding dbf: truncated record")
+		}
+		record := map[string]any{}
+		offset := start + 1 // Skip deletion flag.
+		for _, f := range fields {
+			raw := strings.TrimSpace(string(data[offset : offset+f.length]))
+			offset += f.length
+			switch f.kind {
+			case 'N', 'F':
+				if value, err := strconv.ParseFloat(raw, 64); err == nil {
+					record[f.name] = value
+				} else {
+					record[f.name] = nil
+				}
+			case 'L':
+				record[f.name] = strings.ContainsAny(raw, "TtYy")
+			default:
+				record[f.name] = raw
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -0,0 +1,223 @@
+package aoi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/geom"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/proj"
+)
+
+// wktList represents parenthesised WKT list: either a list of nested lists or a list
+// of positions.
+type wktList struct {
+	lists  []wktList
+	points []geom.Point
+}
+
+type wktGeometryParser struct {
+	s   string
+	pos int
+}
+
+// ReadWKT reads single feature from WKT (or EWKT with SRID=XXXX; prefix) geometry. Polygon,
+// MultiPolygon, LineString and MultiLineString geometries (also inside GeometryCollection)
+// are used, points are ignored. Coordinates with SRID are reprojected to WGS84.
+func ReadWKT(wkt string) ([]Feature, error) {
+	wkt = strings.TrimSpace(wkt)
+	var crs *proj.CRS
+	if strings.HasPrefix(strings.ToUpper(wkt), "SRID=") {
+		srid, rest, ok := strings.Cut(wkt[len("SRID="):], ";")
+		if !ok {
+			return nil, fmt.Errorf("error decoding WKT: invalid SRID prefix")
+		}
+		var err error
+		if crs, err = proj.Lookup(srid); err != nil {
+			return nil, fmt.Errorf("error decoding WKT: %w", err)
+		}
+		wkt = rest
+	}
+
+	p := &wktGeometryParser{s: wkt}
+	feature := Feature{Properties: map[string]any{}}
+	if err := p.parseGeometry(&feature); err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.s) {
+		return nil, fmt.Errorf("error decoding WKT: unexpected %q at position %d", p.s[p.pos], p.pos)
+	}
+
+	features := []Feature{feature}
+	if crs != nil {
+		if err := reproject(features, crs); err != nil {
+			return nil, err
+		}
+	}
+	return features, nil
+}
+
+func (p *wktGeometryParser) skipSpaces() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *wktGeometryParser) peek() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *wktGeometryParser) expect(c byte) error {
+	if p.peek() != c {
+		return fmt.Errorf("error decoding WKT: expected %q at position %d", c, p.pos)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *wktGeometryParser) keyword() string {
+	p.skipSpaces()
+	start := p.pos
+	for p.pos < len(p.s) && (unicode.IsLetter(rune(p.s[p.pos])) || p.s[p.pos] == '_') {
+		p.pos++
+	}
+	return strings.ToUpper(p.s[start:p.pos])
+}
+
+func (p *wktGeometryParser) parseGeometry(feature *Feature) error {
+	kind := p.keyword()
+	if kind == "" {
+		return fmt.Errorf("error decoding WKT: expected geometry type at position %d", p.pos)
+	}
+	// Dimension markers (Z, M, ZM) are optional, extra ordinates are ignored.
+	save := p.pos
+	switch p.keyword() {
+	case "Z", "M", "ZM":
+	case "EMPTY":
+		return nil
+	default:
+		p.pos = save
+	}
+
+	if kind == "GEOMETRYCOLLECTION" {
+		if err := p.expect('('); err != nil {
+			return err
+		}
+		for {
+			if err := p.parseGeometry(feature); err != nil {
+				return err
+			}
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+		}
+		return p.expect(')')
+	}
+
+	list, err := p.parseList()
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case "POLYGON":
+		polygon, err := wktPolygon(list)
+		if err != nil {
+			return err
+		}
+		feature.Polygons = append(feature.Polygons, polygon)
+	case "MULTIPOLYGON":
+		for _, l := range list.lists {
+			polygon, err := wktPolygon(l)
+			if err != nil {
+				return err
+			}
+			feature.Polygons = append(feature.Polygons, polygon)
+		}
+	case "LINESTRING":
+		feature.Lines = append(feature.Lines, geom.LineString(list.points))
+	case "MULTILINESTRING":
+		for _, l := range list.lists {
+			feature.Lines = append(feature.Lines, geom.LineString(l.points))
+		}
+	case "POINT", "MULTIPOINT":
+	default:
+		return fmt.Errorf("error decoding WKT: unsupported geometry type %q", kind)
+	}
+	return nil
+}
+
+// parseList parses parenthesised list of nested lists or positions. EMPTY members are
+// parsed as empty lists.
+func (p *wktGeometryParser) parseList() (wktList, error) {
+	var list wktList
+	if err := p.expect('('); err != nil {
+		return list, err
+	}
+	for {
+		switch c := p.peek(); {
+		case c == '(':
+			nested, err := p.parseList()
+			if err != nil {
+				return list, err
+			}
+			list.lists = append(list.lists, nested)
+		case c == 'E' || c == 'e':
+			if p.keyword() != "EMPTY" {
+				return list, fmt.Errorf("error decoding WKT: unexpected keyword at position %d", p.pos)
+			}
+			list.lists = append(list.lists, wktList{})
+		default:
+			point, err := p.parsePosition()
+			if err != nil {
+				return list, err
+			}
+			list.points = append(list.points, point)
+		}
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+	return list, p.expect(')')
+}
+
+func (p *wktGeometryParser) parsePosition() (geom.Point, error) {
+	var ordinates []float64
+	for {
+		p.skipSpaces()
+		start := p.pos
+		for p.pos < len(p.s) && strings.IndexByte("+-.0123456789eE", p.s[p.pos]) >= 0 {
+			p.pos++
+		}
+		if start == p.pos {
+			break
+		}
+		value, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+		if err != nil {
+			return geom.Point{}, fmt.Errorf("error decoding WKT: invalid number %q", p.s[start:p.pos])
+		}
+		ordinates = append(ordinates, value)
+	}
+	if len(ordinates) < 2 {
+		return geom.Point{}, fmt.Errorf("error decoding WKT: invalid position at position %d", p.pos)
+	}
+	return geom.Point{X: ordinates[0], Y: ordinates[1]}, nil
+}
+
+func wktPolygon(list wktList) (geom.Polygon, error) {
+	polygon := make(geom.Polygon, 0, len(list.lists))
+	for _, ring := range list.lists {
+		if len(ring.points) < 3 {
+			return nil, fmt.Errorf("error decoding WKT: polygon ring needs at least 3 positions")
+		}
+		polygon = append(polygon, ring.points)
+	}
+	return polygon, nil
+}
@@ -0,0 +1,40 @@
+/*
+Package atomicfile writes files atomically, so that readers never see partially written
+files and files linked to the replaced ones are kept.
+*/
+
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteFile writes file atomically: body is written to a temporary file next to it, which
+// then replaces the file. Files linked to the replaced one (e.g. duplicate tiles sharing a
+// blob or empty tiles sharing a placeholder) are not modified.
+func WriteFile(name string, body []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(body); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package atomicfile_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/atomicfile"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	name, link := filepath.Join(dir, "1.png"), filepath.Join(dir, "2.png")
+	assert.NoError(t, atomicfile.WriteFile(name, []byte("placeholder")))
+	assert.NoError(t, os.Link(name, link))
+
+	assert.NoError(t, atomicfile.WriteFile(name, []byte("updated")))
+
+	body, err := os.ReadFile(name)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("updated"), body)
+	body, err = os.ReadFile(link)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("placeholder"), body)
+	info, err := os.Stat(name)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+	// No temporary files are left.
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
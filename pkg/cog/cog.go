@@ -0,0 +1,368 @@
+/*
+Package cog writes Cloud Optimized GeoTIFFs of tile pyramids in Web Mercator.
+
+Tiles are compressed as they are written and kept in temporary files, so only offsets and
+sizes of written tiles are held in memory. The file is assembled when the writer is closed: header
+and image file directories (IFDs) of all levels come first, followed by tile data of
+overviews, from the smallest one, and of the full resolution image.
+*/
+
+package cog
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"math"
+	"os"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+)
+
+// Compression methods of tiles.
+const (
+	Deflate string = "deflate"
+	JPEG           = "jpeg"
+)
+
+// Masks of pixels without data: alpha band, or nodata value (0) of RGB bands given by
+// GDAL_NODATA tag.
+const (
+	MaskAlpha  string = "alpha"
+	MaskNoData        = "nodata"
+)
+
+// MaxTiles is the maximum number of internal tiles of the full resolution image. Offsets
+// and sizes of all tiles (also of tiles without data) are stored in IFDs.
+const MaxTiles = 1 << 20
+
+// GeoKeys of Web Mercator: projected model, pixels as areas, EPSG:3857.
+var geoKeys = []uint16{
+	1, 1, 0, 3,
+	1024, 0, 1, 1,
+	1025, 0, 1, 1,
+	3072, 0, 1, 3857,
+}
+
+type Option func(w *Writer)
+
+// WithCompression sets compression of tiles, Deflate by default.
+func WithCompression(compression string) Option {
+	return func(w *Writer) {
+		w.compression = compression
+	}
+}
+
+// WithQuality sets quality (1-100) of JPEG tiles, jpeg.DefaultQuality by default.
+func WithQuality(quality int) Option {
+	return func(w *Writer) {
+		w.quality = quality
+	}
+}
+
+// WithMask sets mask of pixels without data, MaskAlpha by default. JPEG compression
+// supports only MaskNoData.
+func WithMask(mask string) Option {
+	return func(w *Writer) {
+		w.mask = mask
+	}
+}
+
+// tile is position of compressed tile in temporary file of its level.
+type tile struct {
+	offset, count uint64
+}
+
+// level is an image of the pyramid, with tiles stored in temporary file.
+type level struct {
+	width, height int
+	cols, rows    int
+	file          *os.File
+	size          uint64
+	// tiles are written tiles, by index (row*cols + col).
+	tiles map[int]tile
+}
+
+// tileArrays returns offsets (from given start of tile data of the level) and sizes of all
+// tiles of the level, zero for tiles without data.
+func (l *level) tileArrays(start uint64) ([]uint64, []uint64) {
+	offsets := make([]uint64, l.cols*l.rows)
+	counts := make([]uint64, l.cols*l.rows)
+	for i, t := range l.tiles {
+		offsets[i], counts[i] = start+t.offset, t.count
+	}
+	return offsets, counts
+}
+
+// Writer writes Cloud Optimized GeoTIFF. Writer is not safe for concurrent use.
+type Writer struct {
+	dst         io.Writer
+	bounds      mercantile.Bbox
+	tileSize    int
+	compression string
+	quality     int
+	mask        string
+	levels      []*level
+	closed      bool
+}
+
+// NewWriter returns writer of GeoTIFF of given bounds (in Web Mercator) and size of the full
+// resolution image, with internal tiles of given size and overviews halving size of the
+// image given number of times.
+func NewWriter(dst io.Writer, bounds mercantile.Bbox, width, height, tileSize, overviews int, options ...Option) (*Writer, error) {
+	w := &Writer{
+		dst: dst, bounds: bounds, tileSize: tileSize,
+		compression: Deflate, quality: jpeg.DefaultQuality, mask: MaskAlpha,
+	}
+	for _, option := range options {
+		option(w)
+	}
+
+	switch {
+	case w.compression != Deflate && w.compression != JPEG:
+		return nil, fmt.Errorf("unsupported compression: %s (use deflate or jpeg)", w.compression)
+	case w.mask != MaskAlpha && w.mask != MaskNoData:
+		return nil, fmt.Errorf("unsupported mask: %s (use alpha or nodata)", w.mask)
+	case w.compression == JPEG && w.mask == MaskAlpha:
+		return nil, errors.New("alpha mask is not supported with JPEG compression (use nodata mask)")
+	case w.quality < 1 || w.quality > 100:
+		return nil, fmt.Errorf("invalid quality: %d (use 1-100)", w.quality)
+	case tileSize <= 0 || tileSize%16 != 0:
+		return nil, fmt.Errorf("invalid tile size: %d (use multiple of 16)", tileSize)
+	case width <= 0 || height <= 0 || overviews < 0:
+		return nil, fmt.Errorf("invalid image size: %dx%d with %d overviews", width, height, overviews)
+	}
+
+	for i := 0; i <= overviews; i++ {
+		l := &level{width: max(width>>i, 1), height: max(height>>i, 1)}
+		l.cols = (l.width + tileSize - 1) / tileSize
+		l.rows = (l.height + tileSize - 1) / tileSize
+		if i == 0 && l.cols*l.rows > MaxTiles {
+			return nil, fmt.Errorf("too many tiles: %dx%d (limit %d tiles)", l.cols, l.rows, MaxTiles)
+		}
+		l.tiles = map[int]tile{}
+		w.levels = append(w.levels, l)
+	}
+	return w, nil
+}
+
+// Levels returns sizes of the full resolution image and its overviews.
+func (w *Writer) Levels() []image.Point {
+	sizes := make([]image.Point, 0, len(w.levels))
+	for _, l := range w.levels {
+		sizes = append(sizes, image.Pt(l.width, l.height))
+	}
+	return sizes
+}
+
+// WriteTile compresses tile in given column and row of the level (0 for the full resolution
+// image, 1 for the first overview etc.). Tiles which are not written have no data.
+func (w *Writer) WriteTile(index, col, row int, img image.Image) error {
+	if index < 0 || index >= len(w.levels) {
+		return fmt.Errorf("invalid level: %d", index)
+	}
+	l := w.levels[index]
+	if col < 0 || col >= l.cols || row < 0 || row >= l.rows {
+		return fmt.Errorf("invalid tile %d/%d of level %d", col, row, index)
+	}
+	if size := img.Bounds().Size(); size.X != w.tileSize || size.Y != w.tileSize {
+		return fmt.Errorf("unexpected tile size: %dx%d (expected %dx%d)", size.X, size.Y, w.tileSize, w.tileSize)
+	}
+
+	body, err := w.encode(img)
+	if err != nil {
+		return err
+	}
+	if l.file == nil {
+		if l.file, err = os.CreateTemp("", "cog-*"); err != nil {
+			return err
+		}
+	}
+	if _, err := l.file.Write(body); err != nil {
+		return err
+	}
+	l.tiles[row*l.cols+col] = tile{offset: l.size, count: uint64(len(body))}
+	l.size += uint64(len(body))
+	return nil
+}
+
+// encode compresses tile image, with alpha band or with pixels without data set to nodata.
+func (w *Writer) encode(img image.Image) ([]byte, error) {
+	src := image.NewNRGBA(image.Rect(0, 0, w.tileSize, w.tileSize))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+	if w.mask == MaskNoData {
+		for i := 0; i < len(src.Pix); i += 4 {
+			if src.Pix[i+3] == 0 {
+				src.Pix[i], src.Pix[i+1], src.Pix[i+2] = 0, 0, 0
+			}
+			src.Pix[i+3] = 255
+		}
+	}
+
+	var buf bytes.Buffer
+	if w.compression == JPEG {
+		if err := jpeg.Encode(&buf, src, &jpeg.Options{Quality: w.quality}); err != nil {
+			return nil, fmt.Errorf("error encoding tile: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	samples := w.samplesPerPixel()
+	pix := make([]byte, 0, w.tileSize*w.tileSize*samples)
+	for i := 0; i < len(src.Pix); i += 4 {
+		pix = append(pix, src.Pix[i:i+samples]...)
+	}
+	// Horizontal predictor stores differences of samples of neighbouring pixels.
+	rowSize := w.tileSize * samples
+	for y := 0; y < w.tileSize; y++ {
+		row := pix[y*rowSize : (y+1)*rowSize]
+		for i := rowSize - 1; i >= samples; i-- {
+			row[i] -= row[i-samples]
+		}
+	}
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(pix); err != nil {
+		return nil, fmt.Errorf("error compressing tile: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("error compressing tile: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (w *Writer) samplesPerPixel() int {
+	if w.mask == MaskAlpha {
+		return 4
+	}
+	return 3
+}
+
+// Close writes the GeoTIFF and removes temporary files of tiles. Closing closed writer
+// does nothing.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer w.cleanup()
+
+	var dataSize uint64
+	for _, l := range w.levels {
+		dataSize += l.size
+	}
+	big := false
+	ifds := w.ifds(big)
+	if headerSize(big)+ifdsSize(ifds, big)+dataSize > math.MaxUint32 {
+		big = true
+		ifds = w.ifds(big)
+	}
+
+	// Tile data of levels follows IFDs, from the smallest overview to the full resolution.
+	dataStart := headerSize(big) + ifdsSize(ifds, big)
+	starts := make([]uint64, len(w.levels))
+	next := dataStart
+	for i := len(w.levels) - 1; i >= 0; i-- {
+		starts[i] = next
+		next += w.levels[i].size
+	}
+	for i, l := range w.levels {
+		offsets, counts := l.tileArrays(starts[i])
+		entries := ifds[i][:len(ifds[i])-2]
+		ifds[i] = append(entries, offsetsEntry(tagTileOffsets, offsets, big), offsetsEntry(tagTileByteCounts, counts, big))
+		sortEntries(ifds[i])
+	}
+
+	var buf bytes.Buffer
+	writeHeader(&buf, big)
+	writeIFDs(&buf, ifds, headerSize(big), big)
+	if _, err := w.dst.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	for i := len(w.levels) - 1; i >= 0; i-- {
+		l := w.levels[i]
+		if l.file == nil {
+			continue
+		}
+		if _, err := l.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.Copy(w.dst, l.file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Writer) cleanup() {
+	for _, l := range w.levels {
+		if l.file != nil {
+			l.file.Close()
+			os.Remove(l.file.Name())
+			l.file = nil
+		}
+	}
+}
+
+// ifds returns entries of IFDs of all levels, without tile offsets and sizes.
+func (w *Writer) ifds(big bool) [][]entry {
+	samples := w.samplesPerPixel()
+	bits := make([]uint16, samples)
+	for i := range bits {
+		bits[i] = 8
+	}
+
+	ifds := make([][]entry, len(w.levels))
+	for i, l := range w.levels {
+		subfileType := uint32(0)
+		if i > 0 {
+			// Reduced resolution version of the image.
+			subfileType = 1
+		}
+		entries := []entry{
+			longEntry(tagNewSubfileType, subfileType),
+			longEntry(tagImageWidth, uint32(l.width)),
+			longEntry(tagImageLength, uint32(l.height)),
+			shortEntry(tagBitsPerSample, bits...),
+			shortEntry(tagSamplesPerPixel, uint16(samples)),
+			shortEntry(tagPlanarConfig, 1),
+			longEntry(tagTileWidth, uint32(w.tileSize)),
+			longEntry(tagTileLength, uint32(w.tileSize)),
+		}
+		if w.compression == JPEG {
+			entries = append(entries,
+				shortEntry(tagCompression, compressionJPEG),
+				shortEntry(tagPhotometric, photometricYCbCr),
+				shortEntry(tagYCbCrSubSampling, 2, 2),
+			)
+		} else {
+			entries = append(entries,
+				shortEntry(tagCompression, compressionDeflate),
+				shortEntry(tagPhotometric, photometricRGB),
+				shortEntry(tagPredictor, predictorHorizontal),
+			)
+		}
+		if w.mask == MaskAlpha {
+			entries = append(entries, shortEntry(tagExtraSamples, extraSampleUnassocAlp))
+		} else {
+			entries = append(entries, asciiEntry(tagGDALNoData, "0"))
+		}
+		if i == 0 {
+			res := (w.bounds.Right - w.bounds.Left) / float64(l.width)
+			entries = append(entries,
+				doubleEntry(tagModelPixelScale, res, (w.bounds.Top-w.bounds.Bottom)/float64(l.height), 0),
+				doubleEntry(tagModelTiepoint, 0, 0, 0, w.bounds.Left, w.bounds.Top, 0),
+				shortEntry(tagGeoKeyDirectory, geoKeys...),
+			)
+		}
+		// Offsets and sizes of tiles (the last two entries) are replaced once positions of
+		// tile data are known.
+		offsets, counts := l.tileArrays(0)
+		ifds[i] = append(entries, offsetsEntry(tagTileOffsets, offsets, big), offsetsEntry(tagTileByteCounts, counts, big))
+	}
+	return ifds
+}
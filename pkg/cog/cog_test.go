@@ -0,0 +1,226 @@
+package cog_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/cog"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+)
+
+// ifd maps tags to values of a classic TIFF IFD, read as unsigned integers (or raw bytes of
+// doubles and ASCII).
+type ifd map[uint16][]uint64
+
+// readIFDs reads IFDs of little endian classic TIFF, along with raw values of entries.
+func readIFDs(t *testing.T, data []byte) ([]ifd, []map[uint16][]byte) {
+	t.Helper()
+	le := binary.LittleEndian
+	assert.Equal(t, "II", string(data[:2]))
+	assert.Equal(t, uint16(42), le.Uint16(data[2:]))
+
+	sizes := map[uint16]int{2: 1, 3: 2, 4: 4, 12: 8}
+	var ifds []ifd
+	var raws []map[uint16][]byte
+	for offset := le.Uint32(data[4:]); offset != 0; {
+		n := int(le.Uint16(data[offset:]))
+		entries, raw := ifd{}, map[uint16][]byte{}
+		var previous uint16
+		for i := 0; i < n; i++ {
+			e := data[int(offset)+2+12*i:]
+			tag, typ, count := le.Uint16(e), le.Uint16(e[2:]), int(le.Uint32(e[4:]))
+			assert.Greater(t, tag, previous, "entries sorted by tag")
+			previous = tag
+			size := sizes[typ] * count
+			value := e[8:12]
+			if size > 4 {
+				value = data[le.Uint32(e[8:]):]
+			}
+			raw[tag] = value[:size]
+			for j := 0; j < count; j++ {
+				switch typ {
+				case 3:
+					entries[tag] = append(entries[tag], uint64(le.Uint16(value[2*j:])))
+				case 4:
+					entries[tag] = append(entries[tag], uint64(le.Uint32(value[4*j:])))
+				}
+			}
+		}
+		ifds = append(ifds, entries)
+		raws = append(raws, raw)
+		offset = le.Uint32(data[int(offset)+2+12*n:])
+	}
+	return ifds, raws
+}
+
+func doubles(raw []byte) []float64 {
+	values := make([]float64, len(raw)/8)
+	for i := range values {
+		values[i] = math.Float64frombits(binary.LittleEndian.Uint64(raw[8*i:]))
+	}
+	return values
+}
+
+func uniform(size int, c color.Color) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+func TestWriter(t *testing.T) {
+	bounds := mercantile.XyBounds(mercantile.TileID{X: 571, Y: 337, Z: 10})
+	var buf bytes.Buffer
+	w, err := cog.NewWriter(&buf, bounds, 64, 64, 32, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []image.Point{{64, 64}, {32, 32}}, w.Levels())
+
+	red := color.NRGBA{R: 200, G: 10, B: 20, A: 255}
+	translucent := color.NRGBA{R: 10, G: 20, B: 30, A: 128}
+	assert.NoError(t, w.WriteTile(0, 0, 0, uniform(32, red)))
+	assert.NoError(t, w.WriteTile(0, 1, 1, uniform(32, translucent)))
+	assert.NoError(t, w.WriteTile(1, 0, 0, uniform(32, red)))
+	assert.NoError(t, w.Close())
+
+	data := buf.Bytes()
+	ifds, raws := readIFDs(t, data)
+	assert.Len(t, ifds, 2)
+
+	full, overview := ifds[0], ifds[1]
+	assert.Equal(t, []uint64{0}, full[254])
+	assert.Equal(t, []uint64{1}, overview[254])
+	assert.Equal(t, []uint64{64}, full[256])
+	assert.Equal(t, []uint64{32}, overview[256])
+	assert.Equal(t, []uint64{8, 8, 8, 8}, full[258])
+	assert.Equal(t, []uint64{8}, full[259])
+	assert.Equal(t, []uint64{2}, full[262])
+	assert.Equal(t, []uint64{4}, full[277])
+	assert.Equal(t, []uint64{2}, full[317])
+	assert.Equal(t, []uint64{32}, full[322])
+	assert.Equal(t, []uint64{2}, full[338])
+	assert.Equal(t, []uint64{1, 1, 0, 3, 1024, 0, 1, 1, 1025, 0, 1, 1, 3072, 0, 1, 3857}, full[34735])
+	assert.NotContains(t, overview, uint16(34735))
+
+	res := (bounds.Right - bounds.Left) / 64
+	assert.InDeltaSlice(t, []float64{res, res, 0}, doubles(raws[0][33550]), 1e-9)
+	assert.Equal(t, []float64{0, 0, 0, bounds.Left, bounds.Top, 0}, doubles(raws[0][33922]))
+
+	// Tiles which are not written are sparse, data of overview precedes full resolution.
+	offsets, counts := full[324], full[325]
+	assert.Len(t, offsets, 4)
+	assert.Equal(t, []uint64{0, 0}, []uint64{offsets[1], counts[1]})
+	assert.Equal(t, []uint64{0, 0}, []uint64{offsets[2], counts[2]})
+	assert.Less(t, overview[324][0], offsets[0])
+	assert.Less(t, offsets[0], offsets[3])
+	assert.Equal(t, uint64(len(data)), offsets[3]+counts[3])
+
+	for i, expected := range map[int]color.NRGBA{0: red, 3: translucent} {
+		r, err := zlib.NewReader(bytes.NewReader(data[offsets[i] : offsets[i]+counts[i]]))
+		assert.NoError(t, err)
+		pix, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Len(t, pix, 32*32*4)
+		// The first pixel of a row keeps its value, others are differences.
+		assert.Equal(t, []byte{expected.R, expected.G, expected.B, expected.A}, pix[:4])
+		assert.Equal(t, []byte{0, 0, 0, 0}, pix[4:8])
+	}
+}
+
+func TestWriterJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := cog.NewWriter(
+		&buf, mercantile.XyBounds(mercantile.TileID{}), 32, 32, 32, 0,
+		cog.WithCompression(cog.JPEG), cog.WithMask(cog.MaskNoData), cog.WithQuality(90),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, w.WriteTile(0, 0, 0, uniform(32, color.NRGBA{})))
+	assert.NoError(t, w.Close())
+
+	data := buf.Bytes()
+	ifds, raws := readIFDs(t, data)
+	assert.Len(t, ifds, 1)
+	assert.Equal(t, []uint64{8, 8, 8}, ifds[0][258])
+	assert.Equal(t, []uint64{7}, ifds[0][259])
+	assert.Equal(t, []uint64{6}, ifds[0][262])
+	assert.Equal(t, []uint64{2, 2}, ifds[0][530])
+	assert.NotContains(t, ifds[0], uint16(338))
+	assert.Equal(t, "0\x00", string(raws[0][42113]))
+
+	offset, count := ifds[0][324][0], ifds[0][325][0]
+	img, err := jpeg.Decode(bytes.NewReader(data[offset : offset+count]))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(32, 32), img.Bounds().Size())
+	// Transparent pixels are set to nodata.
+	r, g, b, _ := img.At(16, 16).RGBA()
+	assert.Equal(t, []uint32{0, 0, 0}, []uint32{r >> 8, g >> 8, b >> 8})
+}
+
+func TestNewWriterErrors(t *testing.T) {
+	tests := map[string]struct {
+		TileSize int
+		Options  []cog.Option
+		Error    string
+	}{
+		"Compression": {
+			TileSize: 256,
+			Options:  []cog.Option{cog.WithCompression("lzw")},
+			Error:    "unsupported compression: lzw (use deflate or jpeg)",
+		},
+		"Mask": {
+			TileSize: 256,
+			Options:  []cog.Option{cog.WithMask("internal")},
+			Error:    "unsupported mask: internal (use alpha or nodata)",
+		},
+		"JPEG with alpha": {
+			TileSize: 256,
+			Options:  []cog.Option{cog.WithCompression(cog.JPEG)},
+			Error:    "alpha mask is not supported with JPEG compression (use nodata mask)",
+		},
+		"Quality": {
+			TileSize: 256,
+			Options:  []cog.Option{cog.WithQuality(0)},
+			Error:    "invalid quality: 0 (use 1-100)",
+		},
+		"Tile size": {
+			TileSize: 100,
+			Error:    "invalid tile size: 100 (use multiple of 16)",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := cog.NewWriter(io.Discard, mercantile.Bbox{}, 512, 512, test.TileSize, 1, test.Options...)
+			assert.EqualError(t, err, test.Error)
+		})
+	}
+}
+
+func TestNewWriterTooManyTiles(t *testing.T) {
+	_, err := cog.NewWriter(io.Discard, mercantile.Bbox{}, 1025*16, 1024*16, 16, 10)
+	assert.EqualError(t, err, "too many tiles: 1025x1024 (limit 1048576 tiles)")
+
+	// Only written tiles are held in memory.
+	w, err := cog.NewWriter(io.Discard, mercantile.Bbox{}, 1024*16, 1024*16, 16, 10)
+	assert.NoError(t, err)
+	assert.NoError(t, w.WriteTile(0, 1023, 1023, uniform(16, color.White)))
+	assert.NoError(t, w.Close())
+}
+
+func TestWriteTileErrors(t *testing.T) {
+	w, err := cog.NewWriter(io.Discard, mercantile.Bbox{}, 64, 64, 32, 1)
+	assert.NoError(t, err)
+	defer w.Close()
+
+	assert.EqualError(t, w.WriteTile(2, 0, 0, uniform(32, color.White)), "invalid level: 2")
+	assert.EqualError(t, w.WriteTile(1, 1, 0, uniform(32, color.White)), "invalid tile 1/0 of level 1")
+	assert.EqualError(t, w.WriteTile(0, 0, 0, uniform(16, color.White)), "unexpected tile size: 16x16 (expected 32x32)")
+}
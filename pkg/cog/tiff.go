@@ -0,0 +1,219 @@
+package cog
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"math"
+	"slices"
+)
+
+// TIFF tags.
+const (
+	tagNewSubfileType     = 254
+	tagImageWidth         = 256
+	tagImageLength        = 257
+	tagBitsPerSample      = 258
+	tagCompression        = 259
+	tagPhotometric        = 262
+	tagSamplesPerPixel    = 277
+	tagPlanarConfig       = 284
+	tagPredictor          = 317
+	tagTileWidth          = 322
+	tagTileLength         = 323
+	tagTileOffsets        = 324
+	tagTileByteCounts     = 325
+	tagExtraSamples       = 338
+	tagYCbCrSubSampling   = 530
+	tagModelPixelScale    = 33550
+	tagModelTiepoint      = 33922
+	tagGeoKeyDirectory    = 34735
+	tagGDALNoData         = 42113
+	compressionJPEG       = 7
+	compressionDeflate    = 8
+	photometricRGB        = 2
+	photometricYCbCr      = 6
+	predictorHorizontal   = 2
+	extraSampleUnassocAlp = 2
+)
+
+// TIFF field types.
+const (
+	typeASCII  = 2
+	typeShort  = 3
+	typeLong   = 4
+	typeDouble = 12
+	typeLong8  = 16
+)
+
+// entry is a field of IFD with its value encoded in little endian byte order.
+type entry struct {
+	tag   uint16
+	typ   uint16
+	count uint64
+	value []byte
+}
+
+func shortEntry(tag uint16, values ...uint16) entry {
+	value := make([]byte, 0, 2*len(values))
+	for _, v := range values {
+		value = binary.LittleEndian.AppendUint16(value, v)
+	}
+	return entry{tag: tag, typ: typeShort, count: uint64(len(values)), value: value}
+}
+
+func longEntry(tag uint16, values ...uint32) entry {
+	value := make([]byte, 0, 4*len(values))
+	for _, v := range values {
+		value = binary.LittleEndian.AppendUint32(value, v)
+	}
+	return entry{tag: tag, typ: typeLong, count: uint64(len(values)), value: value}
+}
+
+func doubleEntry(tag uint16, values ...float64) entry {
+	value := make([]byte, 0, 8*len(values))
+	for _, v := range values {
+		value = binary.LittleEndian.AppendUint64(value, math.Float64bits(v))
+	}
+	return entry{tag: tag, typ: typeDouble, count: uint64(len(values)), value: value}
+}
+
+func asciiEntry(tag uint16, s string) entry {
+	value := append([]byte(s), 0)
+	return entry{tag: tag, typ: typeASCII, count: uint64(len(value)), value: value}
+}
+
+// offsetsEntry returns entry of tile offsets or sizes, LONG in classic TIFF and LONG8 in
+// BigTIFF.
+func offsetsEntry(tag uint16, values []uint64, big bool) entry {
+	if big {
+		value := make([]byte, 0, 8*len(values))
+		for _, v := range values {
+			value = binary.LittleEndian.AppendUint64(value, v)
+		}
+		return entry{tag: tag, typ: typeLong8, count: uint64(len(values)), value: value}
+	}
+	longs := make([]uint32, len(values))
+	for i, v := range values {
+		longs[i] = uint32(v)
+	}
+	return longEntry(tag, longs...)
+}
+
+// sortEntries sorts entries by tag, as required in IFDs.
+func sortEntries(entries []entry) {
+	slices.SortFunc(entries, func(a, b entry) int {
+		return cmp.Compare(a.tag, b.tag)
+	})
+}
+
+func headerSize(big bool) uint64 {
+	if big {
+		return 16
+	}
+	return 8
+}
+
+// inlineSize is the size of values stored within IFD entries.
+func inlineSize(big bool) int {
+	if big {
+		return 8
+	}
+	return 4
+}
+
+// entriesSize returns size of IFD with n entries: number of entries, entries and offset
+// of the next IFD.
+func entriesSize(n int, big bool) uint64 {
+	if big {
+		return uint64(8 + 20*n + 8)
+	}
+	return uint64(2 + 12*n + 4)
+}
+
+// ifdSize returns size of IFD along with values of its entries which do not fit in them.
+func ifdSize(entries []entry, big bool) uint64 {
+	size := entriesSize(len(entries), big)
+	for _, e := range entries {
+		if len(e.value) > inlineSize(big) {
+			size += uint64(len(e.value) + len(e.value)%2)
+		}
+	}
+	return size
+}
+
+func ifdsSize(ifds [][]entry, big bool) uint64 {
+	var size uint64
+	for _, entries := range ifds {
+		size += ifdSize(entries, big)
+	}
+	return size
+}
+
+// writeHeader writes little endian header of classic TIFF or BigTIFF, with the first IFD
+// directly after it.
+func writeHeader(buf *bytes.Buffer, big bool) {
+	buf.WriteString("II")
+	if big {
+		buf.Write(binary.LittleEndian.AppendUint16(nil, 43))
+		buf.Write(binary.LittleEndian.AppendUint16(nil, 8))
+		buf.Write(binary.LittleEndian.AppendUint16(nil, 0))
+		buf.Write(binary.LittleEndian.AppendUint64(nil, 16))
+		return
+	}
+	buf.Write(binary.LittleEndian.AppendUint16(nil, 42))
+	buf.Write(binary.LittleEndian.AppendUint32(nil, 8))
+}
+
+// writeIFDs writes chained IFDs starting at given offset, each followed by values of its
+// entries which do not fit in them.
+func writeIFDs(buf *bytes.Buffer, ifds [][]entry, offset uint64, big bool) {
+	for i, entries := range ifds {
+		size := ifdSize(entries, big)
+		next := offset + size
+		if i == len(ifds)-1 {
+			next = 0
+		}
+
+		var values bytes.Buffer
+		valuesOffset := offset + entriesSize(len(entries), big)
+		if big {
+			buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(entries))))
+		} else {
+			buf.Write(binary.LittleEndian.AppendUint16(nil, uint16(len(entries))))
+		}
+		for _, e := range entries {
+			buf.Write(binary.LittleEndian.AppendUint16(nil, e.tag))
+			buf.Write(binary.LittleEndian.AppendUint16(nil, e.typ))
+			if big {
+				buf.Write(binary.LittleEndian.AppendUint64(nil, e.count))
+			} else {
+				buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(e.count)))
+			}
+			field := make([]byte, inlineSize(big))
+			if len(e.value) <= inlineSize(big) {
+				copy(field, e.value)
+			} else {
+				// Values outside of the entry are aligned to word boundary.
+				at := valuesOffset + uint64(values.Len())
+				if big {
+					binary.LittleEndian.PutUint64(field, at)
+				} else {
+					binary.LittleEndian.PutUint32(field, uint32(at))
+				}
+				values.Write(e.value)
+				if values.Len()%2 != 0 {
+					values.WriteByte(0)
+				}
+			}
+			buf.Write(field)
+		}
+		if big {
+			buf.Write(binary.LittleEndian.AppendUint64(nil, next))
+		} else {
+			buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(next)))
+		}
+		buf.Write(values.Bytes())
+		offset = next
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Package dedupe stores tiles in content-addressed way, keeping each unique tile body once.
+*/
+
+package dedupe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/atomicfile"
+)
+
+// Modes of storing tiles: tile files are hard links or symbolic links to blobs, or only
+// blobs are stored and tiles are listed in the index.
+const (
+	Hardlink string = "hardlink"
+	Symlink         = "symlink"
+	Blob            = "blob"
+)
+
+const (
+	// BlobDir is the directory (within the store) with unique tile bodies, named by SHA-256
+	// of their content.
+	BlobDir = "blobs"
+	// IndexName is the name of the index of blob mode, a tab separated file with tile
+	// names and blobs (relative to the store), one tile per line. Later lines override
+	// earlier ones.
+	IndexName = "index.tsv"
+)
+
+// Stats describes tiles written to the store.
+type Stats struct {
+	Files      int
+	Unique     int
+	Duplicates int
+	// SavedBytes is the size of duplicated tile bodies which are not stored.
+	SavedBytes int64
+}
+
+// Store writes tiles into directory, keeping each unique tile body once.
+type Store struct {
+	dir  string
+	mode string
+
+	mu    sync.Mutex
+	index *os.File
+	stats Stats
+}
+
+func NewStore(dir, mode string) (*Store, error) {
+	switch mode {
+	case Hardlink, Symlink, Blob:
+	default:
+		return nil, fmt.Errorf("unsupported dedupe mode: %s", mode)
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, mode: mode}, nil
+}
+
+// Write stores tile body under given name (relative to the store directory, e.g.
+// 10/571/337.png). Existing tile file is replaced, files linked to it are not modified.
+func (s *Store) Write(name string, body []byte) error {
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+	blob := filepath.Join(s.dir, BlobDir, hash[:2], hash+filepath.Ext(name))
+	target := filepath.Join(s.dir, name)
+
+	created, err := s.writeBlob(blob, body)
+	if err != nil {
+		return err
+	}
+	linked, err := s.link(blob, target, name)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Files++
+	switch {
+	case created:
+		s.stats.Unique++
+	case !linked:
+		// Tile is stored already.
+	default:
+		s.stats.Duplicates++
+		s.stats.SavedBytes += int64(len(body))
+	}
+	return nil
+}
+
+// writeBlob writes blob unless it exists, reporting whether it was created.
+func (s *Store) writeBlob(blob string, body []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(blob); err == nil {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(blob), os.ModePerm); err != nil {
+		return false, err
+	}
+	if err := atomicfile.WriteFile(blob, body); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// link makes tile file refer to the blob, reporting whether anything was changed (tile
+// linked to the blob already is left as it is).
+func (s *Store) link(blob, target, name string) (bool, error) {
+	linked := linkedTo(target, blob)
+	if s.mode == Blob {
+		if err := s.appendIndex(name, blob); err != nil {
+			return false, err
+		}
+		// Tile files are moved into blobs.
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		return !linked, nil
+	}
+
+	if linked {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return false, err
+	}
+	// Link is created next to the tile and renamed, so the tile is replaced atomically.
+	tmp := target + ".dedupe"
+	os.Remove(tmp)
+	if s.mode == Hardlink {
+		if err := os.Link(blob, tmp); err != nil {
+			return false, err
+		}
+	} else {
+		rel, err := filepath.Rel(filepath.Dir(target), blob)
+		if err != nil {
+			return false, err
+		}
+		if err := os.Symlink(rel, tmp); err != nil {
+			return false, err
+		}
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+	return true, nil
+}
+
+// linkedTo reports whether target is the blob, either as its hard link or symbolic link.
+func linkedTo(target, blob string) bool {
+	targetInfo, err := os.Stat(target)
+	if err != nil {
+		return false
+	}
+	blobInfo, err := os.Stat(blob)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(targetInfo, blobInfo)
+}
+
+func (s *Store) appendIndex(name, blob string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index == nil {
+		f, err := os.OpenFile(filepath.Join(s.dir, IndexName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		s.index = f
+	}
+	rel, err := filepath.Rel(s.dir, blob)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.index, "%s\t%s\n", filepath.ToSlash(name), filepath.ToSlash(rel))
+	return err
+}
+
+// Stats returns statistics of tiles written so far.
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Close closes the index file of blob mode.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index == nil {
+		return nil
+	}
+	err := s.index.Close()
+	s.index = nil
+	return err
+}
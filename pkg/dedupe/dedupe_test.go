@@ -0,0 +1,124 @@
+package dedupe_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/atomicfile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/dedupe"
+)
+
+func TestStore_Write(t *testing.T) {
+	tests := map[string]struct {
+		mode string
+	}{
+		"hard links":     {mode: dedupe.Hardlink},
+		"symbolic links": {mode: dedupe.Symlink},
+		"blobs":          {mode: dedupe.Blob},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := dedupe.NewStore(dir, tc.mode)
+			assert.NoError(t, err)
+
+			assert.NoError(t, store.Write("1/0/0.png", []byte("sea")))
+			assert.NoError(t, store.Write("1/0/1.png", []byte("sea")))
+			assert.NoError(t, store.Write("1/1/0.png", []byte("land")))
+			assert.NoError(t, store.Close())
+
+			assert.Equal(t, dedupe.Stats{Files: 3, Unique: 2, Duplicates: 1, SavedBytes: 3}, store.Stats())
+			blobs, _ := filepath.Glob(filepath.Join(dir, dedupe.BlobDir, "*", "*.png"))
+			assert.Len(t, blobs, 2)
+
+			if tc.mode == dedupe.Blob {
+				index, err := os.ReadFile(filepath.Join(dir, dedupe.IndexName))
+				assert.NoError(t, err)
+				assert.Equal(t,
+					"1/0/0.png\tblobs/4a/4a69f19c8c264850d0f0fca1d7cd8ac0d07771cb9aaf5923c2c621a3e0f74475.png\n"+
+						"1/0/1.png\tblobs/4a/4a69f19c8c264850d0f0fca1d7cd8ac0d07771cb9aaf5923c2c621a3e0f74475.png\n"+
+						"1/1/0.png\tblobs/90/90eae63487cae2df5b793b07c622680d2df6c9a024891c8a9bd98d08d5bc3d92.png\n",
+					string(index),
+				)
+				assert.NoFileExists(t, filepath.Join(dir, "1/0/0.png"))
+				return
+			}
+
+			body, err := os.ReadFile(filepath.Join(dir, "1/0/1.png"))
+			assert.NoError(t, err)
+			assert.Equal(t, "sea", string(body))
+			first, _ := os.Stat(filepath.Join(dir, "1/0/0.png"))
+			second, _ := os.Stat(filepath.Join(dir, "1/0/1.png"))
+			assert.True(t, os.SameFile(first, second))
+			if tc.mode == dedupe.Symlink {
+				target, err := os.Readlink(filepath.Join(dir, "1/0/1.png"))
+				assert.NoError(t, err)
+				assert.False(t, filepath.IsAbs(target))
+			}
+		})
+	}
+}
+
+func TestStore_WriteReplacesLinkedTile(t *testing.T) {
+	dir := t.TempDir()
+	store, err := dedupe.NewStore(dir, dedupe.Hardlink)
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.Write("1/0/0.png", []byte("sea")))
+	assert.NoError(t, store.Write("1/0/1.png", []byte("sea")))
+	// Tile linked to the same blob is not modified by the new content of the other one.
+	assert.NoError(t, store.Write("1/0/0.png", []byte("island")))
+
+	body, err := os.ReadFile(filepath.Join(dir, "1/0/1.png"))
+	assert.NoError(t, err)
+	assert.Equal(t, "sea", string(body))
+	body, err = os.ReadFile(filepath.Join(dir, "1/0/0.png"))
+	assert.NoError(t, err)
+	assert.Equal(t, "island", string(body))
+
+	// Tiles already linked to their blobs are not counted as duplicates again.
+	assert.NoError(t, store.Write("1/0/1.png", []byte("sea")))
+	assert.Equal(t, dedupe.Stats{Files: 4, Unique: 2, Duplicates: 1, SavedBytes: 3}, store.Stats())
+}
+
+func TestNewStore(t *testing.T) {
+	_, err := dedupe.NewStore(t.TempDir(), "copy")
+	assert.EqualError(t, err, "unsupported dedupe mode: copy")
+}
+
+func TestWriteFileKeepsDuplicates(t *testing.T) {
+	tests := map[string]struct {
+		mode string
+	}{
+		"hard links":     {mode: dedupe.Hardlink},
+		"symbolic links": {mode: dedupe.Symlink},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := dedupe.NewStore(dir, tc.mode)
+			assert.NoError(t, err)
+			assert.NoError(t, store.Write("10/1/1.png", []byte("duplicate")))
+			assert.NoError(t, store.Write("10/1/2.png", []byte("duplicate")))
+			assert.NoError(t, store.Close())
+
+			// Tile is written later without the store.
+			assert.NoError(t, atomicfile.WriteFile(filepath.Join(dir, "10/1/1.png"), []byte("updated")))
+
+			body, err := os.ReadFile(filepath.Join(dir, "10/1/1.png"))
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("updated"), body)
+			body, err = os.ReadFile(filepath.Join(dir, "10/1/2.png"))
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("duplicate"), body)
+			info, err := os.Lstat(filepath.Join(dir, "10/1/1.png"))
+			assert.NoError(t, err)
+			assert.True(t, info.Mode().IsRegular())
+		})
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Package geom contains simple planar geometry types and predicates used to select tiles
+covering areas of interest. Coordinates of geographic geometries are longitude (X) and
+latitude (Y) in degrees.
+*/
+
+package geom
+
+import "math"
+
+// Point represents point on a plane.
+type Point struct {
+	X float64
+	Y float64
+}
+
+// Ring represents closed line string, the last point may or may not repeat the first one.
+type Ring []Point
+
+// Polygon represents polygon with the exterior ring followed by holes.
+type Polygon []Ring
+
+// MultiPolygon represents collection of polygons.
+type MultiPolygon []Polygon
+
+// LineString represents sequence of connected segments.
+type LineString []Point
+
+// MultiLineString represents collection of line strings.
+type MultiLineString []LineString
+
+// Rect represents axis aligned rectangle.
+type Rect struct {
+	MinX float64
+	MinY float64
+	MaxX float64
+	MaxY float64
+}
+
+// EmptyRect returns rectangle which extends to nothing, useful as a starting value
+// for computing bounds.
+func EmptyRect() Rect {
+	return Rect{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+}
+
+// IsEmpty reports whether rectangle contains no points.
+func (r Rect) IsEmpty() bool {
+	return r.MinX > r.MaxX || r.MinY > r.MaxY
+}
+
+// Extend returns rectangle extended to contain given point.
+func (r Rect) Extend(p Point) Rect {
+	return Rect{
+		MinX: math.Min(r.MinX, p.X),
+		MinY: math.Min(r.MinY, p.Y),
+		MaxX: math.Max(r.MaxX, p.X),
+		MaxY: math.Max(r.MaxY, p.Y),
+	}
+}
+
+// Union returns rectangle containing both rectangles.
+func (r Rect) Union(o Rect) Rect {
+	return Rect{
+		MinX: math.Min(r.MinX, o.MinX),
+		MinY: math.Min(r.MinY, o.MinY),
+		MaxX: math.Max(r.MaxX, o.MaxX),
+		MaxY: math.Max(r.MaxY, o.MaxY),
+	}
+}
+
+// Intersects reports whether rectangles share at least one point.
+func (r Rect) Intersects(o Rect) bool {
+	return r.MinX <= o.MaxX && o.MinX <= r.MaxX && r.MinY <= o.MaxY && o.MinY <= r.MaxY
+}
+
+// ContainsPoint reports whether point lies inside or on the boundary of the rectangle.
+func (r Rect) ContainsPoint(p Point) bool {
+	return p.X >= r.MinX && p.X <= r.MaxX && p.Y >= r.MinY && p.Y <= r.MaxY
+}
+
+// Center returns center point of the rectangle.
+func (r Rect) Center() Point {
+	return Point{X: (r.MinX + r.MaxX) / 2, Y: (r.MinY + r.MaxY) / 2}
+}
+
+// Bounds returns bounding rectangle of the ring.
+func (r Ring) Bounds() Rect {
+	bounds := EmptyRect()
+	for _, p := range r {
+		bounds = bounds.Extend(p)
+	}
+	return bounds
+}
+
+// Segments returns segments of the ring, including the closing one.
+func (r Ring) Segments() []Segment {
+	if len(r) < 2 {
+		return nil
+	}
+	segments := make([]Segment, 0, len(r))
+	for i := range r {
+		a, b := r[i], r[(i+1)%len(r)]
+		if a == b {
+			continue
+		}
+		segments = append(segments, Segment{A: a, B: b})
+	}
+	return segments
+}
+
+// Bounds returns bounding rectangle of the polygon.
+func (p Polygon) Bounds() Rect {
+	if len(p) == 0 {
+		return EmptyRect()
+	}
+	return p[0].Bounds()
+}
+
+// Bounds returns bounding rectangle of all polygons.
+func (mp MultiPolygon) Bounds() Rect {
+	bounds := EmptyRect()
+	for _, p := range mp {
+		bounds = bounds.Union(p.Bounds())
+	}
+	return bounds
+}
+
+// Segments returns segments of all rings of all polygons.
+func (mp MultiPolygon) Segments() []Segment {
+	var segments []Segment
+	for _, p := range mp {
+		for _, r := range p {
+			segments = append(segments, r.Segments()...)
+		}
+	}
+	return segments
+}
+
+// Contains reports whether point lies inside of the multipolygon (even-odd rule).
+func (mp MultiPolygon) Contains(p Point) bool {
+	inside := false
+	for _, polygon := range mp {
+		for _, ring := range polygon {
+			for _, s := range ring.Segments() {
+				if s.crossesRay(p) {
+					inside = !inside
+				}
+			}
+		}
+	}
+	return inside
+}
+
+// Bounds returns bounding rectangle of the line string.
+func (l LineString) Bounds() Rect {
+	return Ring(l).Bounds()
+}
+
+// Segments returns segments of the line string. Line string with a single point yields
+// degenerate segment, so it still covers that point.
+func (l LineString) Segments() []Segment {
+	if len(l) == 1 {
+		return []Segment{{A: l[0], B: l[0]}}
+	}
+	segments := make([]Segment, 0, len(l))
+	for i := 1; i < len(l); i++ {
+		segments = append(segments, Segment{A: l[i-1], B: l[i]})
+	}
+	return segments
+}
+
+// Bounds returns bounding rectangle of all line strings.
+func (ml MultiLineString) Bounds() Rect {
+	bounds := EmptyRect()
+	for _, l := range ml {
+		bounds = bounds.Union(l.Bounds())
+	}
+	return bounds
+}
+
+// Segments returns segments of all line strings.
+func (ml MultiLineString) Segments() []Segment {
+	var segments []Segment
+	for _, l := range ml {
+		segments = append(segments, l.Segments()...)
+	}
+	return segments
+}
@@ -0,0 +1,51 @@
+package geom_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/geom"
+)
+
+func TestSegment_IntersectsRect(t *testing.T) {
+	rect := geom.Rect{MinX: 0, MinY: 0, MaxX: 10, MaxY: 10}
+	tests := map[string]struct {
+		Segment geom.Segment
+		Want    bool
+	}{
+		"inside":             {Segment: geom.Segment{A: geom.Point{X: 1, Y: 1}, B: geom.Point{X: 2, Y: 2}}, Want: true},
+		"crossing":           {Segment: geom.Segment{A: geom.Point{X: -5, Y: 5}, B: geom.Point{X: 15, Y: 5}}, Want: true},
+		"touching corner":    {Segment: geom.Segment{A: geom.Point{X: 10, Y: 10}, B: geom.Point{X: 20, Y: 20}}, Want: true},
+		"diagonal outside":   {Segment: geom.Segment{A: geom.Point{X: 8, Y: 15}, B: geom.Point{X: 15, Y: 8}}, Want: false},
+		"parallel outside":   {Segment: geom.Segment{A: geom.Point{X: -5, Y: 11}, B: geom.Point{X: 15, Y: 11}}, Want: false},
+		"bounds intersected": {Segment: geom.Segment{A: geom.Point{X: -6, Y: 5}, B: geom.Point{X: 2, Y: 15}}, Want: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.Want, test.Segment.IntersectsRect(rect))
+		})
+	}
+}
+
+func TestMultiPolygon_Contains(t *testing.T) {
+	square := geom.Ring{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}, {X: 0, Y: 10}, {X: 0, Y: 0}}
+	hole := geom.Ring{{X: 4, Y: 4}, {X: 6, Y: 4}, {X: 6, Y: 6}, {X: 4, Y: 6}}
+	mp := geom.MultiPolygon{{square, hole}}
+	locator := geom.NewLocator(mp)
+
+	for _, test := range []struct {
+		Point geom.Point
+		Want  bool
+	}{
+		{Point: geom.Point{X: 1, Y: 1}, Want: true},
+		{Point: geom.Point{X: 5, Y: 5}, Want: false},
+		{Point: geom.Point{X: 11, Y: 5}, Want: false},
+		{Point: geom.Point{X: 9, Y: 9.5}, Want: true},
+	} {
+		assert.Equal(t, test.Want, mp.Contains(test.Point), "%v", test.Point)
+		assert.Equal(t, test.Want, locator.Contains(test.Point), "%v", test.Point)
+	}
+	assert.Equal(t, geom.Rect{MinX: 0, MinY: 0, MaxX: 10, MaxY: 10}, mp.Bounds())
+}
@@ -0,0 +1,54 @@
+package geom
+
+import "math"
+
+// Locator answers point in polygon queries for large polygons. Segments are bucketed
+// into horizontal bands, so each query tests only segments of a single band.
+type Locator struct {
+	minY       float64
+	bandHeight float64
+	bands      [][]Segment
+}
+
+// NewLocator builds locator for the multipolygon.
+func NewLocator(mp MultiPolygon) *Locator {
+	segments := mp.Segments()
+	bounds := mp.Bounds()
+	count := int(math.Max(1, math.Min(4096, float64(len(segments)/4))))
+
+	l := &Locator{
+		minY:       bounds.MinY,
+		bandHeight: (bounds.MaxY - bounds.MinY) / float64(count),
+		bands:      make([][]Segment, count),
+	}
+	if l.bandHeight <= 0 {
+		l.bands = [][]Segment{segments}
+		return l
+	}
+	for _, s := range segments {
+		b := s.Bounds()
+		for i := l.band(b.MinY); i <= l.band(b.MaxY); i++ {
+			l.bands[i] = append(l.bands[i], s)
+		}
+	}
+	return l
+}
+
+func (l *Locator) band(y float64) int {
+	if l.bandHeight <= 0 {
+		return 0
+	}
+	i := int((y - l.minY) / l.bandHeight)
+	return max(0, min(len(l.bands)-1, i))
+}
+
+// Contains reports whether point lies inside of the multipolygon (even-odd rule).
+func (l *Locator) Contains(p Point) bool {
+	inside := false
+	for _, s := range l.bands[l.band(p.Y)] {
+		if s.crossesRay(p) {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,59 @@
+package geom
+
+import "math"
+
+// Segment represents line segment between two points.
+type Segment struct {
+	A Point
+	B Point
+}
+
+// Bounds returns bounding rectangle of the segment.
+func (s Segment) Bounds() Rect {
+	return Rect{
+		MinX: math.Min(s.A.X, s.B.X),
+		MinY: math.Min(s.A.Y, s.B.Y),
+		MaxX: math.Max(s.A.X, s.B.X),
+		MaxY: math.Max(s.A.Y, s.B.Y),
+	}
+}
+
+// crossesRay reports whether the segment crosses horizontal ray cast from the point
+// towards positive X.
+func (s Segment) crossesRay(p Point) bool {
+	if (s.A.Y > p.Y) == (s.B.Y > p.Y) {
+		return false
+	}
+	x := s.A.X + (p.Y-s.A.Y)*(s.B.X-s.A.X)/(s.B.Y-s.A.Y)
+	return p.X < x
+}
+
+// IntersectsRect reports whether the segment shares at least one point with the
+// rectangle (Liang-Barsky clipping).
+func (s Segment) IntersectsRect(r Rect) bool {
+	if !s.Bounds().Intersects(r) {
+		return false
+	}
+	dx, dy := s.B.X-s.A.X, s.B.Y-s.A.Y
+	t0, t1 := 0.0, 1.0
+	clip := func(p, q float64) bool {
+		if p == 0 {
+			return q >= 0
+		}
+		t := q / p
+		if p < 0 {
+			if t > t1 {
+				return false
+			}
+			t0 = math.Max(t0, t)
+		} else {
+			if t < t0 {
+				return false
+			}
+			t1 = math.Min(t1, t)
+		}
+		return true
+	}
+	return clip(-dx, s.A.X-r.MinX) && clip(dx, r.MaxX-s.A.X) &&
+		clip(-dy, s.A.Y-r.MinY) && clip(dy, r.MaxY-s.A.Y) && t0 <= t1
+}
@@ -0,0 +1,282 @@
+/*
+Package imaging contains helpers for decoding and encoding tile images.
+*/
+
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime"
+	"strings"
+)
+
+const (
+	PNG  string = "image/png"
+	PNG8        = "image/png; mode=8bit"
+	JPEG        = "image/jpeg"
+	GIF         = "image/gif"
+	WebP        = "image/webp"
+	// Mixed stands for JPEG for opaque images and PNG for images with any transparency.
+	Mixed = "mixed"
+)
+
+// formatNames maps short names of formats to their MIME types.
+var formatNames = map[string]string{
+	"png":   PNG,
+	"png8":  PNG8,
+	"jpeg":  JPEG,
+	"jpg":   JPEG,
+	"gif":   GIF,
+	"webp":  WebP,
+	"mixed": Mixed,
+}
+
+type encodeOptions struct {
+	quality     int
+	compression png.CompressionLevel
+	background  color.Color
+}
+
+type EncodeOption func(o *encodeOptions)
+
+// WithQuality sets quality (1-100) of JPEG images, jpeg.DefaultQuality by default.
+func WithQuality(quality int) EncodeOption {
+	return func(o *encodeOptions) {
+		o.quality = quality
+	}
+}
+
+// WithCompression sets compression level of PNG images, png.DefaultCompression by default.
+func WithCompression(level png.CompressionLevel) EncodeOption {
+	return func(o *encodeOptions) {
+		o.compression = level
+	}
+}
+
+// WithBackground sets colour of the background transparent pixels of JPEG images are blended
+// with, white by default.
+func WithBackground(background color.Color) EncodeOption {
+	return func(o *encodeOptions) {
+		o.background = background
+	}
+}
+
+// ParseColor parses colour given in hexadecimal notation: RRGGBB, RRGGBBAA or either of them
+// prefixed with "#".
+func ParseColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	var c color.NRGBA
+	var err error
+	switch len(hex) {
+	case 6:
+		c.A = 0xff
+		_, err = fmt.Sscanf(hex, "%02x%02x%02x", &c.R, &c.G, &c.B)
+	case 8:
+		_, err = fmt.Sscanf(hex, "%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A)
+	default:
+		err = errors.New("invalid length")
+	}
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid colour: %q (use RRGGBB)", s)
+	}
+	return c, nil
+}
+
+// Decode decodes tile image body (PNG, JPEG, GIF or lossless WebP). WebP images are always
+// decoded by the decoder of the package, even when another one is registered for them.
+func Decode(body []byte) (image.Image, error) {
+	if len(body) >= 12 && string(body[:4]) == "RIFF" && string(body[8:12]) == "WEBP" {
+		img, err := decodeWebP(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("error decoding image: %w", err)
+		}
+		return img, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %w", err)
+	}
+	return img, nil
+}
+
+// Encode encodes image in given format (MIME type, optionally with parameters such as
+// "image/png; mode=8bit"). PNG8 ("image/png; mode=8bit" or "image/png8") images are
+// quantized to 256 colours palette. WebP images are lossless. JPEG images have no alpha
+// channel, so transparent pixels are blended with the background. Metadata of the source
+// image is not preserved.
+func Encode(img image.Image, format string, options ...EncodeOption) ([]byte, error) {
+	o := encodeOptions{quality: jpeg.DefaultQuality, compression: png.DefaultCompression, background: color.White}
+	for _, option := range options {
+		option(&o)
+	}
+
+	if format == Mixed {
+		format = MixedFormat(img)
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch {
+	case isPNG8(format):
+		encoder := png.Encoder{CompressionLevel: o.compression}
+		err = encoder.Encode(&buf, Quantize(img, 256))
+	case MediaType(format) == PNG:
+		encoder := png.Encoder{CompressionLevel: o.compression}
+		err = encoder.Encode(&buf, img)
+	case MediaType(format) == JPEG:
+		if !IsOpaque(img) {
+			img = flatten(img, o.background)
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: o.quality})
+	case MediaType(format) == GIF:
+		err = gif.Encode(&buf, img, nil)
+	case MediaType(format) == WebP:
+		err = encodeWebP(&buf, img)
+	default:
+		return nil, fmt.Errorf("unsupported image format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error encoding image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// flatten returns image blended with uniform background.
+func flatten(img image.Image, background color.Color) image.Image {
+	b := img.Bounds()
+	flat := image.NewRGBA(b)
+	draw.Draw(flat, b, image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(flat, b, img, b.Min, draw.Over)
+	return flat
+}
+
+// Crop returns part of image within given rectangle (in coordinates of the image), sharing
+// pixels with the image when possible.
+func Crop(img image.Image, r image.Rectangle) image.Image {
+	if sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r)
+	}
+	cropped := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), img, r.Min, draw.Src)
+	return cropped
+}
+
+// IsEmpty reports whether image is blank: fully transparent or of a uniform colour. Pixels
+// are compared with the first one, tolerance is the maximum difference of each channel
+// (in 0-255 range) still treated as the same colour.
+func IsEmpty(img image.Image, tolerance uint8) bool {
+	b := img.Bounds()
+	if b.Empty() {
+		return true
+	}
+	transparent, uniform := true, true
+	r0, g0, b0, a0 := img.At(b.Min.X, b.Min.Y).RGBA()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			transparent = transparent && a == 0
+			uniform = uniform && within(r, r0, tolerance) && within(g, g0, tolerance) &&
+				within(b, b0, tolerance) && within(a, a0, tolerance)
+			if !transparent && !uniform {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// within reports whether 16-bit colour channels differ by at most tolerance (in 8-bit units).
+func within(c, c0 uint32, tolerance uint8) bool {
+	d := max(c, c0) - min(c, c0)
+	return d>>8 <= uint32(tolerance)
+}
+
+// Transcode re-encodes image body in given format, dropping metadata of the source image.
+func Transcode(body []byte, format string, options ...EncodeOption) ([]byte, error) {
+	img, err := Decode(body)
+	if err != nil {
+		return nil, err
+	}
+	return Encode(img, format, options...)
+}
+
+// ParseFormat returns MIME type of format supported by Encode, given by short name (png,
+// png8, jpeg, jpg, gif, webp or mixed) or MIME type.
+func ParseFormat(name string) (string, error) {
+	format, ok := formatNames[strings.ToLower(name)]
+	if !ok {
+		format = name
+	}
+	switch {
+	case format == Mixed, isPNG8(format):
+		return format, nil
+	case MediaType(format) == PNG, MediaType(format) == JPEG, MediaType(format) == GIF, MediaType(format) == WebP:
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported image format: %s", name)
+}
+
+// Extension returns file extension (with dot) of images of given format, e.g. ".jpg" for
+// "image/jpeg". Unknown (and mixed) formats give ".png".
+func Extension(format string) string {
+	switch MediaType(format) {
+	case JPEG:
+		return ".jpg"
+	case GIF:
+		return ".gif"
+	case WebP:
+		return ".webp"
+	}
+	return ".png"
+}
+
+// MixedFormat returns format of image in mixed format: JPEG for opaque images and PNG for
+// images with any transparency.
+func MixedFormat(img image.Image) string {
+	if IsOpaque(img) {
+		return JPEG
+	}
+	return PNG
+}
+
+// IsOpaque reports whether all pixels of image are fully opaque.
+func IsOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isPNG8 reports whether format is 8-bit paletted PNG: "image/png8" or PNG with mode=8bit
+// parameter (used by MapServer and GeoServer).
+func isPNG8(format string) bool {
+	if MediaType(format) == "image/png8" {
+		return true
+	}
+	_, params, err := mime.ParseMediaType(format)
+	return err == nil && MediaType(format) == PNG && strings.EqualFold(params["mode"], "8bit")
+}
+
+// MediaType strips parameters from MIME type, e.g. "image/png; mode=8bit" becomes "image/png".
+func MediaType(format string) string {
+	mediaType, _, _ := strings.Cut(format, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
@@ -0,0 +1,249 @@
+package imaging_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
+)
+
+func TestEncode(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+
+	body, err := imaging.Encode(img, "image/png; mode=8bit")
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(body, []byte("\x89PNG")))
+
+	decoded, err := imaging.Decode(body)
+	assert.NoError(t, err)
+	assert.Equal(t, img.Bounds(), decoded.Bounds())
+
+	_, err = imaging.Encode(img, "image/tiff")
+	assert.EqualError(t, err, "unsupported image format: image/tiff")
+}
+
+func TestEncodeWithOptions(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 4), B: uint8((x + y) * 2), A: 255})
+		}
+	}
+	img.Set(0, 0, color.NRGBA{})
+
+	low, err := imaging.Encode(img, imaging.JPEG, imaging.WithQuality(10))
+	assert.NoError(t, err)
+	high, err := imaging.Encode(img, imaging.JPEG, imaging.WithQuality(95))
+	assert.NoError(t, err)
+	assert.Less(t, len(low), len(high))
+
+	for _, format := range []string{imaging.PNG8, "image/png8"} {
+		body, err := imaging.Encode(img, format, imaging.WithCompression(png.BestCompression))
+		assert.NoError(t, err)
+		decoded, err := imaging.Decode(body)
+		assert.NoError(t, err)
+		paletted, ok := decoded.(*image.Paletted)
+		assert.True(t, ok, format)
+		assert.LessOrEqual(t, len(paletted.Palette), 256)
+		// Transparent pixels stay transparent.
+		_, _, _, a := decoded.At(0, 0).RGBA()
+		assert.Zero(t, a)
+	}
+}
+
+func TestEncodeJPEGBackground(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i+2] = 255
+	}
+	img.SetNRGBA(0, 0, color.NRGBA{B: 255, A: 255})
+
+	tests := map[string]struct {
+		options  []imaging.EncodeOption
+		expected color.RGBA
+	}{
+		"white":      {expected: color.RGBA{R: 255, G: 255, B: 255, A: 255}},
+		"background": {options: []imaging.EncodeOption{imaging.WithBackground(color.RGBA{G: 255, A: 255})}, expected: color.RGBA{G: 255, A: 255}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			body, err := imaging.Encode(img, imaging.JPEG, append(tc.options, imaging.WithQuality(100))...)
+			assert.NoError(t, err)
+			decoded, err := imaging.Decode(body)
+			assert.NoError(t, err)
+			r, g, b, _ := decoded.At(8, 8).RGBA()
+			er, eg, eb, _ := tc.expected.RGBA()
+			for _, c := range [][2]uint32{{r, er}, {g, eg}, {b, eb}} {
+				assert.InDelta(t, c[1]>>8, c[0]>>8, 8)
+			}
+		})
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := map[string]struct {
+		s             string
+		expected      color.NRGBA
+		expectedError string
+	}{
+		"rgb":       {s: "ff8000", expected: color.NRGBA{R: 255, G: 128, A: 255}},
+		"hash":      {s: "#FFFFFF", expected: color.NRGBA{R: 255, G: 255, B: 255, A: 255}},
+		"rgba":      {s: "00000080", expected: color.NRGBA{A: 128}},
+		"too short": {s: "fff", expectedError: `invalid colour: "fff" (use RRGGBB)`},
+		"not hex":   {s: "gggggg", expectedError: `invalid colour: "gggggg" (use RRGGBB)`},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c, err := imaging.ParseColor(tc.s)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, c)
+		})
+	}
+}
+
+func TestEncodeMixed(t *testing.T) {
+	opaque := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range opaque.Pix {
+		opaque.Pix[i] = 255
+	}
+	transparent := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	copy(transparent.Pix, opaque.Pix)
+	transparent.Set(3, 3, color.RGBA{})
+
+	tests := map[string]struct {
+		img            image.Image
+		expectedFormat string
+		expectedPrefix string
+	}{
+		"opaque":           {img: opaque, expectedFormat: imaging.JPEG, expectedPrefix: "\xff\xd8"},
+		"transparent edge": {img: transparent, expectedFormat: imaging.PNG, expectedPrefix: "\x89PNG"},
+		"uniform":          {img: image.NewUniform(color.Black), expectedFormat: imaging.JPEG},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedFormat, imaging.MixedFormat(tc.img))
+			if tc.expectedPrefix == "" {
+				return
+			}
+			body, err := imaging.Encode(tc.img, imaging.Mixed)
+			assert.NoError(t, err)
+			assert.True(t, bytes.HasPrefix(body, []byte(tc.expectedPrefix)))
+		})
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	img.Set(1, 0, color.RGBA{G: 255, A: 255})
+	img.Set(2, 0, color.RGBA{R: 255, A: 255})
+
+	// Images with few colours keep them exactly.
+	paletted := imaging.Quantize(img, 256)
+	assert.Len(t, paletted.Palette, 3)
+	for x := 0; x < 4; x++ {
+		assert.Equal(t, color.NRGBAModel.Convert(img.At(x, 0)), color.NRGBAModel.Convert(paletted.At(x, 0)))
+	}
+
+	// Other images are reduced to given number of colours.
+	paletted = imaging.Quantize(img, 2)
+	assert.Len(t, paletted.Palette, 2)
+	assert.Equal(t, color.NRGBA{R: 255, A: 255}, paletted.At(0, 0))
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := map[string]struct {
+		name          string
+		expected      string
+		expectedError string
+	}{
+		"short name": {name: "JPG", expected: imaging.JPEG},
+		"png8":       {name: "png8", expected: imaging.PNG8},
+		"mime type":  {name: "image/png; mode=8bit", expected: "image/png; mode=8bit"},
+		"webp":       {name: "webp", expected: imaging.WebP},
+		"unknown":    {name: "image/tiff", expectedError: "unsupported image format: image/tiff"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			format, err := imaging.ParseFormat(tc.name)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, format)
+		})
+	}
+}
+
+func TestExtension(t *testing.T) {
+	assert.Equal(t, ".jpg", imaging.Extension("image/jpeg"))
+	assert.Equal(t, ".png", imaging.Extension(imaging.PNG8))
+	assert.Equal(t, ".gif", imaging.Extension("image/gif"))
+	assert.Equal(t, ".webp", imaging.Extension(imaging.WebP))
+}
+
+func TestCrop(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(2, 1, color.RGBA{R: 255, A: 255})
+
+	cropped := imaging.Crop(img, image.Rect(2, 0, 4, 2))
+	assert.Equal(t, image.Rect(2, 0, 4, 2), cropped.Bounds())
+	assert.Equal(t, color.RGBA{R: 255, A: 255}, cropped.At(2, 1))
+
+	// Images without SubImage method are copied.
+	uniform := imaging.Crop(image.NewUniform(color.RGBA{G: 255, A: 255}), image.Rect(2, 0, 4, 2))
+	assert.Equal(t, image.Rect(0, 0, 2, 2), uniform.Bounds())
+	assert.Equal(t, color.RGBA{G: 255, A: 255}, uniform.At(1, 1))
+}
+
+func TestIsEmpty(t *testing.T) {
+	transparent := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	transparent.Set(1, 1, color.NRGBA{R: 255})
+
+	noisy := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range noisy.Pix {
+		noisy.Pix[i] = 200
+	}
+	noisy.Set(2, 3, color.RGBA{R: 203, G: 198, B: 200, A: 200})
+
+	marked := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	marked.Set(3, 3, color.RGBA{A: 255})
+
+	tests := map[string]struct {
+		img       image.Image
+		tolerance uint8
+		expected  bool
+	}{
+		"fully transparent":           {img: transparent, expected: true},
+		"uniform colour":              {img: imaging.Crop(image.NewUniform(color.RGBA{B: 255, A: 255}), image.Rect(0, 0, 4, 4)), expected: true},
+		"within tolerance":            {img: noisy, tolerance: 3, expected: true},
+		"above tolerance":             {img: noisy, tolerance: 2, expected: false},
+		"opaque pixel on transparent": {img: marked, tolerance: 10, expected: false},
+		"empty bounds":                {img: image.NewRGBA(image.Rectangle{}), expected: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, imaging.IsEmpty(tc.img, tc.tolerance))
+		})
+	}
+}
+
+func TestMediaType(t *testing.T) {
+	assert.Equal(t, "image/png", imaging.MediaType("image/PNG; mode=8bit"))
+	assert.Equal(t, "image/jpeg", imaging.MediaType("image/jpeg"))
+}
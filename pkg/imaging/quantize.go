@@ -0,0 +1,140 @@
+package imaging
+
+import (
+	"cmp"
+	"image"
+	"image/color"
+	"slices"
+)
+
+// colorCount is a colour with number of its pixels.
+type colorCount struct {
+	c     color.NRGBA
+	count int
+}
+
+// Quantize converts image to paletted one with at most n colours. Images with at most n
+// colours keep them exactly, palettes of other images are computed with median cut. All
+// fully transparent pixels are mapped to a single transparent colour.
+func Quantize(img image.Image, n int) *image.Paletted {
+	b := img.Bounds()
+	histogram := map[color.NRGBA]int{}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			histogram[nrgba(img.At(x, y))]++
+		}
+	}
+	colors := make([]colorCount, 0, len(histogram))
+	for c, count := range histogram {
+		colors = append(colors, colorCount{c: c, count: count})
+	}
+	slices.SortFunc(colors, func(a, b colorCount) int {
+		return cmp.Or(
+			cmp.Compare(a.c.R, b.c.R), cmp.Compare(a.c.G, b.c.G), cmp.Compare(a.c.B, b.c.B), cmp.Compare(a.c.A, b.c.A),
+		)
+	})
+
+	var palette color.Palette
+	if len(colors) <= n {
+		for _, c := range colors {
+			palette = append(palette, c.c)
+		}
+	} else {
+		palette = medianCut(colors, n)
+	}
+
+	dst := image.NewPaletted(b, palette)
+	indexes := make(map[color.NRGBA]uint8, len(histogram))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := nrgba(img.At(x, y))
+			index, ok := indexes[c]
+			if !ok {
+				index = uint8(palette.Index(c))
+				indexes[c] = index
+			}
+			dst.SetColorIndex(x, y, index)
+		}
+	}
+	return dst
+}
+
+// nrgba converts colour to non-premultiplied one, fully transparent colours to transparent black.
+func nrgba(c color.Color) color.NRGBA {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if n.A == 0 {
+		return color.NRGBA{}
+	}
+	return n
+}
+
+// medianCut splits colours into n boxes, each time splitting the box with the widest range
+// of a channel at the median pixel, and returns average colours of the boxes.
+func medianCut(colors []colorCount, n int) color.Palette {
+	boxes := [][]colorCount{colors}
+	for len(boxes) < n {
+		widest, channel, widestRange := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			for ch := 0; ch < 4; ch++ {
+				lo, hi := uint8(255), uint8(0)
+				for _, c := range box {
+					v := channelValue(c.c, ch)
+					lo, hi = min(lo, v), max(hi, v)
+				}
+				if r := int(hi) - int(lo); r > widestRange {
+					widest, channel, widestRange = i, ch, r
+				}
+			}
+		}
+		if widest < 0 {
+			break
+		}
+
+		box := boxes[widest]
+		slices.SortStableFunc(box, func(a, b colorCount) int {
+			return cmp.Compare(channelValue(a.c, channel), channelValue(b.c, channel))
+		})
+		total := 0
+		for _, c := range box {
+			total += c.count
+		}
+		split, pixels := 1, box[0].count
+		for split < len(box)-1 && pixels+box[split].count <= total/2 {
+			pixels += box[split].count
+			split++
+		}
+		boxes[widest] = box[:split]
+		boxes = append(boxes, box[split:])
+	}
+
+	palette := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		var r, g, b, a, total int
+		for _, c := range box {
+			r += int(c.c.R) * c.count
+			g += int(c.c.G) * c.count
+			b += int(c.c.B) * c.count
+			a += int(c.c.A) * c.count
+			total += c.count
+		}
+		palette = append(palette, color.NRGBA{
+			R: uint8(r / total), G: uint8(g / total), B: uint8(b / total), A: uint8(a / total),
+		})
+	}
+	return palette
+}
+
+func channelValue(c color.NRGBA, channel int) uint8 {
+	switch channel {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	case 2:
+		return c.B
+	}
+	return c.A
+}
@@ -0,0 +1,678 @@
+package imaging
+
+import (
+	"cmp"
+	"image"
+	"image/draw"
+	"math/bits"
+	"slices"
+)
+
+// Lossless WebP (VP8L) bitstream, see RFC 9649.
+
+const (
+	vp8lSignature = 0x2f
+	// vp8lMaxSize is the maximum width and height of VP8L image.
+	vp8lMaxSize = 1 << 14
+
+	predictorTransform     = 0
+	crossColorTransform    = 1
+	subtractGreenTransform = 2
+	colorIndexingTransform = 3
+
+	// numLiterals, numLengthCodes and numDistanceCodes are sizes of alphabets of prefix codes.
+	numLiterals      = 256
+	numLengthCodes   = 24
+	numDistanceCodes = 40
+	maxCodeLength    = 15
+	// maxReference is the maximum length of backward reference, maxDistance the maximum
+	// distance code.
+	maxReference = 4096
+	maxDistance  = 1 << 20
+	// predictorBits is the size (log2) of blocks of predictor transform written by encoder.
+	predictorBits = 4
+)
+
+// codeLengthOrder is the order in which code lengths of the code length code are stored.
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// distanceMap maps distance codes 1-120 to offsets (xi, yi) of nearby pixels: to the left and
+// up.
+var distanceMap = [120][2]int{
+	{0, 1}, {1, 0}, {1, 1}, {-1, 1}, {0, 2}, {2, 0}, {1, 2}, {-1, 2}, {2, 1}, {-2, 1},
+	{2, 2}, {-2, 2}, {0, 3}, {3, 0}, {1, 3}, {-1, 3}, {3, 1}, {-3, 1}, {2, 3}, {-2, 3},
+	{3, 2}, {-3, 2}, {0, 4}, {4, 0}, {1, 4}, {-1, 4}, {4, 1}, {-4, 1}, {3, 3}, {-3, 3},
+	{2, 4}, {-2, 4}, {4, 2}, {-4, 2}, {0, 5}, {3, 4}, {-3, 4}, {4, 3}, {-4, 3}, {5, 0},
+	{1, 5}, {-1, 5}, {5, 1}, {-5, 1}, {2, 5}, {-2, 5}, {5, 2}, {-5, 2}, {4, 4}, {-4, 4},
+	{3, 5}, {-3, 5}, {5, 3}, {-5, 3}, {0, 6}, {6, 0}, {1, 6}, {-1, 6}, {6, 1}, {-6, 1},
+	{2, 6}, {-2, 6}, {6, 2}, {-6, 2}, {4, 5}, {-4, 5}, {5, 4}, {-5, 4}, {3, 6}, {-3, 6},
+	{6, 3}, {-6, 3}, {0, 7}, {7, 0}, {1, 7}, {-1, 7}, {5, 5}, {-5, 5}, {7, 1}, {-7, 1},
+	{4, 6}, {-4, 6}, {6, 4}, {-6, 4}, {2, 7}, {-2, 7}, {7, 2}, {-7, 2}, {3, 7}, {-3, 7},
+	{7, 3}, {-7, 3}, {5, 6}, {-5, 6}, {6, 5}, {-6, 5}, {8, 0}, {4, 7}, {-4, 7}, {7, 4},
+	{-7, 4}, {8, 1}, {8, 2}, {6, 6}, {-6, 6}, {8, 3}, {5, 7}, {-5, 7}, {7, 5}, {-7, 5},
+	{8, 4}, {6, 7}, {-6, 7}, {7, 6}, {-7, 6}, {8, 5}, {7, 7}, {-7, 7}, {8, 6}, {8, 7},
+}
+
+// bitWriter writes bits, least significant bit first.
+type bitWriter struct {
+	buf   []byte
+	bits  uint64
+	nbits uint
+}
+
+// write writes n (up to 32) lowest bits of value.
+func (w *bitWriter) write(value uint32, n uint) {
+	w.bits |= uint64(value) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits >>= 8
+		w.nbits -= 8
+	}
+}
+
+// bytes returns written bits padded with zeros to full byte.
+func (w *bitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.write(0, 8-w.nbits)
+	}
+	return w.buf
+}
+
+// prefixCode is canonical Huffman code of symbols. Code of a single symbol takes no bits.
+type prefixCode struct {
+	lengths []uint8
+	// codes are bit-reversed, as they are written least significant bit first.
+	codes []uint16
+}
+
+func newPrefixCode(lengths []uint8) prefixCode {
+	used := 0
+	for _, length := range lengths {
+		if length > 0 {
+			used++
+		}
+	}
+	if used <= 1 {
+		return prefixCode{lengths: lengths}
+	}
+
+	var count, next [maxCodeLength + 1]int
+	for _, length := range lengths {
+		count[length]++
+	}
+	count[0] = 0
+	code := 0
+	for length := 1; length <= maxCodeLength; length++ {
+		code = (code + count[length-1]) << 1
+		next[length] = code
+	}
+	codes := make([]uint16, len(lengths))
+	for symbol, length := range lengths {
+		if length > 0 {
+			codes[symbol] = bits.Reverse16(uint16(next[length])) >> (16 - length)
+			next[length]++
+		}
+	}
+	return prefixCode{lengths: lengths, codes: codes}
+}
+
+func (c prefixCode) write(w *bitWriter, symbol int) {
+	if c.codes != nil {
+		w.write(uint32(c.codes[symbol]), uint(c.lengths[symbol]))
+	}
+}
+
+// huffmanLengths returns lengths of Huffman codes of symbols with given frequencies, limited to
+// maxLength bits. Rare symbols are made more frequent until the code fits the limit.
+func huffmanLengths(histogram []uint32, maxLength int) []uint8 {
+	lengths := make([]uint8, len(histogram))
+	var symbols []int
+	for symbol, n := range histogram {
+		if n > 0 {
+			symbols = append(symbols, symbol)
+		}
+	}
+	if len(symbols) == 1 {
+		lengths[symbols[0]] = 1
+	}
+	if len(symbols) <= 1 {
+		return lengths
+	}
+
+	n := len(symbols)
+	for floor := uint64(1); ; floor *= 2 {
+		// Leaves sorted by weight are followed by internal nodes, created in order of weight.
+		order := slices.Clone(symbols)
+		slices.SortStableFunc(order, func(a, b int) int {
+			return cmp.Compare(max(uint64(histogram[a]), floor), max(uint64(histogram[b]), floor))
+		})
+		weights := make([]uint64, 2*n-1)
+		parents := make([]int, 2*n-1)
+		for i, symbol := range order {
+			weights[i] = max(uint64(histogram[symbol]), floor)
+		}
+		leaf, node := 0, n
+		for next := n; next < 2*n-1; next++ {
+			for range 2 {
+				child := node
+				if leaf < n && (node == next || weights[leaf] <= weights[node]) {
+					child = leaf
+					leaf++
+				} else {
+					node++
+				}
+				parents[child] = next
+				weights[next] += weights[child]
+			}
+		}
+		depths := make([]int, 2*n-1)
+		deepest := 0
+		for i := 2*n - 3; i >= 0; i-- {
+			depths[i] = depths[parents[i]] + 1
+			deepest = max(deepest, depths[i])
+		}
+		if deepest <= maxLength {
+			for i, symbol := range order {
+				lengths[symbol] = uint8(depths[i])
+			}
+			return lengths
+		}
+	}
+}
+
+// writePrefixCode writes prefix code of symbols with given frequencies and returns it.
+func writePrefixCode(w *bitWriter, histogram []uint32) prefixCode {
+	var used []int
+	for symbol, n := range histogram {
+		if n > 0 {
+			if used = append(used, symbol); len(used) > 2 {
+				break
+			}
+		}
+	}
+
+	// Simple code of one or two symbols below 256.
+	if len(used) <= 2 && (len(used) == 0 || used[len(used)-1] < 256) {
+		if len(used) == 0 {
+			used = []int{0}
+		}
+		w.write(1, 1)
+		w.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			w.write(0, 1)
+			w.write(uint32(used[0]), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			w.write(uint32(used[1]), 8)
+		}
+		lengths := make([]uint8, len(histogram))
+		for _, symbol := range used {
+			lengths[symbol] = 1
+		}
+		return newPrefixCode(lengths)
+	}
+
+	lengths := huffmanLengths(histogram, maxCodeLength)
+	w.write(0, 1)
+	writeCodeLengths(w, lengths)
+	return newPrefixCode(lengths)
+}
+
+// writeCodeLengths writes code lengths of normal prefix code, with runs of lengths coded by
+// the repeat codes 16 (previous non-zero length), 17 and 18 (zeros).
+func writeCodeLengths(w *bitWriter, lengths []uint8) {
+	type token struct {
+		symbol uint8
+		extra  uint32
+	}
+	var tokens []token
+	for i := 0; i < len(lengths); {
+		length, run := lengths[i], 1
+		for i+run < len(lengths) && lengths[i+run] == length {
+			run++
+		}
+		i += run
+		if length == 0 {
+			for run >= 11 {
+				n := min(run, 138)
+				tokens = append(tokens, token{18, uint32(n - 11)})
+				run -= n
+			}
+			if run >= 3 {
+				tokens = append(tokens, token{17, uint32(run - 3)})
+				run = 0
+			}
+		} else {
+			tokens = append(tokens, token{length, 0})
+			run--
+			for run >= 3 {
+				n := min(run, 6)
+				tokens = append(tokens, token{16, uint32(n - 3)})
+				run -= n
+			}
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, token{length, 0})
+		}
+	}
+
+	histogram := make([]uint32, len(codeLengthOrder))
+	for _, t := range tokens {
+		histogram[t.symbol]++
+	}
+	codeLengths := huffmanLengths(histogram, 7)
+	n := len(codeLengthOrder)
+	for n > 4 && codeLengths[codeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	w.write(uint32(n-4), 4)
+	for _, symbol := range codeLengthOrder[:n] {
+		w.write(uint32(codeLengths[symbol]), 3)
+	}
+	// All code lengths of the alphabet are written.
+	w.write(0, 1)
+
+	code := newPrefixCode(codeLengths)
+	extraBits := map[uint8]uint{16: 2, 17: 3, 18: 7}
+	for _, t := range tokens {
+		code.write(w, int(t.symbol))
+		if n, ok := extraBits[t.symbol]; ok {
+			w.write(t.extra, n)
+		}
+	}
+}
+
+// prefixEncode returns prefix symbol and extra bits of length or distance code (from 1).
+func prefixEncode(value int) (symbol int, n uint, extra uint32) {
+	d := value - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	highest := bits.Len(uint(d)) - 1
+	n = uint(highest - 1)
+	return 2*highest + (d>>n)&1, n, uint32(d) & (1<<n - 1)
+}
+
+// reference is literal pixel (when length is 0) or backward reference to pixels decoded
+// before.
+type reference struct {
+	argb     uint32
+	length   int
+	distance int
+}
+
+// backwardReferences finds repeated runs of pixels with hash chains of pixel pairs and
+// returns greedy sequence of literals and backward references with distance codes.
+func backwardReferences(pixels []uint32, width int) []reference {
+	const (
+		hashBits  = 16
+		maxChain  = 32
+		minLength = 3
+	)
+	// Distance codes of nearby pixels, the shortest code of each distance.
+	distanceCodes := map[int]int{}
+	for i := len(distanceMap) - 1; i >= 0; i-- {
+		if d := distanceMap[i][0] + distanceMap[i][1]*width; d >= 1 {
+			distanceCodes[d] = i + 1
+		}
+	}
+
+	head := make([]int32, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, len(pixels))
+	hash := func(i int) uint32 {
+		return (pixels[i]*0x9e3779b1 ^ pixels[i+1]*0x85ebca77) >> (32 - hashBits)
+	}
+	insert := func(i int) {
+		if i+1 < len(pixels) {
+			h := hash(i)
+			prev[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+
+	var refs []reference
+	for i := 0; i < len(pixels); {
+		bestLength, bestDistance := 0, 0
+		if i+1 < len(pixels) {
+			limit := min(maxReference, len(pixels)-i)
+			for j, chain := head[hash(i)], 0; j >= 0 && chain < maxChain; j, chain = prev[j], chain+1 {
+				distance := i - int(j)
+				if distance+len(distanceMap) > maxDistance {
+					break
+				}
+				length := 0
+				for length < limit && pixels[int(j)+length] == pixels[i+length] {
+					length++
+				}
+				if length > bestLength {
+					bestLength, bestDistance = length, distance
+					if length == limit {
+						break
+					}
+				}
+			}
+		}
+		if bestLength < minLength {
+			refs = append(refs, reference{argb: pixels[i]})
+			insert(i)
+			i++
+			continue
+		}
+		code, ok := distanceCodes[bestDistance]
+		if !ok {
+			code = bestDistance + len(distanceMap)
+		}
+		refs = append(refs, reference{length: bestLength, distance: code})
+		for end := i + bestLength; i < end; i++ {
+			insert(i)
+		}
+	}
+	return refs
+}
+
+// writeImage writes entropy-coded image without color cache. Main image (the last one in the
+// bitstream) uses a single group of prefix codes.
+func writeImage(w *bitWriter, pixels []uint32, width int, main bool) {
+	// No color cache.
+	w.write(0, 1)
+	if main {
+		// No meta prefix codes.
+		w.write(0, 1)
+	}
+
+	refs := backwardReferences(pixels, width)
+	histograms := [5][]uint32{
+		make([]uint32, numLiterals+numLengthCodes),
+		make([]uint32, numLiterals),
+		make([]uint32, numLiterals),
+		make([]uint32, numLiterals),
+		make([]uint32, numDistanceCodes),
+	}
+	for _, ref := range refs {
+		if ref.length == 0 {
+			histograms[0][ref.argb>>8&0xff]++
+			histograms[1][ref.argb>>16&0xff]++
+			histograms[2][ref.argb&0xff]++
+			histograms[3][ref.argb>>24]++
+			continue
+		}
+		symbol, _, _ := prefixEncode(ref.length)
+		histograms[0][numLiterals+symbol]++
+		symbol, _, _ = prefixEncode(ref.distance)
+		histograms[4][symbol]++
+	}
+	var codes [5]prefixCode
+	for i, histogram := range histograms {
+		codes[i] = writePrefixCode(w, histogram)
+	}
+
+	for _, ref := range refs {
+		if ref.length == 0 {
+			codes[0].write(w, int(ref.argb>>8&0xff))
+			codes[1].write(w, int(ref.argb>>16&0xff))
+			codes[2].write(w, int(ref.argb&0xff))
+			codes[3].write(w, int(ref.argb>>24))
+			continue
+		}
+		symbol, n, extra := prefixEncode(ref.length)
+		codes[0].write(w, numLiterals+symbol)
+		w.write(extra, n)
+		symbol, n, extra = prefixEncode(ref.distance)
+		codes[4].write(w, symbol)
+		w.write(extra, n)
+	}
+}
+
+// encodeVP8L encodes image as VP8L bitstream. Images of up to 256 colours are stored with
+// color indexing transform, other ones with subtract green and predictor transforms.
+func encodeVP8L(img image.Image) []byte {
+	b := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+	width, height := b.Dx(), b.Dy()
+	pixels := make([]uint32, width*height)
+	alpha := uint32(0)
+	for i := range pixels {
+		p := nrgba.Pix[4*i : 4*i+4]
+		pixels[i] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+		if p[3] != 0xff {
+			alpha = 1
+		}
+	}
+
+	w := &bitWriter{}
+	w.write(vp8lSignature, 8)
+	w.write(uint32(width-1), 14)
+	w.write(uint32(height-1), 14)
+	w.write(alpha, 1)
+	w.write(0, 3)
+
+	if palette := colorPalette(pixels, 256); palette != nil {
+		pixels, width = writeColorIndexing(w, pixels, width, palette)
+	} else {
+		w.write(1, 1)
+		w.write(subtractGreenTransform, 2)
+		for i, p := range pixels {
+			green := p >> 8 & 0xff
+			pixels[i] = p&0xff00ff00 | (p>>16-green)&0xff<<16 | (p-green)&0xff
+		}
+		w.write(1, 1)
+		w.write(predictorTransform, 2)
+		pixels = writePredictor(w, pixels, width)
+	}
+	// No more transforms.
+	w.write(0, 1)
+	writeImage(w, pixels, width, true)
+	return w.bytes()
+}
+
+// colorPalette returns sorted colours of pixels, or nil when there are more than limit.
+func colorPalette(pixels []uint32, limit int) []uint32 {
+	colors := map[uint32]bool{}
+	for _, p := range pixels {
+		if colors[p] = true; len(colors) > limit {
+			return nil
+		}
+	}
+	palette := make([]uint32, 0, len(colors))
+	for p := range colors {
+		palette = append(palette, p)
+	}
+	slices.Sort(palette)
+	return palette
+}
+
+// paletteBits returns the number (log2) of pixels packed into one by color indexing
+// transform with palette of given size.
+func paletteBits(size int) int {
+	switch {
+	case size <= 2:
+		return 3
+	case size <= 4:
+		return 2
+	case size <= 16:
+		return 1
+	}
+	return 0
+}
+
+// writeColorIndexing writes color indexing transform and returns indices of pixels in the
+// palette, packed into green channel, and width of packed image.
+func writeColorIndexing(w *bitWriter, pixels []uint32, width int, palette []uint32) ([]uint32, int) {
+	w.write(1, 1)
+	w.write(colorIndexingTransform, 2)
+	w.write(uint32(len(palette)-1), 8)
+	// Palette is delta-coded.
+	deltas := make([]uint32, len(palette))
+	index := make(map[uint32]uint32, len(palette))
+	for i, p := range palette {
+		deltas[i] = p
+		if i > 0 {
+			deltas[i] = subPixels(p, palette[i-1])
+		}
+		index[p] = uint32(i)
+	}
+	writeImage(w, deltas, len(palette), false)
+
+	xbits := paletteBits(len(palette))
+	packedWidth := (width + 1<<xbits - 1) >> xbits
+	height := len(pixels) / width
+	packed := make([]uint32, packedWidth*height)
+	depth := 8 >> xbits
+	for y := range height {
+		for x := range width {
+			shift := 8 + depth*(x&(1<<xbits-1))
+			packed[y*packedWidth+x>>xbits] |= index[pixels[y*width+x]] << shift
+		}
+	}
+	return packed, packedWidth
+}
+
+// writePredictor writes predictor transform with the best mode of each block and returns
+// residuals of pixels.
+func writePredictor(w *bitWriter, pixels []uint32, width int) []uint32 {
+	height := len(pixels) / width
+	blocksWidth := (width + 1<<predictorBits - 1) >> predictorBits
+	blocksHeight := (height + 1<<predictorBits - 1) >> predictorBits
+	modes := make([]uint32, blocksWidth*blocksHeight)
+	residuals := make([]uint32, len(pixels))
+
+	for by := range blocksHeight {
+		for bx := range blocksWidth {
+			x0, y0 := bx<<predictorBits, by<<predictorBits
+			x1, y1 := min(x0+1<<predictorBits, width), min(y0+1<<predictorBits, height)
+			bestMode, bestCost := 0, -1
+			for mode := range 14 {
+				cost := 0
+				for y := y0; y < y1; y++ {
+					for x := x0; x < x1; x++ {
+						i := y*width + x
+						residual := subPixels(pixels[i], predict(pixels, i, x, y, width, mode))
+						for shift := 0; shift < 32; shift += 8 {
+							c := int(residual >> shift & 0xff)
+							cost += min(c, 256-c)
+						}
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					bestMode, bestCost = mode, cost
+				}
+			}
+			modes[by*blocksWidth+bx] = 0xff000000 | uint32(bestMode)<<8
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					i := y*width + x
+					residuals[i] = subPixels(pixels[i], predict(pixels, i, x, y, width, bestMode))
+				}
+			}
+		}
+	}
+
+	w.write(predictorBits-2, 3)
+	writeImage(w, modes, blocksWidth, false)
+	return residuals
+}
+
+// predict returns prediction of pixel i at (x, y) from its neighbours decoded before: left,
+// top, top-left and top-right ones.
+func predict(pixels []uint32, i, x, y, width, mode int) uint32 {
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return pixels[i-1]
+	case x == 0:
+		return pixels[i-width]
+	}
+	// Top-right pixel of the rightmost column is the leftmost pixel of the current row.
+	l, t, tl, tr := pixels[i-1], pixels[i-width], pixels[i-width-1], pixels[i-width+1]
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		return selectPixel(l, t, tl)
+	case 12:
+		return mapChannels(func(c [3]int) int { return c[0] + c[1] - c[2] }, l, t, tl)
+	case 13:
+		a := average2(l, t)
+		return mapChannels(func(c [3]int) int { return c[0] + (c[0]-c[1])/2 }, a, tl, 0)
+	}
+	return 0
+}
+
+// average2 returns average of each channel of pixels, rounded down.
+func average2(a, b uint32) uint32 {
+	return (a^b)&0xfefefefe>>1 + a&b
+}
+
+// selectPixel returns left or top pixel, the one closer to gradient estimate l + t - tl.
+func selectPixel(l, t, tl uint32) uint32 {
+	distanceL, distanceT := 0, 0
+	for shift := 0; shift < 32; shift += 8 {
+		cl, ct, ctl := int(l>>shift&0xff), int(t>>shift&0xff), int(tl>>shift&0xff)
+		distanceL += abs(ct - ctl)
+		distanceT += abs(cl - ctl)
+	}
+	if distanceL < distanceT {
+		return l
+	}
+	return t
+}
+
+// mapChannels applies f to channels of pixels and clamps the results to 0-255.
+func mapChannels(f func(c [3]int) int, a, b, c uint32) uint32 {
+	var p uint32
+	for shift := 0; shift < 32; shift += 8 {
+		v := f([3]int{int(a >> shift & 0xff), int(b >> shift & 0xff), int(c >> shift & 0xff)})
+		p |= uint32(min(max(v, 0), 255)) << shift
+	}
+	return p
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// addPixels adds channels of pixels modulo 256.
+func addPixels(a, b uint32) uint32 {
+	alphaGreen := a&0xff00ff00 + b&0xff00ff00
+	redBlue := a&0x00ff00ff + b&0x00ff00ff
+	return alphaGreen&0xff00ff00 | redBlue&0x00ff00ff
+}
+
+// subPixels subtracts channels of pixels modulo 256.
+func subPixels(a, b uint32) uint32 {
+	alphaGreen := 0x00ff00ff + a&0xff00ff00 - b&0xff00ff00
+	redBlue := 0xff00ff00 + a&0x00ff00ff - b&0x00ff00ff
+	return alphaGreen&0xff00ff00 | redBlue&0x00ff00ff
+}
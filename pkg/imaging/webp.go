@@ -0,0 +1,482 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// WebP images are encoded losslessly (VP8L). Decoding supports lossless images only, lossy
+// (VP8) ones are rejected.
+
+var errInvalidWebP = errors.New("invalid WebP image")
+
+func init() {
+	image.RegisterFormat("webp", "RIFF????WEBPVP8", decodeWebP, decodeWebPConfig)
+}
+
+// encodeWebP encodes image as lossless WebP.
+func encodeWebP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	if b.Dx() < 1 || b.Dy() < 1 || b.Dx() > vp8lMaxSize || b.Dy() > vp8lMaxSize {
+		return fmt.Errorf("invalid size of WebP image: %dx%d", b.Dx(), b.Dy())
+	}
+	data := encodeVP8L(img)
+	padding := len(data) % 2
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+8+len(data)+padding))
+	buf.WriteString("WEBPVP8L")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	if padding > 0 {
+		buf.WriteByte(0)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// vp8lChunk returns VP8L bitstream of WebP image.
+func vp8lChunk(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errInvalidWebP
+	}
+	for chunks := data[12:]; len(chunks) >= 8; {
+		fourCC, size := string(chunks[:4]), binary.LittleEndian.Uint32(chunks[4:8])
+		if uint64(size) > uint64(len(chunks)-8) {
+			return nil, errInvalidWebP
+		}
+		switch fourCC {
+		case "VP8L":
+			return chunks[8 : 8+size], nil
+		case "VP8 ":
+			return nil, errors.New("lossy WebP images are not supported")
+		case "ANIM":
+			return nil, errors.New("animated WebP images are not supported")
+		}
+		chunks = chunks[min(8+int(size)+int(size%2), len(chunks)):]
+	}
+	return nil, errInvalidWebP
+}
+
+// readVP8LHeader returns size of VP8L image.
+func readVP8LHeader(r *bitReader) (int, int, error) {
+	if r.read(8) != vp8lSignature {
+		return 0, 0, errInvalidWebP
+	}
+	width, height := int(r.read(14))+1, int(r.read(14))+1
+	r.read(1) // alpha is used
+	if version := r.read(3); version != 0 || r.err != nil {
+		return 0, 0, errInvalidWebP
+	}
+	return width, height, nil
+}
+
+func decodeWebPConfig(r io.Reader) (image.Config, error) {
+	data, err := vp8lChunk(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	width, height, err := readVP8LHeader(&bitReader{data: data})
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: width, Height: height}, nil
+}
+
+func decodeWebP(r io.Reader) (image.Image, error) {
+	data, err := vp8lChunk(r)
+	if err != nil {
+		return nil, err
+	}
+	br := &bitReader{data: data}
+	width, height, err := readVP8LHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	pixels, err := decodeVP8L(br, width, height)
+	if br.err != nil {
+		return nil, br.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i, p := range pixels {
+		img.Pix[4*i] = uint8(p >> 16)
+		img.Pix[4*i+1] = uint8(p >> 8)
+		img.Pix[4*i+2] = uint8(p)
+		img.Pix[4*i+3] = uint8(p >> 24)
+	}
+	return img, nil
+}
+
+// bitReader reads bits, least significant bit first. Reading past the end of data sets err.
+type bitReader struct {
+	data  []byte
+	pos   int
+	bits  uint64
+	nbits uint
+	err   error
+}
+
+// read reads n (up to 32) bits.
+func (r *bitReader) read(n uint) uint32 {
+	for r.nbits < n {
+		if r.pos >= len(r.data) {
+			r.err = io.ErrUnexpectedEOF
+			return 0
+		}
+		r.bits |= uint64(r.data[r.pos]) << r.nbits
+		r.pos++
+		r.nbits += 8
+	}
+	value := uint32(r.bits & (1<<n - 1))
+	r.bits >>= n
+	r.nbits -= n
+	return value
+}
+
+// huffmanDecoder decodes symbols of canonical prefix code bit by bit.
+type huffmanDecoder struct {
+	counts  [maxCodeLength + 1]int
+	symbols []int
+}
+
+func newHuffmanDecoder(lengths []uint8) (*huffmanDecoder, error) {
+	h := &huffmanDecoder{}
+	for _, length := range lengths {
+		h.counts[length]++
+	}
+	h.counts[0] = 0
+	for length := 1; length <= maxCodeLength; length++ {
+		for symbol, l := range lengths {
+			if int(l) == length {
+				h.symbols = append(h.symbols, symbol)
+			}
+		}
+	}
+	if len(h.symbols) == 0 {
+		return nil, errInvalidWebP
+	}
+	if len(h.symbols) == 1 {
+		return h, nil
+	}
+	// Code has to be complete.
+	left := 1
+	for length := 1; length <= maxCodeLength; length++ {
+		if left = left<<1 - h.counts[length]; left < 0 {
+			return nil, errInvalidWebP
+		}
+	}
+	if left != 0 {
+		return nil, errInvalidWebP
+	}
+	return h, nil
+}
+
+func (h *huffmanDecoder) decode(r *bitReader) (int, error) {
+	if len(h.symbols) == 1 {
+		return h.symbols[0], nil
+	}
+	code, first, index := 0, 0, 0
+	for length := 1; length <= maxCodeLength; length++ {
+		code |= int(r.read(1))
+		count := h.counts[length]
+		if code-first < count {
+			return h.symbols[index+code-first], r.err
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	return 0, errInvalidWebP
+}
+
+// readPrefixCode reads prefix code of alphabet of given size.
+func readPrefixCode(r *bitReader, alphabetSize int) (*huffmanDecoder, error) {
+	lengths := make([]uint8, alphabetSize)
+	if r.read(1) == 1 {
+		// Simple code of one or two symbols.
+		n := int(r.read(1)) + 1
+		symbol := int(r.read(uint(1 + 7*r.read(1))))
+		for i := range n {
+			if i > 0 {
+				symbol = int(r.read(8))
+			}
+			if symbol >= alphabetSize {
+				return nil, errInvalidWebP
+			}
+			lengths[symbol] = 1
+		}
+		return newHuffmanDecoder(lengths)
+	}
+
+	var codeLengths [len(codeLengthOrder)]uint8
+	n := int(r.read(4)) + 4
+	for _, symbol := range codeLengthOrder[:n] {
+		codeLengths[symbol] = uint8(r.read(3))
+	}
+	code, err := newHuffmanDecoder(codeLengths[:])
+	if err != nil {
+		return nil, err
+	}
+	maxSymbol := alphabetSize
+	if r.read(1) == 1 {
+		if maxSymbol = 2 + int(r.read(uint(2+2*r.read(3)))); maxSymbol > alphabetSize {
+			return nil, errInvalidWebP
+		}
+	}
+	previous := uint8(8)
+	for symbol := 0; symbol < alphabetSize && maxSymbol > 0; maxSymbol-- {
+		length, err := code.decode(r)
+		if err != nil {
+			return nil, err
+		}
+		if length < 16 {
+			lengths[symbol] = uint8(length)
+			symbol++
+			if length != 0 {
+				previous = uint8(length)
+			}
+			continue
+		}
+		repeat, value := 0, uint8(0)
+		switch length {
+		case 16:
+			repeat, value = 3+int(r.read(2)), previous
+		case 17:
+			repeat = 3 + int(r.read(3))
+		case 18:
+			repeat = 11 + int(r.read(7))
+		}
+		if symbol+repeat > alphabetSize {
+			return nil, errInvalidWebP
+		}
+		for range repeat {
+			lengths[symbol] = value
+			symbol++
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return newHuffmanDecoder(lengths)
+}
+
+// prefixDecode reads length or distance code given by prefix symbol and extra bits.
+func prefixDecode(r *bitReader, symbol int) int {
+	if symbol < 4 {
+		return symbol + 1
+	}
+	n := uint(symbol-2) >> 1
+	return (2+symbol&1)<<n + int(r.read(n)) + 1
+}
+
+type transform struct {
+	kind  int
+	bits  int
+	width int
+	data  []uint32
+}
+
+// decodeVP8L decodes ARGB pixels of VP8L image following the header.
+func decodeVP8L(r *bitReader, width, height int) ([]uint32, error) {
+	var transforms []transform
+	var seen [4]bool
+	xsize := width
+	for r.read(1) == 1 {
+		t := transform{kind: int(r.read(2)), width: xsize}
+		if seen[t.kind] {
+			return nil, errInvalidWebP
+		}
+		seen[t.kind] = true
+		var err error
+		switch t.kind {
+		case predictorTransform, crossColorTransform:
+			t.bits = int(r.read(3)) + 2
+			t.data, err = decodeImage(r, subSampleSize(xsize, t.bits), subSampleSize(height, t.bits), false)
+		case colorIndexingTransform:
+			size := int(r.read(8)) + 1
+			t.bits = paletteBits(size)
+			if t.data, err = decodeImage(r, size, 1, false); err == nil {
+				for i := 1; i < size; i++ {
+					t.data[i] = addPixels(t.data[i], t.data[i-1])
+				}
+			}
+			xsize = subSampleSize(xsize, t.bits)
+		}
+		if err != nil {
+			return nil, err
+		}
+		transforms = append(transforms, t)
+	}
+
+	pixels, err := decodeImage(r, xsize, height, true)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(transforms) - 1; i >= 0; i-- {
+		pixels = transforms[i].inverse(pixels, height)
+	}
+	return pixels, nil
+}
+
+// inverse applies inverse transform to pixels.
+func (t transform) inverse(pixels []uint32, height int) []uint32 {
+	switch t.kind {
+	case predictorTransform:
+		blocksWidth := subSampleSize(t.width, t.bits)
+		for y := range height {
+			for x := range t.width {
+				i := y*t.width + x
+				mode := int(t.data[(y>>t.bits)*blocksWidth+x>>t.bits] >> 8 & 0xf)
+				pixels[i] = addPixels(pixels[i], predict(pixels, i, x, y, t.width, mode))
+			}
+		}
+	case crossColorTransform:
+		blocksWidth := subSampleSize(t.width, t.bits)
+		for y := range height {
+			for x := range t.width {
+				i := y*t.width + x
+				e := t.data[(y>>t.bits)*blocksWidth+x>>t.bits]
+				p := pixels[i]
+				green := int(int8(p >> 8))
+				red := int(p>>16&0xff) + int(int8(e))*green>>5
+				blue := int(p&0xff) + int(int8(e>>8))*green>>5 + int(int8(e>>16))*int(int8(red))>>5
+				pixels[i] = p&0xff00ff00 | uint32(red&0xff)<<16 | uint32(blue&0xff)
+			}
+		}
+	case subtractGreenTransform:
+		for i, p := range pixels {
+			green := p >> 8 & 0xff
+			pixels[i] = p&0xff00ff00 | (p>>16+green)&0xff<<16 | (p+green)&0xff
+		}
+	case colorIndexingTransform:
+		packedWidth := subSampleSize(t.width, t.bits)
+		depth := 8 >> t.bits
+		unpacked := make([]uint32, t.width*height)
+		for y := range height {
+			for x := range t.width {
+				packed := pixels[y*packedWidth+x>>t.bits] >> 8
+				index := int(packed>>(depth*(x&(1<<t.bits-1)))) & (1<<depth - 1)
+				// Indices out of the palette are transparent black.
+				if index < len(t.data) {
+					unpacked[y*t.width+x] = t.data[index]
+				}
+			}
+		}
+		return unpacked
+	}
+	return pixels
+}
+
+// decodeImage decodes entropy-coded image. Main image may use groups of prefix codes
+// selected by meta prefix image.
+func decodeImage(r *bitReader, width, height int, main bool) ([]uint32, error) {
+	var cacheBits uint
+	if r.read(1) == 1 {
+		if cacheBits = uint(r.read(4)); cacheBits < 1 || cacheBits > 11 {
+			return nil, errInvalidWebP
+		}
+	}
+	var cache []uint32
+	if cacheBits > 0 {
+		cache = make([]uint32, 1<<cacheBits)
+	}
+
+	var groupBits int
+	var groupImage []uint32
+	groups := 1
+	if main && r.read(1) == 1 {
+		groupBits = int(r.read(3)) + 2
+		var err error
+		groupImage, err = decodeImage(r, subSampleSize(width, groupBits), subSampleSize(height, groupBits), false)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range groupImage {
+			groups = max(groups, int(p>>8&0xffff)+1)
+		}
+	}
+	alphabetSizes := [5]int{numLiterals + numLengthCodes + len(cache), numLiterals, numLiterals, numLiterals, numDistanceCodes}
+	codes := make([][5]*huffmanDecoder, groups)
+	for g := range codes {
+		for i, size := range alphabetSizes {
+			code, err := readPrefixCode(r, size)
+			if err != nil {
+				return nil, err
+			}
+			codes[g][i] = code
+		}
+	}
+
+	pixels := make([]uint32, width*height)
+	cached := 0
+	for i := 0; i < len(pixels); {
+		group := &codes[0]
+		if groupImage != nil {
+			x, y := i%width, i/width
+			group = &codes[groupImage[(y>>groupBits)*subSampleSize(width, groupBits)+x>>groupBits]>>8&0xffff]
+		}
+		green, err := group[0].decode(r)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case green < numLiterals:
+			red, _ := group[1].decode(r)
+			blue, _ := group[2].decode(r)
+			alpha, err := group[3].decode(r)
+			if err != nil {
+				return nil, err
+			}
+			pixels[i] = uint32(alpha)<<24 | uint32(red)<<16 | uint32(green)<<8 | uint32(blue)
+			i++
+		case green < numLiterals+numLengthCodes:
+			length := prefixDecode(r, green-numLiterals)
+			symbol, err := group[4].decode(r)
+			if err != nil {
+				return nil, err
+			}
+			distance := prefixDecode(r, symbol)
+			if distance <= len(distanceMap) {
+				offset := distanceMap[distance-1]
+				distance = max(offset[0]+offset[1]*width, 1)
+			} else {
+				distance -= len(distanceMap)
+			}
+			if distance > i || length > len(pixels)-i {
+				return nil, errInvalidWebP
+			}
+			for end := i + length; i < end; i++ {
+				pixels[i] = pixels[i-distance]
+			}
+		default:
+			pixels[i] = cache[green-numLiterals-numLengthCodes]
+			i++
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		// Every decoded pixel is inserted into color cache.
+		for ; cache != nil && cached < i; cached++ {
+			cache[(0x1e35a7bd*pixels[cached])>>(32-cacheBits)] = pixels[cached]
+		}
+	}
+	return pixels, nil
+}
+
+// subSampleSize returns size of image subsampled by 2^bits, rounded up.
+func subSampleSize(size, bits int) int {
+	return (size + 1<<bits - 1) >> bits
+}
@@ -0,0 +1,146 @@
+package imaging_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	xwebp "golang.org/x/image/webp"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
+)
+
+func TestEncodeWebP(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	newImage := func(width, height int, pixel func(x, y int) color.NRGBA) *image.NRGBA {
+		img := image.NewNRGBA(image.Rect(0, 0, width, height))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				img.SetNRGBA(x, y, pixel(x, y))
+			}
+		}
+		return img
+	}
+	palette := func(n int) func(x, y int) color.NRGBA {
+		return func(x, y int) color.NRGBA {
+			i := uint8((x/3 + y/5 + x*y%7) % n)
+			return color.NRGBA{R: i * 37, G: i * 11, B: 255 - i, A: 255 - i%3*100}
+		}
+	}
+
+	tests := map[string]struct {
+		img *image.NRGBA
+	}{
+		"single pixel": {img: newImage(1, 1, func(x, y int) color.NRGBA { return color.NRGBA{R: 10, G: 20, B: 30, A: 40} })},
+		"transparent":  {img: newImage(256, 256, func(x, y int) color.NRGBA { return color.NRGBA{} })},
+		"2 colours":    {img: newImage(13, 7, palette(2))},
+		"4 colours":    {img: newImage(29, 31, palette(4))},
+		"16 colours":   {img: newImage(256, 256, palette(16))},
+		"256 colours":  {img: newImage(255, 257, palette(256))},
+		"gradient": {img: newImage(256, 256, func(x, y int) color.NRGBA {
+			return color.NRGBA{R: uint8(x), G: uint8(y), B: uint8(x*y>>8) + uint8(random.Intn(4)), A: 255}
+		})},
+		"noise": {img: newImage(97, 61, func(x, y int) color.NRGBA {
+			return color.NRGBA{R: uint8(random.Intn(256)), G: uint8(random.Intn(256)), B: uint8(random.Intn(256)), A: uint8(random.Intn(256))}
+		})},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			body, err := imaging.Encode(tc.img, imaging.WebP)
+			assert.NoError(t, err)
+			assert.Equal(t, "RIFF", string(body[:4]))
+			assert.Equal(t, "WEBPVP8L", string(body[8:16]))
+			assert.Zero(t, len(body)%2)
+
+			decoded, err := imaging.Decode(body)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.img, decoded)
+			// Encoded images are decoded by other decoders as well.
+			reference, err := xwebp.Decode(bytes.NewReader(body))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.img, toNRGBA(reference))
+
+			config, format, err := image.DecodeConfig(bytes.NewReader(body))
+			assert.NoError(t, err)
+			assert.Equal(t, "webp", format)
+			assert.Equal(t, tc.img.Bounds().Dx(), config.Width)
+			assert.Equal(t, tc.img.Bounds().Dy(), config.Height)
+		})
+	}
+}
+
+func TestEncodeWebPCompression(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	body, err := imaging.Encode(img, imaging.WebP)
+	assert.NoError(t, err)
+	png, err := imaging.Encode(img, imaging.PNG)
+	assert.NoError(t, err)
+	assert.Less(t, len(body), len(png))
+}
+
+func TestDecodeWebP(t *testing.T) {
+	tests := map[string]struct {
+		body          string
+		expectedError string
+	}{
+		"lossy":     {body: "RIFF\x0e\x00\x00\x00WEBPVP8 \x02\x00\x00\x00\x00\x00", expectedError: "error decoding image: lossy WebP images are not supported"},
+		"truncated": {body: "RIFF\x0e\x00\x00\x00WEBPVP8L\x05\x00\x00\x00\x2f\x00\x00\x00\x00\x00", expectedError: "error decoding image: unexpected EOF"},
+		"no image":  {body: "RIFF\x16\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00" + strings.Repeat("\x00", 10), expectedError: "error decoding image: invalid WebP image"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := imaging.Decode([]byte(tc.body))
+			assert.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
+
+// TestDecodeWebP_Fixtures decodes lossless images encoded by cwebp (copied from
+// golang.org/x/image testdata), compared with images decoded by golang.org/x/image/webp.
+func TestDecodeWebP_Fixtures(t *testing.T) {
+	names, err := filepath.Glob("testdata/*.lossless.webp")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, names)
+
+	for _, name := range names {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			body, err := os.ReadFile(name)
+			assert.NoError(t, err)
+			decoded, err := imaging.Decode(body)
+			assert.NoError(t, err)
+			reference, err := xwebp.Decode(bytes.NewReader(body))
+			assert.NoError(t, err)
+			assert.Equal(t, toNRGBA(reference), toNRGBA(decoded))
+		})
+	}
+
+	// Lossy images are rejected by the decoder of the package, although golang.org/x/image/webp
+	// registered in the test binary decodes them.
+	body, err := os.ReadFile("testdata/blue-purple-pink.lossy.webp")
+	assert.NoError(t, err)
+	_, err = imaging.Decode(body)
+	assert.EqualError(t, err, "error decoding image: lossy WebP images are not supported")
+}
+
+// toNRGBA returns copy of the image as *image.NRGBA with origin at (0, 0).
+func toNRGBA(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+	return nrgba
+}
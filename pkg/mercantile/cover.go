@@ -0,0 +1,268 @@
+package mercantile
+
+import (
+	"iter"
+	"math"
+	"slices"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/geom"
+)
+
+// metersPerDegree is the length of one degree of latitude on the Web Mercator sphere.
+const metersPerDegree = 6378137.0 * math.Pi / 180.0
+
+// cover selects tiles whose extent (expanded by buffer) intersects boundary or interior
+// of given geometries. It descends the quadtree from zoom 0 and passes to children only
+// segments which intersect their parent, so large geometries stay cheap.
+type cover struct {
+	segments []geom.Segment
+	locator  *geom.Locator
+	buffer   float64
+}
+
+// newPolygonCover returns cover for multipolygon given in longitude and latitude.
+func newPolygonCover(mp geom.MultiPolygon, buffer float64) *cover {
+	mp = normalizePolygons(mp)
+	return &cover{segments: mp.Segments(), locator: geom.NewLocator(mp), buffer: buffer}
+}
+
+// lngLatRect returns extent of a tile in longitude and latitude.
+func lngLatRect(tile TileID) geom.Rect {
+	ul := Ul(tile)
+	lr := Ul(TileID{tile.X + 1, tile.Y + 1, tile.Z})
+	return geom.Rect{MinX: ul.Lng, MinY: lr.Lat, MaxX: lr.Lng, MaxY: ul.Lat}
+}
+
+// expand grows rectangle by buffer (in meters). Longitude offset is computed on the
+// latitude closest to the pole, so the expanded rectangle covers the whole buffer.
+func (c *cover) expand(r geom.Rect) geom.Rect {
+	if c.buffer <= 0 {
+		return r
+	}
+	lat := math.Min(89.0, math.Max(math.Abs(r.MinY), math.Abs(r.MaxY)))
+	dLat := c.buffer / metersPerDegree
+	dLng := c.buffer / (metersPerDegree * math.Cos(lat*math.Pi/180.0))
+	return geom.Rect{MinX: r.MinX - dLng, MinY: r.MinY - dLat, MaxX: r.MaxX + dLng, MaxY: r.MaxY + dLat}
+}
+
+// tiles calls emit for every tile on given zoom level which is covered. It stops and
+// returns false as soon as emit returns false.
+func (c *cover) tiles(zoom int, emit func(TileID) bool) bool {
+	return c.visit(TileID{0, 0, 0}, c.segments, zoom, emit)
+}
+
+func (c *cover) visit(tile TileID, segments []geom.Segment, zoom int, emit func(TileID) bool) bool {
+	rect := lngLatRect(tile)
+	expanded := c.expand(rect)
+
+	var relevant []geom.Segment
+	for _, s := range segments {
+		if s.IntersectsRect(expanded) {
+			relevant = append(relevant, s)
+		}
+	}
+	if len(relevant) == 0 {
+		// Tile is either completely inside or completely outside of the geometry.
+		if c.locator != nil && c.locator.Contains(rect.Center()) {
+			return emitDescendants(tile, zoom, emit)
+		}
+		return true
+	}
+	if tile.Z == zoom {
+		return emit(tile)
+	}
+	for _, child := range [4]TileID{
+		{tile.X * 2, tile.Y * 2, tile.Z + 1},
+		{tile.X*2 + 1, tile.Y * 2, tile.Z + 1},
+		{tile.X * 2, tile.Y*2 + 1, tile.Z + 1},
+		{tile.X*2 + 1, tile.Y*2 + 1, tile.Z + 1},
+	} {
+		if !c.visit(child, relevant, zoom, emit) {
+			return false
+		}
+	}
+	return true
+}
+
+// emitDescendants calls emit for all descendants of a tile on given zoom level.
+func emitDescendants(tile TileID, zoom int, emit func(TileID) bool) bool {
+	d := zoom - tile.Z
+	for i := tile.X << d; i < (tile.X+1)<<d; i++ {
+		for j := tile.Y << d; j < (tile.Y+1)<<d; j++ {
+			if !emit(TileID{i, j, zoom}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// unwrap makes coordinates continuous across the antimeridian, so that consecutive
+// points never differ by more than 180 degrees of longitude.
+func unwrap(points []geom.Point) []geom.Point {
+	result := make([]geom.Point, len(points))
+	for i, p := range points {
+		if i > 0 {
+			prev := result[i-1].X
+			for p.X-prev > 180.0 {
+				p.X -= 360.0
+			}
+			for p.X-prev < -180.0 {
+				p.X += 360.0
+			}
+		}
+		result[i] = p
+	}
+	return result
+}
+
+// shift moves points by given longitude offset.
+func shift(points []geom.Point, dx float64) []geom.Point {
+	result := make([]geom.Point, len(points))
+	for i, p := range points {
+		result[i] = geom.Point{X: p.X + dx, Y: p.Y}
+	}
+	return result
+}
+
+// normalizePolygons handles polygons crossing the antimeridian similarly to west > east
+// case in Tiles: rings are unwrapped and the parts sticking out of [-180, 180] range are
+// covered by copies of the polygon shifted by 360 degrees.
+func normalizePolygons(mp geom.MultiPolygon) geom.MultiPolygon {
+	var result geom.MultiPolygon
+	for _, polygon := range mp {
+		var unwrapped geom.Polygon
+		for i, ring := range polygon {
+			r := geom.Ring(unwrap(ring))
+			// Keep holes next to the exterior ring.
+			if i > 0 && len(r) > 0 && len(unwrapped) > 0 && len(unwrapped[0]) > 0 {
+				dx := math.Round((unwrapped[0][0].X-r[0].X)/360.0) * 360.0
+				r = shift(r, dx)
+			}
+			unwrapped = append(unwrapped, r)
+		}
+		result = append(result, unwrapped)
+
+		bounds := unwrapped.Bounds()
+		for _, dx := range []float64{-360.0, 360.0} {
+			if (dx < 0 && bounds.MaxX > 180.0) || (dx > 0 && bounds.MinX < -180.0) {
+				var shifted geom.Polygon
+				for _, ring := range unwrapped {
+					shifted = append(shifted, shift(ring, dx))
+				}
+				result = append(result, shifted)
+			}
+		}
+	}
+	return result
+}
+
+// PolygonBounds retrieves geographic bounding box of multipolygon. Rings crossing the
+// antimeridian are unwrapped like in PolygonTiles and the narrowest extent of polygons is
+// returned, with west > east when it crosses the antimeridian.
+func PolygonBounds(mp geom.MultiPolygon) LngLatBbox {
+	var bounds []geom.Rect
+	for _, polygon := range mp {
+		if len(polygon) == 0 || len(polygon[0]) == 0 {
+			continue
+		}
+		b := geom.Ring(unwrap(polygon[0])).Bounds()
+		// Unwrapped ring starts within [-180, 180], but may stick out on either side.
+		if b.MinX < -180.0 {
+			b.MinX, b.MaxX = b.MinX+360.0, b.MaxX+360.0
+		}
+		bounds = append(bounds, b)
+	}
+	if len(bounds) == 0 {
+		b := geom.EmptyRect()
+		return LngLatBbox{West: b.MinX, South: b.MinY, East: b.MaxX, North: b.MaxY}
+	}
+
+	// Polygons on both sides of the antimeridian are closer to each other when the western
+	// ones are shifted by 360 degrees.
+	extent, shifted := geom.EmptyRect(), geom.EmptyRect()
+	for _, b := range bounds {
+		extent = extent.Union(b)
+		if b.MinX < 0 {
+			b.MinX, b.MaxX = b.MinX+360.0, b.MaxX+360.0
+		}
+		shifted = shifted.Union(b)
+	}
+	if shifted.MaxX-shifted.MinX < extent.MaxX-extent.MinX {
+		extent = shifted
+	}
+	if extent.MaxX-extent.MinX >= 360.0 {
+		return LngLatBbox{West: -180.0, South: extent.MinY, East: 180.0, North: extent.MaxY}
+	}
+	west, east := extent.MinX, extent.MaxX
+	if west >= 180.0 {
+		west -= 360.0
+	}
+	if east > 180.0 {
+		east -= 360.0
+	}
+	return LngLatBbox{West: west, South: extent.MinY, East: east, North: extent.MaxY}
+}
+
+// newLineCover returns cover for line strings given in longitude and latitude.
+func newLineCover(ml geom.MultiLineString, buffer float64) *cover {
+	return &cover{segments: normalizeLines(ml).Segments(), buffer: buffer}
+}
+
+// normalizeLines unwraps line strings crossing the antimeridian and adds their copies
+// shifted by 360 degrees, see normalizePolygons.
+func normalizeLines(ml geom.MultiLineString) geom.MultiLineString {
+	var result geom.MultiLineString
+	for _, line := range ml {
+		unwrapped := geom.LineString(unwrap(line))
+		result = append(result, unwrapped)
+
+		bounds := unwrapped.Bounds()
+		if bounds.MaxX > 180.0 {
+			result = append(result, shift(unwrapped, -360.0))
+		}
+		if bounds.MinX < -180.0 {
+			result = append(result, shift(unwrapped, 360.0))
+		}
+	}
+	return result
+}
+
+// PolygonTiles retrieves tiles intersecting multipolygon (longitude and latitude) on given
+// zoom levels. Tiles closer to the polygon than buffer (in meters) are included as well.
+func PolygonTiles(mp geom.MultiPolygon, zooms []int, buffer float64) []TileID {
+	return slices.Collect(PolygonTilesSeq(mp, zooms, buffer))
+}
+
+// PolygonTilesSeq is like PolygonTiles but yields tiles one by one, without keeping them
+// in memory.
+func PolygonTilesSeq(mp geom.MultiPolygon, zooms []int, buffer float64) iter.Seq[TileID] {
+	c := newPolygonCover(mp, buffer)
+	return func(yield func(TileID) bool) {
+		for _, z := range zooms {
+			if !c.tiles(z, yield) {
+				return
+			}
+		}
+	}
+}
+
+// LineTiles retrieves tiles within buffer (in meters) of line strings (longitude and latitude)
+// on given zoom levels. Buffer can differ per zoom level.
+func LineTiles(ml geom.MultiLineString, zooms []int, buffer func(zoom int) float64) []TileID {
+	return slices.Collect(LineTilesSeq(ml, zooms, buffer))
+}
+
+// LineTilesSeq is like LineTiles but yields tiles one by one, without keeping them in memory.
+func LineTilesSeq(ml geom.MultiLineString, zooms []int, buffer func(zoom int) float64) iter.Seq[TileID] {
+	base := newLineCover(ml, 0)
+	return func(yield func(TileID) bool) {
+		for _, z := range zooms {
+			c := *base
+			c.buffer = buffer(z)
+			if !c.tiles(z, yield) {
+				return
+			}
+		}
+	}
+}
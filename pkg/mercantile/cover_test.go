@@ -0,0 +1,109 @@
+package mercantile_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/geom"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+)
+
+func box(west, south, east, north float64) geom.Polygon {
+	return geom.Polygon{{
+		{X: west, Y: south}, {X: east, Y: south}, {X: east, Y: north}, {X: west, Y: north}, {X: west, Y: south},
+	}}
+}
+
+func TestPolygonTiles(t *testing.T) {
+	zooms := []int{3, 6, 9}
+
+	// Polygon equal to bbox covers the same tiles.
+	square := geom.MultiPolygon{box(14.1, 49.1, 24.1, 54.8)}
+	assert.ElementsMatch(t, mercantile.Tiles(14.1, 49.1, 24.1, 54.8, zooms), mercantile.PolygonTiles(square, zooms, 0))
+
+	// Diagonal triangle covers roughly half of its bbox.
+	triangle := geom.MultiPolygon{{{{X: 14.1, Y: 49.1}, {X: 24.1, Y: 49.1}, {X: 24.1, Y: 54.8}}}}
+	tiles := mercantile.PolygonTiles(triangle, []int{9}, 0)
+	all := mercantile.Tiles(14.1, 49.1, 24.1, 54.8, []int{9})
+	assert.Less(t, len(tiles), len(all)*6/10)
+	assert.Contains(t, tiles, mercantile.Tile(24.0, 49.2, 9))
+	assert.NotContains(t, tiles, mercantile.Tile(14.2, 54.7, 9))
+
+	// Hole in the middle of the polygon is skipped.
+	withHole := geom.MultiPolygon{append(box(14.1, 49.1, 24.1, 54.8), box(18, 51, 20, 53)[0])}
+	assert.NotContains(t, mercantile.PolygonTiles(withHole, []int{9}, 0), mercantile.Tile(19.0, 52.0, 9))
+}
+
+func TestPolygonTiles_Buffer(t *testing.T) {
+	square := geom.MultiPolygon{box(14.1, 49.1, 24.1, 54.8)}
+	tile := mercantile.Tile(13.9, 52.0, 12)
+
+	// Tile is about 14 km west of the polygon.
+	assert.NotContains(t, mercantile.PolygonTiles(square, []int{12}, 0), tile)
+	assert.NotContains(t, mercantile.PolygonTiles(square, []int{12}, 5000), tile)
+	assert.Contains(t, mercantile.PolygonTiles(square, []int{12}, 20000), tile)
+}
+
+func TestPolygonTiles_Antimeridian(t *testing.T) {
+	zooms := []int{2, 5}
+	want := mercantile.Tiles(170.0, -20.0, -170.0, 20.0, zooms)
+
+	// Polygon crossing the antimeridian written with continuous longitudes.
+	unwrapped := geom.MultiPolygon{box(170.0, -20.0, 190.0, 20.0)}
+	assert.ElementsMatch(t, want, mercantile.PolygonTiles(unwrapped, zooms, 0))
+
+	// Polygon crossing the antimeridian with longitudes jumping from 180 to -180.
+	jumping := geom.MultiPolygon{{{
+		{X: 170.0, Y: -20.0}, {X: -170.0, Y: -20.0}, {X: -170.0, Y: 20.0}, {X: 170.0, Y: 20.0}, {X: 170.0, Y: -20.0},
+	}}}
+	assert.ElementsMatch(t, want, mercantile.PolygonTiles(jumping, zooms, 0))
+}
+
+func TestPolygonBounds(t *testing.T) {
+	jumping := geom.Polygon{{
+		{X: 175.0, Y: -20.0}, {X: -175.0, Y: -20.0}, {X: -175.0, Y: 20.0}, {X: 175.0, Y: 20.0}, {X: 175.0, Y: -20.0},
+	}}
+
+	tests := map[string]struct {
+		Polygons geom.MultiPolygon
+		Expected mercantile.LngLatBbox
+	}{
+		"polygon":               {Polygons: geom.MultiPolygon{box(14.1, 49.1, 24.1, 54.8)}, Expected: mercantile.LngLatBbox{West: 14.1, South: 49.1, East: 24.1, North: 54.8}},
+		"jumping longitudes":    {Polygons: geom.MultiPolygon{jumping}, Expected: mercantile.LngLatBbox{West: 175, South: -20, East: -175, North: 20}},
+		"continuous longitudes": {Polygons: geom.MultiPolygon{box(175, -20, 185, 20)}, Expected: mercantile.LngLatBbox{West: 175, South: -20, East: -175, North: 20}},
+		"both sides":            {Polygons: geom.MultiPolygon{box(175, -20, 180, 0), box(-180, 0, -170, 20)}, Expected: mercantile.LngLatBbox{West: 175, South: -20, East: -170, North: 20}},
+		"prime meridian":        {Polygons: geom.MultiPolygon{box(-10, 40, -5, 50), box(5, 40, 10, 50)}, Expected: mercantile.LngLatBbox{West: -10, South: 40, East: 10, North: 50}},
+		"world":                 {Polygons: geom.MultiPolygon{box(-180, -80, 0, 80), box(0, -80, 180, 80)}, Expected: mercantile.LngLatBbox{West: -180, South: -80, East: 180, North: 80}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.Expected, mercantile.PolygonBounds(test.Polygons))
+		})
+	}
+}
+
+func TestLineTiles(t *testing.T) {
+	// Route along the 52nd parallel.
+	route := geom.MultiLineString{{{X: 14.1, Y: 52.0}, {X: 24.1, Y: 52.0}}}
+	noBuffer := func(int) float64 { return 0 }
+
+	tiles := mercantile.LineTiles(route, []int{10}, noBuffer)
+	assert.Len(t, tiles, len(mercantile.Tiles(14.1, 52.0, 24.1, 52.0, []int{10})))
+
+	perZoom := func(zoom int) float64 {
+		if zoom < 10 {
+			return 0
+		}
+		return 10000
+	}
+	// Buffer differs per zoom, tiles about 8 km north of the route are included only on zoom 10.
+	tiles = mercantile.LineTiles(route, []int{9, 10}, perZoom)
+	assert.Contains(t, tiles, mercantile.Tile(18.0, 52.07, 10))
+	assert.NotContains(t, tiles, mercantile.Tile(18.0, 52.3, 9))
+
+	// Single point route covers the tile containing the point.
+	point := geom.MultiLineString{{{X: 18.0, Y: 52.0}}}
+	assert.Equal(t, []mercantile.TileID{mercantile.Tile(18.0, 52.0, 12)}, mercantile.LineTiles(point, []int{12}, noBuffer))
+}
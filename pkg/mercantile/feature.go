@@ -0,0 +1,121 @@
+package mercantile
+
+import (
+	"fmt"
+	"math"
+)
+
+// Feature represents tile as GeoJSON Feature with Polygon geometry.
+type Feature struct {
+	Type       string          `json:"type"`
+	Bbox       [4]float64      `json:"bbox"`
+	ID         string          `json:"id"`
+	Geometry   FeatureGeometry `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+// FeatureGeometry represents GeoJSON Polygon geometry.
+type FeatureGeometry struct {
+	Type        string         `json:"type"`
+	Coordinates [][][2]float64 `json:"coordinates"`
+}
+
+// FeatureCollection represents GeoJSON FeatureCollection of tiles.
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+type featureOptions struct {
+	id         string
+	properties map[string]any
+	mercator   bool
+	buffer     float64
+	precision  int
+}
+
+type FeatureOption func(*featureOptions)
+
+// WithFeatureID sets ID of the feature (defaults to tile representation).
+func WithFeatureID(id string) FeatureOption {
+	return func(o *featureOptions) {
+		o.id = id
+	}
+}
+
+// WithProperties adds properties to the feature.
+func WithProperties(properties map[string]any) FeatureOption {
+	return func(o *featureOptions) {
+		o.properties = properties
+	}
+}
+
+// WithMercator outputs coordinates in Spherical Mercator meters instead of longitude
+// and latitude.
+func WithMercator() FeatureOption {
+	return func(o *featureOptions) {
+		o.mercator = true
+	}
+}
+
+// WithBuffer expands the tile shape by given distance (in units of output coordinates).
+func WithBuffer(buffer float64) FeatureOption {
+	return func(o *featureOptions) {
+		o.buffer = buffer
+	}
+}
+
+// WithPrecision rounds coordinates to given number of decimal places.
+func WithPrecision(precision int) FeatureOption {
+	return func(o *featureOptions) {
+		o.precision = precision
+	}
+}
+
+// String returns tile representation compatible with Python's mercantile.
+func (t TileID) String() string {
+	return fmt.Sprintf("Tile(x=%d, y=%d, z=%d)", t.X, t.Y, t.Z)
+}
+
+// TileFeature retrieves GeoJSON Feature representing the shape of a tile.
+func TileFeature(tile TileID, options ...FeatureOption) Feature {
+	opts := featureOptions{precision: -1}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	b := Bounds(tile)
+	west, south, east, north := b.West, b.South, b.East, b.North
+	if opts.mercator {
+		xy := XyBounds(tile)
+		west, south, east, north = xy.Left, xy.Bottom, xy.Right, xy.Top
+	}
+	if opts.buffer != 0 {
+		west, south, east, north = west-opts.buffer, south-opts.buffer, east+opts.buffer, north+opts.buffer
+	}
+	if opts.precision >= 0 {
+		scale := math.Pow(10, float64(opts.precision))
+		round := func(v float64) float64 { return math.Round(v*scale) / scale }
+		west, south, east, north = round(west), round(south), round(east), round(north)
+	}
+
+	feature := Feature{
+		Type: "Feature",
+		Bbox: [4]float64{math.Min(west, east), math.Min(south, north), math.Max(west, east), math.Max(south, north)},
+		ID:   tile.String(),
+		Geometry: FeatureGeometry{
+			Type: "Polygon",
+			Coordinates: [][][2]float64{{
+				{west, south}, {west, north}, {east, north}, {east, south}, {west, south},
+			}},
+		},
+		Properties: map[string]any{"title": "XYZ tile " + tile.String()},
+	}
+	for key, value := range opts.properties {
+		feature.Properties[key] = value
+	}
+	if opts.id != "" {
+		feature.ID = opts.id
+	}
+	return feature
+}
@@ -5,9 +5,22 @@ Code below ports some functions from Python's https://github.com/mapbox/mercanti
 package mercantile
 
 import (
+	"errors"
+	"fmt"
+	"iter"
 	"math"
+	"slices"
+	"sort"
+	"strings"
 )
 
+// ErrInvalidZoom is returned when requested zoom level of parent or children tiles does
+// not make sense for the input tile.
+var ErrInvalidZoom = errors.New("invalid zoom level")
+
+// earthRadius is the radius of the Web Mercator sphere.
+const earthRadius = 6378137.0
+
 // Bbox represents Web Mercator Bounding Box.
 type Bbox struct {
 	Left   float64
@@ -16,6 +29,14 @@ type Bbox struct {
 	Top    float64
 }
 
+// LngLatBbox represents geographic bounding box.
+type LngLatBbox struct {
+	West  float64
+	South float64
+	East  float64
+	North float64
+}
+
 // TileID represents ID of the tile in X, Y, Z format.
 type TileID struct {
 	X int
@@ -38,6 +59,13 @@ func Xy(lngLat LngLat) (x, y float64) {
 	return x, y
 }
 
+// Lnglat retrieves longitude and latitude of Spherical Mercator (x, y) given in meters.
+func Lnglat(x, y float64) LngLat {
+	lng := x * (180.0 / math.Pi) / earthRadius
+	lat := ((math.Pi * 0.5) - 2.0*math.Atan(math.Exp(-y/earthRadius))) * (180.0 / math.Pi)
+	return LngLat{lng, lat}
+}
+
 // Ul retrieves upper left coordinates (lon, lat) of a tile.
 func Ul(tile TileID) LngLat {
 	n := math.Pow(2.0, float64(tile.Z))
@@ -47,6 +75,13 @@ func Ul(tile TileID) LngLat {
 	return LngLat{lonDeg, latDeg}
 }
 
+// Bounds retrieves geographic bounding box of a tile.
+func Bounds(tile TileID) LngLatBbox {
+	ul := Ul(tile)
+	lr := Ul(TileID{tile.X + 1, tile.Y + 1, tile.Z})
+	return LngLatBbox{ul.Lng, lr.Lat, lr.Lng, ul.Lat}
+}
+
 // XyBounds retrieves Spherical Mercator Bounding Box of a tile.
 func XyBounds(tile TileID) Bbox {
 	left, top := Xy(Ul(tile))
@@ -64,8 +99,71 @@ func Tile(lng float64, lat float64, zoom int) TileID {
 	return TileID{tileX, tileY, zoom}
 }
 
+// XyToTile retrieves tile containing given Spherical Mercator (x, y) in meters. Points
+// outside of the Web Mercator extent are clamped to the edge tiles.
+func XyToTile(x, y float64, zoom int) TileID {
+	circumference := 2 * math.Pi * earthRadius
+	return clampedTile(x/circumference+0.5, 0.5-y/circumference, zoom)
+}
+
+// clampedTile retrieves tile containing point given as fraction (0-1) of the world
+// extent, counted from the upper left corner.
+func clampedTile(fx, fy float64, zoom int) TileID {
+	n := math.Pow(2.0, float64(zoom))
+	index := func(f float64) int {
+		switch {
+		case f <= 0 || math.IsNaN(f):
+			return 0
+		case f >= 1:
+			return int(n - 1)
+		}
+		return int(math.Floor((f + 1e-14) * n))
+	}
+	return TileID{index(fx), index(fy), zoom}
+}
+
 // Tiles retrieves tiles intersecting a geographic bounding box.
 func Tiles(west, south, east, north float64, zooms []int) []TileID {
+	return slices.Collect(TilesSeq(west, south, east, north, zooms))
+}
+
+// TilesSeq is like Tiles but yields tiles one by one, without keeping them in memory.
+func TilesSeq(west, south, east, north float64, zooms []int) iter.Seq[TileID] {
+	return func(yield func(TileID) bool) {
+		for _, r := range tileRanges(west, south, east, north, zooms) {
+			for i := r.minX; i < r.maxX; i++ {
+				for j := r.minY; j < r.maxY; j++ {
+					if !yield(TileID{i, j, r.zoom}) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// Count retrieves number of tiles intersecting a geographic bounding box, it is equal to
+// the number of tiles returned by Tiles but computed without enumerating them.
+func Count(west, south, east, north float64, zooms []int) int {
+	count := 0
+	for _, r := range tileRanges(west, south, east, north, zooms) {
+		if r.maxX > r.minX && r.maxY > r.minY {
+			count += (r.maxX - r.minX) * (r.maxY - r.minY)
+		}
+	}
+	return count
+}
+
+// tileRange represents range of tiles on a zoom level, minimums are inclusive
+// and maximums are exclusive.
+type tileRange struct {
+	minX, minY, maxX, maxY, zoom int
+}
+
+// tileRanges retrieves ranges of tiles intersecting a geographic bounding box, zoom level
+// after zoom level. Bounding boxes crossing the antimeridian are split in two, on low zoom
+// levels columns shared by both parts are in the first range only.
+func tileRanges(west, south, east, north float64, zooms []int) []tileRange {
 	var bboxes [][]float64
 	if west > east {
 		bboxWest := []float64{-180.0, south, east, north}
@@ -75,22 +173,23 @@ func Tiles(west, south, east, north float64, zooms []int) []TileID {
 		bboxes = [][]float64{{west, south, east, north}}
 	}
 
-	var tiles []TileID
-	for _, bbox := range bboxes {
-		w := math.Max(-180.0, bbox[0])
-		s := math.Max(-85.051129, bbox[1])
-		e := math.Min(180.0, bbox[2])
-		n := math.Min(85.051129, bbox[3])
+	var ranges []tileRange
+	for _, z := range zooms {
+		minX := 0
+		for _, bbox := range bboxes {
+			w := math.Max(-180.0, bbox[0])
+			s := math.Max(-85.051129, bbox[1])
+			e := math.Min(180.0, bbox[2])
+			n := math.Min(85.051129, bbox[3])
 
-		for _, z := range zooms {
 			ll := Tile(w, s, z)
 			ur := Tile(e, n, z)
 
 			var llx int
 			var ury int
 
-			if ll.X < 0 {
-				llx = 0
+			if ll.X < minX {
+				llx = minX
 			} else {
 				llx = ll.X
 			}
@@ -100,12 +199,200 @@ func Tiles(west, south, east, north float64, zooms []int) []TileID {
 				ury = ur.Y
 			}
 
-			for i := llx; i < int(math.Min(float64(ur.X)+1.0, math.Pow(2.0, float64(z)))); i++ {
-				for j := ury; j < int(math.Min(float64(ll.Y)+1.0, math.Pow(2.0, float64(z)))); j++ {
-					tiles = append(tiles, TileID{i, j, z})
-				}
+			r := tileRange{
+				minX: llx,
+				minY: ury,
+				maxX: int(math.Min(float64(ur.X)+1.0, math.Pow(2.0, float64(z)))),
+				maxY: int(math.Min(float64(ll.Y)+1.0, math.Pow(2.0, float64(z)))),
+				zoom: z,
+			}
+			ranges = append(ranges, r)
+			minX = max(minX, r.maxX)
+		}
+	}
+	return ranges
+}
+
+// Unique removes duplicated tiles, keeping the order of their first occurrences.
+func Unique(tiles []TileID) []TileID {
+	seen := make(map[TileID]bool, len(tiles))
+	unique := make([]TileID, 0, len(tiles))
+	for _, tile := range tiles {
+		if !seen[tile] {
+			seen[tile] = true
+			unique = append(unique, tile)
+		}
+	}
+	return unique
+}
+
+// Parent retrieves parent of a tile on given zoom level (tile.Z-1 for the direct parent).
+func Parent(tile TileID, zoom int) (TileID, error) {
+	if zoom < 0 || zoom > tile.Z {
+		return TileID{}, fmt.Errorf("%w: zoom of parent must be between 0 and %d", ErrInvalidZoom, tile.Z)
+	}
+	shift := tile.Z - zoom
+	return TileID{tile.X >> shift, tile.Y >> shift, zoom}, nil
+}
+
+// Children retrieves children of a tile on given zoom level (tile.Z+1 for the direct
+// children). Children of every tile are ordered: upper left, upper right, lower right,
+// lower left.
+func Children(tile TileID, zoom int) ([]TileID, error) {
+	if zoom < tile.Z {
+		return nil, fmt.Errorf("%w: zoom of children must be greater than or equal to %d", ErrInvalidZoom, tile.Z)
+	}
+	tiles := []TileID{tile}
+	for tiles[0].Z < zoom {
+		t := tiles[0]
+		tiles = append(tiles[1:],
+			TileID{t.X * 2, t.Y * 2, t.Z + 1},
+			TileID{t.X*2 + 1, t.Y * 2, t.Z + 1},
+			TileID{t.X*2 + 1, t.Y*2 + 1, t.Z + 1},
+			TileID{t.X * 2, t.Y*2 + 1, t.Z + 1},
+		)
+	}
+	return tiles, nil
+}
+
+// Neighbors retrieves tiles adjacent to a tile (on the same zoom level). Tiles outside
+// of the grid are skipped.
+func Neighbors(tile TileID) []TileID {
+	n := 1 << tile.Z
+	var tiles []TileID
+	for i := -1; i <= 1; i++ {
+		for j := -1; j <= 1; j++ {
+			x, y := tile.X+i, tile.Y+j
+			if (i == 0 && j == 0) || x < 0 || y < 0 || x >= n || y >= n {
+				continue
 			}
+			tiles = append(tiles, TileID{x, y, tile.Z})
 		}
 	}
 	return tiles
 }
+
+// Quadkey retrieves quadkey of a tile.
+func Quadkey(tile TileID) string {
+	var qk strings.Builder
+	for z := tile.Z; z > 0; z-- {
+		digit := '0'
+		mask := 1 << (z - 1)
+		if tile.X&mask != 0 {
+			digit++
+		}
+		if tile.Y&mask != 0 {
+			digit += 2
+		}
+		qk.WriteRune(digit)
+	}
+	return qk.String()
+}
+
+// QuadkeyToTile retrieves tile with given quadkey.
+func QuadkeyToTile(qk string) (TileID, error) {
+	var tile TileID
+	for i := 0; i < len(qk); i++ {
+		mask := 1 << (len(qk) - 1 - i)
+		switch qk[i] {
+		case '0':
+		case '1':
+			tile.X |= mask
+		case '2':
+			tile.Y |= mask
+		case '3':
+			tile.X |= mask
+			tile.Y |= mask
+		default:
+			return TileID{}, fmt.Errorf("unexpected quadkey digit: %q", qk[i])
+		}
+	}
+	tile.Z = len(qk)
+	return tile, nil
+}
+
+// BoundingTile retrieves the smallest tile containing a geographic bounding box.
+func BoundingTile(west, south, east, north float64) TileID {
+	const maxZoom = 28
+	east -= 1e-11
+	south += 1e-11
+	xy := func(lng, lat float64) (float64, float64) {
+		sinLat := math.Sin(lat * (math.Pi / 180.0))
+		return lng/360.0 + 0.5, 0.5 - 0.25*math.Log((1.0+sinLat)/(1.0-sinLat))/math.Pi
+	}
+	fx, fy := xy(west, north)
+	tmin := clampedTile(fx, fy, 32)
+	fx, fy = xy(east, south)
+	tmax := clampedTile(fx, fy, 32)
+
+	z := maxZoom
+	for i := 0; i < maxZoom; i++ {
+		mask := 1 << (32 - (i + 1))
+		if tmin.X&mask != tmax.X&mask || tmin.Y&mask != tmax.Y&mask {
+			z = i
+			break
+		}
+	}
+	return TileID{tmin.X >> (32 - z), tmin.Y >> (32 - z), z}
+}
+
+// Simplify reduces set of tiles to the smallest equivalent set: tiles covered by their
+// ancestors are removed and complete sets of four children are replaced with their parent.
+// Returned tiles are sorted by zoom level, x and y.
+func Simplify(tiles []TileID) []TileID {
+	sorted := append([]TileID(nil), tiles...)
+	sortTiles(sorted)
+
+	set := map[TileID]bool{}
+	for _, tile := range sorted {
+		covered := false
+		for z := 0; z < tile.Z && !covered; z++ {
+			ancestor, _ := Parent(tile, z)
+			covered = set[ancestor]
+		}
+		if !covered {
+			set[tile] = true
+		}
+	}
+
+	for merged := true; merged; {
+		merged = false
+		siblings := map[TileID][]TileID{}
+		for tile := range set {
+			if tile.Z == 0 {
+				continue
+			}
+			parent, _ := Parent(tile, tile.Z-1)
+			siblings[parent] = append(siblings[parent], tile)
+		}
+		for parent, children := range siblings {
+			if len(children) == 4 {
+				for _, child := range children {
+					delete(set, child)
+				}
+				set[parent] = true
+				merged = true
+			}
+		}
+	}
+
+	simplified := make([]TileID, 0, len(set))
+	for tile := range set {
+		simplified = append(simplified, tile)
+	}
+	sortTiles(simplified)
+	return simplified
+}
+
+func sortTiles(tiles []TileID) {
+	sort.Slice(tiles, func(i, j int) bool {
+		a, b := tiles[i], tiles[j]
+		if a.Z != b.Z {
+			return a.Z < b.Z
+		}
+		if a.X != b.X {
+			return a.X < b.X
+		}
+		return a.Y < b.Y
+	})
+}
@@ -0,0 +1,244 @@
+package mercantile_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+)
+
+func TestUnique(t *testing.T) {
+	tiles := []mercantile.TileID{{X: 1, Y: 2, Z: 3}, {X: 0, Y: 0, Z: 0}, {X: 1, Y: 2, Z: 3}, {X: 2, Y: 2, Z: 3}}
+
+	assert.Equal(
+		t,
+		[]mercantile.TileID{{X: 1, Y: 2, Z: 3}, {X: 0, Y: 0, Z: 0}, {X: 2, Y: 2, Z: 3}},
+		mercantile.Unique(tiles),
+	)
+}
+
+func TestBounds(t *testing.T) {
+	bounds := mercantile.Bounds(mercantile.TileID{X: 486, Y: 332, Z: 10})
+
+	assert.InDelta(t, -9.140625, bounds.West, 1e-9)
+	assert.InDelta(t, 53.12040528310657, bounds.South, 1e-9)
+	assert.InDelta(t, -8.7890625, bounds.East, 1e-9)
+	assert.InDelta(t, 53.33087298301705, bounds.North, 1e-9)
+}
+
+func TestLnglat(t *testing.T) {
+	lngLat := mercantile.Lnglat(-8366731.739810849, -1655181.9927159143)
+
+	assert.InDelta(t, -75.15963, lngLat.Lng, 1e-9)
+	assert.InDelta(t, -14.70462, lngLat.Lat, 1e-9)
+}
+
+func TestXyToTile(t *testing.T) {
+	tests := map[string]struct {
+		X, Y float64
+		Tile mercantile.TileID
+	}{
+		"inside":       {X: -1000000, Y: 7010000, Tile: mercantile.TileID{X: 486, Y: 332, Z: 10}},
+		"upper left":   {X: -20037508.342789244, Y: 20037508.342789244, Tile: mercantile.TileID{X: 0, Y: 0, Z: 10}},
+		"out of range": {X: 30000000, Y: -30000000, Tile: mercantile.TileID{X: 1023, Y: 1023, Z: 10}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.Tile, mercantile.XyToTile(test.X, test.Y, 10))
+		})
+	}
+}
+
+func TestParent(t *testing.T) {
+	tests := map[string]struct {
+		Zoom    int
+		Parent  mercantile.TileID
+		WantErr string
+	}{
+		"direct parent": {Zoom: 9, Parent: mercantile.TileID{X: 243, Y: 166, Z: 9}},
+		"ancestor":      {Zoom: 5, Parent: mercantile.TileID{X: 15, Y: 10, Z: 5}},
+		"root":          {Zoom: 0, Parent: mercantile.TileID{X: 0, Y: 0, Z: 0}},
+		"higher zoom":   {Zoom: 11, WantErr: "invalid zoom level: zoom of parent must be between 0 and 10"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			parent, err := mercantile.Parent(mercantile.TileID{X: 486, Y: 332, Z: 10}, test.Zoom)
+			if test.WantErr != "" {
+				assert.EqualError(t, err, test.WantErr)
+				assert.ErrorIs(t, err, mercantile.ErrInvalidZoom)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.Parent, parent)
+		})
+	}
+}
+
+func TestChildren(t *testing.T) {
+	children, err := mercantile.Children(mercantile.TileID{X: 243, Y: 166, Z: 9}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []mercantile.TileID{
+		{X: 486, Y: 332, Z: 10}, {X: 487, Y: 332, Z: 10}, {X: 487, Y: 333, Z: 10}, {X: 486, Y: 333, Z: 10},
+	}, children)
+
+	children, err = mercantile.Children(mercantile.TileID{X: 0, Y: 0, Z: 0}, 2)
+	assert.NoError(t, err)
+	assert.Len(t, children, 16)
+
+	_, err = mercantile.Children(mercantile.TileID{X: 243, Y: 166, Z: 9}, 8)
+	assert.ErrorIs(t, err, mercantile.ErrInvalidZoom)
+}
+
+func TestNeighbors(t *testing.T) {
+	tests := map[string]struct {
+		Tile      mercantile.TileID
+		Neighbors []mercantile.TileID
+	}{
+		"inside": {
+			Tile: mercantile.TileID{X: 1, Y: 1, Z: 2},
+			Neighbors: []mercantile.TileID{
+				{X: 0, Y: 0, Z: 2}, {X: 0, Y: 1, Z: 2}, {X: 0, Y: 2, Z: 2}, {X: 1, Y: 0, Z: 2},
+				{X: 1, Y: 2, Z: 2}, {X: 2, Y: 0, Z: 2}, {X: 2, Y: 1, Z: 2}, {X: 2, Y: 2, Z: 2},
+			},
+		},
+		"corner": {
+			Tile:      mercantile.TileID{X: 3, Y: 0, Z: 2},
+			Neighbors: []mercantile.TileID{{X: 2, Y: 0, Z: 2}, {X: 2, Y: 1, Z: 2}, {X: 3, Y: 1, Z: 2}},
+		},
+		"root": {
+			Tile: mercantile.TileID{X: 0, Y: 0, Z: 0},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.Neighbors, mercantile.Neighbors(test.Tile))
+		})
+	}
+}
+
+func TestQuadkey(t *testing.T) {
+	tile := mercantile.TileID{X: 486, Y: 332, Z: 10}
+	assert.Equal(t, "0313102310", mercantile.Quadkey(tile))
+	assert.Equal(t, "", mercantile.Quadkey(mercantile.TileID{}))
+
+	decoded, err := mercantile.QuadkeyToTile("0313102310")
+	assert.NoError(t, err)
+	assert.Equal(t, tile, decoded)
+
+	decoded, err = mercantile.QuadkeyToTile("")
+	assert.NoError(t, err)
+	assert.Equal(t, mercantile.TileID{}, decoded)
+
+	_, err = mercantile.QuadkeyToTile("0314")
+	assert.EqualError(t, err, `unexpected quadkey digit: '4'`)
+}
+
+func TestBoundingTile(t *testing.T) {
+	tests := map[string]struct {
+		Bbox mercantile.LngLatBbox
+		Tile mercantile.TileID
+	}{
+		"bbox":        {Bbox: mercantile.LngLatBbox{West: -92.5, South: 0.5, East: -90.5, North: 1.5}, Tile: mercantile.TileID{X: 31, Y: 63, Z: 7}},
+		"tile bounds": {Bbox: mercantile.Bounds(mercantile.TileID{X: 486, Y: 332, Z: 10}), Tile: mercantile.TileID{X: 486, Y: 332, Z: 10}},
+		"hemispheres": {Bbox: mercantile.LngLatBbox{West: -10, South: -10, East: 10, North: 10}, Tile: mercantile.TileID{X: 0, Y: 0, Z: 0}},
+		"world":       {Bbox: mercantile.LngLatBbox{West: -180, South: -90, East: 180, North: 90}, Tile: mercantile.TileID{X: 0, Y: 0, Z: 0}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			b := test.Bbox
+			assert.Equal(t, test.Tile, mercantile.BoundingTile(b.West, b.South, b.East, b.North))
+		})
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	children, _ := mercantile.Children(mercantile.TileID{X: 243, Y: 166, Z: 9}, 11)
+	tiles := append(children, mercantile.TileID{X: 486, Y: 332, Z: 10}, mercantile.TileID{X: 0, Y: 0, Z: 9})
+
+	assert.Equal(
+		t,
+		[]mercantile.TileID{{X: 0, Y: 0, Z: 9}, {X: 243, Y: 166, Z: 9}},
+		mercantile.Simplify(tiles),
+	)
+	assert.Equal(
+		t,
+		[]mercantile.TileID{{X: 0, Y: 0, Z: 0}},
+		mercantile.Simplify([]mercantile.TileID{{X: 0, Y: 0, Z: 1}, {X: 1, Y: 0, Z: 1}, {X: 0, Y: 1, Z: 1}, {X: 1, Y: 1, Z: 1}}),
+	)
+}
+
+func TestTileFeature(t *testing.T) {
+	tile := mercantile.TileID{X: 486, Y: 332, Z: 10}
+
+	feature := mercantile.TileFeature(tile, mercantile.WithPrecision(3), mercantile.WithProperties(map[string]any{"a": 1}))
+	assert.Equal(t, mercantile.Feature{
+		Type: "Feature",
+		Bbox: [4]float64{-9.141, 53.12, -8.789, 53.331},
+		ID:   "Tile(x=486, y=332, z=10)",
+		Geometry: mercantile.FeatureGeometry{
+			Type: "Polygon",
+			Coordinates: [][][2]float64{{
+				{-9.141, 53.12}, {-9.141, 53.331}, {-8.789, 53.331}, {-8.789, 53.12}, {-9.141, 53.12},
+			}},
+		},
+		Properties: map[string]any{"title": "XYZ tile Tile(x=486, y=332, z=10)", "a": 1},
+	}, feature)
+
+	feature = mercantile.TileFeature(tile, mercantile.WithMercator(), mercantile.WithBuffer(10), mercantile.WithFeatureID("1"))
+	assert.Equal(t, "1", feature.ID)
+	assert.InDelta(t, -1017539.7205322663, feature.Bbox[0], 1e-6)
+	assert.InDelta(t, 7044446.526761846, feature.Bbox[3], 1e-6)
+}
+
+func TestCount(t *testing.T) {
+	tests := map[string]struct {
+		West, South, East, North float64
+		Zooms                    []int
+	}{
+		"bbox":            {West: 20.85, South: 52.1, East: 21.27, North: 52.37, Zooms: []int{0, 5, 10, 14}},
+		"world":           {West: -180, South: -90, East: 180, North: 90, Zooms: []int{0, 1, 2, 3}},
+		"antimeridian":    {West: 170, South: -20, East: -170, North: 20, Zooms: []int{2, 6}},
+		"antimeridian z0": {West: 170, South: -20, East: -170, North: 20, Zooms: []int{0, 1}},
+		"inverted bounds": {West: 21.27, South: 52.37, East: 21.27, North: 52.1, Zooms: []int{8}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tiles := mercantile.Tiles(test.West, test.South, test.East, test.North, test.Zooms)
+			assert.Equal(t, len(tiles), mercantile.Count(test.West, test.South, test.East, test.North, test.Zooms))
+			assert.Equal(t, mercantile.Unique(tiles), tiles)
+		})
+	}
+}
+
+func TestTilesSeq(t *testing.T) {
+	var tiles []mercantile.TileID
+	for tile := range mercantile.TilesSeq(-180, -90, 180, 90, []int{0, 1, 2}) {
+		tiles = append(tiles, tile)
+		if len(tiles) == 3 {
+			break
+		}
+	}
+
+	assert.Equal(t, []mercantile.TileID{{X: 0, Y: 0, Z: 0}, {X: 0, Y: 0, Z: 1}, {X: 0, Y: 1, Z: 1}}, tiles)
+}
+
+func TestTilesSeq_Antimeridian(t *testing.T) {
+	var tiles []mercantile.TileID
+	for tile := range mercantile.TilesSeq(170, -10, -170, 10, []int{0, 1, 2}) {
+		tiles = append(tiles, tile)
+	}
+
+	// Tiles of both parts are enumerated zoom level after zoom level, the only tile of zoom 0
+	// once.
+	assert.Equal(t, []mercantile.TileID{
+		{X: 0, Y: 0, Z: 0},
+		{X: 0, Y: 0, Z: 1}, {X: 0, Y: 1, Z: 1}, {X: 1, Y: 0, Z: 1}, {X: 1, Y: 1, Z: 1},
+		{X: 0, Y: 1, Z: 2}, {X: 0, Y: 2, Z: 2}, {X: 3, Y: 1, Z: 2}, {X: 3, Y: 2, Z: 2},
+	}, tiles)
+}
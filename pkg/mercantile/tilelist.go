@@ -0,0 +1,206 @@
+package mercantile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"strconv"
+	"strings"
+)
+
+// ReadTileList reads list of tiles in z/x/y format, one tile per line (e.g. expire lists
+// written by osm2pgsql). Blank lines and lines starting with # are skipped.
+func ReadTileList(r io.Reader) ([]TileID, error) {
+	var tiles []TileID
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		tile, err := parseTilePath(text)
+		if err != nil {
+			return nil, fmt.Errorf("error reading tile list: line %d: %w", line, err)
+		}
+		tiles = append(tiles, tile)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading tile list: %w", err)
+	}
+	return tiles, nil
+}
+
+// parseTilePath parses tile given as z/x/y.
+func parseTilePath(s string) (TileID, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 3 {
+		return TileID{}, fmt.Errorf("invalid tile %q (expected z/x/y)", s)
+	}
+	var coords [3]int
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 {
+			return TileID{}, fmt.Errorf("invalid tile %q (expected z/x/y)", s)
+		}
+		coords[i] = value
+	}
+	tile := TileID{X: coords[1], Y: coords[2], Z: coords[0]}
+	if tile.Z > 30 || tile.X >= 1<<tile.Z || tile.Y >= 1<<tile.Z {
+		return TileID{}, fmt.Errorf("tile %q is outside of the grid", s)
+	}
+	return tile, nil
+}
+
+// Cascade expands tiles with their parents down to minZoom and their children up to
+// maxZoom, so that all tiles overlapping the given ones on these zoom levels are
+// included. Given tiles are always included, tiles are returned without duplicates,
+// zoom level after zoom level (from the lowest one), so parents come before their
+// children: on each zoom level given tiles, their parents and then children.
+func Cascade(tiles []TileID, minZoom, maxZoom int) iter.Seq[TileID] {
+	return func(yield func(TileID) bool) {
+		tiles := Unique(tiles)
+		given := make(map[TileID]bool, len(tiles))
+		lowest, deepest := minZoom, maxZoom
+		for _, tile := range tiles {
+			given[tile] = true
+			lowest, deepest = min(lowest, tile.Z), max(deepest, tile.Z)
+		}
+		seen := maps.Clone(given)
+
+		parents := map[int][]TileID{}
+		for _, tile := range tiles {
+			for z := tile.Z - 1; z >= minZoom; z-- {
+				parent, _ := Parent(tile, z)
+				if seen[parent] {
+					// Ancestors of seen tiles are already included (or will be, when the
+					// parent is one of given tiles).
+					break
+				}
+				seen[parent] = true
+				parents[z] = append(parents[z], parent)
+			}
+		}
+		// Children of tiles with one of their ancestors given are included already with
+		// children of the ancestor.
+		var roots []TileID
+		for _, tile := range tiles {
+			if !hasAncestor(tile, given) {
+				roots = append(roots, tile)
+			}
+		}
+
+		for z := lowest; z <= deepest; z++ {
+			for _, tile := range tiles {
+				if tile.Z == z && !yield(tile) {
+					return
+				}
+			}
+			for _, parent := range parents[z] {
+				if !yield(parent) {
+					return
+				}
+			}
+			if z > maxZoom {
+				continue
+			}
+			for _, tile := range roots {
+				if tile.Z >= z {
+					continue
+				}
+				ok := emitDescendants(tile, z, func(child TileID) bool {
+					if seen[child] {
+						return true
+					}
+					return yield(child)
+				})
+				if !ok {
+					return
+				}
+			}
+		}
+	}
+}
+
+// hasAncestor reports whether any ancestor of a tile is in the set.
+func hasAncestor(tile TileID, set map[TileID]bool) bool {
+	for z := tile.Z - 1; z >= 0; z-- {
+		if parent, _ := Parent(tile, z); set[parent] {
+			return true
+		}
+	}
+	return false
+}
+
+// ZoomLevels splits tiles into sequences of consecutive tiles of the same zoom level, so
+// that tiles can be processed zoom level after zoom level. Each sequence has to be consumed
+// (at least partially) before the next one is requested, tiles skipped by breaking out of
+// a sequence are dropped.
+func ZoomLevels(tiles iter.Seq[TileID]) iter.Seq[iter.Seq[TileID]] {
+	return func(yield func(iter.Seq[TileID]) bool) {
+		next, stop := iter.Pull(tiles)
+		defer stop()
+
+		tile, ok := next()
+		for ok {
+			zoom := tile.Z
+			level := func(yield func(TileID) bool) {
+				for ok && tile.Z == zoom {
+					if !yield(tile) {
+						break
+					}
+					tile, ok = next()
+				}
+			}
+			if !yield(level) {
+				return
+			}
+			// Drop tiles of the zoom level which were not consumed.
+			for ok && tile.Z == zoom {
+				tile, ok = next()
+			}
+		}
+	}
+}
+
+// MergeZoomLevels merges sequences of tiles ordered by zoom level (e.g. tiles of areas
+// given for different zoom levels) into one sequence ordered by zoom level. Tiles of each
+// zoom level are taken from the sequences in their order, sequences are consumed lazily.
+func MergeZoomLevels(seqs ...iter.Seq[TileID]) iter.Seq[TileID] {
+	return func(yield func(TileID) bool) {
+		type head struct {
+			next func() (TileID, bool)
+			tile TileID
+			ok   bool
+		}
+		heads := make([]*head, 0, len(seqs))
+		for _, seq := range seqs {
+			next, stop := iter.Pull(seq)
+			defer stop()
+			h := &head{next: next}
+			h.tile, h.ok = next()
+			heads = append(heads, h)
+		}
+
+		for {
+			zoom := -1
+			for _, h := range heads {
+				if h.ok && (zoom < 0 || h.tile.Z < zoom) {
+					zoom = h.tile.Z
+				}
+			}
+			if zoom < 0 {
+				return
+			}
+			for _, h := range heads {
+				for h.ok && h.tile.Z == zoom {
+					if !yield(h.tile) {
+						return
+					}
+					h.tile, h.ok = h.next()
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package mercantile_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+)
+
+func TestReadTileList(t *testing.T) {
+	tests := map[string]struct {
+		List    string
+		Tiles   []mercantile.TileID
+		WantErr string
+	}{
+		"expire list": {
+			List:  "# expired\n14/9056/5384\n\n 15/18112/10768 \n",
+			Tiles: []mercantile.TileID{{X: 9056, Y: 5384, Z: 14}, {X: 18112, Y: 10768, Z: 15}},
+		},
+		"invalid line": {
+			List:    "14/9056/5384\n14/9056\n",
+			WantErr: `error reading tile list: line 2: invalid tile "14/9056" (expected z/x/y)`,
+		},
+		"outside of the grid": {
+			List:    "1/2/0\n",
+			WantErr: `error reading tile list: line 1: tile "1/2/0" is outside of the grid`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tiles, err := mercantile.ReadTileList(strings.NewReader(test.List))
+			if test.WantErr != "" {
+				assert.EqualError(t, err, test.WantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.Tiles, tiles)
+		})
+	}
+}
+
+func TestCascade(t *testing.T) {
+	tests := map[string]struct {
+		Tiles            []mercantile.TileID
+		MinZoom, MaxZoom int
+		Want             []mercantile.TileID
+	}{
+		"parents": {
+			Tiles:   []mercantile.TileID{{X: 4, Y: 2, Z: 3}, {X: 5, Y: 2, Z: 3}},
+			MinZoom: 1, MaxZoom: 3,
+			Want: []mercantile.TileID{{X: 1, Y: 0, Z: 1}, {X: 2, Y: 1, Z: 2}, {X: 4, Y: 2, Z: 3}, {X: 5, Y: 2, Z: 3}},
+		},
+		"children": {
+			Tiles:   []mercantile.TileID{{X: 1, Y: 0, Z: 1}},
+			MinZoom: 1, MaxZoom: 2,
+			Want: []mercantile.TileID{{X: 1, Y: 0, Z: 1}, {X: 2, Y: 0, Z: 2}, {X: 2, Y: 1, Z: 2}, {X: 3, Y: 0, Z: 2}, {X: 3, Y: 1, Z: 2}},
+		},
+		"nested tiles": {
+			Tiles:   []mercantile.TileID{{X: 2, Y: 1, Z: 2}, {X: 1, Y: 0, Z: 1}, {X: 2, Y: 1, Z: 2}},
+			MinZoom: 0, MaxZoom: 2,
+			Want: []mercantile.TileID{
+				{X: 0, Y: 0, Z: 0}, {X: 1, Y: 0, Z: 1},
+				{X: 2, Y: 1, Z: 2}, {X: 2, Y: 0, Z: 2}, {X: 3, Y: 0, Z: 2}, {X: 3, Y: 1, Z: 2},
+			},
+		},
+		"tiles outside of zoom range": {
+			Tiles:   []mercantile.TileID{{X: 0, Y: 0, Z: 0}, {X: 8, Y: 8, Z: 4}},
+			MinZoom: 1, MaxZoom: 1,
+			Want: []mercantile.TileID{
+				{X: 0, Y: 0, Z: 0}, {X: 1, Y: 1, Z: 1}, {X: 0, Y: 0, Z: 1}, {X: 0, Y: 1, Z: 1}, {X: 1, Y: 0, Z: 1},
+				{X: 2, Y: 2, Z: 2}, {X: 4, Y: 4, Z: 3}, {X: 8, Y: 8, Z: 4},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.Want, slices.Collect(mercantile.Cascade(test.Tiles, test.MinZoom, test.MaxZoom)))
+		})
+	}
+}
+
+func TestZoomLevels(t *testing.T) {
+	tiles := []mercantile.TileID{
+		{X: 0, Y: 0, Z: 1}, {X: 1, Y: 0, Z: 1},
+		{X: 0, Y: 0, Z: 2}, {X: 1, Y: 0, Z: 2}, {X: 2, Y: 0, Z: 2},
+		{X: 0, Y: 0, Z: 3},
+	}
+
+	var levels [][]mercantile.TileID
+	for level := range mercantile.ZoomLevels(slices.Values(tiles)) {
+		levels = append(levels, slices.Collect(level))
+	}
+	assert.Equal(t, [][]mercantile.TileID{tiles[:2], tiles[2:5], tiles[5:]}, levels)
+
+	// Tiles not consumed from a zoom level are dropped.
+	var first []mercantile.TileID
+	for level := range mercantile.ZoomLevels(slices.Values(tiles)) {
+		for tile := range level {
+			first = append(first, tile)
+			break
+		}
+	}
+	assert.Equal(t, []mercantile.TileID{tiles[0], tiles[2], tiles[5]}, first)
+}
+
+func TestMergeZoomLevels(t *testing.T) {
+	main := []mercantile.TileID{{X: 0, Y: 0, Z: 1}, {X: 0, Y: 0, Z: 4}}
+	extent := []mercantile.TileID{{X: 1, Y: 1, Z: 2}, {X: 2, Y: 2, Z: 2}, {X: 4, Y: 4, Z: 3}, {X: 8, Y: 8, Z: 4}}
+
+	merged := mercantile.MergeZoomLevels(slices.Values(main), slices.Values(extent))
+	assert.Equal(t, []mercantile.TileID{
+		{X: 0, Y: 0, Z: 1}, {X: 1, Y: 1, Z: 2}, {X: 2, Y: 2, Z: 2}, {X: 4, Y: 4, Z: 3},
+		{X: 0, Y: 0, Z: 4}, {X: 8, Y: 8, Z: 4},
+	}, slices.Collect(merged))
+
+	// Sequences are consumed lazily.
+	var first []mercantile.TileID
+	for tile := range merged {
+		first = append(first, tile)
+		break
+	}
+	assert.Equal(t, main[:1], first)
+}
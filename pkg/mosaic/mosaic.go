@@ -0,0 +1,136 @@
+/*
+Package mosaic stitches Web Mercator tiles into a single georeferenced image.
+*/
+
+package mosaic
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strings"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+)
+
+// originShift is the half of Web Mercator extent in meters.
+const originShift = math.Pi * 6378137.0
+
+// maxLatitude is the latitude of edges of Web Mercator extent.
+const maxLatitude = 85.0511287798066
+
+// maxPixels limits size of mosaic images.
+const maxPixels = 1 << 28
+
+// PseudoMercatorPRJ is the definition of Web Mercator (EPSG:3857) written to .prj files.
+const PseudoMercatorPRJ = `PROJCS["WGS_1984_Web_Mercator_Auxiliary_Sphere",GEOGCS["GCS_WGS_1984",` +
+	`DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]],PRIMEM["Greenwich",0.0],` +
+	`UNIT["Degree",0.0174532925199433]],PROJECTION["Mercator_Auxiliary_Sphere"],` +
+	`PARAMETER["False_Easting",0.0],PARAMETER["False_Northing",0.0],PARAMETER["Central_Meridian",0.0],` +
+	`PARAMETER["Standard_Parallel_1",0.0],PARAMETER["Auxiliary_Sphere_Type",0.0],UNIT["Meter",1.0]]`
+
+// TileFunc returns image of the tile. Missing tiles, given as nil image, are left transparent.
+type TileFunc func(tile mercantile.TileID) (image.Image, error)
+
+// Mosaic is an image stitched from tiles.
+type Mosaic struct {
+	Image *image.NRGBA
+	// Bounds are bounds of the image in Web Mercator. For extents crossing the antimeridian
+	// the right edge is beyond the extent of Web Mercator (east of 180°).
+	Bounds mercantile.Bbox
+}
+
+// Build stitches tiles of given zoom level and size (in pixels) covering the bbox, and crops
+// the image to the bbox (rounded to whole pixels). Bbox with west greater than east crosses
+// the antimeridian.
+func Build(bbox mercantile.LngLatBbox, zoom, tileSize int, tile TileFunc) (*Mosaic, error) {
+	east := bbox.East
+	if east < bbox.West {
+		east += 360
+	}
+	worldSize := float64(tileSize) * math.Exp2(float64(zoom))
+	res := 2 * originShift / worldSize
+	left, top := mercantile.Xy(mercantile.LngLat{Lng: bbox.West, Lat: clampLatitude(bbox.North)})
+	right, bottom := mercantile.Xy(mercantile.LngLat{Lng: east, Lat: clampLatitude(bbox.South)})
+
+	// Pixel bounds of the bbox in the world image.
+	px0 := int(math.Round((left + originShift) / res))
+	px1 := int(math.Round((right + originShift) / res))
+	py0 := int(math.Round((originShift - top) / res))
+	py1 := int(math.Round((originShift - bottom) / res))
+	width, height := px1-px0, py1-py0
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("error building mosaic: empty bbox on zoom %d", zoom)
+	}
+	if width*height > maxPixels {
+		return nil, fmt.Errorf("error building mosaic: image too large (%dx%d)", width, height)
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	n := 1 << zoom
+	for ty := floorDiv(py0, tileSize); ty <= floorDiv(py1-1, tileSize); ty++ {
+		for tx := floorDiv(px0, tileSize); tx <= floorDiv(px1-1, tileSize); tx++ {
+			// Columns beyond the antimeridian wrap around.
+			id := mercantile.TileID{X: ((tx % n) + n) % n, Y: ty, Z: zoom}
+			img, err := tile(id)
+			if err != nil {
+				return nil, err
+			}
+			if img == nil {
+				continue
+			}
+			if size := img.Bounds().Size(); size.X != tileSize || size.Y != tileSize {
+				return nil, fmt.Errorf(
+					"error building mosaic: unexpected size of tile %v: %dx%d (expected %dx%d)",
+					id, size.X, size.Y, tileSize, tileSize,
+				)
+			}
+			r := image.Rect(0, 0, tileSize, tileSize).Add(image.Pt(tx*tileSize-px0, ty*tileSize-py0))
+			draw.Draw(dst, r, img, img.Bounds().Min, draw.Src)
+		}
+	}
+
+	return &Mosaic{
+		Image: dst,
+		Bounds: mercantile.Bbox{
+			Left:   float64(px0)*res - originShift,
+			Bottom: originShift - float64(py1)*res,
+			Right:  float64(px1)*res - originShift,
+			Top:    originShift - float64(py0)*res,
+		},
+	}, nil
+}
+
+// WorldFile returns world file of the mosaic: pixel size, rotation and coordinates of the
+// center of the upper left pixel.
+func (m *Mosaic) WorldFile() string {
+	size := m.Image.Bounds().Size()
+	resX := (m.Bounds.Right - m.Bounds.Left) / float64(size.X)
+	resY := (m.Bounds.Top - m.Bounds.Bottom) / float64(size.Y)
+	return fmt.Sprintf(
+		"%.10f\n0.0000000000\n0.0000000000\n%.10f\n%.10f\n%.10f\n",
+		resX, -resY, m.Bounds.Left+resX/2, m.Bounds.Top-resY/2,
+	)
+}
+
+// WorldFileExtension returns extension of world file of image with given extension, e.g.
+// .pgw for .png and .jgw for .jpg.
+func WorldFileExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	if ext == "jpeg" {
+		ext = "jpg"
+	}
+	if len(ext) < 2 {
+		return ".wld"
+	}
+	return "." + ext[:1] + ext[len(ext)-1:] + "w"
+}
+
+func clampLatitude(lat float64) float64 {
+	return max(min(lat, maxLatitude), -maxLatitude)
+}
+
+func floorDiv(a, b int) int {
+	return int(math.Floor(float64(a) / float64(b)))
+}
@@ -0,0 +1,159 @@
+package mosaic_test
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mosaic"
+)
+
+// columnTiles returns tiles of uniform colours, red channel is the column of the tile.
+func columnTiles(size int, requested *[]mercantile.TileID) mosaic.TileFunc {
+	return func(tile mercantile.TileID) (image.Image, error) {
+		*requested = append(*requested, tile)
+		img := image.NewNRGBA(image.Rect(0, 0, size, size))
+		draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{R: uint8(tile.X), A: 255}), image.Point{}, draw.Src)
+		return img, nil
+	}
+}
+
+func TestBuild(t *testing.T) {
+	tests := map[string]struct {
+		Bbox      mercantile.LngLatBbox
+		Zoom      int
+		TileSize  int
+		Size      image.Point
+		Tiles     []mercantile.TileID
+		Columns   map[int]uint8
+		Bounds    mercantile.Bbox
+		WorldFile string
+	}{
+		"Tile": {
+			Bbox:     mercantile.Bounds(mercantile.TileID{X: 1, Y: 1, Z: 2}),
+			Zoom:     2,
+			TileSize: 256,
+			Size:     image.Pt(256, 256),
+			Tiles:    []mercantile.TileID{{X: 1, Y: 1, Z: 2}},
+			Columns:  map[int]uint8{0: 1, 255: 1},
+			Bounds:   mercantile.XyBounds(mercantile.TileID{X: 1, Y: 1, Z: 2}),
+			WorldFile: "39135.7584820102\n0.0000000000\n0.0000000000\n-39135.7584820102\n" +
+				"-9999186.2921536174\n9999186.2921536174\n",
+		},
+		"Cropped": {
+			Bbox:     mercantile.LngLatBbox{West: -22.5, South: 0, East: 22.5, North: 40.9798980696},
+			Zoom:     2,
+			TileSize: 256,
+			Size:     image.Pt(128, 128),
+			Tiles:    []mercantile.TileID{{X: 1, Y: 1, Z: 2}, {X: 2, Y: 1, Z: 2}},
+			Columns:  map[int]uint8{0: 1, 63: 1, 64: 2, 127: 2},
+			Bounds:   mercantile.Bbox{Left: -2504688.542848656, Bottom: 0, Right: 2504688.542848656, Top: 5009377.085697312},
+		},
+		"Antimeridian": {
+			Bbox:     mercantile.LngLatBbox{West: 157.5, South: -40.9798980696, East: -157.5, North: 0},
+			Zoom:     2,
+			TileSize: 256,
+			Size:     image.Pt(128, 128),
+			Tiles:    []mercantile.TileID{{X: 3, Y: 2, Z: 2}, {X: 0, Y: 2, Z: 2}},
+			Columns:  map[int]uint8{0: 3, 63: 3, 64: 0, 127: 0},
+			Bounds: mercantile.Bbox{
+				Left: 17532819.79994059, Bottom: -5009377.085697312, Right: 22542196.885637905, Top: 0,
+			},
+		},
+		"512px tiles": {
+			Bbox:     mercantile.Bounds(mercantile.TileID{X: 0, Y: 0, Z: 1}),
+			Zoom:     1,
+			TileSize: 512,
+			Size:     image.Pt(512, 512),
+			Tiles:    []mercantile.TileID{{X: 0, Y: 0, Z: 1}},
+			Columns:  map[int]uint8{0: 0, 511: 0},
+			Bounds:   mercantile.XyBounds(mercantile.TileID{X: 0, Y: 0, Z: 1}),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var requested []mercantile.TileID
+			m, err := mosaic.Build(test.Bbox, test.Zoom, test.TileSize, columnTiles(test.TileSize, &requested))
+			assert.NoError(t, err)
+			assert.Equal(t, test.Size, m.Image.Bounds().Size())
+			assert.Equal(t, test.Tiles, requested)
+			for x, column := range test.Columns {
+				assert.Equal(t, column, m.Image.NRGBAAt(x, 0).R, "column of pixel %d", x)
+			}
+			assert.InDelta(t, test.Bounds.Left, m.Bounds.Left, 1e-6)
+			assert.InDelta(t, test.Bounds.Bottom, m.Bounds.Bottom, 1e-6)
+			assert.InDelta(t, test.Bounds.Right, m.Bounds.Right, 1e-6)
+			assert.InDelta(t, test.Bounds.Top, m.Bounds.Top, 1e-6)
+			if test.WorldFile != "" {
+				assert.Equal(t, test.WorldFile, m.WorldFile())
+			}
+		})
+	}
+}
+
+func TestBuildMissingTiles(t *testing.T) {
+	m, err := mosaic.Build(
+		mercantile.Bounds(mercantile.TileID{X: 0, Y: 0, Z: 1}), 1, 256,
+		func(tile mercantile.TileID) (image.Image, error) { return nil, nil },
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, color.NRGBA{}, m.Image.NRGBAAt(128, 128))
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := map[string]struct {
+		Bbox     mercantile.LngLatBbox
+		Zoom     int
+		TileSize int
+		Error    string
+	}{
+		"Empty": {
+			Bbox:     mercantile.LngLatBbox{West: 10, South: 10, East: 10, North: 20},
+			Zoom:     2,
+			TileSize: 256,
+			Error:    "error building mosaic: empty bbox on zoom 2",
+		},
+		"Too large": {
+			Bbox:     mercantile.LngLatBbox{West: -180, South: -85, East: 180, North: 85},
+			Zoom:     10,
+			TileSize: 256,
+			Error:    "error building mosaic: image too large (262144x261286)",
+		},
+		"Tile size": {
+			Bbox:     mercantile.Bounds(mercantile.TileID{X: 0, Y: 0, Z: 1}),
+			Zoom:     1,
+			TileSize: 512,
+			Error:    "error building mosaic: unexpected size of tile Tile(x=0, y=0, z=1): 256x256 (expected 512x512)",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var requested []mercantile.TileID
+			_, err := mosaic.Build(test.Bbox, test.Zoom, test.TileSize, columnTiles(256, &requested))
+			assert.EqualError(t, err, test.Error)
+		})
+	}
+}
+
+func TestWorldFileExtension(t *testing.T) {
+	tests := map[string]string{
+		".png":  ".pgw",
+		".PNG":  ".pgw",
+		".jpg":  ".jgw",
+		".jpeg": ".jgw",
+		".tif":  ".tfw",
+		"":      ".wld",
+	}
+
+	for ext, expected := range tests {
+		t.Run(ext, func(t *testing.T) {
+			assert.Equal(t, expected, mosaic.WorldFileExtension(ext))
+		})
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Package overview builds tiles of lower zoom levels from tiles of the zoom level below, and
+tiles beyond the maximum zoom level served by the server from their ancestors.
+*/
+
+package overview
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+)
+
+// Resampling represents method used to compute pixels of parent tile from 2x2 blocks of
+// pixels of its children.
+type Resampling int
+
+const (
+	// Nearest takes the top left pixel of each block.
+	Nearest Resampling = iota
+	// Average takes the mean of pixels of each block.
+	Average
+	// Bilinear weights 4x4 pixels around each block with triangle filter, which smooths
+	// more than Average.
+	Bilinear
+	// Mode takes the most frequent colour of each block, keeping colours of categorical
+	// maps.
+	Mode
+)
+
+func (r Resampling) String() string {
+	switch r {
+	case Nearest:
+		return "nearest"
+	case Average:
+		return "average"
+	case Bilinear:
+		return "bilinear"
+	case Mode:
+		return "mode"
+	}
+	return fmt.Sprintf("Resampling(%d)", int(r))
+}
+
+// ParseResampling parses resampling method name.
+func ParseResampling(name string) (Resampling, error) {
+	switch strings.ToLower(name) {
+	case "nearest":
+		return Nearest, nil
+	case "average":
+		return Average, nil
+	case "bilinear":
+		return Bilinear, nil
+	case "mode":
+		return Mode, nil
+	}
+	return 0, fmt.Errorf("unsupported resampling method: %s", name)
+}
+
+// bilinearWeights are weights of triangle filter halving image size, for pixels at
+// offsets -1, 0, 1 and 2 from the top left pixel of a block.
+var bilinearWeights = [4]int{1, 3, 3, 1}
+
+// Build composes four children tiles of given size (top left, top right, bottom left and
+// bottom right; nil for missing, transparent ones) and downsamples them into the parent
+// tile of the same size.
+func Build(children [4]image.Image, size int, resampling Resampling) (*image.RGBA, error) {
+	// Work on premultiplied pixels so transparent pixels do not bleed colour.
+	src := image.NewRGBA(image.Rect(0, 0, 2*size, 2*size))
+	for i, child := range children {
+		if child == nil {
+			continue
+		}
+		if s := child.Bounds().Size(); s.X != size || s.Y != size {
+			return nil, fmt.Errorf("unexpected size of child tile: %dx%d (expected %dx%d)", s.X, s.Y, size, size)
+		}
+		at := image.Pt(i%2*size, i/2*size)
+		draw.Draw(src, image.Rectangle{Min: at, Max: at.Add(image.Pt(size, size))}, child, child.Bounds().Min, draw.Src)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			var c color.RGBA
+			switch resampling {
+			case Average:
+				c = average(src, 2*x, 2*y)
+			case Bilinear:
+				c = bilinear(src, 2*x, 2*y)
+			case Mode:
+				c = mode(src, 2*x, 2*y)
+			default:
+				c = src.RGBAAt(2*x, 2*y)
+			}
+			dst.SetRGBA(x, y, c)
+		}
+	}
+	return dst, nil
+}
+
+func average(img *image.RGBA, x, y int) color.RGBA {
+	var r, g, b, a int
+	for _, p := range [4]color.RGBA{img.RGBAAt(x, y), img.RGBAAt(x+1, y), img.RGBAAt(x, y+1), img.RGBAAt(x+1, y+1)} {
+		r, g, b, a = r+int(p.R), g+int(p.G), b+int(p.B), a+int(p.A)
+	}
+	return color.RGBA{R: uint8((r + 2) / 4), G: uint8((g + 2) / 4), B: uint8((b + 2) / 4), A: uint8((a + 2) / 4)}
+}
+
+// bilinear filters 4x4 pixels around the block. Pixels outside of the image are skipped and
+// weights of the remaining ones are normalized.
+func bilinear(img *image.RGBA, x, y int) color.RGBA {
+	var r, g, b, a, total int
+	for j, wy := range bilinearWeights {
+		for i, wx := range bilinearWeights {
+			px, py := x-1+i, y-1+j
+			if !(image.Point{X: px, Y: py}.In(img.Bounds())) {
+				continue
+			}
+			w := wx * wy
+			p := img.RGBAAt(px, py)
+			r, g, b, a = r+w*int(p.R), g+w*int(p.G), b+w*int(p.B), a+w*int(p.A)
+			total += w
+		}
+	}
+	return color.RGBA{
+		R: uint8((r + total/2) / total), G: uint8((g + total/2) / total),
+		B: uint8((b + total/2) / total), A: uint8((a + total/2) / total),
+	}
+}
+
+// mode returns the most frequent colour of the block, the first one of equally frequent
+// colours.
+func mode(img *image.RGBA, x, y int) color.RGBA {
+	block := [4]color.RGBA{img.RGBAAt(x, y), img.RGBAAt(x+1, y), img.RGBAAt(x, y+1), img.RGBAAt(x+1, y+1)}
+	best, bestCount := block[0], 0
+	for _, c := range block {
+		count := 0
+		for _, other := range block {
+			if other == c {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = c, count
+		}
+	}
+	return best
+}
+
+// Overzoom crops the part of the ancestor tile covered by its descendant dz zoom levels
+// deeper, in given column and row of the 2^dz x 2^dz grid of descendants, and upscales it
+// to the size of the ancestor. Nearest and Mode resampling repeat pixels, keeping colours
+// of categorical maps, Average and Bilinear interpolate them.
+func Overzoom(ancestor image.Image, dz, col, row int, resampling Resampling) (*image.RGBA, error) {
+	if dz < 1 || dz > 30 || col < 0 || col >= 1<<dz || row < 0 || row >= 1<<dz {
+		return nil, fmt.Errorf("invalid descendant: column %d, row %d, %d zoom levels deeper", col, row, dz)
+	}
+	size := ancestor.Bounds().Size()
+	src := image.NewRGBA(image.Rectangle{Max: size})
+	draw.Draw(src, src.Bounds(), ancestor, ancestor.Bounds().Min, draw.Src)
+
+	n := 1 << dz
+	dst := image.NewRGBA(src.Bounds())
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			var c color.RGBA
+			switch resampling {
+			case Average, Bilinear:
+				// Centre of the pixel in pixel space of the ancestor.
+				fx := (float64(col*size.X+x)+0.5)/float64(n) - 0.5
+				fy := (float64(row*size.Y+y)+0.5)/float64(n) - 0.5
+				c = interpolate(src, fx, fy)
+			default:
+				c = src.RGBAAt((col*size.X+x)/n, (row*size.Y+y)/n)
+			}
+			dst.SetRGBA(x, y, c)
+		}
+	}
+	return dst, nil
+}
+
+// interpolate interpolates pixels around the point bilinearly, points outside of the image
+// take pixels of its edges.
+func interpolate(img *image.RGBA, fx, fy float64) color.RGBA {
+	size := img.Bounds().Size()
+	fx = max(0, min(fx, float64(size.X-1)))
+	fy = max(0, min(fy, float64(size.Y-1)))
+	x0, y0 := int(fx), int(fy)
+	x1, y1 := min(x0+1, size.X-1), min(y0+1, size.Y-1)
+	tx, ty := fx-float64(x0), fy-float64(y0)
+
+	p00, p10, p01, p11 := img.RGBAAt(x0, y0), img.RGBAAt(x1, y0), img.RGBAAt(x0, y1), img.RGBAAt(x1, y1)
+	channel := func(c00, c10, c01, c11 uint8) uint8 {
+		top := float64(c00)*(1-tx) + float64(c10)*tx
+		bottom := float64(c01)*(1-tx) + float64(c11)*tx
+		return uint8(math.Round(top*(1-ty) + bottom*ty))
+	}
+	return color.RGBA{
+		R: channel(p00.R, p10.R, p01.R, p11.R), G: channel(p00.G, p10.G, p01.G, p11.G),
+		B: channel(p00.B, p10.B, p01.B, p11.B), A: channel(p00.A, p10.A, p01.A, p11.A),
+	}
+}
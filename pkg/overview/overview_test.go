@@ -0,0 +1,192 @@
+package overview_test
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/overview"
+)
+
+// stripes returns image with columns of alternating colours.
+func stripes(size int, a, b color.RGBA) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if x%2 == 0 {
+				img.SetRGBA(x, y, a)
+			} else {
+				img.SetRGBA(x, y, b)
+			}
+		}
+	}
+	return img
+}
+
+func TestBuild(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	black := color.RGBA{A: 255}
+	red := color.RGBA{R: 255, A: 255}
+
+	tests := map[string]struct {
+		Children   [4]image.Image
+		Resampling overview.Resampling
+		Pixels     map[image.Point]color.RGBA
+	}{
+		"Nearest": {
+			Children:   [4]image.Image{stripes(4, white, black), nil, nil, stripes(4, red, black)},
+			Resampling: overview.Nearest,
+			Pixels: map[image.Point]color.RGBA{
+				{0, 0}: white, {1, 1}: white, {2, 0}: {}, {0, 2}: {}, {3, 3}: red,
+			},
+		},
+		"Average": {
+			Children:   [4]image.Image{stripes(4, white, black), nil, nil, stripes(4, red, black)},
+			Resampling: overview.Average,
+			Pixels: map[image.Point]color.RGBA{
+				{0, 0}: {R: 128, G: 128, B: 128, A: 255}, {2, 0}: {}, {3, 3}: {R: 128, A: 255},
+			},
+		},
+		"Average of transparent pixels": {
+			Children:   [4]image.Image{stripes(4, white, color.RGBA{}), nil, nil, nil},
+			Resampling: overview.Average,
+			Pixels: map[image.Point]color.RGBA{
+				// Premultiplied half transparent white.
+				{0, 0}: {R: 128, G: 128, B: 128, A: 128},
+			},
+		},
+		"Bilinear": {
+			Children:   [4]image.Image{stripes(4, white, black), nil, nil, nil},
+			Resampling: overview.Bilinear,
+			Pixels: map[image.Point]color.RGBA{
+				// Weights of columns 0, 1 and 2 (without the column outside) are 3, 3 and 1,
+				// of columns 1, 2, 3 and 4 (transparent) are 1, 3, 3 and 1.
+				{0, 0}: {R: 146, G: 146, B: 146, A: 255}, {1, 0}: {R: 96, G: 96, B: 96, A: 223},
+			},
+		},
+		"Mode": {
+			Children: [4]image.Image{
+				stripes(4, red, red), stripes(4, white, black), stripes(4, white, white), nil,
+			},
+			Resampling: overview.Mode,
+			Pixels: map[image.Point]color.RGBA{
+				{0, 0}: red, {2, 0}: white, {0, 2}: white, {2, 2}: {},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			img, err := overview.Build(test.Children, 4, test.Resampling)
+			assert.NoError(t, err)
+			assert.Equal(t, image.Rect(0, 0, 4, 4), img.Bounds())
+			for p, expected := range test.Pixels {
+				assert.Equal(t, expected, img.RGBAAt(p.X, p.Y), "pixel %v", p)
+			}
+		})
+	}
+}
+
+func TestBuildUnexpectedSize(t *testing.T) {
+	_, err := overview.Build([4]image.Image{image.NewRGBA(image.Rect(0, 0, 2, 2))}, 4, overview.Average)
+	assert.EqualError(t, err, "unexpected size of child tile: 2x2 (expected 4x4)")
+}
+
+func TestParseResampling(t *testing.T) {
+	tests := map[string]struct {
+		Name       string
+		Resampling overview.Resampling
+		Error      string
+	}{
+		"Nearest":     {Name: "nearest", Resampling: overview.Nearest},
+		"Average":     {Name: "Average", Resampling: overview.Average},
+		"Bilinear":    {Name: "bilinear", Resampling: overview.Bilinear},
+		"Mode":        {Name: "mode", Resampling: overview.Mode},
+		"Unsupported": {Name: "cubic", Error: "unsupported resampling method: cubic"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			resampling, err := overview.ParseResampling(test.Name)
+			if test.Error != "" {
+				assert.EqualError(t, err, test.Error)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.Resampling, resampling)
+			assert.Equal(t, strings.ToLower(test.Name), resampling.String())
+		})
+	}
+}
+
+func TestOverzoom(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	black := color.RGBA{A: 255}
+	red := color.RGBA{R: 255, A: 255}
+	// Quadrants: white, red, black and transparent.
+	quadrants := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			quadrants.SetRGBA(x, y, [4]color.RGBA{white, red, black, {}}[y/2*2+x/2])
+		}
+	}
+	// Columns 0 and 1 black, 2 and 3 red.
+	columns := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			columns.SetRGBA(x, y, [4]color.RGBA{black, black, red, red}[x])
+		}
+	}
+
+	tests := map[string]struct {
+		Ancestor   image.Image
+		Dz         int
+		Col, Row   int
+		Resampling overview.Resampling
+		Pixels     map[image.Point]color.RGBA
+	}{
+		"Nearest": {
+			Ancestor: quadrants, Dz: 1, Col: 1, Row: 0, Resampling: overview.Nearest,
+			Pixels: map[image.Point]color.RGBA{{0, 0}: red, {3, 3}: red},
+		},
+		"Nearest two zoom levels deeper": {
+			Ancestor: quadrants, Dz: 2, Col: 0, Row: 3, Resampling: overview.Mode,
+			Pixels: map[image.Point]color.RGBA{{0, 0}: black, {3, 3}: black},
+		},
+		"Bilinear": {
+			Ancestor: columns, Dz: 1, Col: 0, Row: 0, Resampling: overview.Bilinear,
+			Pixels: map[image.Point]color.RGBA{
+				// Column 3 is 1/4 of the way from column 1 to column 2 of the ancestor.
+				{0, 0}: black, {2, 0}: black, {3, 0}: {R: 64, A: 255},
+			},
+		},
+		"Bilinear at the edge": {
+			Ancestor: columns, Dz: 1, Col: 1, Row: 1, Resampling: overview.Average,
+			Pixels: map[image.Point]color.RGBA{
+				{0, 0}: {R: 191, A: 255}, {3, 3}: red,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			img, err := overview.Overzoom(test.Ancestor, test.Dz, test.Col, test.Row, test.Resampling)
+			assert.NoError(t, err)
+			assert.Equal(t, test.Ancestor.Bounds(), img.Bounds())
+			for p, expected := range test.Pixels {
+				assert.Equal(t, expected, img.RGBAAt(p.X, p.Y), "pixel %v", p)
+			}
+		})
+	}
+}
+
+func TestOverzoomInvalidDescendant(t *testing.T) {
+	ancestor := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	_, err := overview.Overzoom(ancestor, 1, 2, 0, overview.Nearest)
+	assert.EqualError(t, err, "invalid descendant: column 2, row 0, 1 zoom levels deeper")
+	_, err = overview.Overzoom(ancestor, 0, 0, 0, overview.Nearest)
+	assert.EqualError(t, err, "invalid descendant: column 0, row 0, 0 zoom levels deeper")
+}
@@ -0,0 +1,165 @@
+package proj
+
+import "math"
+
+// Ellipsoid represents reference ellipsoid defined by semi-major axis (in meters)
+// and inverse flattening.
+type Ellipsoid struct {
+	A    float64
+	InvF float64
+}
+
+var (
+	WGS84             = Ellipsoid{A: 6378137.0, InvF: 298.257223563}
+	GRS80             = Ellipsoid{A: 6378137.0, InvF: 298.257222101}
+	Bessel1841        = Ellipsoid{A: 6377397.155, InvF: 299.1528128}
+	Airy1830          = Ellipsoid{A: 6377563.396, InvF: 299.3249646}
+	International1924 = Ellipsoid{A: 6378388.0, InvF: 297.0}
+	Clarke1866        = Ellipsoid{A: 6378206.4, InvF: 294.9786982138982}
+	Krassowsky1940    = Ellipsoid{A: 6378245.0, InvF: 298.3}
+)
+
+// F returns flattening of the ellipsoid.
+func (e Ellipsoid) F() float64 {
+	if e.InvF == 0 {
+		return 0
+	}
+	return 1 / e.InvF
+}
+
+// Es returns squared eccentricity of the ellipsoid.
+func (e Ellipsoid) Es() float64 {
+	f := e.F()
+	return 2*f - f*f
+}
+
+// E returns eccentricity of the ellipsoid.
+func (e Ellipsoid) E() float64 {
+	return math.Sqrt(e.Es())
+}
+
+// Datum represents geodetic datum together with parameters of 7-parameter Helmert
+// transformation to WGS84 (position vector convention, as used by PROJ towgs84):
+// translations in meters, rotations in arc seconds and scale difference in ppm.
+type Datum struct {
+	Name      string
+	Ellipsoid Ellipsoid
+	ToWGS84   [7]float64
+}
+
+var (
+	DatumWGS84  = Datum{Name: "WGS84", Ellipsoid: WGS84}
+	DatumETRS89 = Datum{Name: "ETRS89", Ellipsoid: GRS80}
+	DatumNAD83  = Datum{Name: "NAD83", Ellipsoid: GRS80}
+	DatumOSGB36 = Datum{
+		Name: "OSGB36", Ellipsoid: Airy1830,
+		ToWGS84: [7]float64{446.448, -125.157, 542.06, 0.15, 0.247, 0.842, -20.489},
+	}
+	DatumDHDN = Datum{
+		Name: "DHDN", Ellipsoid: Bessel1841,
+		ToWGS84: [7]float64{598.1, 73.7, 418.2, 0.202, 0.045, -2.455, 6.7},
+	}
+	DatumBelge1972 = Datum{
+		Name: "Belge 1972", Ellipsoid: International1924,
+		ToWGS84: [7]float64{-106.8686, 52.2978, -103.7239, 0.3366, -0.457, 1.8422, -1.2747},
+	}
+	DatumPulkovo1942 = Datum{
+		Name: "Pulkovo 1942(58)", Ellipsoid: Krassowsky1940,
+		ToWGS84: [7]float64{33.4, -146.6, -76.3, -0.359, -0.053, 0.844, -0.84},
+	}
+)
+
+func (d Datum) isWGS84() bool {
+	return d.ToWGS84 == [7]float64{}
+}
+
+// toGeocentric converts geodetic coordinates (radians, height in meters) to geocentric
+// cartesian coordinates.
+func toGeocentric(e Ellipsoid, lon, lat, h float64) (x, y, z float64) {
+	es := e.Es()
+	sinLat := math.Sin(lat)
+	n := e.A / math.Sqrt(1-es*sinLat*sinLat)
+	x = (n + h) * math.Cos(lat) * math.Cos(lon)
+	y = (n + h) * math.Cos(lat) * math.Sin(lon)
+	z = (n*(1-es) + h) * sinLat
+	return x, y, z
+}
+
+// fromGeocentric converts geocentric cartesian coordinates to geodetic coordinates
+// (radians, height in meters) using Bowring's method refined by iteration.
+func fromGeocentric(e Ellipsoid, x, y, z float64) (lon, lat, h float64) {
+	es := e.Es()
+	p := math.Hypot(x, y)
+	lon = math.Atan2(y, x)
+	lat = math.Atan2(z, p*(1-es))
+	for i := 0; i < 10; i++ {
+		sinLat := math.Sin(lat)
+		n := e.A / math.Sqrt(1-es*sinLat*sinLat)
+		h = p/math.Cos(lat) - n
+		next := math.Atan2(z, p*(1-es*n/(n+h)))
+		if math.Abs(next-lat) < 1e-14 {
+			lat = next
+			break
+		}
+		lat = next
+	}
+	sinLat := math.Sin(lat)
+	n := e.A / math.Sqrt(1-es*sinLat*sinLat)
+	h = p/math.Cos(lat) - n
+	return lon, lat, h
+}
+
+// helmert applies 7-parameter transformation (position vector convention) or its
+// exact inverse.
+func helmert(p [7]float64, x, y, z float64, inverse bool) (float64, float64, float64) {
+	const arcSec = math.Pi / (180 * 3600)
+	rx, ry, rz := p[3]*arcSec, p[4]*arcSec, p[5]*arcSec
+	m := 1 + p[6]*1e-6
+	r := [3][3]float64{
+		{m, -m * rz, m * ry},
+		{m * rz, m, -m * rx},
+		{-m * ry, m * rx, m},
+	}
+	if !inverse {
+		return p[0] + r[0][0]*x + r[0][1]*y + r[0][2]*z,
+			p[1] + r[1][0]*x + r[1][1]*y + r[1][2]*z,
+			p[2] + r[2][0]*x + r[2][1]*y + r[2][2]*z
+	}
+
+	// Solve r * v = (x, y, z) - t using Cramer's rule.
+	bx, by, bz := x-p[0], y-p[1], z-p[2]
+	det := func(a [3][3]float64) float64 {
+		return a[0][0]*(a[1][1]*a[2][2]-a[1][2]*a[2][1]) -
+			a[0][1]*(a[1][0]*a[2][2]-a[1][2]*a[2][0]) +
+			a[0][2]*(a[1][0]*a[2][1]-a[1][1]*a[2][0])
+	}
+	column := func(i int) [3][3]float64 {
+		a := r
+		a[0][i], a[1][i], a[2][i] = bx, by, bz
+		return a
+	}
+	d := det(r)
+	return det(column(0)) / d, det(column(1)) / d, det(column(2)) / d
+}
+
+// toWGS84 shifts geodetic coordinates (radians) from the datum to WGS84.
+func (d Datum) toWGS84(lon, lat float64) (float64, float64) {
+	if d.isWGS84() && (d.Ellipsoid == WGS84 || d.Ellipsoid == GRS80) {
+		return lon, lat
+	}
+	x, y, z := toGeocentric(d.Ellipsoid, lon, lat, 0)
+	x, y, z = helmert(d.ToWGS84, x, y, z, false)
+	lon, lat, _ = fromGeocentric(WGS84, x, y, z)
+	return lon, lat
+}
+
+// fromWGS84 shifts geodetic coordinates (radians) from WGS84 to the datum.
+func (d Datum) fromWGS84(lon, lat float64) (float64, float64) {
+	if d.isWGS84() && (d.Ellipsoid == WGS84 || d.Ellipsoid == GRS80) {
+		return lon, lat
+	}
+	x, y, z := toGeocentric(WGS84, lon, lat, 0)
+	x, y, z = helmert(d.ToWGS84, x, y, z, true)
+	lon, lat, _ = fromGeocentric(d.Ellipsoid, x, y, z)
+	return lon, lat
+}
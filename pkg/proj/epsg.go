@@ -0,0 +1,154 @@
+package proj
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Lookup returns CRS for given identifier. Accepted forms are EPSG:XXXX, CRS:84,
+// urn:ogc:def:crs:EPSG::XXXX and http://www.opengis.net/def/crs/EPSG/0/XXXX.
+func Lookup(id string) (*CRS, error) {
+	code, err := normalizeCode(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if code == "CRS:84" {
+		return &CRS{Code: code, Datum: DatumWGS84}, nil
+	}
+	epsg, err := strconv.Atoi(strings.TrimPrefix(code, "EPSG:"))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported CRS: %s", id)
+	}
+	crs := epsgCRS(epsg)
+	if crs == nil {
+		return nil, fmt.Errorf("unsupported CRS: %s", id)
+	}
+	crs.Code = code
+
+	return crs, nil
+}
+
+// MustLookup is like Lookup but panics if CRS is not supported.
+func MustLookup(id string) *CRS {
+	crs, err := Lookup(id)
+	if err != nil {
+		panic(err)
+	}
+	return crs
+}
+
+func normalizeCode(id string) (string, error) {
+	s := strings.TrimSpace(id)
+	upper := strings.ToUpper(s)
+	switch {
+	case upper == "CRS:84", upper == "OGC:CRS84", strings.HasSuffix(upper, "/OGC/1.3/CRS84"), upper == "URN:OGC:DEF:CRS:OGC:1.3:CRS84", upper == "WGS84":
+		return "CRS:84", nil
+	case strings.HasPrefix(upper, "EPSG:"):
+		return "EPSG:" + strings.TrimPrefix(upper, "EPSG:"), nil
+	case strings.HasPrefix(upper, "URN:OGC:DEF:CRS:EPSG:"):
+		parts := strings.Split(s, ":")
+		return "EPSG:" + parts[len(parts)-1], nil
+	case strings.Contains(upper, "OPENGIS.NET/DEF/CRS/EPSG/"):
+		parts := strings.Split(strings.TrimSuffix(s, "/"), "/")
+		return "EPSG:" + parts[len(parts)-1], nil
+	}
+	if _, err := strconv.Atoi(s); err == nil {
+		return "EPSG:" + s, nil
+	}
+
+	return "", fmt.Errorf("unsupported CRS: %s", id)
+}
+
+// epsgCRS returns definition of supported EPSG codes.
+func epsgCRS(code int) *CRS {
+	switch {
+	// Geographic CRSs.
+	case code == 4326:
+		return &CRS{NorthingFirst: true, Datum: DatumWGS84}
+	case code == 4258:
+		return &CRS{NorthingFirst: true, Datum: DatumETRS89}
+	case code == 4269:
+		return &CRS{NorthingFirst: true, Datum: DatumNAD83}
+	case code == 4277:
+		return &CRS{NorthingFirst: true, Datum: DatumOSGB36}
+	case code == 4314:
+		return &CRS{NorthingFirst: true, Datum: DatumDHDN}
+	case code == 4313:
+		return &CRS{NorthingFirst: true, Datum: DatumBelge1972}
+	case code == 4179:
+		return &CRS{NorthingFirst: true, Datum: DatumPulkovo1942}
+
+	// Mercator.
+	case code == 3857, code == 900913, code == 3785, code == 102100:
+		return &CRS{Datum: DatumWGS84, Projection: NewWebMercator()}
+	case code == 3395:
+		return &CRS{Datum: DatumWGS84, Projection: NewMercator(WGS84, 0, 1, 0, 0)}
+
+	// Universal Transverse Mercator.
+	case code >= 32601 && code <= 32660:
+		return &CRS{Datum: DatumWGS84, Projection: utm(WGS84, code-32600, false)}
+	case code >= 32701 && code <= 32760:
+		return &CRS{Datum: DatumWGS84, Projection: utm(WGS84, code-32700, true)}
+	case code >= 25828 && code <= 25838:
+		return &CRS{Datum: DatumETRS89, Projection: utm(GRS80, code-25800, false)}
+	case code >= 26901 && code <= 26923:
+		return &CRS{Datum: DatumNAD83, Projection: utm(GRS80, code-26900, false)}
+	case code == 3067:
+		return &CRS{Datum: DatumETRS89, Projection: utm(GRS80, 35, false)}
+
+	// Universal Polar Stereographic and polar stereographic projections.
+	case code == 32661:
+		return &CRS{Datum: DatumWGS84, Projection: NewPolarStereographicA(WGS84, false, 0, 0.994, 2000000, 2000000)}
+	case code == 32761:
+		return &CRS{Datum: DatumWGS84, Projection: NewPolarStereographicA(WGS84, true, 0, 0.994, 2000000, 2000000)}
+	case code == 3413:
+		return &CRS{Datum: DatumWGS84, Projection: NewPolarStereographicB(WGS84, 70, -45, 0, 0)}
+	case code == 3031:
+		return &CRS{Datum: DatumWGS84, Projection: NewPolarStereographicB(WGS84, -71, 0, 0, 0)}
+	case code == 3976:
+		return &CRS{Datum: DatumWGS84, Projection: NewPolarStereographicB(WGS84, -70, 0, 0, 0)}
+	case code == 3995:
+		return &CRS{Datum: DatumWGS84, Projection: NewPolarStereographicB(WGS84, 71, 0, 0, 0)}
+
+	// National Transverse Mercator grids.
+	case code == 2180:
+		return &CRS{NorthingFirst: true, Datum: DatumETRS89, Projection: NewTransverseMercator(GRS80, 0, 19, 0.9993, 500000, -5300000)}
+	case code >= 2176 && code <= 2179:
+		zone := code - 2171
+		return &CRS{NorthingFirst: true, Datum: DatumETRS89, Projection: NewTransverseMercator(GRS80, 0, float64(zone*3), 0.999923, float64(zone)*1e6+500000, 0)}
+	case code == 3006:
+		return &CRS{NorthingFirst: true, Datum: DatumETRS89, Projection: NewTransverseMercator(GRS80, 0, 15, 0.9996, 500000, 0)}
+	case code == 2193:
+		return &CRS{NorthingFirst: true, Datum: DatumETRS89, Projection: NewTransverseMercator(GRS80, 0, 173, 0.9996, 1600000, 10000000)}
+	case code == 27700:
+		return &CRS{Datum: DatumOSGB36, Projection: NewTransverseMercator(Airy1830, 49, -2, 0.9996012717, 400000, -100000)}
+	case code >= 31466 && code <= 31469:
+		zone := code - 31464
+		return &CRS{NorthingFirst: true, Datum: DatumDHDN, Projection: NewTransverseMercator(Bessel1841, 0, float64(zone*3), 1, float64(zone)*1e6+500000, 0)}
+
+	// National Lambert Conformal Conic grids.
+	case code == 2154:
+		return &CRS{Datum: DatumETRS89, Projection: NewLambertConformalConic2SP(GRS80, 46.5, 3, 49, 44, 700000, 6600000)}
+	case code == 3034:
+		return &CRS{NorthingFirst: true, Datum: DatumETRS89, Projection: NewLambertConformalConic2SP(GRS80, 52, 10, 35, 65, 4000000, 2800000)}
+	case code == 31370:
+		return &CRS{Datum: DatumBelge1972, Projection: NewLambertConformalConic2SP(
+			International1924, 90, 4.367486666666666, 51.16666723333333, 49.8333339, 150000.013, 5400088.438,
+		)}
+	case code == 3347:
+		return &CRS{Datum: DatumNAD83, Projection: NewLambertConformalConic2SP(GRS80, 63.390675, -91.8666666666667, 49, 77, 6200000, 3000000)}
+	}
+
+	return nil
+}
+
+// utm returns Universal Transverse Mercator projection for given zone.
+func utm(e Ellipsoid, zone int, south bool) *TransverseMercator {
+	falseNorthing := 0.0
+	if south {
+		falseNorthing = 10000000
+	}
+	return NewTransverseMercator(e, 0, float64(zone*6-183), 0.9996, 500000, falseNorthing)
+}
@@ -0,0 +1,113 @@
+package proj
+
+import "math"
+
+// LambertConformalConic implements ellipsoidal Lambert Conformal Conic projection with
+// one (LatOrigin with ScaleFactor) or two standard parallels.
+type LambertConformalConic struct {
+	Ellipsoid     Ellipsoid
+	LatOrigin     float64
+	CentralLon    float64
+	StdParallel1  float64
+	StdParallel2  float64
+	ScaleFactor   float64
+	FalseEasting  float64
+	FalseNorthing float64
+
+	e, n, f, rho0 float64
+}
+
+// NewLambertConformalConic2SP returns Lambert Conformal Conic projection with two standard
+// parallels. Angles are given in degrees.
+func NewLambertConformalConic2SP(e Ellipsoid, latOrigin, centralLon, stdParallel1, stdParallel2, falseEasting, falseNorthing float64) *LambertConformalConic {
+	p := &LambertConformalConic{
+		Ellipsoid:     e,
+		LatOrigin:     latOrigin,
+		CentralLon:    centralLon,
+		StdParallel1:  stdParallel1,
+		StdParallel2:  stdParallel2,
+		ScaleFactor:   1,
+		FalseEasting:  falseEasting,
+		FalseNorthing: falseNorthing,
+	}
+	p.e = e.E()
+	lat1, lat2 := radians(stdParallel1), radians(stdParallel2)
+	m1, m2 := p.m(lat1), p.m(lat2)
+	t1, t2 := p.t(lat1), p.t(lat2)
+	if math.Abs(lat1-lat2) < 1e-10 {
+		p.n = math.Sin(lat1)
+	} else {
+		p.n = (math.Log(m1) - math.Log(m2)) / (math.Log(t1) - math.Log(t2))
+	}
+	p.f = m1 / (p.n * math.Pow(t1, p.n))
+	p.rho0 = p.rho(radians(latOrigin))
+
+	return p
+}
+
+// NewLambertConformalConic1SP returns Lambert Conformal Conic projection with one standard
+// parallel (latitude of origin) and scale factor. Angles are given in degrees.
+func NewLambertConformalConic1SP(e Ellipsoid, latOrigin, centralLon, scale, falseEasting, falseNorthing float64) *LambertConformalConic {
+	p := &LambertConformalConic{
+		Ellipsoid:     e,
+		LatOrigin:     latOrigin,
+		CentralLon:    centralLon,
+		StdParallel1:  latOrigin,
+		StdParallel2:  latOrigin,
+		ScaleFactor:   scale,
+		FalseEasting:  falseEasting,
+		FalseNorthing: falseNorthing,
+	}
+	p.e = e.E()
+	lat0 := radians(latOrigin)
+	p.n = math.Sin(lat0)
+	p.f = p.m(lat0) / (p.n * math.Pow(p.t(lat0), p.n))
+	p.rho0 = p.rho(lat0)
+
+	return p
+}
+
+func (p *LambertConformalConic) m(lat float64) float64 {
+	sinLat := math.Sin(lat)
+	return math.Cos(lat) / math.Sqrt(1-p.e*p.e*sinLat*sinLat)
+}
+
+func (p *LambertConformalConic) t(lat float64) float64 {
+	return tsfn(lat, p.e)
+}
+
+func (p *LambertConformalConic) rho(lat float64) float64 {
+	if math.Abs(math.Abs(lat)-math.Pi/2) < 1e-12 {
+		if lat*p.n > 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return p.Ellipsoid.A * p.f * p.ScaleFactor * math.Pow(p.t(lat), p.n)
+}
+
+func (p *LambertConformalConic) Forward(lon, lat float64) (x, y float64) {
+	rho := p.rho(lat)
+	theta := p.n * normalizeLon(lon-radians(p.CentralLon))
+	x = p.FalseEasting + rho*math.Sin(theta)
+	y = p.FalseNorthing + p.rho0 - rho*math.Cos(theta)
+	return x, y
+}
+
+func (p *LambertConformalConic) Inverse(x, y float64) (lon, lat float64) {
+	dx := x - p.FalseEasting
+	dy := p.rho0 - (y - p.FalseNorthing)
+	sign := 1.0
+	if p.n < 0 {
+		sign = -1.0
+	}
+	rho := sign * math.Hypot(dx, dy)
+	theta := math.Atan2(sign*dx, sign*dy)
+	if rho == 0 {
+		return radians(p.CentralLon), sign * math.Pi / 2
+	}
+	t := math.Pow(rho/(p.Ellipsoid.A*p.f*p.ScaleFactor), 1/p.n)
+	lat = phi2(t, p.e)
+	lon = theta/p.n + radians(p.CentralLon)
+	return normalizeLon(lon), lat
+}
@@ -0,0 +1,54 @@
+package proj
+
+import "math"
+
+// Mercator implements normal aspect Mercator projection. With Spherical set, ellipsoid
+// semi-major axis is used as a sphere radius, which gives Web Mercator (EPSG:3857).
+type Mercator struct {
+	Ellipsoid     Ellipsoid
+	Spherical     bool
+	CentralLon    float64
+	ScaleFactor   float64
+	FalseEasting  float64
+	FalseNorthing float64
+}
+
+// NewWebMercator returns Popular Visualisation Pseudo Mercator projection.
+func NewWebMercator() *Mercator {
+	return &Mercator{Ellipsoid: WGS84, Spherical: true, ScaleFactor: 1}
+}
+
+// NewMercator returns ellipsoidal Mercator projection. Angles are given in degrees.
+func NewMercator(e Ellipsoid, centralLon, scale, falseEasting, falseNorthing float64) *Mercator {
+	return &Mercator{
+		Ellipsoid:     e,
+		CentralLon:    centralLon,
+		ScaleFactor:   scale,
+		FalseEasting:  falseEasting,
+		FalseNorthing: falseNorthing,
+	}
+}
+
+func (p *Mercator) e() float64 {
+	if p.Spherical {
+		return 0
+	}
+	return p.Ellipsoid.E()
+}
+
+func (p *Mercator) Forward(lon, lat float64) (x, y float64) {
+	if math.Abs(math.Abs(lat)-math.Pi/2) < 1e-12 {
+		return math.NaN(), math.NaN()
+	}
+	k := p.Ellipsoid.A * p.ScaleFactor
+	x = p.FalseEasting + k*normalizeLon(lon-radians(p.CentralLon))
+	y = p.FalseNorthing - k*math.Log(tsfn(lat, p.e()))
+	return x, y
+}
+
+func (p *Mercator) Inverse(x, y float64) (lon, lat float64) {
+	k := p.Ellipsoid.A * p.ScaleFactor
+	lon = (x-p.FalseEasting)/k + radians(p.CentralLon)
+	lat = phi2(math.Exp(-(y-p.FalseNorthing)/k), p.e())
+	return lon, lat
+}
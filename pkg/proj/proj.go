@@ -0,0 +1,159 @@
+/*
+Package proj implements coordinate transformations between the most common coordinate
+reference systems without external dependencies. Supported projections are Transverse
+Mercator, Lambert Conformal Conic, Polar Stereographic and (Web) Mercator, datum shifts
+are done with 7-parameter Helmert transformation.
+*/
+
+package proj
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+)
+
+// Projection converts geodetic coordinates (radians) on its ellipsoid to projected
+// coordinates (meters) and back. Points outside of projection domain yield NaN.
+type Projection interface {
+	Forward(lon, lat float64) (x, y float64)
+	Inverse(x, y float64) (lon, lat float64)
+}
+
+// CRS represents coordinate reference system. Geographic CRSs have no projection and use
+// degrees. Coordinates are always passed with longitude/easting as the first value,
+// NorthingFirst only describes axis order defined by the authority (used e.g. by WMS 1.3.0).
+type CRS struct {
+	Code          string
+	Datum         Datum
+	Projection    Projection
+	NorthingFirst bool
+}
+
+var ErrOutOfDomain = errors.New("coordinates outside of projection domain")
+
+// IsGeographic reports whether CRS uses geographic coordinates (degrees).
+func (c *CRS) IsGeographic() bool {
+	return c.Projection == nil
+}
+
+// ToWGS84 converts coordinates in the CRS to WGS84 longitude and latitude (degrees).
+func (c *CRS) ToWGS84(x, y float64) (lon, lat float64, err error) {
+	if c.IsGeographic() {
+		lon, lat = radians(x), radians(y)
+	} else {
+		lon, lat = c.Projection.Inverse(x, y)
+	}
+	if math.IsNaN(lon) || math.IsNaN(lat) {
+		return 0, 0, ErrOutOfDomain
+	}
+	lon, lat = c.Datum.toWGS84(lon, lat)
+	return degrees(lon), degrees(lat), nil
+}
+
+// FromWGS84 converts WGS84 longitude and latitude (degrees) to coordinates in the CRS.
+func (c *CRS) FromWGS84(lon, lat float64) (x, y float64, err error) {
+	lonRad, latRad := c.Datum.fromWGS84(radians(lon), radians(lat))
+	if c.IsGeographic() {
+		return degrees(lonRad), degrees(latRad), nil
+	}
+	x, y = c.Projection.Forward(lonRad, latRad)
+	if math.IsNaN(x) || math.IsNaN(y) || math.IsInf(x, 0) || math.IsInf(y, 0) {
+		return 0, 0, ErrOutOfDomain
+	}
+	return x, y, nil
+}
+
+// Transform converts coordinates between two CRSs.
+func Transform(src, dst *CRS, x, y float64) (float64, float64, error) {
+	if src.Code != "" && src.Code == dst.Code {
+		return x, y, nil
+	}
+	lon, lat, err := src.ToWGS84(x, y)
+	if err != nil {
+		return 0, 0, err
+	}
+	return dst.FromWGS84(lon, lat)
+}
+
+// TransformBounds converts bounding box between two CRSs. Each edge of the bounding box is
+// densified with given number of points, so the result covers whole source area even when
+// edges are curved in the destination CRS. Points outside of destination CRS domain are skipped.
+func TransformBounds(src, dst *CRS, bbox mercantile.Bbox, densify int) (mercantile.Bbox, error) {
+	if src.Code != "" && src.Code == dst.Code {
+		return bbox, nil
+	}
+	if densify < 0 {
+		densify = 0
+	}
+
+	result := mercantile.Bbox{
+		Left: math.Inf(1), Bottom: math.Inf(1), Right: math.Inf(-1), Top: math.Inf(-1),
+	}
+	add := func(x, y float64) {
+		tx, ty, err := Transform(src, dst, x, y)
+		if err != nil {
+			return
+		}
+		result.Left = math.Min(result.Left, tx)
+		result.Bottom = math.Min(result.Bottom, ty)
+		result.Right = math.Max(result.Right, tx)
+		result.Top = math.Max(result.Top, ty)
+	}
+
+	steps := densify + 1
+	width, height := bbox.Right-bbox.Left, bbox.Top-bbox.Bottom
+	for i := 0; i <= steps; i++ {
+		f := float64(i) / float64(steps)
+		add(bbox.Left+f*width, bbox.Bottom)
+		add(bbox.Left+f*width, bbox.Top)
+		add(bbox.Left, bbox.Bottom+f*height)
+		add(bbox.Right, bbox.Bottom+f*height)
+	}
+	if math.IsInf(result.Left, 0) {
+		return mercantile.Bbox{}, fmt.Errorf("error transforming bbox from %s to %s: %w", src.Code, dst.Code, ErrOutOfDomain)
+	}
+
+	return result, nil
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180.0
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180.0 / math.Pi
+}
+
+// normalizeLon wraps longitude (radians) into [-π, π] range.
+func normalizeLon(lon float64) float64 {
+	for lon > math.Pi {
+		lon -= 2 * math.Pi
+	}
+	for lon < -math.Pi {
+		lon += 2 * math.Pi
+	}
+	return lon
+}
+
+// tsfn computes isometric latitude related function t (Snyder, eq. 15-9).
+func tsfn(lat, e float64) float64 {
+	sinLat := e * math.Sin(lat)
+	return math.Tan(math.Pi/4-lat/2) / math.Pow((1-sinLat)/(1+sinLat), e/2)
+}
+
+// phi2 computes latitude from t (Snyder, eq. 7-9) iteratively.
+func phi2(t, e float64) float64 {
+	lat := math.Pi/2 - 2*math.Atan(t)
+	for i := 0; i < 15; i++ {
+		sinLat := e * math.Sin(lat)
+		next := math.Pi/2 - 2*math.Atan(t*math.Pow((1-sinLat)/(1+sinLat), e/2))
+		if math.Abs(next-lat) < 1e-14 {
+			return next
+		}
+		lat = next
+	}
+	return lat
+}
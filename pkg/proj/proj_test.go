@@ -0,0 +1,171 @@
+package proj_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/proj"
+)
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// Expected values below come from worked examples of EPSG Guidance Note 7-2.
+func TestProjection_Forward(t *testing.T) {
+	usFoot := 1200.0 / 3937.0
+	tests := map[string]struct {
+		Projection proj.Projection
+		Lon, Lat   float64
+		X, Y       float64
+		Delta      float64
+	}{
+		"Transverse Mercator (OSGB)": {
+			Projection: proj.NewTransverseMercator(proj.Airy1830, 49, -2, 0.9996012717, 400000, -100000),
+			Lon:        0.5, Lat: 50.5,
+			X: 577274.99, Y: 69740.50,
+			Delta: 0.01,
+		},
+		"Lambert Conformal Conic 2SP (Texas South Central)": {
+			Projection: proj.NewLambertConformalConic2SP(
+				proj.Clarke1866, 27+50.0/60, -99, 28+23.0/60, 30+17.0/60, 2000000*usFoot, 0,
+			),
+			Lon: -96, Lat: 28.5,
+			X: 2963503.91 * usFoot, Y: 254759.80 * usFoot,
+			Delta: 0.01,
+		},
+		"Polar Stereographic variant A (UPS North)": {
+			Projection: proj.NewPolarStereographicA(proj.WGS84, false, 0, 0.994, 2000000, 2000000),
+			Lon:        44, Lat: 73,
+			X: 3320416.75, Y: 632668.43,
+			Delta: 0.01,
+		},
+		"Polar Stereographic variant B (Australian Antarctic)": {
+			Projection: proj.NewPolarStereographicB(proj.WGS84, -71, 70, 6000000, 6000000),
+			Lon:        120, Lat: -75,
+			X: 7255380.79, Y: 7053389.56,
+			Delta: 0.01,
+		},
+		"Web Mercator": {
+			Projection: proj.NewWebMercator(),
+			Lon:        -(100 + 20.0/60), Lat: 24 + 22.0/60 + 54.433/3600,
+			X: -11169055.58, Y: 2800000.00,
+			Delta: 0.01,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			x, y := test.Projection.Forward(radians(test.Lon), radians(test.Lat))
+			assert.InDelta(t, test.X, x, test.Delta)
+			assert.InDelta(t, test.Y, y, test.Delta)
+
+			lon, lat := test.Projection.Inverse(x, y)
+			assert.InDelta(t, radians(test.Lon), lon, 1e-9)
+			assert.InDelta(t, radians(test.Lat), lat, 1e-9)
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := map[string]struct {
+		ID      string
+		Code    string
+		WantErr string
+	}{
+		"EPSG code":       {ID: "EPSG:2180", Code: "EPSG:2180"},
+		"lower case code": {ID: "epsg:3857", Code: "EPSG:3857"},
+		"URN":             {ID: "urn:ogc:def:crs:EPSG::32633", Code: "EPSG:32633"},
+		"URI":             {ID: "http://www.opengis.net/def/crs/EPSG/0/2154", Code: "EPSG:2154"},
+		"CRS84":           {ID: "http://www.opengis.net/def/crs/OGC/1.3/CRS84", Code: "CRS:84"},
+		"unsupported":     {ID: "EPSG:5514", WantErr: "unsupported CRS: EPSG:5514"},
+		"invalid":         {ID: "foo", WantErr: "unsupported CRS: foo"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			crs, err := proj.Lookup(test.ID)
+			if test.WantErr != "" {
+				assert.EqualError(t, err, test.WantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.Code, crs.Code)
+		})
+	}
+}
+
+func TestCRS_RoundTrip(t *testing.T) {
+	tests := map[string]struct {
+		Lon, Lat float64
+	}{
+		"EPSG:2180":  {Lon: 21.0122, Lat: 52.2297},
+		"EPSG:2178":  {Lon: 21.0122, Lat: 52.2297},
+		"EPSG:32633": {Lon: 13.4050, Lat: 52.5200},
+		"EPSG:32733": {Lon: 18.4241, Lat: -33.9249},
+		"EPSG:27700": {Lon: -0.1246, Lat: 51.5007},
+		"EPSG:31468": {Lon: 11.5820, Lat: 48.1351},
+		"EPSG:31370": {Lon: 4.3517, Lat: 50.8503},
+		"EPSG:2154":  {Lon: 2.3522, Lat: 48.8566},
+		"EPSG:3413":  {Lon: -51.7216, Lat: 64.1814},
+		"EPSG:3031":  {Lon: 166.6863, Lat: -77.8419},
+		"EPSG:3857":  {Lon: 179.9, Lat: -60.0},
+	}
+
+	for code, test := range tests {
+		t.Run(code, func(t *testing.T) {
+			crs := proj.MustLookup(code)
+			x, y, err := crs.FromWGS84(test.Lon, test.Lat)
+			assert.NoError(t, err)
+
+			lon, lat, err := crs.ToWGS84(x, y)
+			assert.NoError(t, err)
+			assert.InDelta(t, test.Lon, lon, 1e-7)
+			assert.InDelta(t, test.Lat, lat, 1e-7)
+		})
+	}
+}
+
+func TestCRS_DatumShift(t *testing.T) {
+	// OSGB36 coordinates of the same point differ from WGS84 by roughly 100 meters.
+	osgb := proj.MustLookup("EPSG:4277")
+	lon, lat, err := osgb.FromWGS84(-0.1246, 51.5007)
+	assert.NoError(t, err)
+
+	assert.InDelta(t, -0.1246+0.0016, lon, 0.0002)
+	assert.InDelta(t, 51.5007-0.0005, lat, 0.0002)
+}
+
+func TestTransform(t *testing.T) {
+	// Points on the central meridian keep their longitude.
+	x, _, err := proj.Transform(proj.MustLookup("EPSG:2180"), proj.MustLookup("EPSG:4326"), 500000, 500000)
+	assert.NoError(t, err)
+	assert.InDelta(t, 19.0, x, 1e-9)
+
+	x, y, err := proj.Transform(proj.MustLookup("EPSG:4326"), proj.MustLookup("EPSG:3857"), 17.0, 10.0)
+	assert.NoError(t, err)
+	wantX, wantY := mercantile.Xy(mercantile.LngLat{Lng: 17.0, Lat: 10.0})
+	assert.InDelta(t, wantX, x, 1e-6)
+	assert.InDelta(t, wantY, y, 1e-6)
+}
+
+func TestTransformBounds(t *testing.T) {
+	// Parallels are curved in Lambert Conformal Conic, so the southern edge of the bbox
+	// reaches its lowest point on the central meridian, below its corners.
+	bbox := mercantile.Bbox{Left: -5, Bottom: 42, Right: 8, Top: 51}
+	lambert93 := proj.MustLookup("EPSG:2154")
+
+	bounds, err := proj.TransformBounds(proj.MustLookup("EPSG:4326"), lambert93, bbox, 25)
+	assert.NoError(t, err)
+
+	_, cornerY, _ := lambert93.FromWGS84(8, 42)
+	_, middleY, _ := lambert93.FromWGS84(3, 42)
+	assert.Less(t, middleY, cornerY)
+	assert.InDelta(t, middleY, bounds.Bottom, 1)
+
+	_, err = proj.TransformBounds(proj.MustLookup("EPSG:3857"), proj.MustLookup("EPSG:4326"), mercantile.Bbox{}, 0)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,85 @@
+package proj
+
+import "math"
+
+// PolarStereographic implements ellipsoidal Polar Stereographic projection. The projection
+// is defined either by the latitude of true scale (variant B, when StdParallel is not ±90)
+// or by the scale factor at the pole (variant A).
+type PolarStereographic struct {
+	Ellipsoid     Ellipsoid
+	South         bool
+	CentralLon    float64
+	StdParallel   float64
+	ScaleFactor   float64
+	FalseEasting  float64
+	FalseNorthing float64
+
+	e, k float64
+}
+
+// NewPolarStereographicA returns Polar Stereographic projection defined by the scale factor
+// at the pole. Angles are given in degrees.
+func NewPolarStereographicA(e Ellipsoid, south bool, centralLon, scale, falseEasting, falseNorthing float64) *PolarStereographic {
+	p := &PolarStereographic{
+		Ellipsoid:     e,
+		South:         south,
+		CentralLon:    centralLon,
+		StdParallel:   90,
+		ScaleFactor:   scale,
+		FalseEasting:  falseEasting,
+		FalseNorthing: falseNorthing,
+	}
+	p.e = e.E()
+	p.k = 2 * e.A * scale / math.Sqrt(math.Pow(1+p.e, 1+p.e)*math.Pow(1-p.e, 1-p.e))
+	return p
+}
+
+// NewPolarStereographicB returns Polar Stereographic projection defined by the latitude of
+// true scale. Negative latitude means south pole aspect. Angles are given in degrees.
+func NewPolarStereographicB(e Ellipsoid, stdParallel, centralLon, falseEasting, falseNorthing float64) *PolarStereographic {
+	p := &PolarStereographic{
+		Ellipsoid:     e,
+		South:         stdParallel < 0,
+		CentralLon:    centralLon,
+		StdParallel:   stdParallel,
+		ScaleFactor:   1,
+		FalseEasting:  falseEasting,
+		FalseNorthing: falseNorthing,
+	}
+	p.e = e.E()
+	latC := math.Abs(radians(stdParallel))
+	if math.Abs(latC-math.Pi/2) < 1e-12 {
+		p.k = 2 * e.A / math.Sqrt(math.Pow(1+p.e, 1+p.e)*math.Pow(1-p.e, 1-p.e))
+		return p
+	}
+	sinC := math.Sin(latC)
+	mC := math.Cos(latC) / math.Sqrt(1-p.e*p.e*sinC*sinC)
+	p.k = e.A * mC / tsfn(latC, p.e)
+	return p
+}
+
+func (p *PolarStereographic) Forward(lon, lat float64) (x, y float64) {
+	if p.South {
+		lat = -lat
+	}
+	rho := p.k * tsfn(lat, p.e)
+	dlon := normalizeLon(lon - radians(p.CentralLon))
+	x = p.FalseEasting + rho*math.Sin(dlon)
+	if p.South {
+		return x, p.FalseNorthing + rho*math.Cos(dlon)
+	}
+	return x, p.FalseNorthing - rho*math.Cos(dlon)
+}
+
+func (p *PolarStereographic) Inverse(x, y float64) (lon, lat float64) {
+	dx := x - p.FalseEasting
+	dy := y - p.FalseNorthing
+	rho := math.Hypot(dx, dy)
+	lat = phi2(rho/p.k, p.e)
+	if p.South {
+		lon = radians(p.CentralLon) + math.Atan2(dx, dy)
+		return normalizeLon(lon), -lat
+	}
+	lon = radians(p.CentralLon) + math.Atan2(dx, -dy)
+	return normalizeLon(lon), lat
+}
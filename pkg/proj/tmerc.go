@@ -0,0 +1,96 @@
+package proj
+
+import "math"
+
+// TransverseMercator implements Transverse Mercator projection using Krüger series
+// (accurate to millimetres within several thousand kilometres from the central meridian).
+type TransverseMercator struct {
+	Ellipsoid     Ellipsoid
+	LatOrigin     float64
+	CentralLon    float64
+	ScaleFactor   float64
+	FalseEasting  float64
+	FalseNorthing float64
+
+	a, xi0, conformalCoeff float64
+	alpha, beta, delta     [4]float64
+}
+
+// NewTransverseMercator returns Transverse Mercator projection. Angles are given in degrees.
+func NewTransverseMercator(e Ellipsoid, latOrigin, centralLon, scale, falseEasting, falseNorthing float64) *TransverseMercator {
+	p := &TransverseMercator{
+		Ellipsoid:     e,
+		LatOrigin:     latOrigin,
+		CentralLon:    centralLon,
+		ScaleFactor:   scale,
+		FalseEasting:  falseEasting,
+		FalseNorthing: falseNorthing,
+	}
+	f := e.F()
+	n := f / (2 - f)
+	n2, n3, n4 := n*n, n*n*n, n*n*n*n
+	p.a = e.A / (1 + n) * (1 + n2/4 + n4/64)
+	p.alpha = [4]float64{
+		n/2 - 2*n2/3 + 5*n3/16 + 41*n4/180,
+		13*n2/48 - 3*n3/5 + 557*n4/1440,
+		61*n3/240 - 103*n4/140,
+		49561 * n4 / 161280,
+	}
+	p.beta = [4]float64{
+		n/2 - 2*n2/3 + 37*n3/96 - n4/360,
+		n2/48 + n3/15 - 437*n4/1440,
+		17*n3/480 - 37*n4/840,
+		4397 * n4 / 161280,
+	}
+	p.delta = [4]float64{
+		2*n - 2*n2/3 - 2*n3 + 116*n4/45,
+		7*n2/3 - 8*n3/5 - 227*n4/45,
+		56*n3/15 - 136*n4/35,
+		4279 * n4 / 630,
+	}
+	p.conformalCoeff = 2 * math.Sqrt(n) / (1 + n)
+	p.xi0, _ = p.xiEta(radians(latOrigin), 0)
+
+	return p
+}
+
+func (p *TransverseMercator) xiEta(lat, dlon float64) (xi, eta float64) {
+	sinLat := math.Sin(lat)
+	t := math.Sinh(math.Atanh(sinLat) - p.conformalCoeff*math.Atanh(p.conformalCoeff*sinLat))
+	xiP := math.Atan2(t, math.Cos(dlon))
+	etaP := math.Atanh(math.Sin(dlon) / math.Sqrt(1+t*t))
+
+	xi, eta = xiP, etaP
+	for j, a := range p.alpha {
+		k := 2 * float64(j+1)
+		xi += a * math.Sin(k*xiP) * math.Cosh(k*etaP)
+		eta += a * math.Cos(k*xiP) * math.Sinh(k*etaP)
+	}
+	return xi, eta
+}
+
+func (p *TransverseMercator) Forward(lon, lat float64) (x, y float64) {
+	xi, eta := p.xiEta(lat, normalizeLon(lon-radians(p.CentralLon)))
+	x = p.FalseEasting + p.ScaleFactor*p.a*eta
+	y = p.FalseNorthing + p.ScaleFactor*p.a*(xi-p.xi0)
+	return x, y
+}
+
+func (p *TransverseMercator) Inverse(x, y float64) (lon, lat float64) {
+	xi := (y-p.FalseNorthing)/(p.ScaleFactor*p.a) + p.xi0
+	eta := (x - p.FalseEasting) / (p.ScaleFactor * p.a)
+
+	xiP, etaP := xi, eta
+	for j, b := range p.beta {
+		k := 2 * float64(j+1)
+		xiP -= b * math.Sin(k*xi) * math.Cosh(k*eta)
+		etaP -= b * math.Cos(k*xi) * math.Sinh(k*eta)
+	}
+	chi := math.Asin(math.Sin(xiP) / math.Cosh(etaP))
+	lat = chi
+	for j, d := range p.delta {
+		lat += d * math.Sin(2*float64(j+1)*chi)
+	}
+	lon = radians(p.CentralLon) + math.Atan2(math.Sinh(etaP), math.Cos(xiP))
+	return normalizeLon(lon), lat
+}
@@ -0,0 +1,322 @@
+package proj
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// wktNode represents node of WKT (version 1) CRS definition, e.g. SPHEROID["GRS 1980",6378137,298.257222101].
+type wktNode struct {
+	keyword  string
+	values   []string
+	children []*wktNode
+}
+
+func (n *wktNode) child(keyword string) *wktNode {
+	for _, c := range n.children {
+		if strings.EqualFold(c.keyword, keyword) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (n *wktNode) name() string {
+	if len(n.values) == 0 {
+		return ""
+	}
+	return n.values[0]
+}
+
+func (n *wktNode) number(i int) (float64, error) {
+	if i >= len(n.values) {
+		return 0, fmt.Errorf("error parsing WKT: %s: missing value", n.keyword)
+	}
+	return strconv.ParseFloat(n.values[i], 64)
+}
+
+type wktParser struct {
+	s   string
+	pos int
+}
+
+func (p *wktParser) skipSpaces() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// nodeAhead reports whether keyword at current position opens a nested node.
+func (p *wktParser) nodeAhead() bool {
+	i := p.pos
+	for i < len(p.s) && (unicode.IsLetter(rune(p.s[i])) || unicode.IsDigit(rune(p.s[i])) || p.s[i] == '_') {
+		i++
+	}
+	for i < len(p.s) && unicode.IsSpace(rune(p.s[i])) {
+		i++
+	}
+	return i < len(p.s) && (p.s[i] == '[' || p.s[i] == '(')
+}
+
+func (p *wktParser) parseNode() (*wktNode, error) {
+	p.skipSpaces()
+	start := p.pos
+	for p.pos < len(p.s) && (unicode.IsLetter(rune(p.s[p.pos])) || unicode.IsDigit(rune(p.s[p.pos])) || p.s[p.pos] == '_') {
+		p.pos++
+	}
+	node := &wktNode{keyword: p.s[start:p.pos]}
+	p.skipSpaces()
+	if node.keyword == "" || p.pos >= len(p.s) || (p.s[p.pos] != '[' && p.s[p.pos] != '(') {
+		return nil, fmt.Errorf("error parsing WKT at position %d", p.pos)
+	}
+	closing := byte(']')
+	if p.s[p.pos] == '(' {
+		closing = ')'
+	}
+	p.pos++
+
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.s) {
+			return nil, fmt.Errorf("error parsing WKT: unexpected end of %s", node.keyword)
+		}
+		switch c := p.s[p.pos]; {
+		case c == closing:
+			p.pos++
+			return node, nil
+		case c == ',':
+			p.pos++
+		case c == '"':
+			end := strings.IndexByte(p.s[p.pos+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("error parsing WKT: unterminated string")
+			}
+			node.values = append(node.values, p.s[p.pos+1:p.pos+1+end])
+			p.pos += end + 2
+		case unicode.IsLetter(rune(c)):
+			// Either nested node or bare enumeration value (e.g. AXIS["Easting",EAST]).
+			if !p.nodeAhead() {
+				start := p.pos
+				for p.pos < len(p.s) && unicode.IsLetter(rune(p.s[p.pos])) {
+					p.pos++
+				}
+				node.values = append(node.values, p.s[start:p.pos])
+				continue
+			}
+			child, err := p.parseNode()
+			if err != nil {
+				return nil, err
+			}
+			node.children = append(node.children, child)
+		default:
+			start := p.pos
+			for p.pos < len(p.s) && p.s[p.pos] != ',' && p.s[p.pos] != closing && !unicode.IsSpace(rune(p.s[p.pos])) {
+				p.pos++
+			}
+			node.values = append(node.values, p.s[start:p.pos])
+		}
+	}
+}
+
+// ParseWKT parses CRS definition in WKT version 1 (also ESRI flavour used by .prj files).
+// Definitions with EPSG authority of a supported CRS are resolved by Lookup, other ones
+// are built from their datum and projection parameters.
+func ParseWKT(wkt string) (*CRS, error) {
+	p := &wktParser{s: strings.TrimSpace(wkt)}
+	root, err := p.parseNode()
+	if err != nil {
+		return nil, err
+	}
+
+	if authority := root.child("AUTHORITY"); authority != nil && len(authority.values) == 2 && strings.EqualFold(authority.values[0], "EPSG") {
+		if crs, err := Lookup("EPSG:" + authority.values[1]); err == nil {
+			return crs, nil
+		}
+	}
+
+	switch strings.ToUpper(root.keyword) {
+	case "GEOGCS":
+		datum, err := wktDatum(root)
+		if err != nil {
+			return nil, err
+		}
+		return &CRS{Code: root.name(), Datum: datum}, nil
+	case "PROJCS":
+		geogcs := root.child("GEOGCS")
+		if geogcs == nil {
+			return nil, fmt.Errorf("error parsing WKT: PROJCS without GEOGCS")
+		}
+		datum, err := wktDatum(geogcs)
+		if err != nil {
+			return nil, err
+		}
+		projection, err := wktProjection(root, datum.Ellipsoid)
+		if err != nil {
+			return nil, err
+		}
+		return &CRS{Code: root.name(), Datum: datum, Projection: projection}, nil
+	}
+	return nil, fmt.Errorf("error parsing WKT: unsupported CRS type %s", root.keyword)
+}
+
+// knownDatums maps (normalized) datum names to datums with known shifts to WGS84.
+var knownDatums = map[string]Datum{
+	"wgs1984":                                DatumWGS84,
+	"worldgeodeticsystem1984":                DatumWGS84,
+	"europeanterrestrialreferencesystem1989": DatumETRS89,
+	"etrs1989":                               DatumETRS89,
+	"etrf1989":                               DatumETRS89,
+	"northamerican1983":                      DatumNAD83,
+	"osgb1936":                               DatumOSGB36,
+	"deutscheshauptdreiecksnetz":             DatumDHDN,
+	"belge1972":                              DatumBelge1972,
+	"reseaunationalbelge1972":                DatumBelge1972,
+	"reseaugeodesiquefrancais1993":           DatumETRS89,
+}
+
+func normalizeName(name string) string {
+	name = strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(name, "D_"), "d_"))
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+func wktDatum(geogcs *wktNode) (Datum, error) {
+	datumNode := geogcs.child("DATUM")
+	if datumNode == nil {
+		return Datum{}, fmt.Errorf("error parsing WKT: GEOGCS without DATUM")
+	}
+	spheroid := datumNode.child("SPHEROID")
+	if spheroid == nil {
+		return Datum{}, fmt.Errorf("error parsing WKT: DATUM without SPHEROID")
+	}
+	a, err := spheroid.number(1)
+	if err != nil {
+		return Datum{}, err
+	}
+	invF, err := spheroid.number(2)
+	if err != nil {
+		return Datum{}, err
+	}
+	datum := Datum{Name: datumNode.name(), Ellipsoid: Ellipsoid{A: a, InvF: invF}}
+
+	if towgs84 := datumNode.child("TOWGS84"); towgs84 != nil {
+		for i := 0; i < 7 && i < len(towgs84.values); i++ {
+			if datum.ToWGS84[i], err = towgs84.number(i); err != nil {
+				return Datum{}, err
+			}
+		}
+		return datum, nil
+	}
+	if known, ok := knownDatums[normalizeName(datum.Name)]; ok {
+		datum.ToWGS84 = known.ToWGS84
+	}
+	return datum, nil
+}
+
+func wktProjection(projcs *wktNode, e Ellipsoid) (Projection, error) {
+	projectionNode := projcs.child("PROJECTION")
+	if projectionNode == nil {
+		return nil, fmt.Errorf("error parsing WKT: PROJCS without PROJECTION")
+	}
+
+	params := map[string]float64{}
+	for _, c := range projcs.children {
+		if strings.EqualFold(c.keyword, "PARAMETER") && len(c.values) == 2 {
+			value, err := c.number(1)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing WKT: invalid parameter %s", c.name())
+			}
+			params[normalizeName(c.name())] = value
+		}
+	}
+	param := func(fallback float64, names ...string) float64 {
+		for _, name := range names {
+			if value, ok := params[name]; ok {
+				return value
+			}
+		}
+		return fallback
+	}
+
+	// Linear unit applies to false easting and northing as well as to projected coordinates.
+	unit := 1.0
+	if unitNode := projcs.child("UNIT"); unitNode != nil {
+		if value, err := unitNode.number(1); err == nil && value > 0 {
+			unit = value
+		}
+	}
+
+	lat0 := param(0, "latitudeoforigin", "latitudeofcenter", "latitudeofnaturalorigin")
+	lon0 := param(0, "centralmeridian", "longitudeofcenter", "longitudeoforigin", "longitudeofnaturalorigin")
+	k0 := param(1, "scalefactor", "scalefactoratnaturalorigin")
+	fe := param(0, "falseeasting") * unit
+	fn := param(0, "falsenorthing") * unit
+	lat1 := param(lat0, "standardparallel1")
+	lat2 := param(lat1, "standardparallel2")
+
+	var projection Projection
+	switch normalizeName(projectionNode.name()) {
+	case "transversemercator", "gausskruger":
+		projection = NewTransverseMercator(e, lat0, lon0, k0, fe, fn)
+	case "lambertconformalconic2sp":
+		projection = NewLambertConformalConic2SP(e, lat0, lon0, lat1, lat2, fe, fn)
+	case "lambertconformalconic1sp":
+		projection = NewLambertConformalConic1SP(e, lat0, lon0, k0, fe, fn)
+	case "lambertconformalconic":
+		// ESRI uses single name for both variants.
+		if _, ok := params["standardparallel1"]; ok {
+			projection = NewLambertConformalConic2SP(e, lat0, lon0, lat1, lat2, fe, fn)
+		} else {
+			projection = NewLambertConformalConic1SP(e, lat0, lon0, k0, fe, fn)
+		}
+	case "polarstereographic", "stereographicnorthpole", "stereographicsouthpole":
+		latTS, hasLatTS := params["standardparallel1"]
+		if !hasLatTS {
+			latTS, hasLatTS = params["latitudeoftruescale"]
+		}
+		if hasLatTS && math.Abs(latTS) != 90 {
+			projection = NewPolarStereographicB(e, latTS, lon0, fe, fn)
+		} else {
+			south := lat0 < 0 || normalizeName(projectionNode.name()) == "stereographicsouthpole"
+			projection = NewPolarStereographicA(e, south, lon0, k0, fe, fn)
+		}
+	case "mercatorauxiliarysphere", "popularvisualisationpseudomercator":
+		projection = &Mercator{Ellipsoid: e, Spherical: true, CentralLon: lon0, ScaleFactor: 1, FalseEasting: fe, FalseNorthing: fn}
+	case "mercator", "mercator1sp":
+		projection = NewMercator(e, lon0, k0, fe, fn)
+	case "mercator2sp":
+		latTS := param(0, "standardparallel1")
+		sinLat := math.Sin(radians(latTS))
+		k := math.Cos(radians(latTS)) / math.Sqrt(1-e.Es()*sinLat*sinLat)
+		projection = NewMercator(e, lon0, k, fe, fn)
+	default:
+		return nil, fmt.Errorf("error parsing WKT: unsupported projection %s", projectionNode.name())
+	}
+
+	if unit != 1 {
+		return &scaled{Projection: projection, unit: unit}, nil
+	}
+	return projection, nil
+}
+
+// scaled converts projected coordinates given in other linear units (e.g. feet) to meters.
+type scaled struct {
+	Projection
+	unit float64
+}
+
+func (s *scaled) Forward(lon, lat float64) (x, y float64) {
+	x, y = s.Projection.Forward(lon, lat)
+	return x / s.unit, y / s.unit
+}
+
+func (s *scaled) Inverse(x, y float64) (lon, lat float64) {
+	return s.Projection.Inverse(x*s.unit, y*s.unit)
+}
@@ -0,0 +1,100 @@
+package proj_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/proj"
+)
+
+func TestParseWKT(t *testing.T) {
+	tests := map[string]struct {
+		WKT  string
+		Want string
+	}{
+		"ESRI projected CRS without authority": {
+			WKT: `PROJCS["ETRS89_Poland_CS92",GEOGCS["GCS_ETRS_1989",DATUM["D_ETRS_1989",SPHEROID["GRS_1980",6378137.0,298.257222101]],` +
+				`PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]],PROJECTION["Transverse_Mercator"],` +
+				`PARAMETER["False_Easting",500000.0],PARAMETER["False_Northing",-5300000.0],PARAMETER["Central_Meridian",19.0],` +
+				`PARAMETER["Scale_Factor",0.9993],PARAMETER["Latitude_Of_Origin",0.0],UNIT["Meter",1.0]]`,
+			Want: "EPSG:2180",
+		},
+		"OGC projected CRS with authority": {
+			WKT: `PROJCS["OSGB 1936 / British National Grid",GEOGCS["OSGB 1936",DATUM["OSGB_1936",` +
+				`SPHEROID["Airy 1830",6377563.396,299.3249646,AUTHORITY["EPSG","7001"]],AUTHORITY["EPSG","6277"]],` +
+				`PRIMEM["Greenwich",0],UNIT["degree",0.0174532925199433]],PROJECTION["Transverse_Mercator"],` +
+				`PARAMETER["latitude_of_origin",49],PARAMETER["central_meridian",-2],PARAMETER["scale_factor",0.9996012717],` +
+				`PARAMETER["false_easting",400000],PARAMETER["false_northing",-100000],UNIT["metre",1],` +
+				`AXIS["Easting",EAST],AXIS["Northing",NORTH],AUTHORITY["EPSG","27700"]]`,
+			Want: "EPSG:27700",
+		},
+		"ESRI Lambert without authority": {
+			WKT: `PROJCS["RGF_1993_Lambert_93",GEOGCS["GCS_RGF_1993",DATUM["D_RGF_1993",SPHEROID["GRS_1980",6378137.0,298.257222101]],` +
+				`PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]],PROJECTION["Lambert_Conformal_Conic"],` +
+				`PARAMETER["False_Easting",700000.0],PARAMETER["False_Northing",6600000.0],PARAMETER["Central_Meridian",3.0],` +
+				`PARAMETER["Standard_Parallel_1",49.0],PARAMETER["Standard_Parallel_2",44.0],PARAMETER["Latitude_Of_Origin",46.5],` +
+				`UNIT["Meter",1.0]]`,
+			Want: "EPSG:2154",
+		},
+		"geographic CRS": {
+			WKT:  `GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]]`,
+			Want: "EPSG:4326",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			crs, err := proj.ParseWKT(test.WKT)
+			assert.NoError(t, err)
+
+			want := proj.MustLookup(test.Want)
+			for _, p := range [][2]float64{{19.5, 52.1}, {-1.5, 51.0}, {2.35, 48.85}} {
+				x, y, err := want.FromWGS84(p[0], p[1])
+				assert.NoError(t, err)
+				lon, lat, err := crs.ToWGS84(x, y)
+				assert.NoError(t, err)
+				assert.InDelta(t, p[0], lon, 1e-7)
+				assert.InDelta(t, p[1], lat, 1e-7)
+			}
+		})
+	}
+}
+
+func TestParseWKT_Feet(t *testing.T) {
+	crs, err := proj.ParseWKT(`PROJCS["NAD83 / Texas South Central (ftUS)",GEOGCS["NAD83",DATUM["North_American_Datum_1983",` +
+		`SPHEROID["GRS 1980",6378137,298.257222101]],PRIMEM["Greenwich",0],UNIT["degree",0.0174532925199433]],` +
+		`PROJECTION["Lambert_Conformal_Conic_2SP"],PARAMETER["standard_parallel_1",30.28333333333333],` +
+		`PARAMETER["standard_parallel_2",28.38333333333333],PARAMETER["latitude_of_origin",27.83333333333333],` +
+		`PARAMETER["central_meridian",-99],PARAMETER["false_easting",1968500],PARAMETER["false_northing",13123333.333],` +
+		`UNIT["US survey foot",0.3048006096012192]]`)
+	assert.NoError(t, err)
+
+	x, y, err := crs.FromWGS84(-99, 27.83333333333333)
+	assert.NoError(t, err)
+	assert.InDelta(t, 1968500, x, 1e-3)
+	assert.InDelta(t, 13123333.333, y, 1e-3)
+}
+
+func TestParseWKT_Invalid(t *testing.T) {
+	tests := map[string]struct {
+		WKT     string
+		WantErr string
+	}{
+		"unsupported projection": {
+			WKT:     `PROJCS["x",GEOGCS["x",DATUM["x",SPHEROID["x",6378137,298.257223563]]],PROJECTION["Krovak"]]`,
+			WantErr: "error parsing WKT: unsupported projection Krovak",
+		},
+		"unterminated": {
+			WKT:     `GEOGCS["x",DATUM["x"`,
+			WantErr: "error parsing WKT: unexpected end of DATUM",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := proj.ParseWKT(test.WKT)
+			assert.EqualError(t, err, test.WantErr)
+		})
+	}
+}
@@ -0,0 +1,245 @@
+/*
+Package tilestore reads downloaded tiles from output directories and zip archives.
+*/
+
+package tilestore
+
+import (
+	"archive/zip"
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/dedupe"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+)
+
+// ErrNotFound is returned for tiles missing in the store.
+var ErrNotFound = errors.New("tile not found")
+
+// Extensions are extensions of tile files, in order they are looked up.
+var Extensions = []string{".png", ".jpg", ".jpeg", ".gif", ".webp"}
+
+// tilePath matches paths of tiles in archives, z/x/y.ext optionally with directory prefix
+// and @{scale}x suffix.
+var tilePath = regexp.MustCompile(`(?:^|/)(\d+)/(\d+)/(\d+)(@\d+x)?\.([A-Za-z]+)$`)
+
+// Reader reads tiles of a store.
+type Reader interface {
+	// ReadTile returns body of the tile, or ErrNotFound.
+	ReadTile(tile mercantile.TileID) ([]byte, error)
+	// Tiles returns tiles of given zoom level in the store, sorted by column and row.
+	Tiles(zoom int) ([]mercantile.TileID, error)
+	Close() error
+}
+
+type options struct {
+	suffix string
+}
+
+type Option func(o *options)
+
+// WithScale reads HiDPI tiles of given scale, named {y}@{scale}x.
+func WithScale(scale int) Option {
+	return func(o *options) {
+		o.suffix = ""
+		if scale > 1 {
+			o.suffix = fmt.Sprintf("@%dx", scale)
+		}
+	}
+}
+
+// Open opens store of tiles: output directory with {z}/{x}/{y}.{ext} tiles (or index.tsv of
+// deduplicated blobs) or zip archive with such tiles.
+func Open(name string, opts ...Option) (Reader, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if !strings.EqualFold(filepath.Ext(name), ".zip") {
+			return nil, fmt.Errorf("unsupported tile store: %s (use directory or zip archive)", name)
+		}
+		return openZip(name, o)
+	}
+
+	d := &dirReader{dir: name, suffix: o.suffix}
+	f, err := os.Open(filepath.Join(name, dedupe.IndexName))
+	if errors.Is(err, os.ErrNotExist) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if d.index, err = readIndex(f); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// dirReader reads tiles of output directory.
+type dirReader struct {
+	dir    string
+	suffix string
+	// index maps tile names to blobs (relative to the directory) of deduplicated tiles.
+	index map[string]string
+}
+
+func (d *dirReader) ReadTile(tile mercantile.TileID) ([]byte, error) {
+	for _, ext := range Extensions {
+		name := fmt.Sprintf("%d/%d/%d%s%s", tile.Z, tile.X, tile.Y, d.suffix, ext)
+		if blob, ok := d.index[name]; ok {
+			name = blob
+		}
+		body, err := os.ReadFile(filepath.Join(d.dir, filepath.FromSlash(name)))
+		if err == nil {
+			return body, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%w: %v", ErrNotFound, tile)
+}
+
+func (d *dirReader) Tiles(zoom int) ([]mercantile.TileID, error) {
+	seen := map[mercantile.TileID]bool{}
+	for name := range d.index {
+		if tile, ok := parseTilePath(name, d.suffix); ok && tile.Z == zoom {
+			seen[tile] = true
+		}
+	}
+	zoomDir := filepath.Join(d.dir, strconv.Itoa(zoom))
+	columns, err := os.ReadDir(zoomDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, column := range columns {
+		if !column.IsDir() {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(zoomDir, column.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			name := fmt.Sprintf("%d/%s/%s", zoom, column.Name(), f.Name())
+			if tile, ok := parseTilePath(name, d.suffix); ok {
+				seen[tile] = true
+			}
+		}
+	}
+	return sortedTiles(seen), nil
+}
+
+func (d *dirReader) Close() error {
+	return nil
+}
+
+// readIndex reads index of deduplicated blobs, later lines override earlier ones.
+func readIndex(r io.Reader) (map[string]string, error) {
+	index := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name, blob, ok := strings.Cut(scanner.Text(), "\t")
+		if ok {
+			index[name] = blob
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading index: %w", err)
+	}
+	return index, nil
+}
+
+// zipReader reads tiles of zip archive.
+type zipReader struct {
+	archive *zip.ReadCloser
+	files   map[mercantile.TileID]map[string]*zip.File
+}
+
+func openZip(name string, o options) (*zipReader, error) {
+	archive, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+	z := &zipReader{archive: archive, files: map[mercantile.TileID]map[string]*zip.File{}}
+	for _, f := range archive.File {
+		tile, ok := parseTilePath(f.Name, o.suffix)
+		if !ok {
+			continue
+		}
+		if z.files[tile] == nil {
+			z.files[tile] = map[string]*zip.File{}
+		}
+		z.files[tile][strings.ToLower(path.Ext(f.Name))] = f
+	}
+	return z, nil
+}
+
+func (z *zipReader) ReadTile(tile mercantile.TileID) ([]byte, error) {
+	for _, ext := range Extensions {
+		f, ok := z.files[tile][ext]
+		if !ok {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+	return nil, fmt.Errorf("%w: %v", ErrNotFound, tile)
+}
+
+func (z *zipReader) Tiles(zoom int) ([]mercantile.TileID, error) {
+	seen := map[mercantile.TileID]bool{}
+	for tile := range z.files {
+		if tile.Z == zoom {
+			seen[tile] = true
+		}
+	}
+	return sortedTiles(seen), nil
+}
+
+func (z *zipReader) Close() error {
+	return z.archive.Close()
+}
+
+// parseTilePath parses tile of path matching tilePath with given suffix and one of
+// Extensions.
+func parseTilePath(name, suffix string) (mercantile.TileID, bool) {
+	match := tilePath.FindStringSubmatch(name)
+	if match == nil || match[4] != suffix || !slices.Contains(Extensions, "."+strings.ToLower(match[5])) {
+		return mercantile.TileID{}, false
+	}
+	zoom, _ := strconv.Atoi(match[1])
+	x, _ := strconv.Atoi(match[2])
+	y, _ := strconv.Atoi(match[3])
+	return mercantile.TileID{X: x, Y: y, Z: zoom}, true
+}
+
+func sortedTiles(set map[mercantile.TileID]bool) []mercantile.TileID {
+	tiles := slices.Collect(maps.Keys(set))
+	slices.SortFunc(tiles, func(a, b mercantile.TileID) int {
+		return cmp.Or(cmp.Compare(a.X, b.X), cmp.Compare(a.Y, b.Y))
+	})
+	return tiles
+}
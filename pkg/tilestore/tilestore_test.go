@@ -0,0 +1,118 @@
+package tilestore_test
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/dedupe"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tilestore"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, body := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(name), os.ModePerm))
+		assert.NoError(t, os.WriteFile(name, []byte(body), 0o644))
+	}
+}
+
+func writeZip(t *testing.T, name string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(name)
+	assert.NoError(t, err)
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for name, body := range files {
+		entry, err := w.Create(name)
+		assert.NoError(t, err)
+		entry.Write([]byte(body))
+	}
+	assert.NoError(t, w.Close())
+}
+
+func TestOpen(t *testing.T) {
+	files := map[string]string{
+		"10/571/337.png":    "png",
+		"10/571/338.jpg":    "jpeg",
+		"10/571/338@2x.png": "hidpi",
+	}
+	dir := t.TempDir()
+	writeFiles(t, filepath.Join(dir, "tiles"), files)
+	archive := filepath.Join(dir, "tiles.zip")
+	zipped := map[string]string{}
+	for name, body := range files {
+		zipped["tiles/"+name] = body
+	}
+	writeZip(t, archive, zipped)
+
+	blobs := filepath.Join(dir, "blobs")
+	store, err := dedupe.NewStore(blobs, dedupe.Blob)
+	assert.NoError(t, err)
+	for name, body := range files {
+		assert.NoError(t, store.Write(name, []byte(body)))
+	}
+	assert.NoError(t, store.Close())
+
+	tests := map[string]struct {
+		name     string
+		options  []tilestore.Option
+		expected map[mercantile.TileID]string
+		tiles    []mercantile.TileID
+	}{
+		"directory": {
+			name:     filepath.Join(dir, "tiles"),
+			expected: map[mercantile.TileID]string{{X: 571, Y: 337, Z: 10}: "png", {X: 571, Y: 338, Z: 10}: "jpeg"},
+			tiles:    []mercantile.TileID{{X: 571, Y: 337, Z: 10}, {X: 571, Y: 338, Z: 10}},
+		},
+		"directory with scale": {
+			name:     filepath.Join(dir, "tiles"),
+			options:  []tilestore.Option{tilestore.WithScale(2)},
+			expected: map[mercantile.TileID]string{{X: 571, Y: 338, Z: 10}: "hidpi"},
+			tiles:    []mercantile.TileID{{X: 571, Y: 338, Z: 10}},
+		},
+		"zip archive": {
+			name:     archive,
+			expected: map[mercantile.TileID]string{{X: 571, Y: 337, Z: 10}: "png", {X: 571, Y: 338, Z: 10}: "jpeg"},
+			tiles:    []mercantile.TileID{{X: 571, Y: 337, Z: 10}, {X: 571, Y: 338, Z: 10}},
+		},
+		"deduplicated blobs": {
+			name:     blobs,
+			expected: map[mercantile.TileID]string{{X: 571, Y: 337, Z: 10}: "png", {X: 571, Y: 338, Z: 10}: "jpeg"},
+			tiles:    []mercantile.TileID{{X: 571, Y: 337, Z: 10}, {X: 571, Y: 338, Z: 10}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, err := tilestore.Open(tc.name, tc.options...)
+			assert.NoError(t, err)
+			defer r.Close()
+
+			for _, tile := range []mercantile.TileID{{X: 571, Y: 337, Z: 10}, {X: 571, Y: 338, Z: 10}, {X: 0, Y: 0, Z: 0}} {
+				body, err := r.ReadTile(tile)
+				if expected, ok := tc.expected[tile]; ok {
+					assert.NoError(t, err)
+					assert.Equal(t, expected, string(body))
+				} else {
+					assert.ErrorIs(t, err, tilestore.ErrNotFound)
+				}
+			}
+
+			tiles, err := r.Tiles(10)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.tiles, tiles)
+			tiles, err = r.Tiles(11)
+			assert.NoError(t, err)
+			assert.Empty(t, tiles)
+		})
+	}
+
+	_, err = tilestore.Open(filepath.Join(dir, "tiles", "10", "571", "337.png"))
+	assert.Error(t, err)
+}
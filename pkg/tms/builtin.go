@@ -0,0 +1,79 @@
+package tms
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+)
+
+const (
+	webMercatorOrigin = 20037508.3427892
+	maxBuiltinZoom    = 24
+)
+
+// WebMercatorQuad is the Web Mercator tile matrix set used by most web maps
+// (EPSG:3857, 256x256 tiles, 1x1 tile on zoom 0).
+var WebMercatorQuad = newWebMercatorQuad()
+
+// WorldCRS84Quad is the geographic tile matrix set (CRS84, 256x256 tiles, 2x1 tiles on zoom 0).
+var WorldCRS84Quad = newWorldCRS84Quad()
+
+func newWebMercatorQuad() *TileMatrixSet {
+	set := &TileMatrixSet{
+		ID:          "WebMercatorQuad",
+		Title:       "Google Maps Compatible for the World",
+		URI:         "http://www.opengis.net/def/tilematrixset/OGC/1.0/WebMercatorQuad",
+		CRSRef:      CRSRef{URI: "http://www.opengis.net/def/crs/EPSG/0/3857"},
+		OrderedAxes: []string{"E", "N"},
+		// Bounds are computed by the mercantile port, so tiles requested with the
+		// default grid do not change.
+		bounds: mercantile.XyBounds,
+	}
+	for z := 0; z <= maxBuiltinZoom; z++ {
+		n := int(math.Pow(2.0, float64(z)))
+		cellSize := 2 * webMercatorOrigin / 256 / float64(n)
+		set.TileMatrices = append(set.TileMatrices, TileMatrix{
+			ID:               fmt.Sprint(z),
+			ScaleDenominator: cellSize / 0.00028,
+			CellSize:         cellSize,
+			CornerOfOrigin:   TopLeft,
+			PointOfOrigin:    [2]float64{-webMercatorOrigin, webMercatorOrigin},
+			TileWidth:        256,
+			TileHeight:       256,
+			MatrixWidth:      n,
+			MatrixHeight:     n,
+		})
+	}
+
+	return set
+}
+
+func newWorldCRS84Quad() *TileMatrixSet {
+	set := &TileMatrixSet{
+		ID:          "WorldCRS84Quad",
+		Title:       "CRS84 for the World",
+		URI:         "http://www.opengis.net/def/tilematrixset/OGC/1.0/WorldCRS84Quad",
+		CRSRef:      CRSRef{URI: "http://www.opengis.net/def/crs/OGC/1.3/CRS84"},
+		OrderedAxes: []string{"Lon", "Lat"},
+	}
+	// Meters per degree on the equator of the WGS84 ellipsoid, used for scale denominators.
+	metersPerUnit := 2 * math.Pi * 6378137.0 / 360.0
+	for z := 0; z <= maxBuiltinZoom-1; z++ {
+		n := int(math.Pow(2.0, float64(z)))
+		cellSize := 180.0 / 256 / float64(n)
+		set.TileMatrices = append(set.TileMatrices, TileMatrix{
+			ID:               fmt.Sprint(z),
+			ScaleDenominator: cellSize * metersPerUnit / 0.00028,
+			CellSize:         cellSize,
+			CornerOfOrigin:   TopLeft,
+			PointOfOrigin:    [2]float64{-180, 90},
+			TileWidth:        256,
+			TileHeight:       256,
+			MatrixWidth:      2 * n,
+			MatrixHeight:     n,
+		})
+	}
+
+	return set
+}
@@ -0,0 +1,333 @@
+/*
+Package tms implements tile matrix sets as defined by the OGC Two Dimensional Tile Matrix Set
+and Tile Set Metadata standard (version 2.0, JSON encoding).
+*/
+
+package tms
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+)
+
+const (
+	TopLeft    string = "topLeft"
+	BottomLeft        = "bottomLeft"
+)
+
+// epsilon protects tile enumeration against floating point noise on tile edges.
+const epsilon = 1e-9
+
+// TileMatrixSet represents a set of tile matrices (one per zoom level) sharing the same CRS.
+type TileMatrixSet struct {
+	ID           string       `json:"id,omitempty"`
+	Title        string       `json:"title,omitempty"`
+	URI          string       `json:"uri,omitempty"`
+	CRSRef       CRSRef       `json:"crs"`
+	OrderedAxes  []string     `json:"orderedAxes,omitempty"`
+	TileMatrices []TileMatrix `json:"tileMatrices"`
+
+	// bounds overrides generic bounds computation (used by built-in sets to stay
+	// bit-for-bit compatible with the mercantile port).
+	bounds func(tile mercantile.TileID) mercantile.Bbox
+}
+
+// TileMatrix represents a single zoom level of a tile matrix set.
+type TileMatrix struct {
+	ID               string     `json:"id"`
+	ScaleDenominator float64    `json:"scaleDenominator"`
+	CellSize         float64    `json:"cellSize"`
+	CornerOfOrigin   string     `json:"cornerOfOrigin,omitempty"`
+	PointOfOrigin    [2]float64 `json:"pointOfOrigin"`
+	TileWidth        int        `json:"tileWidth"`
+	TileHeight       int        `json:"tileHeight"`
+	MatrixWidth      int        `json:"matrixWidth"`
+	MatrixHeight     int        `json:"matrixHeight"`
+}
+
+// CRSRef represents CRS reference which can be encoded either as a plain URI string
+// or as an object with "uri" member.
+type CRSRef struct {
+	URI string
+}
+
+func (c *CRSRef) UnmarshalJSON(data []byte) error {
+	var uri string
+	if err := json.Unmarshal(data, &uri); err == nil {
+		c.URI = uri
+		return nil
+	}
+
+	var ref struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(data, &ref); err != nil {
+		return err
+	}
+	if ref.URI == "" {
+		return errors.New("only URI CRS references are supported")
+	}
+	c.URI = ref.URI
+
+	return nil
+}
+
+func (c CRSRef) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.URI)
+}
+
+// Load reads tile matrix set JSON definition.
+func Load(r io.Reader) (*TileMatrixSet, error) {
+	var set TileMatrixSet
+	if err := json.NewDecoder(r).Decode(&set); err != nil {
+		return nil, fmt.Errorf("error decoding tile matrix set: %w", err)
+	}
+	if err := set.validate(); err != nil {
+		return nil, err
+	}
+
+	return &set, nil
+}
+
+// LoadFile reads tile matrix set JSON definition from a file.
+func LoadFile(name string) (*TileMatrixSet, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
+
+// Lookup returns built-in tile matrix set with given ID or, if there is no such set,
+// loads the definition from a file.
+func Lookup(name string) (*TileMatrixSet, error) {
+	for _, set := range []*TileMatrixSet{WebMercatorQuad, WorldCRS84Quad} {
+		if strings.EqualFold(set.ID, name) {
+			return set, nil
+		}
+	}
+
+	return LoadFile(name)
+}
+
+func (s *TileMatrixSet) validate() error {
+	if s.CRSRef.URI == "" {
+		return errors.New("tile matrix set: crs is required")
+	}
+	if len(s.TileMatrices) == 0 {
+		return errors.New("tile matrix set: at least one tile matrix is required")
+	}
+	for i, m := range s.TileMatrices {
+		if m.CellSize <= 0 || m.TileWidth <= 0 || m.TileHeight <= 0 || m.MatrixWidth <= 0 || m.MatrixHeight <= 0 {
+			return fmt.Errorf("tile matrix set: invalid tile matrix %q (index %d)", m.ID, i)
+		}
+		if m.CornerOfOrigin != "" && m.CornerOfOrigin != TopLeft && m.CornerOfOrigin != BottomLeft {
+			return fmt.Errorf("tile matrix set: unsupported corner of origin %q", m.CornerOfOrigin)
+		}
+	}
+
+	return nil
+}
+
+// CRS returns CRS identifier in the form expected by WMS servers, e.g. EPSG:2180 or CRS:84.
+func (s *TileMatrixSet) CRS() string {
+	uri := s.CRSRef.URI
+	switch {
+	case strings.HasPrefix(uri, "http://www.opengis.net/def/crs/"), strings.HasPrefix(uri, "https://www.opengis.net/def/crs/"):
+		parts := strings.Split(strings.TrimSuffix(uri, "/"), "/")
+		authority, code := parts[len(parts)-3], parts[len(parts)-1]
+		if authority == "OGC" {
+			return strings.Replace(code, "CRS", "CRS:", 1)
+		}
+		return authority + ":" + code
+	case strings.HasPrefix(uri, "urn:ogc:def:crs:"):
+		parts := strings.Split(uri, ":")
+		authority, code := parts[4], parts[len(parts)-1]
+		if authority == "OGC" {
+			return strings.Replace(code, "CRS", "CRS:", 1)
+		}
+		return authority + ":" + code
+	}
+
+	return uri
+}
+
+// NorthingFirst reports whether the first CRS axis is latitude/northing. In such case
+// points of origin are encoded as (northing, easting) and WMS 1.3.0 expects the same
+// order in BBOX parameter.
+func (s *TileMatrixSet) NorthingFirst() bool {
+	if len(s.OrderedAxes) == 0 {
+		return false
+	}
+	switch strings.ToLower(s.OrderedAxes[0]) {
+	case "lat", "latitude", "n", "northing":
+		return true
+	}
+
+	return false
+}
+
+// MaxZoom returns the highest zoom level (index of the last tile matrix).
+func (s *TileMatrixSet) MaxZoom() int {
+	return len(s.TileMatrices) - 1
+}
+
+// Matrix returns tile matrix for given zoom level. Zoom levels are indexes of tile
+// matrices in the set.
+func (s *TileMatrixSet) Matrix(zoom int) (TileMatrix, bool) {
+	if zoom < 0 || zoom >= len(s.TileMatrices) {
+		return TileMatrix{}, false
+	}
+
+	return s.TileMatrices[zoom], true
+}
+
+// origin returns point of origin in (easting, northing) order.
+func (s *TileMatrixSet) origin(m TileMatrix) (x, y float64) {
+	if s.NorthingFirst() {
+		return m.PointOfOrigin[1], m.PointOfOrigin[0]
+	}
+
+	return m.PointOfOrigin[0], m.PointOfOrigin[1]
+}
+
+// XyBounds retrieves bounding box of a tile in the native CRS, in (easting, northing) order.
+func (s *TileMatrixSet) XyBounds(tile mercantile.TileID) mercantile.Bbox {
+	if s.bounds != nil {
+		return s.bounds(tile)
+	}
+
+	m, ok := s.Matrix(tile.Z)
+	if !ok {
+		return mercantile.Bbox{}
+	}
+	ox, oy := s.origin(m)
+	spanX := m.CellSize * float64(m.TileWidth)
+	spanY := m.CellSize * float64(m.TileHeight)
+
+	left := ox + float64(tile.X)*spanX
+	right := ox + float64(tile.X+1)*spanX
+	if m.CornerOfOrigin == BottomLeft {
+		bottom := oy + float64(tile.Y)*spanY
+		return mercantile.Bbox{Left: left, Bottom: bottom, Right: right, Top: bottom + spanY}
+	}
+	top := oy - float64(tile.Y)*spanY
+
+	return mercantile.Bbox{Left: left, Bottom: top - spanY, Right: right, Top: top}
+}
+
+// Bounds retrieves extent of the whole tile matrix on given zoom level.
+func (s *TileMatrixSet) Bounds(zoom int) mercantile.Bbox {
+	m, ok := s.Matrix(zoom)
+	if !ok {
+		return mercantile.Bbox{}
+	}
+	ul := s.XyBounds(mercantile.TileID{X: 0, Y: 0, Z: zoom})
+	lr := s.XyBounds(mercantile.TileID{X: m.MatrixWidth - 1, Y: m.MatrixHeight - 1, Z: zoom})
+
+	return mercantile.Bbox{
+		Left:   math.Min(ul.Left, lr.Left),
+		Bottom: math.Min(ul.Bottom, lr.Bottom),
+		Right:  math.Max(ul.Right, lr.Right),
+		Top:    math.Max(ul.Top, lr.Top),
+	}
+}
+
+// Tile retrieves tile containing given point (easting, northing) on given zoom level.
+// Returned tile can be outside of the matrix if the point is outside of its extent.
+func (s *TileMatrixSet) Tile(x, y float64, zoom int) mercantile.TileID {
+	m, ok := s.Matrix(zoom)
+	if !ok {
+		return mercantile.TileID{Z: zoom}
+	}
+	ox, oy := s.origin(m)
+	spanX := m.CellSize * float64(m.TileWidth)
+	spanY := m.CellSize * float64(m.TileHeight)
+
+	col := math.Floor((x - ox) / spanX)
+	row := math.Floor((oy - y) / spanY)
+	if m.CornerOfOrigin == BottomLeft {
+		row = math.Floor((y - oy) / spanY)
+	}
+
+	return mercantile.TileID{X: int(col), Y: int(row), Z: zoom}
+}
+
+// TileRange retrieves range of tile columns and rows (inclusive) intersecting given
+// bounding box on given zoom level. Returns false if the bounding box is outside of the matrix.
+func (s *TileMatrixSet) TileRange(bbox mercantile.Bbox, zoom int) (minX, minY, maxX, maxY int, ok bool) {
+	m, ok := s.Matrix(zoom)
+	if !ok {
+		return 0, 0, 0, 0, false
+	}
+	ox, oy := s.origin(m)
+	spanX := m.CellSize * float64(m.TileWidth)
+	spanY := m.CellSize * float64(m.TileHeight)
+
+	colMin := math.Floor((bbox.Left-ox)/spanX + epsilon)
+	colMax := math.Ceil((bbox.Right-ox)/spanX-epsilon) - 1
+	rowMin := math.Floor((oy-bbox.Top)/spanY + epsilon)
+	rowMax := math.Ceil((oy-bbox.Bottom)/spanY-epsilon) - 1
+	if m.CornerOfOrigin == BottomLeft {
+		rowMin = math.Floor((bbox.Bottom-oy)/spanY + epsilon)
+		rowMax = math.Ceil((bbox.Top-oy)/spanY-epsilon) - 1
+	}
+
+	colMin = math.Max(colMin, 0)
+	rowMin = math.Max(rowMin, 0)
+	colMax = math.Min(colMax, float64(m.MatrixWidth-1))
+	rowMax = math.Min(rowMax, float64(m.MatrixHeight-1))
+	if colMin > colMax || rowMin > rowMax {
+		return 0, 0, 0, 0, false
+	}
+
+	return int(colMin), int(rowMin), int(colMax), int(rowMax), true
+}
+
+// Tiles retrieves tiles intersecting a bounding box given in the native CRS,
+// in (easting, northing) order.
+func (s *TileMatrixSet) Tiles(bbox mercantile.Bbox, zooms []int) []mercantile.TileID {
+	return slices.Collect(s.TilesSeq(bbox, zooms))
+}
+
+// TilesSeq is like Tiles but yields tiles one by one, without keeping them in memory.
+func (s *TileMatrixSet) TilesSeq(bbox mercantile.Bbox, zooms []int) iter.Seq[mercantile.TileID] {
+	return func(yield func(mercantile.TileID) bool) {
+		for _, z := range zooms {
+			minX, minY, maxX, maxY, ok := s.TileRange(bbox, z)
+			if !ok {
+				continue
+			}
+			for i := minX; i <= maxX; i++ {
+				for j := minY; j <= maxY; j++ {
+					if !yield(mercantile.TileID{X: i, Y: j, Z: z}) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// Count retrieves number of tiles intersecting a bounding box given in the native CRS,
+// without enumerating them.
+func (s *TileMatrixSet) Count(bbox mercantile.Bbox, zooms []int) int {
+	count := 0
+	for _, z := range zooms {
+		if minX, minY, maxX, maxY, ok := s.TileRange(bbox, z); ok {
+			count += (maxX - minX + 1) * (maxY - minY + 1)
+		}
+	}
+	return count
+}
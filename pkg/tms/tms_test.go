@@ -0,0 +1,118 @@
+package tms_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tms"
+)
+
+func TestLoadFile(t *testing.T) {
+	set, err := tms.LoadFile("testdata/puwg1992.json")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "PUWG1992", set.ID)
+	assert.Equal(t, "EPSG:2180", set.CRS())
+	assert.True(t, set.NorthingFirst())
+	assert.Equal(t, 1, set.MaxZoom())
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := map[string]struct {
+		Definition string
+		WantErr    string
+	}{
+		"missing crs": {
+			Definition: `{"tileMatrices": [{"cellSize": 1, "tileWidth": 1, "tileHeight": 1, "matrixWidth": 1, "matrixHeight": 1}]}`,
+			WantErr:    "tile matrix set: crs is required",
+		},
+		"missing tile matrices": {
+			Definition: `{"crs": "http://www.opengis.net/def/crs/EPSG/0/2180"}`,
+			WantErr:    "tile matrix set: at least one tile matrix is required",
+		},
+		"invalid tile matrix": {
+			Definition: `{"crs": {"uri": "http://www.opengis.net/def/crs/EPSG/0/2180"}, "tileMatrices": [{"id": "0"}]}`,
+			WantErr:    `tile matrix set: invalid tile matrix "0" (index 0)`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := tms.Load(strings.NewReader(test.Definition))
+			assert.EqualError(t, err, test.WantErr)
+		})
+	}
+}
+
+func TestTileMatrixSet_CRS(t *testing.T) {
+	tests := map[string]string{
+		"http://www.opengis.net/def/crs/EPSG/0/3857":   "EPSG:3857",
+		"http://www.opengis.net/def/crs/OGC/1.3/CRS84": "CRS:84",
+		"urn:ogc:def:crs:EPSG::2180":                   "EPSG:2180",
+		"EPSG:4326":                                    "EPSG:4326",
+	}
+
+	for uri, want := range tests {
+		t.Run(uri, func(t *testing.T) {
+			set := &tms.TileMatrixSet{CRSRef: tms.CRSRef{URI: uri}}
+			assert.Equal(t, want, set.CRS())
+		})
+	}
+}
+
+func TestTileMatrixSet_XyBounds(t *testing.T) {
+	set, err := tms.LoadFile("testdata/puwg1992.json")
+	assert.NoError(t, err)
+
+	span := 4233.3418 * 512
+	bbox := set.XyBounds(mercantile.TileID{X: 1, Y: 1, Z: 1})
+
+	assert.InDelta(t, 100000.0+span, bbox.Left, 1e-6)
+	assert.InDelta(t, 850000.0-2*span, bbox.Bottom, 1e-6)
+	assert.InDelta(t, 100000.0+2*span, bbox.Right, 1e-6)
+	assert.InDelta(t, 850000.0-span, bbox.Top, 1e-6)
+}
+
+func TestTileMatrixSet_Tiles(t *testing.T) {
+	set, err := tms.LoadFile("testdata/puwg1992.json")
+	assert.NoError(t, err)
+
+	tiles := set.Tiles(mercantile.Bbox{Left: 200000, Bottom: 500000, Right: 300000, Top: 600000}, []int{0, 1})
+	assert.Equal(t, []mercantile.TileID{{X: 0, Y: 0, Z: 0}, {X: 0, Y: 0, Z: 1}}, tiles)
+
+	tiles = set.Tiles(mercantile.Bbox{Left: 2000000, Bottom: 2000000, Right: 3000000, Top: 3000000}, []int{0, 1})
+	assert.Empty(t, tiles)
+}
+
+func TestTileMatrixSet_Count(t *testing.T) {
+	bbox := mercantile.Bbox{Left: 2300000, Bottom: 6800000, Right: 2400000, Top: 6900000}
+	zooms := []int{0, 5, 10, 12}
+
+	assert.Equal(t, len(tms.WebMercatorQuad.Tiles(bbox, zooms)), tms.WebMercatorQuad.Count(bbox, zooms))
+	assert.Equal(t, 0, tms.WebMercatorQuad.Count(mercantile.Bbox{Left: 3e7, Bottom: 3e7, Right: 4e7, Top: 4e7}, zooms))
+}
+
+func TestWebMercatorQuad(t *testing.T) {
+	tile := mercantile.TileID{X: 17, Y: 10, Z: 5}
+	assert.Equal(t, mercantile.XyBounds(tile), tms.WebMercatorQuad.XyBounds(tile))
+	assert.Equal(t, "EPSG:3857", tms.WebMercatorQuad.CRS())
+
+	left, bottom := mercantile.Xy(mercantile.LngLat{Lng: 14.0, Lat: 49.0})
+	right, top := mercantile.Xy(mercantile.LngLat{Lng: 24.2, Lat: 54.9})
+	bbox := mercantile.Bbox{Left: left, Bottom: bottom, Right: right, Top: top}
+	zooms := []int{4, 7, 10}
+
+	assert.ElementsMatch(t, mercantile.Tiles(14.0, 49.0, 24.2, 54.9, zooms), tms.WebMercatorQuad.Tiles(bbox, zooms))
+}
+
+func TestLookup(t *testing.T) {
+	set, err := tms.Lookup("worldcrs84quad")
+	assert.NoError(t, err)
+	assert.Equal(t, tms.WorldCRS84Quad, set)
+
+	bbox := set.XyBounds(mercantile.TileID{X: 1, Y: 0, Z: 0})
+	assert.Equal(t, mercantile.Bbox{Left: 0, Bottom: -90, Right: 180, Top: 90}, bbox)
+}
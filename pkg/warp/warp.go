@@ -0,0 +1,129 @@
+/*
+Package warp reprojects georeferenced images between coordinate reference systems.
+*/
+
+package warp
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/proj"
+)
+
+// Resampling represents method used to compute destination pixel values.
+type Resampling int
+
+const (
+	Nearest Resampling = iota
+	Bilinear
+)
+
+func (r Resampling) String() string {
+	switch r {
+	case Nearest:
+		return "nearest"
+	case Bilinear:
+		return "bilinear"
+	}
+	return fmt.Sprintf("Resampling(%d)", int(r))
+}
+
+// ParseResampling parses resampling method name.
+func ParseResampling(name string) (Resampling, error) {
+	switch strings.ToLower(name) {
+	case "nearest":
+		return Nearest, nil
+	case "bilinear":
+		return Bilinear, nil
+	}
+	return 0, fmt.Errorf("unsupported resampling method: %s", name)
+}
+
+// Source represents image with known extent (in easting, northing order) in its CRS.
+type Source struct {
+	Image  image.Image
+	Bounds mercantile.Bbox
+	CRS    *proj.CRS
+}
+
+// Warp renders image of given size covering bounds in the destination CRS. Pixels which
+// fall outside of the source image are transparent.
+func Warp(src Source, dstCRS *proj.CRS, dstBounds mercantile.Bbox, width, height int, resampling Resampling) *image.RGBA {
+	// Work on premultiplied pixels so transparent source pixels do not bleed colour.
+	srcImg := image.NewRGBA(image.Rect(0, 0, src.Image.Bounds().Dx(), src.Image.Bounds().Dy()))
+	draw.Draw(srcImg, srcImg.Bounds(), src.Image, src.Image.Bounds().Min, draw.Src)
+
+	srcResX := (src.Bounds.Right - src.Bounds.Left) / float64(srcImg.Bounds().Dx())
+	srcResY := (src.Bounds.Top - src.Bounds.Bottom) / float64(srcImg.Bounds().Dy())
+	dstResX := (dstBounds.Right - dstBounds.Left) / float64(width)
+	dstResY := (dstBounds.Top - dstBounds.Bottom) / float64(height)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for j := 0; j < height; j++ {
+		y := dstBounds.Top - (float64(j)+0.5)*dstResY
+		for i := 0; i < width; i++ {
+			x := dstBounds.Left + (float64(i)+0.5)*dstResX
+			sx, sy, err := proj.Transform(dstCRS, src.CRS, x, y)
+			if err != nil {
+				continue
+			}
+			// Source pixel coordinates relative to pixel centers.
+			u := (sx-src.Bounds.Left)/srcResX - 0.5
+			v := (src.Bounds.Top-sy)/srcResY - 0.5
+
+			switch resampling {
+			case Bilinear:
+				dst.SetRGBA(i, j, bilinear(srcImg, u, v))
+			default:
+				dst.SetRGBA(i, j, nearest(srcImg, u, v))
+			}
+		}
+	}
+
+	return dst
+}
+
+func nearest(img *image.RGBA, u, v float64) color.RGBA {
+	x, y := int(math.Round(u)), int(math.Round(v))
+	if !(image.Point{X: x, Y: y}.In(img.Bounds())) {
+		return color.RGBA{}
+	}
+	return img.RGBAAt(x, y)
+}
+
+// bilinear interpolates four neighbouring pixels. Neighbours outside of the image count
+// as transparent, which gives smooth alpha on image edges.
+func bilinear(img *image.RGBA, u, v float64) color.RGBA {
+	x0, y0 := int(math.Floor(u)), int(math.Floor(v))
+	fx, fy := u-float64(x0), v-float64(y0)
+
+	var r, g, b, a float64
+	for _, n := range []struct {
+		x, y int
+		w    float64
+	}{
+		{x0, y0, (1 - fx) * (1 - fy)},
+		{x0 + 1, y0, fx * (1 - fy)},
+		{x0, y0 + 1, (1 - fx) * fy},
+		{x0 + 1, y0 + 1, fx * fy},
+	} {
+		if n.w == 0 || !(image.Point{X: n.x, Y: n.y}.In(img.Bounds())) {
+			continue
+		}
+		c := img.RGBAAt(n.x, n.y)
+		r += n.w * float64(c.R)
+		g += n.w * float64(c.G)
+		b += n.w * float64(c.B)
+		a += n.w * float64(c.A)
+	}
+
+	return color.RGBA{
+		R: uint8(math.Round(r)), G: uint8(math.Round(g)), B: uint8(math.Round(b)), A: uint8(math.Round(a)),
+	}
+}
@@ -0,0 +1,65 @@
+package warp_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/proj"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/warp"
+)
+
+func TestParseResampling(t *testing.T) {
+	resampling, err := warp.ParseResampling("Bilinear")
+	assert.NoError(t, err)
+	assert.Equal(t, warp.Bilinear, resampling)
+
+	_, err = warp.ParseResampling("cubic")
+	assert.EqualError(t, err, "unsupported resampling method: cubic")
+}
+
+func TestWarp(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			img.SetRGBA(x, y, red)
+		}
+	}
+	mercator := proj.MustLookup("EPSG:3857")
+	src := warp.Source{
+		Image:  img,
+		Bounds: mercantile.Bbox{Left: 0, Bottom: 0, Right: 400, Top: 400},
+		CRS:    mercator,
+	}
+	// Destination covers the source image and the same area to the right of it.
+	dstBounds := mercantile.Bbox{Left: 0, Bottom: 0, Right: 800, Top: 400}
+
+	tests := map[string]struct {
+		Resampling warp.Resampling
+		Edge       color.RGBA
+	}{
+		"nearest": {
+			Resampling: warp.Nearest,
+			Edge:       color.RGBA{},
+		},
+		"bilinear": {
+			Resampling: warp.Bilinear,
+			Edge:       color.RGBA{R: 64, A: 64},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dst := warp.Warp(src, mercator, dstBounds, 16, 8, test.Resampling)
+
+			assert.Equal(t, image.Rect(0, 0, 16, 8), dst.Bounds())
+			assert.Equal(t, red, dst.RGBAAt(2, 2))
+			assert.Equal(t, test.Edge, dst.RGBAAt(8, 2))
+			assert.Equal(t, color.RGBA{}, dst.RGBAAt(12, 2))
+		})
+	}
+}
@@ -4,14 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"image"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/atomicfile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
 	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
 )
 
@@ -22,6 +26,10 @@ const (
 	V1_3_0        = "1.3.0"
 )
 
+// ErrNoData is returned for responses with HTTP status codes configured with WithNoDataStatus,
+// which the server uses for tiles without data.
+var ErrNoData = errors.New("no data")
+
 type Client struct {
 	httpClient       *http.Client
 	baseURL          string
@@ -32,6 +40,9 @@ type Client struct {
 	requestType      string
 	spatialRefSystem string
 	queryStrings     map[string]string
+	reprojection     *reprojection
+	rateLimiter      *rateLimiter
+	noDataStatus     []int
 }
 
 type ClientOption func(c *Client)
@@ -54,6 +65,33 @@ func WithQueryString(qs map[string]string) ClientOption {
 	}
 }
 
+// WithCRS sets CRS (crs/srs parameter) of requested tiles, EPSG:3857 by default.
+// It should match the CRS of the tile matrix set used to compute tile bounds.
+func WithCRS(crs string) ClientOption {
+	return func(c *Client) {
+		c.spatialRefSystem = crs
+	}
+}
+
+// WithRateLimit limits number of requests sent to the server per second. Zero or
+// negative value disables the limit.
+func WithRateLimit(requestsPerSecond float64) ClientOption {
+	return func(c *Client) {
+		c.rateLimiter = nil
+		if requestsPerSecond > 0 {
+			c.rateLimiter = newRateLimiter(requestsPerSecond)
+		}
+	}
+}
+
+// WithNoDataStatus sets HTTP status codes (e.g. 204 or 404) which mean that the server has
+// no data for the tile. Requests answered with them fail with ErrNoData.
+func WithNoDataStatus(codes ...int) ClientOption {
+	return func(c *Client) {
+		c.noDataStatus = codes
+	}
+}
+
 func WithBasicAuth(credentials string) ClientOption {
 	username, password := "", ""
 
@@ -117,6 +155,9 @@ func (c *Client) BaseURL() string {
 
 func (c *Client) GetTile(ctx context.Context, tileID mercantile.TileID, timeout int, params ...TileOption) (*Tile, error) {
 	tile := NewTile(tileID, params...)
+	if c.reprojection != nil {
+		return c.getReprojectedTile(ctx, tile, timeout, params...)
+	}
 
 	tileURL, err := tile.Url(c.BaseURL())
 	if err != nil {
@@ -128,10 +169,57 @@ func (c *Client) GetTile(ctx context.Context, tileID mercantile.TileID, timeout
 		return nil, err
 	}
 	tile.body = body
+	switch {
+	case tile.gutter > 0:
+		if tile.body, err = cropGutter(body, tile); err != nil {
+			return nil, err
+		}
+	case tile.outputFormat != "":
+		img, err := imaging.Decode(body)
+		if err != nil {
+			return nil, err
+		}
+		if tile.body, err = tile.encode(img); err != nil {
+			return nil, err
+		}
+	}
 
 	return tile, nil
 }
 
+// cropGutter crops the gutter of requested image to tile bounds and encodes the tile in
+// its output format.
+func cropGutter(body []byte, tile *Tile) ([]byte, error) {
+	img, err := imaging.Decode(body)
+	if err != nil {
+		return nil, err
+	}
+	if size := img.Bounds().Size(); size.X != tile.width+2*tile.gutter || size.Y != tile.height+2*tile.gutter {
+		return nil, fmt.Errorf(
+			"error cropping tile %v: unexpected image size %dx%d (requested %dx%d)",
+			tile.id, size.X, size.Y, tile.width+2*tile.gutter, tile.height+2*tile.gutter,
+		)
+	}
+	r := image.Rect(tile.gutter, tile.gutter, tile.gutter+tile.width, tile.gutter+tile.height)
+
+	return tile.encode(imaging.Crop(img, r.Add(img.Bounds().Min)))
+}
+
+// TileURL returns URL of GetMap request sent by GetTile for given tile, without sending it.
+// For reprojected tiles it is the request of the source image.
+func (c *Client) TileURL(tileID mercantile.TileID, params ...TileOption) (string, error) {
+	tile := NewTile(tileID, params...)
+	if c.reprojection != nil {
+		source, err := c.reprojectionSource(tile, params...)
+		if err != nil {
+			return "", err
+		}
+		return source.request.Url(c.BaseURL())
+	}
+
+	return tile.Url(c.BaseURL())
+}
+
 func (c *Client) SaveTile(tile *Tile) error {
 	outputPath := path.Join(tile.outputdir, tile.Path())
 
@@ -140,9 +228,9 @@ func (c *Client) SaveTile(tile *Tile) error {
 		return err
 	}
 
-	err = os.WriteFile(
-		path.Join(outputPath, tile.Name()), tile.Body(), os.ModePerm,
-	)
+	// Tile is replaced atomically, so tiles linked to it (deduplicated or empty ones) are
+	// not modified.
+	err = atomicfile.WriteFile(path.Join(outputPath, tile.Name()), tile.Body())
 	if err != nil {
 		return err
 	}
@@ -151,6 +239,12 @@ func (c *Client) SaveTile(tile *Tile) error {
 }
 
 func (c *Client) request(ctx context.Context, method string, url string, timeout int) ([]byte, error) {
+	if c.rateLimiter != nil {
+		if err := c.rateLimiter.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
 	defer cancel()
 
@@ -167,7 +261,11 @@ func (c *Client) request(ctx context.Context, method string, url string, timeout
 	if err != nil {
 		return nil, err
 	}
+	defer res.Body.Close()
 
+	if slices.Contains(c.noDataStatus, res.StatusCode) {
+		return nil, fmt.Errorf("%w (%v)", ErrNoData, res.StatusCode)
+	}
 	if res.StatusCode >= 400 || res.StatusCode < 200 {
 		return nil, fmt.Errorf("error making HTTP request (%v): %s", res.StatusCode, http.StatusText(res.StatusCode))
 	}
@@ -3,12 +3,24 @@ package wms_test
 import (
 	"context"
 	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
 	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/warp"
 	"github.com/lmikolajczak/wms-tiles-downloader/pkg/wms"
 )
 
@@ -17,6 +29,7 @@ func TestClient_BaseURL(t *testing.T) {
 		BaseURL      string
 		Version      string
 		QueryStrings map[string]string
+		CRS          string
 		Want         string
 		WantErr      error
 	}{
@@ -56,6 +69,12 @@ func TestClient_BaseURL(t *testing.T) {
 			Version: wms.V1_3_0,
 			Want:    "http://wms.service.com?crs=EPSG%3A3857&request=GetMap&service=WMS&version=1.3.0",
 		},
+		"Set CRS if provided": {
+			BaseURL: "https://wms.service.com",
+			Version: wms.V1_3_0,
+			CRS:     "EPSG:2180",
+			Want:    "https://wms.service.com?crs=EPSG%3A2180&request=GetMap&service=WMS&version=1.3.0",
+		},
 		"BaseURL is required": {
 			BaseURL: "",
 			Version: wms.V1_0_0,
@@ -65,11 +84,14 @@ func TestClient_BaseURL(t *testing.T) {
 
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
-			client, err := wms.NewClient(
-				test.BaseURL,
+			options := []wms.ClientOption{
 				wms.WithVersion(test.Version),
 				wms.WithQueryString(test.QueryStrings),
-			)
+			}
+			if test.CRS != "" {
+				options = append(options, wms.WithCRS(test.CRS))
+			}
+			client, err := wms.NewClient(test.BaseURL, options...)
 			if err != nil {
 				testErrorMessage(t, err, test.WantErr)
 			} else {
@@ -155,6 +177,310 @@ func TestClient_GetTile(t *testing.T) {
 	}
 }
 
+func TestClient_GetTileWithGutter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		width, _ := strconv.Atoi(r.URL.Query().Get("width"))
+		height, _ := strconv.Atoi(r.URL.Query().Get("height"))
+		// The gutter is red, the tile is green.
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for x := 0; x < width; x++ {
+			for y := 0; y < height; y++ {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+				if x >= 8 && y >= 8 && x < width-8 && y < height-8 {
+					img.Set(x, y, color.RGBA{G: 255, A: 255})
+				}
+			}
+		}
+		png.Encode(w, img)
+	}))
+	defer server.Close()
+
+	client, err := wms.NewClient(server.URL)
+	assert.NoError(t, err)
+
+	tile, err := client.GetTile(context.Background(), mercantile.TileID{X: 17, Y: 10, Z: 5}, 10000, wms.WithGutter(8))
+	assert.NoError(t, err)
+
+	img, err := imaging.Decode(tile.Body())
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 256, 256), img.Bounds())
+	for _, p := range []image.Point{{0, 0}, {255, 255}} {
+		assert.Equal(t, color.RGBA{G: 255, A: 255}, color.RGBAModel.Convert(img.At(p.X, p.Y)))
+	}
+}
+
+func TestClient_GetTileWithOutputFormat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		width, _ := strconv.Atoi(r.URL.Query().Get("width"))
+		height, _ := strconv.Atoi(r.URL.Query().Get("height"))
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for x := 0; x < width; x++ {
+			for y := 0; y < height; y++ {
+				img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), A: 255})
+			}
+		}
+		png.Encode(w, img)
+	}))
+	defer server.Close()
+
+	client, err := wms.NewClient(server.URL)
+	assert.NoError(t, err)
+
+	tests := map[string]struct {
+		options        []wms.TileOption
+		expectedPrefix string
+		paletted       bool
+	}{
+		"jpeg": {
+			options:        []wms.TileOption{wms.WithOutputFormat("image/jpeg", imaging.WithQuality(50))},
+			expectedPrefix: "\xff\xd8",
+		},
+		"jpeg with gutter": {
+			options:        []wms.TileOption{wms.WithOutputFormat("image/jpeg"), wms.WithGutter(8)},
+			expectedPrefix: "\xff\xd8",
+		},
+		"png8": {
+			options:        []wms.TileOption{wms.WithOutputFormat("image/png; mode=8bit")},
+			expectedPrefix: "\x89PNG",
+			paletted:       true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tile, err := client.GetTile(context.Background(), mercantile.TileID{X: 17, Y: 10, Z: 5}, 10000, tc.options...)
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(string(tile.Body()), tc.expectedPrefix))
+
+			img, err := imaging.Decode(tile.Body())
+			assert.NoError(t, err)
+			assert.Equal(t, image.Rect(0, 0, 256, 256), img.Bounds())
+			_, paletted := img.(*image.Paletted)
+			assert.Equal(t, tc.paletted, paletted)
+		})
+	}
+}
+
+func TestClient_GetTileWithMixedFormat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		img := image.NewNRGBA(image.Rect(0, 0, 512, 256))
+		for x := 0; x < 512; x++ {
+			for y := 0; y < 256; y++ {
+				// Imagery covers only the left tile of the metatile.
+				if x < 256 {
+					img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), A: 255})
+				}
+			}
+		}
+		png.Encode(w, img)
+	}))
+	defer server.Close()
+
+	client, err := wms.NewClient(server.URL)
+	assert.NoError(t, err)
+
+	metatile := wms.Metatile{X: 16, Y: 10, Z: 5, Cols: 2, Rows: 1, Tiles: []mercantile.TileID{{X: 16, Y: 10, Z: 5}, {X: 17, Y: 10, Z: 5}}}
+	tiles, err := client.GetMetatile(context.Background(), metatile, 10000, wms.WithOutputFormat(imaging.Mixed))
+	assert.NoError(t, err)
+	assert.Len(t, tiles, 2)
+
+	assert.Equal(t, "10.jpg", tiles[0].Name())
+	assert.Equal(t, imaging.JPEG, tiles[0].OutputFormat())
+	assert.True(t, strings.HasPrefix(string(tiles[0].Body()), "\xff\xd8"))
+	assert.Equal(t, "10.png", tiles[1].Name())
+	assert.Equal(t, imaging.PNG, tiles[1].OutputFormat())
+	assert.True(t, strings.HasPrefix(string(tiles[1].Body()), "\x89PNG"))
+}
+
+func TestClient_GetTileNoData(t *testing.T) {
+	tests := map[string]struct {
+		HTTPStatusCode int
+		NoDataStatus   []int
+		ExpectedError  error
+	}{
+		"no content configured as no data": {
+			HTTPStatusCode: http.StatusNoContent,
+			NoDataStatus:   []int{http.StatusNoContent, http.StatusNotFound},
+			ExpectedError:  wms.ErrNoData,
+		},
+		"not found configured as no data": {
+			HTTPStatusCode: http.StatusNotFound,
+			NoDataStatus:   []int{http.StatusNoContent, http.StatusNotFound},
+			ExpectedError:  wms.ErrNoData,
+		},
+		"not found not configured": {
+			HTTPStatusCode: http.StatusNotFound,
+			ExpectedError:  nil,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.HTTPStatusCode)
+			}))
+			defer server.Close()
+
+			client, err := wms.NewClient(server.URL, wms.WithNoDataStatus(test.NoDataStatus...))
+			assert.NoError(t, err)
+
+			_, err = client.GetTile(context.Background(), mercantile.TileID{X: 17, Y: 10, Z: 5}, 10000)
+			assert.Error(t, err)
+			if test.ExpectedError != nil {
+				assert.ErrorIs(t, err, test.ExpectedError)
+			} else {
+				assert.NotErrorIs(t, err, wms.ErrNoData)
+			}
+		})
+	}
+}
+
+// roundTripFunc serves HTTP requests with given function.
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// closeRecorder is response body recording whether it is closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestClient_GetTileClosesResponseBody(t *testing.T) {
+	tests := map[string]struct {
+		HTTPStatusCode int
+		ExpectedError  bool
+	}{
+		"ok":           {HTTPStatusCode: http.StatusOK},
+		"no data":      {HTTPStatusCode: http.StatusNoContent, ExpectedError: true},
+		"server error": {HTTPStatusCode: http.StatusInternalServerError, ExpectedError: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			body := &closeRecorder{Reader: strings.NewReader("")}
+			httpClient := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: test.HTTPStatusCode, Body: body, Request: req}, nil
+			})}
+			client, err := wms.NewClient(
+				"https://wms.server.url", wms.WithHTTPClient(httpClient), wms.WithNoDataStatus(http.StatusNoContent),
+			)
+			assert.NoError(t, err)
+
+			_, err = client.GetTile(context.Background(), mercantile.TileID{X: 17, Y: 10, Z: 5}, 10000)
+			assert.Equal(t, test.ExpectedError, err != nil)
+			assert.True(t, body.closed)
+		})
+	}
+}
+
+func TestClient_SaveTileReplacesLinkedTile(t *testing.T) {
+	dir := t.TempDir()
+	client, err := wms.NewClient("wms.service.com")
+	assert.NoError(t, err)
+
+	// Tile saved earlier is a hard link to a file shared with other tiles.
+	shared := filepath.Join(dir, "shared.png")
+	assert.NoError(t, os.WriteFile(shared, []byte("shared body"), 0o644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "5", "17"), os.ModePerm))
+	assert.NoError(t, os.Link(shared, filepath.Join(dir, "5", "17", "10.png")))
+
+	tile := wms.NewTile(mercantile.TileID{X: 17, Y: 10, Z: 5}, wms.WithOutputDir(dir))
+	assert.NoError(t, tile.SetImage(image.NewNRGBA(image.Rect(0, 0, 256, 256))))
+	assert.NoError(t, client.SaveTile(tile))
+
+	body, err := os.ReadFile(filepath.Join(dir, "5", "17", "10.png"))
+	assert.NoError(t, err)
+	assert.Equal(t, tile.Body(), body)
+	body, err = os.ReadFile(shared)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("shared body"), body)
+}
+
+func TestTile_IsEmpty(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+		if r.URL.Query().Get("layers") == "parcels" {
+			img.Set(100, 100, color.RGBA{R: 255, A: 255})
+		}
+		png.Encode(w, img)
+	}))
+	defer server.Close()
+
+	client, err := wms.NewClient(server.URL)
+	assert.NoError(t, err)
+
+	for layer, expected := range map[string]bool{"blank": true, "parcels": false} {
+		tile, err := client.GetTile(context.Background(), mercantile.TileID{X: 17, Y: 10, Z: 5}, 10000, wms.WithLayers(layer))
+		assert.NoError(t, err)
+
+		empty, err := tile.IsEmpty(0)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, empty, layer)
+	}
+}
+
+func TestClient_GetTileWithRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client, err := wms.NewClient(server.URL, wms.WithRateLimit(20))
+	assert.NoError(t, err)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		_, err := client.GetTile(context.Background(), mercantile.TileID{X: i, Y: 10, Z: 5}, 10000)
+		assert.NoError(t, err)
+	}
+	// The first request starts immediately, the next ones every 50ms.
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+}
+
+func TestClient_TileURL(t *testing.T) {
+	tests := map[string]struct {
+		Options  []wms.ClientOption
+		Contains []string
+	}{
+		"Web Mercator tile": {
+			Contains: []string{
+				"crs=EPSG%3A3857",
+				"bbox=-1252344.271424328%2C7514065.628545966%2C0.000000000%2C8766409.899970293",
+				"layers=layer",
+			},
+		},
+		"reprojected tile": {
+			Options: []wms.ClientOption{wms.WithCRS("EPSG:4326"), wms.WithReprojection(warp.Nearest, 0)},
+			// Latitude first, as defined by EPSG:4326, and square pixels.
+			Contains: []string{
+				"crs=EPSG%3A4326",
+				"bbox=55.776573019%2C-11.250000000%2C61.606396371%2C0.022509998",
+				"width=495",
+				"height=256",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			client, err := wms.NewClient("https://wms.service.com", test.Options...)
+			assert.NoError(t, err)
+
+			url, err := client.TileURL(mercantile.TileID{X: 15, Y: 9, Z: 5}, wms.WithLayers("layer"))
+			assert.NoError(t, err)
+			for _, want := range test.Contains {
+				assert.Contains(t, url, want)
+			}
+		})
+	}
+}
+
 func testErrorMessage(t *testing.T, err error, want error) {
 	t.Helper()
 	if err != nil && want == nil {
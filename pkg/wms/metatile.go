@@ -0,0 +1,249 @@
+package wms
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"io"
+	"iter"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tms"
+)
+
+// Metatile is a block of neighbouring tiles requested from the server as a single image.
+type Metatile struct {
+	// X, Y and Z identify the upper left tile of the block.
+	X, Y, Z    int
+	Cols, Rows int
+	// Tiles are tiles of the block which are sliced from the image.
+	Tiles []mercantile.TileID
+}
+
+// Metatiles groups tiles into metatiles of size x size tiles. Metatiles are aligned to the
+// grid (x and y of their upper left tiles are multiples of size), metatiles at edges of the
+// tile matrix are smaller. Metatile is yielded once all its tiles are given, or after the
+// last tile of its zoom level, so tiles have to be given zoom level after zoom level.
+func Metatiles(tileIDs iter.Seq[mercantile.TileID], size int, matrixSet *tms.TileMatrixSet) iter.Seq[Metatile] {
+	if matrixSet == nil {
+		matrixSet = tms.WebMercatorQuad
+	}
+	return func(yield func(Metatile) bool) {
+		pending := map[mercantile.TileID]*Metatile{}
+		flush := func() bool {
+			metatiles := make([]*Metatile, 0, len(pending))
+			for _, metatile := range pending {
+				metatiles = append(metatiles, metatile)
+			}
+			slices.SortFunc(metatiles, func(a, b *Metatile) int {
+				return cmp.Or(cmp.Compare(a.X, b.X), cmp.Compare(a.Y, b.Y))
+			})
+			clear(pending)
+			for _, metatile := range metatiles {
+				if !yield(*metatile) {
+					return false
+				}
+			}
+			return true
+		}
+
+		zoom := -1
+		for tile := range tileIDs {
+			if tile.Z != zoom {
+				if !flush() {
+					return
+				}
+				zoom = tile.Z
+			}
+			key := mercantile.TileID{X: tile.X / size * size, Y: tile.Y / size * size, Z: tile.Z}
+			metatile, ok := pending[key]
+			if !ok {
+				metatile = &Metatile{X: key.X, Y: key.Y, Z: key.Z, Cols: size, Rows: size}
+				if m, ok := matrixSet.Matrix(tile.Z); ok {
+					metatile.Cols = min(size, m.MatrixWidth-key.X)
+					metatile.Rows = min(size, m.MatrixHeight-key.Y)
+				}
+				pending[key] = metatile
+			}
+			if slices.Contains(metatile.Tiles, tile) {
+				continue
+			}
+			metatile.Tiles = append(metatile.Tiles, tile)
+			if len(metatile.Tiles) == metatile.Cols*metatile.Rows {
+				delete(pending, key)
+				if !yield(*metatile) {
+					return
+				}
+			}
+		}
+		flush()
+	}
+}
+
+// MetatileSize returns the largest size of metatiles (not greater than size) whose images
+// fit within maxWidth x maxHeight pixels. Zero max width or height means no limit.
+func MetatileSize(size, tileWidth, tileHeight, maxWidth, maxHeight int) int {
+	if maxWidth > 0 && tileWidth > 0 {
+		size = min(size, maxWidth/tileWidth)
+	}
+	if maxHeight > 0 && tileHeight > 0 {
+		size = min(size, maxHeight/tileHeight)
+	}
+	return max(size, 1)
+}
+
+// metatileRequest returns request of the whole metatile image.
+func metatileRequest(metatile Metatile, params ...TileOption) *Tile {
+	origin := NewTile(mercantile.TileID{X: metatile.X, Y: metatile.Y, Z: metatile.Z}, params...)
+	set := origin.TileMatrixSet()
+	ul := set.XyBounds(mercantile.TileID{X: metatile.X, Y: metatile.Y, Z: metatile.Z})
+	lr := set.XyBounds(mercantile.TileID{X: metatile.X + metatile.Cols - 1, Y: metatile.Y + metatile.Rows - 1, Z: metatile.Z})
+	bounds := mercantile.Bbox{
+		Left:   math.Min(ul.Left, lr.Left),
+		Bottom: math.Min(ul.Bottom, lr.Bottom),
+		Right:  math.Max(ul.Right, lr.Right),
+		Top:    math.Max(ul.Top, lr.Top),
+	}
+
+	return NewTile(origin.id, append(
+		params,
+		WithBounds(bounds),
+		WithWidth(metatile.Cols*origin.width),
+		WithHeight(metatile.Rows*origin.height),
+	)...)
+}
+
+// MetatileURL returns URL of GetMap request sent by GetMetatile for given metatile, without
+// sending it. For reprojected tiles it is the request of the source image.
+func (c *Client) MetatileURL(metatile Metatile, params ...TileOption) (string, error) {
+	request := metatileRequest(metatile, params...)
+	if c.reprojection != nil {
+		source, err := c.reprojectionSource(request, params...)
+		if err != nil {
+			return "", err
+		}
+		return source.request.Url(c.BaseURL())
+	}
+
+	return request.Url(c.BaseURL())
+}
+
+// GetMetatile requests image of the whole metatile with a single GetMap request and slices
+// it into its tiles, encoded in their output format.
+func (c *Client) GetMetatile(ctx context.Context, metatile Metatile, timeout int, params ...TileOption) ([]*Tile, error) {
+	request := metatileRequest(metatile, params...)
+
+	// Warped images have no gutter, it only widens the margin of source images.
+	var img image.Image
+	gutter := request.gutter
+	if c.reprojection != nil {
+		var err error
+		if img, err = c.getReprojectedImage(ctx, request, timeout, params...); err != nil {
+			return nil, err
+		}
+		gutter = 0
+	} else {
+		requestURL, err := request.Url(c.BaseURL())
+		if err != nil {
+			return nil, err
+		}
+		body, err := c.request(ctx, http.MethodGet, requestURL, timeout)
+		if err != nil {
+			return nil, err
+		}
+		if img, err = imaging.Decode(body); err != nil {
+			return nil, err
+		}
+	}
+	if size := img.Bounds().Size(); size.X != request.width+2*gutter || size.Y != request.height+2*gutter {
+		return nil, fmt.Errorf(
+			"error slicing metatile %v: unexpected image size %dx%d (requested %dx%d)",
+			request.id, size.X, size.Y, request.width+2*gutter, request.height+2*gutter,
+		)
+	}
+
+	bounds := request.Bounds()
+	tiles := make([]*Tile, 0, len(metatile.Tiles))
+	for _, tileID := range metatile.Tiles {
+		tile := NewTile(tileID, params...)
+		tileBounds := tile.Bounds()
+		x := int(math.Round((tileBounds.Left - bounds.Left) / (bounds.Right - bounds.Left) * float64(request.width)))
+		y := int(math.Round((bounds.Top - tileBounds.Top) / (bounds.Top - bounds.Bottom) * float64(request.height)))
+		r := image.Rect(x, y, x+tile.width, y+tile.height).Add(img.Bounds().Min).Add(image.Pt(gutter, gutter))
+
+		var err error
+		tile.body, err = tile.encode(imaging.Crop(img, r))
+		if err != nil {
+			return nil, err
+		}
+		tiles = append(tiles, tile)
+	}
+
+	return tiles, nil
+}
+
+// GetMaxSize reads maximum width and height of images served by GetMap requests from
+// capabilities of the server (MaxWidth and MaxHeight of WMS 1.3.0). Zero values mean that
+// the server does not declare the limit.
+func (c *Client) GetMaxSize(ctx context.Context, timeout int) (maxWidth, maxHeight int, err error) {
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return 0, 0, err
+	}
+	if u.Scheme == "" {
+		u.Scheme = "https"
+	}
+	params := u.Query()
+	params.Add("version", c.version)
+	params.Add("service", c.service)
+	params.Add("request", "GetCapabilities")
+	for name, param := range c.queryStrings {
+		params.Add(name, param)
+	}
+	u.RawQuery = params.Encode()
+
+	body, err := c.request(ctx, http.MethodGet, u.String(), timeout)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("error decoding capabilities: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || (start.Name.Local != "MaxWidth" && start.Name.Local != "MaxHeight") {
+			continue
+		}
+		var value string
+		if err := decoder.DecodeElement(&value, &start); err != nil {
+			return 0, 0, fmt.Errorf("error decoding capabilities: %w", err)
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return 0, 0, fmt.Errorf("error decoding capabilities: invalid %s: %q", start.Name.Local, value)
+		}
+		if start.Name.Local == "MaxWidth" {
+			maxWidth = size
+		} else {
+			maxHeight = size
+		}
+	}
+
+	return maxWidth, maxHeight, nil
+}
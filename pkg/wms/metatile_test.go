@@ -0,0 +1,174 @@
+package wms_test
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/wms"
+)
+
+func TestMetatiles(t *testing.T) {
+	tileIDs := []mercantile.TileID{
+		{X: 0, Y: 0, Z: 1}, {X: 1, Y: 1, Z: 1},
+		{X: 3, Y: 4, Z: 3}, {X: 2, Y: 5, Z: 3}, {X: 2, Y: 4, Z: 3}, {X: 3, Y: 5, Z: 3}, {X: 4, Y: 4, Z: 3},
+	}
+
+	metatiles := slices.Collect(wms.Metatiles(slices.Values(tileIDs), 4, nil))
+	assert.Equal(t, []wms.Metatile{
+		// Metatiles are clipped to the tile matrix.
+		{X: 0, Y: 0, Z: 1, Cols: 2, Rows: 2, Tiles: []mercantile.TileID{{X: 0, Y: 0, Z: 1}, {X: 1, Y: 1, Z: 1}}},
+		{X: 0, Y: 4, Z: 3, Cols: 4, Rows: 4, Tiles: []mercantile.TileID{
+			{X: 3, Y: 4, Z: 3}, {X: 2, Y: 5, Z: 3}, {X: 2, Y: 4, Z: 3}, {X: 3, Y: 5, Z: 3},
+		}},
+		{X: 4, Y: 4, Z: 3, Cols: 4, Rows: 4, Tiles: []mercantile.TileID{{X: 4, Y: 4, Z: 3}}},
+	}, metatiles)
+
+	// Complete metatiles are yielded as soon as all their tiles are given.
+	metatiles = slices.Collect(wms.Metatiles(slices.Values(tileIDs[2:6]), 2, nil))
+	assert.Equal(t, []wms.Metatile{
+		{X: 2, Y: 4, Z: 3, Cols: 2, Rows: 2, Tiles: tileIDs[2:6]},
+	}, metatiles)
+}
+
+func TestMetatileSize(t *testing.T) {
+	tests := map[string]struct {
+		Size, MaxWidth, MaxHeight, Want int
+	}{
+		"no limit":        {Size: 8, Want: 8},
+		"within limit":    {Size: 4, MaxWidth: 4096, MaxHeight: 4096, Want: 4},
+		"capped":          {Size: 8, MaxWidth: 2048, MaxHeight: 1500, Want: 5},
+		"at least 1 tile": {Size: 8, MaxWidth: 100, MaxHeight: 100, Want: 1},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.Want, wms.MetatileSize(test.Size, 256, 300, test.MaxWidth, test.MaxHeight))
+		})
+	}
+}
+
+func TestClient_GetMetatile(t *testing.T) {
+	var query map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		width, _ := strconv.Atoi(r.URL.Query().Get("width"))
+		height, _ := strconv.Atoi(r.URL.Query().Get("height"))
+		// Every tile of the image has its own color.
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for x := 0; x < width; x++ {
+			for y := 0; y < height; y++ {
+				img.Set(x, y, color.RGBA{R: uint8(x / 256), G: uint8(y / 256), A: 255})
+			}
+		}
+		png.Encode(w, img)
+	}))
+	defer server.Close()
+
+	client, err := wms.NewClient(server.URL)
+	assert.NoError(t, err)
+
+	metatile := wms.Metatile{X: 4, Y: 2, Z: 3, Cols: 2, Rows: 2, Tiles: []mercantile.TileID{{X: 5, Y: 3, Z: 3}, {X: 4, Y: 2, Z: 3}}}
+	tiles, err := client.GetMetatile(context.Background(), metatile, 10000, wms.WithFormat("image/png"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"512"}, query["width"])
+	assert.Equal(t, []string{"512"}, query["height"])
+	ul := mercantile.XyBounds(mercantile.TileID{X: 4, Y: 2, Z: 3})
+	lr := mercantile.XyBounds(mercantile.TileID{X: 5, Y: 3, Z: 3})
+	bbox := wms.NewTile(mercantile.TileID{}, wms.WithBounds(mercantile.Bbox{
+		Left: ul.Left, Bottom: lr.Bottom, Right: lr.Right, Top: ul.Top,
+	})).Bbox()
+	assert.Equal(t, []string{bbox}, query["bbox"])
+
+	assert.Len(t, tiles, 2)
+	for i, want := range []color.RGBA{{R: 1, G: 1, A: 255}, {A: 255}} {
+		assert.Equal(t, metatile.Tiles[i], mercantile.TileID{X: tiles[i].X(), Y: tiles[i].Y(), Z: tiles[i].Z()})
+		img, err := imaging.Decode(tiles[i].Body())
+		assert.NoError(t, err)
+		assert.Equal(t, image.Rect(0, 0, 256, 256), img.Bounds())
+		assert.Equal(t, want, color.RGBAModel.Convert(img.At(128, 128)))
+	}
+}
+
+func TestClient_GetMetatileWithGutter(t *testing.T) {
+	var query map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		width, _ := strconv.Atoi(r.URL.Query().Get("width"))
+		height, _ := strconv.Atoi(r.URL.Query().Get("height"))
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for x := 0; x < width; x++ {
+			for y := 0; y < height; y++ {
+				img.Set(x, y, color.RGBA{R: uint8((x - 16) / 256), G: uint8((y - 16) / 256), A: 255})
+			}
+		}
+		png.Encode(w, img)
+	}))
+	defer server.Close()
+
+	client, err := wms.NewClient(server.URL)
+	assert.NoError(t, err)
+
+	metatile := wms.Metatile{X: 4, Y: 2, Z: 3, Cols: 2, Rows: 2, Tiles: []mercantile.TileID{{X: 5, Y: 3, Z: 3}}}
+	tiles, err := client.GetMetatile(context.Background(), metatile, 10000, wms.WithGutter(16))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"544"}, query["width"])
+	img, err := imaging.Decode(tiles[0].Body())
+	assert.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 1, G: 1, A: 255}, color.RGBAModel.Convert(img.At(0, 0)))
+	assert.Equal(t, color.RGBA{R: 1, G: 1, A: 255}, color.RGBAModel.Convert(img.At(255, 255)))
+}
+
+func TestClient_GetMaxSize(t *testing.T) {
+	tests := map[string]struct {
+		Capabilities        string
+		MaxWidth, MaxHeight int
+		WantErr             string
+	}{
+		"limits": {
+			Capabilities: `<WMS_Capabilities version="1.3.0" xmlns="http://www.opengis.net/wms"><Service>` +
+				`<Name>WMS</Name><MaxWidth>4096</MaxWidth><MaxHeight> 2048 </MaxHeight></Service></WMS_Capabilities>`,
+			MaxWidth: 4096, MaxHeight: 2048,
+		},
+		"no limits": {
+			Capabilities: `<WMT_MS_Capabilities version="1.1.1"><Service><Name>OGC:WMS</Name></Service></WMT_MS_Capabilities>`,
+		},
+		"invalid limit": {
+			Capabilities: `<WMS_Capabilities><Service><MaxWidth>large</MaxWidth></Service></WMS_Capabilities>`,
+			WantErr:      `error decoding capabilities: invalid MaxWidth: "large"`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			client, server, teardown := wms.TestClientWithServer(t)
+			defer teardown()
+
+			server.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "GetCapabilities", r.URL.Query().Get("request"))
+				w.Write([]byte(test.Capabilities))
+			})
+
+			maxWidth, maxHeight, err := client.GetMaxSize(context.Background(), 10000)
+			if test.WantErr != "" {
+				assert.EqualError(t, err, test.WantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.MaxWidth, maxWidth)
+			assert.Equal(t, test.MaxHeight, maxHeight)
+		})
+	}
+}
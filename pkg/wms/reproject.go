@@ -0,0 +1,128 @@
+package wms
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"net/http"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/proj"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/warp"
+)
+
+const (
+	// reprojectionDensify is the number of points added along tile edges when tile
+	// bounds are transformed to the CRS of the server.
+	reprojectionDensify = 16
+	// maxReprojectionSize limits size of source images requested from the server.
+	maxReprojectionSize = 4096
+)
+
+type reprojection struct {
+	resampling warp.Resampling
+	margin     int
+}
+
+// WithReprojection makes the client request source images in its CRS (set with WithCRS)
+// and warp them locally into tiles of the tile matrix set (Web Mercator by default).
+// Each tile is covered by source image with a margin given in pixels, so resampling
+// near tile edges has enough data.
+func WithReprojection(resampling warp.Resampling, margin int) ClientOption {
+	return func(c *Client) {
+		c.reprojection = &reprojection{resampling: resampling, margin: margin}
+	}
+}
+
+// reprojectionSource describes source image requested from the server to reproject a tile.
+type reprojectionSource struct {
+	request *Tile
+	bounds  mercantile.Bbox
+	srcCRS  *proj.CRS
+	dstCRS  *proj.CRS
+}
+
+// reprojectionSource computes bounds and size of source image covering the tile in the CRS
+// of the server.
+func (c *Client) reprojectionSource(tile *Tile, params ...TileOption) (*reprojectionSource, error) {
+	srcCRS, err := proj.Lookup(c.spatialRefSystem)
+	if err != nil {
+		return nil, err
+	}
+	dstCRS, err := proj.Lookup(tile.TileMatrixSet().CRS())
+	if err != nil {
+		return nil, err
+	}
+
+	core, err := proj.TransformBounds(dstCRS, srcCRS, tile.Bounds(), reprojectionDensify)
+	if err != nil {
+		return nil, err
+	}
+	// Request square pixels at least as fine as the tile resolution.
+	res := math.Min((core.Right-core.Left)/float64(tile.width), (core.Top-core.Bottom)/float64(tile.height))
+	// Gutter of the tile widens the margin, as warped image is cropped to tile bounds anyway.
+	margin := float64(c.reprojection.margin+tile.gutter) * res
+	width := int(math.Ceil((core.Right - core.Left + 2*margin) / res))
+	height := int(math.Ceil((core.Top - core.Bottom + 2*margin) / res))
+	if width > maxReprojectionSize || height > maxReprojectionSize {
+		return nil, fmt.Errorf("error reprojecting tile %v: source image too large (%dx%d)", tile.id, width, height)
+	}
+	srcBounds := mercantile.Bbox{
+		Left:   core.Left - margin,
+		Bottom: core.Top + margin - float64(height)*res,
+		Right:  core.Left - margin + float64(width)*res,
+		Top:    core.Top + margin,
+	}
+
+	request := NewTile(tile.id, append(
+		params,
+		WithBounds(srcBounds),
+		WithNorthingFirst(srcCRS.NorthingFirst),
+		WithWidth(width),
+		WithHeight(height),
+		WithGutter(0),
+	)...)
+
+	return &reprojectionSource{request: request, bounds: srcBounds, srcCRS: srcCRS, dstCRS: dstCRS}, nil
+}
+
+func (c *Client) getReprojectedTile(ctx context.Context, tile *Tile, timeout int, params ...TileOption) (*Tile, error) {
+	warped, err := c.getReprojectedImage(ctx, tile, timeout, params...)
+	if err != nil {
+		return nil, err
+	}
+	tile.body, err = tile.encode(warped)
+	if err != nil {
+		return nil, err
+	}
+
+	return tile, nil
+}
+
+// getReprojectedImage requests source image covering the tile and warps it into tile bounds
+// and size.
+func (c *Client) getReprojectedImage(ctx context.Context, tile *Tile, timeout int, params ...TileOption) (image.Image, error) {
+	source, err := c.reprojectionSource(tile, params...)
+	if err != nil {
+		return nil, err
+	}
+	requestURL, err := source.request.Url(c.BaseURL())
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.request(ctx, http.MethodGet, requestURL, timeout)
+	if err != nil {
+		return nil, err
+	}
+	img, err := imaging.Decode(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return warp.Warp(
+		warp.Source{Image: img, Bounds: source.bounds, CRS: source.srcCRS},
+		source.dstCRS, tile.Bounds(), tile.width, tile.height, c.reprojection.resampling,
+	), nil
+}
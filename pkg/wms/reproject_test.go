@@ -0,0 +1,72 @@
+package wms_test
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/warp"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/wms"
+)
+
+func TestClient_GetTileWithReprojection(t *testing.T) {
+	var query map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		width, _ := strconv.Atoi(r.URL.Query().Get("width"))
+		height, _ := strconv.Atoi(r.URL.Query().Get("height"))
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for x := 0; x < width; x++ {
+			for y := 0; y < height; y++ {
+				img.Set(x, y, color.RGBA{G: 255, A: 255})
+			}
+		}
+		png.Encode(w, img)
+	}))
+	defer server.Close()
+
+	client, err := wms.NewClient(
+		server.URL, wms.WithCRS("EPSG:2180"), wms.WithReprojection(warp.Bilinear, 8),
+	)
+	assert.NoError(t, err)
+
+	// Tile covering part of Warsaw.
+	tileID := mercantile.Tile(21.0, 52.2, 12)
+	tile, err := client.GetTile(context.Background(), tileID, 10000)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"EPSG:2180"}, query["crs"])
+	// EPSG:2180 uses (northing, easting) axis order in WMS 1.3.0.
+	bbox := strings.Split(query["bbox"][0], ",")
+	minY, _ := strconv.ParseFloat(bbox[0], 64)
+	minX, _ := strconv.ParseFloat(bbox[1], 64)
+	assert.InDelta(t, 485000, minY, 10000)
+	assert.InDelta(t, 636000, minX, 10000)
+
+	img, err := imaging.Decode(tile.Body())
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 256, 256), img.Bounds())
+	_, g, _, a := img.At(128, 128).RGBA()
+	assert.Equal(t, uint32(0xffff), g)
+	assert.Equal(t, uint32(0xffff), a)
+}
+
+func TestClient_GetTileWithReprojectionUnsupportedCRS(t *testing.T) {
+	client, err := wms.NewClient(
+		"https://wms.service.com", wms.WithCRS("EPSG:5514"), wms.WithReprojection(warp.Nearest, 0),
+	)
+	assert.NoError(t, err)
+
+	_, err = client.GetTile(context.Background(), mercantile.TileID{X: 17, Y: 10, Z: 5}, 10000)
+	assert.EqualError(t, err, "unsupported CRS: EPSG:5514")
+}
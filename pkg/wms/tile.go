@@ -2,12 +2,33 @@ package wms
 
 import (
 	"fmt"
+	"image"
 	"net/url"
 	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
 
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
 	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tms"
+)
+
+// DPI modes select vendor parameters used to request images rendered for high density
+// displays: FORMAT_OPTIONS=dpi: of GeoServer, MAP_RESOLUTION of MapServer and DPI of QGIS Server.
+const (
+	DPIModeAll       string = "all"
+	DPIModeOff              = "off"
+	DPIModeGeoServer        = "geoserver"
+	DPIModeMapServer        = "mapserver"
+	DPIModeQGIS             = "qgis"
+)
+
+// Default resolutions (in DPI) of images rendered by the servers.
+const (
+	geoServerDPI = 90
+	mapServerDPI = 72
+	qgisDPI      = 96
 )
 
 type Tile struct {
@@ -21,6 +42,16 @@ type Tile struct {
 	width     int
 	height    int
 	outputdir string
+	matrixSet *tms.TileMatrixSet
+	bounds    *mercantile.Bbox
+	// northingFirst overrides axis order of the tile matrix set CRS.
+	northingFirst *bool
+	gutter        int
+	scale         int
+	dpiMode       string
+	// outputFormat is the format tiles are transcoded to, if other than requested one.
+	outputFormat  string
+	encodeOptions []imaging.EncodeOption
 }
 
 type TileOption func(t *Tile)
@@ -64,15 +95,91 @@ func WithOutputDir(dir string) TileOption {
 	}
 }
 
+// WithTileMatrixSet sets the grid used to compute tile bounds. Tile width and height
+// default to the tile size of the matrix, use WithWidth/WithHeight after this option
+// to override them.
+func WithTileMatrixSet(set *tms.TileMatrixSet) TileOption {
+	return func(t *Tile) {
+		t.matrixSet = set
+		if m, ok := set.Matrix(t.id.Z); ok {
+			t.width = m.TileWidth
+			t.height = m.TileHeight
+		}
+	}
+}
+
+// WithBounds overrides tile bounds computed from the tile matrix set. Bounds are given
+// in the CRS of requested image, in (easting, northing) order.
+func WithBounds(bbox mercantile.Bbox) TileOption {
+	return func(t *Tile) {
+		t.bounds = &bbox
+	}
+}
+
+// WithNorthingFirst overrides axis order of the CRS used in BBOX parameter of WMS 1.3.0
+// requests, which by default follows axis order of the tile matrix set.
+func WithNorthingFirst(northingFirst bool) TileOption {
+	return func(t *Tile) {
+		t.northingFirst = &northingFirst
+	}
+}
+
+// WithGutter expands requested image by given number of pixels on each side, so labels and
+// symbols near tile edges are rendered as on neighbouring tiles. The gutter is cropped
+// before the tile is saved.
+func WithGutter(pixels int) TileOption {
+	return func(t *Tile) {
+		t.gutter = max(pixels, 0)
+	}
+}
+
+// WithScale requests tiles for high density displays: tile width and height (set by
+// earlier options) are multiplied by scale and the server is asked to render images at
+// scaled DPI, so labels and symbols keep their size. Tiles are named {y}@{scale}x.
+func WithScale(scale int) TileOption {
+	return func(t *Tile) {
+		if scale <= 1 {
+			return
+		}
+		t.scale = scale
+		t.width *= scale
+		t.height *= scale
+		t.name = fmt.Sprintf("%v@%dx%s", t.id.Y, scale, path.Ext(t.name))
+	}
+}
+
+// WithOutputFormat transcodes downloaded tiles to given format (see imaging.Encode) with
+// given encoding options, e.g. to store PNG tiles served by the server as JPEG. Tile name
+// follows extension of the format. Re-encoded tiles have no metadata of served images.
+// In imaging.Mixed format opaque tiles are stored as JPEG and other ones as PNG, the
+// format (and the name) of tile is known once its body is encoded.
+func WithOutputFormat(format string, options ...imaging.EncodeOption) TileOption {
+	return func(t *Tile) {
+		t.outputFormat = format
+		t.encodeOptions = options
+		t.name = strings.TrimSuffix(t.name, path.Ext(t.name)) + imaging.Extension(format)
+	}
+}
+
+// WithDPIMode selects vendor parameters used to request scaled DPI (DPIModeAll by default).
+func WithDPIMode(mode string) TileOption {
+	return func(t *Tile) {
+		t.dpiMode = mode
+	}
+}
+
 func NewTile(id mercantile.TileID, options ...TileOption) *Tile {
 	t := &Tile{
-		id:     id,
-		name:   fmt.Sprintf("%v.png", id.Y),
-		path:   fmt.Sprintf("%v/%v", id.Z, id.X),
-		body:   make([]byte, 0),
-		format: "image/png",
-		width:  256,
-		height: 256,
+		id:        id,
+		name:      fmt.Sprintf("%v.png", id.Y),
+		path:      fmt.Sprintf("%v/%v", id.Z, id.X),
+		body:      make([]byte, 0),
+		format:    "image/png",
+		width:     256,
+		height:    256,
+		matrixSet: tms.WebMercatorQuad,
+		scale:     1,
+		dpiMode:   DPIModeAll,
 	}
 
 	for _, option := range options {
@@ -106,6 +213,15 @@ func (t *Tile) Format() string {
 	return t.format
 }
 
+// OutputFormat returns format of tile body: the format tiles are transcoded to, or the
+// requested one. For tiles in mixed format it is imaging.Mixed until the body is encoded.
+func (t *Tile) OutputFormat() string {
+	if t.outputFormat != "" {
+		return t.outputFormat
+	}
+	return t.format
+}
+
 func (t *Tile) Width() int {
 	return t.width
 }
@@ -118,6 +234,13 @@ func (t *Tile) OutputDir() string {
 	return t.outputdir
 }
 
+func (t *Tile) TileMatrixSet() *tms.TileMatrixSet {
+	if t.matrixSet == nil {
+		return tms.WebMercatorQuad
+	}
+	return t.matrixSet
+}
+
 func (t *Tile) X() int {
 	return t.id.X
 }
@@ -130,14 +253,85 @@ func (t *Tile) Z() int {
 	return t.id.Z
 }
 
+// IsEmpty decodes tile body and reports whether it is blank: fully transparent or of a
+// uniform colour, within given tolerance of colour channels (see imaging.IsEmpty).
+func (t *Tile) IsEmpty(tolerance uint8) (bool, error) {
+	img, err := imaging.Decode(t.body)
+	if err != nil {
+		return false, fmt.Errorf("error checking tile %v: %w", t.id, err)
+	}
+	return imaging.IsEmpty(img, tolerance), nil
+}
+
+// SetImage encodes image as the tile body in output format of the tile, e.g. for tiles
+// built locally instead of requested from the server.
+func (t *Tile) SetImage(img image.Image) error {
+	body, err := t.encode(img)
+	if err != nil {
+		return fmt.Errorf("error encoding tile %v: %w", t.id, err)
+	}
+	t.body = body
+	return nil
+}
+
+// encode encodes tile image in its output format. Format of tiles in mixed format is
+// chosen by transparency of the image, tile name follows it.
+func (t *Tile) encode(img image.Image) ([]byte, error) {
+	if t.outputFormat == imaging.Mixed {
+		t.outputFormat = imaging.MixedFormat(img)
+		t.name = strings.TrimSuffix(t.name, path.Ext(t.name)) + imaging.Extension(t.outputFormat)
+	}
+	return imaging.Encode(img, t.OutputFormat(), t.encodeOptions...)
+}
+
+// Bounds returns tile bounds in (easting, northing) order.
+func (t *Tile) Bounds() mercantile.Bbox {
+	if t.bounds != nil {
+		return *t.bounds
+	}
+	return t.TileMatrixSet().XyBounds(t.id)
+}
+
+// requestBounds returns bounds of requested image, which are tile bounds expanded by the gutter.
+func (t *Tile) requestBounds() mercantile.Bbox {
+	bbox := t.Bounds()
+	if t.gutter == 0 {
+		return bbox
+	}
+	dx := (bbox.Right - bbox.Left) / float64(t.width) * float64(t.gutter)
+	dy := (bbox.Top - bbox.Bottom) / float64(t.height) * float64(t.gutter)
+
+	return mercantile.Bbox{Left: bbox.Left - dx, Bottom: bbox.Bottom - dy, Right: bbox.Right + dx, Top: bbox.Top + dy}
+}
+
 func (t *Tile) Bbox() string {
-	bbox := mercantile.XyBounds(t.id)
+	bbox := t.Bounds()
 
 	return fmt.Sprintf(
 		"%.9f,%.9f,%.9f,%.9f", bbox.Left, bbox.Bottom, bbox.Right, bbox.Top,
 	)
 }
 
+// bboxParam returns BBOX parameter (of tile bounds expanded by the gutter) for given WMS
+// version. WMS 1.3.0 follows axis order of the CRS, so coordinates are swapped for CRSs with
+// northing as the first axis.
+func (t *Tile) bboxParam(version string) string {
+	northingFirst := t.TileMatrixSet().NorthingFirst()
+	if t.northingFirst != nil {
+		northingFirst = *t.northingFirst
+	}
+	bbox := t.requestBounds()
+	if version != V1_3_0 || !northingFirst {
+		return fmt.Sprintf(
+			"%.9f,%.9f,%.9f,%.9f", bbox.Left, bbox.Bottom, bbox.Right, bbox.Top,
+		)
+	}
+
+	return fmt.Sprintf(
+		"%.9f,%.9f,%.9f,%.9f", bbox.Bottom, bbox.Left, bbox.Top, bbox.Right,
+	)
+}
+
 func (t *Tile) Url(baseUrl string) (string, error) {
 	u, err := url.Parse(baseUrl)
 	if err != nil {
@@ -145,13 +339,38 @@ func (t *Tile) Url(baseUrl string) (string, error) {
 	}
 
 	params := u.Query()
-	params.Add("bbox", t.Bbox())
+	params.Add("bbox", t.bboxParam(params.Get("version")))
 	params.Add("layers", t.layers)
 	params.Add("styles", t.styles)
 	params.Add("format", t.format)
-	params.Add("width", strconv.Itoa(t.width))
-	params.Add("height", strconv.Itoa(t.height))
+	params.Add("width", strconv.Itoa(t.width+2*t.gutter))
+	params.Add("height", strconv.Itoa(t.height+2*t.gutter))
+	if t.scale > 1 {
+		t.addDPIParams(params)
+	}
 	u.RawQuery = params.Encode()
 
 	return u.String(), nil
 }
+
+// addDPIParams adds vendor parameters requesting images rendered at scaled DPI. DPI option
+// is appended to FORMAT_OPTIONS already present in the query.
+func (t *Tile) addDPIParams(params url.Values) {
+	if t.dpiMode == DPIModeAll || t.dpiMode == DPIModeGeoServer {
+		formatOptions := fmt.Sprintf("dpi:%d", geoServerDPI*t.scale)
+		key := "FORMAT_OPTIONS"
+		for name := range params {
+			if strings.EqualFold(name, key) {
+				key = name
+				formatOptions = params.Get(name) + ";" + formatOptions
+			}
+		}
+		params.Set(key, formatOptions)
+	}
+	if t.dpiMode == DPIModeAll || t.dpiMode == DPIModeMapServer {
+		params.Set("MAP_RESOLUTION", strconv.Itoa(mapServerDPI*t.scale))
+	}
+	if t.dpiMode == DPIModeAll || t.dpiMode == DPIModeQGIS {
+		params.Set("DPI", strconv.Itoa(qgisDPI*t.scale))
+	}
+}
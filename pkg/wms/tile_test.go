@@ -1,14 +1,20 @@
 package wms_test
 
 import (
+	"bytes"
 	"fmt"
+	"image"
+	"image/draw"
+	"net/url"
 	"os"
 	"path"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/imaging"
 	"github.com/lmikolajczak/wms-tiles-downloader/pkg/mercantile"
+	"github.com/lmikolajczak/wms-tiles-downloader/pkg/tms"
 	"github.com/lmikolajczak/wms-tiles-downloader/pkg/wms"
 )
 
@@ -125,6 +131,205 @@ func TestTile_url(t *testing.T) {
 	assert.Equal(t, expectedTileUrl, url)
 }
 
+func TestWithTileMatrixSet(t *testing.T) {
+	set := &tms.TileMatrixSet{
+		CRSRef:      tms.CRSRef{URI: "http://www.opengis.net/def/crs/EPSG/0/2180"},
+		OrderedAxes: []string{"N", "E"},
+		TileMatrices: []tms.TileMatrix{{
+			ID:            "0",
+			CellSize:      1000,
+			PointOfOrigin: [2]float64{850000, 100000},
+			TileWidth:     512,
+			TileHeight:    512,
+			MatrixWidth:   2,
+			MatrixHeight:  2,
+		}},
+	}
+	tile := wms.NewTile(mercantile.TileID{X: 1, Y: 0, Z: 0}, wms.WithTileMatrixSet(set))
+
+	assert.Equal(t, set, tile.TileMatrixSet())
+	assert.Equal(t, 512, tile.Width())
+	assert.Equal(t, 512, tile.Height())
+	assert.Equal(t, "612000.000000000,338000.000000000,1124000.000000000,850000.000000000", tile.Bbox())
+
+	url, _ := tile.Url("https://wms.service.com?crs=EPSG%3A2180&request=GetMap&service=WMS&version=1.3.0")
+	expectedTileUrl := "https://wms.service.com?bbox=338000.000000000%2C612000.000000000%2C850000.000000000%2C1124000.000000000&crs=EPSG%3A2180&format=image%2Fpng&height=512&layers=&request=GetMap&service=WMS&styles=&version=1.3.0&width=512"
+	assert.Equal(t, expectedTileUrl, url)
+
+	url, _ = tile.Url("https://wms.service.com?request=GetMap&service=WMS&srs=EPSG%3A2180&version=1.1.1")
+	expectedTileUrl = "https://wms.service.com?bbox=612000.000000000%2C338000.000000000%2C1124000.000000000%2C850000.000000000&format=image%2Fpng&height=512&layers=&request=GetMap&service=WMS&srs=EPSG%3A2180&styles=&version=1.1.1&width=512"
+	assert.Equal(t, expectedTileUrl, url)
+}
+
+func TestWithGutter(t *testing.T) {
+	set := &tms.TileMatrixSet{
+		CRSRef: tms.CRSRef{URI: "http://www.opengis.net/def/crs/EPSG/0/2180"},
+		TileMatrices: []tms.TileMatrix{{
+			ID:            "0",
+			CellSize:      1000,
+			PointOfOrigin: [2]float64{100000, 850000},
+			TileWidth:     512,
+			TileHeight:    512,
+			MatrixWidth:   2,
+			MatrixHeight:  2,
+		}},
+	}
+	tile := wms.NewTile(mercantile.TileID{X: 1, Y: 0, Z: 0}, wms.WithTileMatrixSet(set), wms.WithGutter(16))
+
+	// Tile bounds and size do not include the gutter.
+	assert.Equal(t, "612000.000000000,338000.000000000,1124000.000000000,850000.000000000", tile.Bbox())
+	assert.Equal(t, 512, tile.Width())
+
+	url, _ := tile.Url("https://wms.service.com?request=GetMap&service=WMS&srs=EPSG%3A2180&version=1.1.1")
+	expectedTileUrl := "https://wms.service.com?bbox=596000.000000000%2C322000.000000000%2C1140000.000000000%2C866000.000000000&format=image%2Fpng&height=544&layers=&request=GetMap&service=WMS&srs=EPSG%3A2180&styles=&version=1.1.1&width=544"
+	assert.Equal(t, expectedTileUrl, url)
+}
+
+func TestWithScale(t *testing.T) {
+	tile := wms.NewTile(mercantile.TileID{X: 17, Y: 10, Z: 5}, wms.WithWidth(256), wms.WithHeight(128), wms.WithScale(2))
+
+	assert.Equal(t, "10@2x.png", tile.Name())
+	assert.Equal(t, 512, tile.Width())
+	assert.Equal(t, 256, tile.Height())
+}
+
+func TestWithOutputFormat(t *testing.T) {
+	tests := map[string]struct {
+		options      []wms.TileOption
+		expectedName string
+	}{
+		"jpeg": {
+			options:      []wms.TileOption{wms.WithOutputFormat("image/jpeg")},
+			expectedName: "10.jpg",
+		},
+		"png8": {
+			options:      []wms.TileOption{wms.WithFormat("image/jpeg"), wms.WithOutputFormat("image/png; mode=8bit")},
+			expectedName: "10.png",
+		},
+		"scaled before": {
+			options:      []wms.TileOption{wms.WithScale(2), wms.WithOutputFormat("image/jpeg")},
+			expectedName: "10@2x.jpg",
+		},
+		"scaled after": {
+			options:      []wms.TileOption{wms.WithOutputFormat("image/jpeg"), wms.WithScale(2)},
+			expectedName: "10@2x.jpg",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tile := wms.NewTile(mercantile.TileID{X: 17, Y: 10, Z: 5}, tc.options...)
+			assert.Equal(t, tc.expectedName, tile.Name())
+		})
+	}
+
+	// Requested format does not change.
+	tile := wms.NewTile(mercantile.TileID{X: 17, Y: 10, Z: 5}, wms.WithOutputFormat("image/jpeg"))
+	assert.Equal(t, "image/png", tile.Format())
+	assert.Equal(t, "image/jpeg", tile.OutputFormat())
+}
+
+func TestTile_SetImage(t *testing.T) {
+	opaque := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	draw.Draw(opaque, opaque.Bounds(), image.White, image.Point{}, draw.Src)
+	transparent := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+
+	tests := map[string]struct {
+		options      []wms.TileOption
+		img          image.Image
+		expectedName string
+		expectedType string
+	}{
+		"png": {
+			img:          opaque,
+			expectedName: "10.png",
+			expectedType: "png",
+		},
+		"jpeg": {
+			options:      []wms.TileOption{wms.WithOutputFormat(imaging.JPEG)},
+			img:          opaque,
+			expectedName: "10.jpg",
+			expectedType: "jpeg",
+		},
+		"mixed opaque": {
+			options:      []wms.TileOption{wms.WithOutputFormat(imaging.Mixed)},
+			img:          opaque,
+			expectedName: "10.jpg",
+			expectedType: "jpeg",
+		},
+		"mixed transparent": {
+			options:      []wms.TileOption{wms.WithOutputFormat(imaging.Mixed)},
+			img:          transparent,
+			expectedName: "10.png",
+			expectedType: "png",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tile := wms.NewTile(mercantile.TileID{X: 17, Y: 10, Z: 5}, tc.options...)
+			assert.NoError(t, tile.SetImage(tc.img))
+			assert.Equal(t, tc.expectedName, tile.Name())
+			_, format, err := image.Decode(bytes.NewReader(tile.Body()))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedType, format)
+		})
+	}
+}
+
+func TestWithDPIMode(t *testing.T) {
+	tests := map[string]struct {
+		baseUrl        string
+		mode           string
+		expectedParams map[string]string
+	}{
+		"all": {
+			baseUrl: "https://wms.service.com?request=GetMap",
+			mode:    wms.DPIModeAll,
+			expectedParams: map[string]string{
+				"FORMAT_OPTIONS": "dpi:180", "MAP_RESOLUTION": "144", "DPI": "192",
+			},
+		},
+		"geoserver with format options": {
+			baseUrl: "https://wms.service.com?request=GetMap&format_options=antialias%3Atext",
+			mode:    wms.DPIModeGeoServer,
+			expectedParams: map[string]string{
+				"format_options": "antialias:text;dpi:180", "FORMAT_OPTIONS": "", "MAP_RESOLUTION": "", "DPI": "",
+			},
+		},
+		"mapserver": {
+			baseUrl: "https://wms.service.com?request=GetMap",
+			mode:    wms.DPIModeMapServer,
+			expectedParams: map[string]string{
+				"FORMAT_OPTIONS": "", "MAP_RESOLUTION": "144", "DPI": "",
+			},
+		},
+		"off": {
+			baseUrl: "https://wms.service.com?request=GetMap",
+			mode:    wms.DPIModeOff,
+			expectedParams: map[string]string{
+				"FORMAT_OPTIONS": "", "MAP_RESOLUTION": "", "DPI": "",
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tile := wms.NewTile(mercantile.TileID{X: 17, Y: 10, Z: 5}, wms.WithScale(2), wms.WithDPIMode(tc.mode))
+
+			tileUrl, err := tile.Url(tc.baseUrl)
+			assert.NoError(t, err)
+			u, err := url.Parse(tileUrl)
+			assert.NoError(t, err)
+			params := u.Query()
+			assert.Equal(t, "512", params.Get("width"))
+			for param, expected := range tc.expectedParams {
+				assert.Equal(t, expected, params.Get(param), param)
+			}
+		})
+	}
+}
+
 func TestNewTile(t *testing.T) {
 	expectedX, expectedY, expectedZ := 17, 10, 5
 	expectedName := fmt.Sprintf("%v.png", expectedY)